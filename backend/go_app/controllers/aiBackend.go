@@ -0,0 +1,31 @@
+// go_app/controllers/aiBackend.go
+
+package controllers
+
+import (
+	"chatbot/utils/aibackend"
+	"errors"
+	"sync"
+)
+
+var (
+	aiBackend      *aibackend.Client
+	aiBackendMutex sync.RWMutex
+)
+
+// SetAIBackend configura el cliente del servidor de IA que usa el webhook para crear hilos y generar respuestas.
+func SetAIBackend(client *aibackend.Client) {
+	aiBackendMutex.Lock()
+	defer aiBackendMutex.Unlock()
+	aiBackend = client
+}
+
+// getAIBackend devuelve el cliente configurado con SetAIBackend.
+func getAIBackend() (*aibackend.Client, error) {
+	aiBackendMutex.RLock()
+	defer aiBackendMutex.RUnlock()
+	if aiBackend == nil {
+		return nil, errors.New("cliente del servidor de IA no configurado")
+	}
+	return aiBackend, nil
+}
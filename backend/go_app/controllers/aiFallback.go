@@ -0,0 +1,445 @@
+// go_app/controllers/aiFallback.go
+
+package controllers
+
+import (
+	"chatbot/initializers"
+	"chatbot/logger"
+	"chatbot/models"
+	"chatbot/utils/aibackend"
+	"chatbot/utils/cache"
+	db "chatbot/utils/db"
+	"chatbot/utils/outbound"
+	"chatbot/utils/session"
+	"chatbot/utils/whatsapp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "chatbot/utils/proto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// defaultFallbackMessage es la respuesta de contingencia cuando no hay una configurada en Postgres.
+const defaultFallbackMessage = "En este momento no podemos responder tu consulta. Te escribiremos en cuanto sea posible. Mientras tanto, cuéntanos qué carrera te interesa:"
+
+// aiReplayKey es la lista de Redis con los turnos que se responderán cuando el servidor de IA se recupere.
+const aiReplayKey = "ia:reintentos"
+
+// aiReplayProcessingKey es la lista de Redis con los turnos que se están respondiendo, y
+// aiReplayLeasesKey el hash con el vencimiento de la reserva de cada uno. Un turno sale de ambos solo al
+// responderse o descartarse; si la instancia se cae antes, vuelve a la lista de reintentos al vencer.
+const (
+	aiReplayProcessingKey = "ia:reintentos:procesando"
+	aiReplayLeasesKey     = "ia:reintentos:reservas"
+)
+
+// aiReplayBatch es el número de turnos que se sacan de la lista en cada revisión.
+const aiReplayBatch = 20
+
+// maxReplayAttempts es el número de veces que se reintenta un turno que falla por un error distinto a
+// la falta de disponibilidad del servidor de IA antes de descartarlo.
+const maxReplayAttempts = 5
+
+// aiReplayLease es el tiempo durante el cual una instancia se reserva los turnos que está respondiendo.
+var aiReplayLease = 10 * time.Minute
+
+// claimReplayScript mueve hasta ARGV[1] turnos de la lista de reintentos a la de procesamiento y los
+// reserva hasta ARGV[2].
+var claimReplayScript = redis.NewScript(`
+local payloads = {}
+for i = 1, tonumber(ARGV[1]) do
+	local payload = redis.call('LMOVE', KEYS[1], KEYS[2], 'LEFT', 'RIGHT')
+	if not payload then
+		break
+	end
+	redis.call('HSET', KEYS[3], payload, ARGV[2])
+	payloads[#payloads + 1] = payload
+end
+return payloads
+`)
+
+// recoverReplayScript devuelve al inicio de la lista de reintentos, en su orden, los turnos en
+// procesamiento cuya reserva venció antes de ARGV[1].
+var recoverReplayScript = redis.NewScript(`
+local payloads = redis.call('LRANGE', KEYS[2], 0, -1)
+local recovered = 0
+for i = #payloads, 1, -1 do
+	local payload = payloads[i]
+	local deadline = tonumber(redis.call('HGET', KEYS[3], payload))
+	if not deadline or deadline < tonumber(ARGV[1]) then
+		redis.call('LREM', KEYS[2], 1, payload)
+		redis.call('HDEL', KEYS[3], payload)
+		redis.call('LPUSH', KEYS[1], payload)
+		recovered = recovered + 1
+	end
+end
+return recovered
+`)
+
+// replayEntry es un turno guardado para responderse cuando el servidor de IA se recupere.
+type replayEntry struct {
+	Phone     string           `json:"phone"`
+	Name      string           `json:"name"`
+	MessageID string           `json:"message_id"`
+	Text      string           `json:"text"`
+	Selection *replaySelection `json:"selection,omitempty"`
+	QueuedAt  time.Time        `json:"queued_at"`
+	// Attempts es el número de reintentos fallidos del turno.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// replaySelection es la opción elegida en un turno guardado.
+type replaySelection struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Question string `json:"question"`
+}
+
+// replyWithFallback responde el turno con la respuesta de contingencia y lo guarda para responderlo
+// cuando el servidor de IA se recupere. Los turnos que ya se estaban reintentando solo se vuelven a guardar.
+func replyWithFallback(redisConn *redis.Client, turn *conversationTurn, cause error) error {
+	logger.Log.Warnf("Servidor de IA no disponible para %s, se responde con la contingencia: %v", turn.Phone, cause)
+
+	if err := enqueueReplay(redisConn, turn); err != nil {
+		logger.Log.Errorf("Error al guardar el turno de %s para reintentarlo: %v", turn.Phone, err)
+	}
+	if turn.Replay {
+		return nil
+	}
+
+	message, question, options := buildFallbackMessage(turn.Phone)
+	if err := recordReply(turn.Phone, turn.Name, question); err != nil {
+		logger.Log.Errorf("Error al registrar la contingencia en la sesión de %s: %v", turn.Phone, err)
+	}
+
+	_, err := sendWhatsAppMessage(redisConn, message)
+	if errors.Is(err, errWindowClosed) {
+		logger.Log.Warnf("Respuesta de contingencia a %s no enviada: %v", turn.Phone, err)
+		return nil
+	}
+	if err != nil && !errors.Is(err, outbound.ErrDeferred) {
+		return fmt.Errorf("fallo al enviar la respuesta de contingencia: %w", err)
+	}
+
+	if len(options) > 0 {
+		if err := savePendingOptions(turn.Phone, question, optionsFormat(message), options); err != nil {
+			logger.Log.Errorf("Error al guardar las opciones enviadas a %s: %v", turn.Phone, err)
+		}
+	}
+	return nil
+}
+
+// buildFallbackMessage arma la respuesta de contingencia configurada en Postgres, con el menú de
+// carreras del catálogo de intereses si corresponde.
+func buildFallbackMessage(phone string) (*whatsapp.OutboundMessage, string, []session.Option) {
+	text, includeMenu := defaultFallbackMessage, true
+	respuesta, err := db.FindActiveFallback(initializers.DB)
+	switch {
+	case err == nil:
+		text, includeMenu = respuesta.Mensaje, respuesta.IncluirMenu
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		logger.Log.Errorf("Error al obtener la respuesta de contingencia, se usa la predeterminada: %v", err)
+	}
+
+	if !includeMenu {
+		return whatsapp.NewTextMessage(phone, text), text, nil
+	}
+
+	categories := catalogCategories(cache.ObtenerInteresCache())
+	choices := make([]whatsapp.Option, len(categories))
+	options := make([]session.Option, len(categories))
+	for i, category := range categories {
+		choices[i] = whatsapp.Option{ID: fmt.Sprintf("categoria_%d", i+1), Title: category}
+		options[i] = session.Option{ID: choices[i].ID, Title: category}
+	}
+	return whatsapp.NewOptionsMessage(phone, text, choices), text, options
+}
+
+// catalogCategories extrae las carreras de las descripciones del catálogo de intereses, por ejemplo
+// "Medicina Humana" de "Costos de la Carrera de Medicina Humana", sin repetirlas.
+func catalogCategories(intereses []models.CatalogoInteres) []string {
+	var categories []string
+	seen := make(map[string]bool)
+	for _, interes := range intereses {
+		category := interes.Descripcion
+		if index := strings.Index(category, "Carrera de "); index >= 0 {
+			category = category[index+len("Carrera de "):]
+		} else if index := strings.Index(category, " de "); index >= 0 {
+			category = category[index+len(" de "):]
+		}
+		category = strings.TrimSpace(category)
+		if category == "" || seen[category] {
+			continue
+		}
+		seen[category] = true
+		categories = append(categories, category)
+	}
+	return categories
+}
+
+// enqueueReplay guarda el turno en la lista de reintentos. Un turno que se estaba reintentando conserva
+// sus reintentos fallidos.
+func enqueueReplay(redisConn *redis.Client, turn *conversationTurn) error {
+	entry := replayEntry{
+		Phone:     turn.Phone,
+		Name:      turn.Name,
+		MessageID: turn.LastMessageID(),
+		Text:      turn.Text(),
+		QueuedAt:  turn.queuedAt,
+		Attempts:  turn.replayAttempts,
+	}
+	if entry.QueuedAt.IsZero() {
+		entry.QueuedAt = time.Now()
+	}
+	if selection := turn.Selection(); selection != nil {
+		entry.Selection = &replaySelection{ID: selection.Id, Title: selection.Title, Question: selection.Question}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return redisConn.RPush(ctx, aiReplayKey, data).Err()
+}
+
+// StartAIReplay lanza el proceso que responde los turnos guardados cuando el servidor de IA vuelve a
+// estar disponible. Se detiene cuando se cancela ctx.
+func StartAIReplay(ctx context.Context, rdb *redis.Client) {
+	interval := initializers.GetEnvDuration("AI_REPLAY_INTERVAL", 15*time.Second)
+	aiReplayLease = initializers.GetEnvDuration("AI_REPLAY_LEASE", aiReplayLease)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				replayPendingTurns(ctx, rdb)
+			}
+		}
+	}()
+	logger.Log.Infof("Reintento de turnos pendientes del servidor de IA iniciado cada %v", interval)
+}
+
+// replayPendingTurns reserva los turnos guardados y los encola para responderse en orden por
+// teléfono, combinando los de un mismo usuario en un solo turno. Los turnos siguen guardados hasta que
+// se responden.
+func replayPendingTurns(ctx context.Context, rdb *redis.Client) {
+	keys := []string{aiReplayKey, aiReplayProcessingKey, aiReplayLeasesKey}
+	now := time.Now()
+	if recovered, err := recoverReplayScript.Run(ctx, rdb, keys, now.UnixMilli()).Int(); err != nil {
+		logger.Log.Errorf("Error al recuperar los turnos pendientes abandonados: %v", err)
+	} else if recovered > 0 {
+		logger.Log.Warnf("%d turno(s) pendiente(s) abandonado(s) vuelven a la lista de reintentos", recovered)
+	}
+
+	ai, err := getAIBackend()
+	if err != nil {
+		return
+	}
+	if ai.Breaker().State != aibackend.StateClosed && !backendServing(ctx, ai) {
+		return
+	}
+
+	payloads, err := claimReplayScript.Run(ctx, rdb, keys, aiReplayBatch, now.Add(aiReplayLease).UnixMilli()).StringSlice()
+	if err != nil && err != redis.Nil {
+		logger.Log.Errorf("Error al leer los turnos pendientes del servidor de IA: %v", err)
+		return
+	}
+
+	var order []string
+	turns := make(map[string]*replayBatch)
+	for _, payload := range payloads {
+		var entry replayEntry
+		if err := json.Unmarshal([]byte(payload), &entry); err != nil {
+			logger.Log.Errorf("Turno pendiente inválido descartado: %v", err)
+			ackReplay(rdb, payload)
+			continue
+		}
+		if time.Since(entry.QueuedAt) > customerServiceWindow {
+			logger.Log.Warnf("Turno pendiente de %s descartado: la ventana de 24 horas ya se cerró", entry.Phone)
+			ackReplay(rdb, payload)
+			continue
+		}
+
+		batch, ok := turns[entry.Phone]
+		if !ok {
+			batch = &replayBatch{turn: &conversationTurn{Phone: entry.Phone, Replay: true, queuedAt: entry.QueuedAt}}
+			turns[entry.Phone] = batch
+			order = append(order, entry.Phone)
+		}
+		batch.payloads = append(batch.payloads, payload)
+		if entry.Attempts > batch.attempts {
+			batch.attempts = entry.Attempts
+		}
+		turn := batch.turn
+		turn.Name = entry.Name
+		message := pendingMessage{MessageID: entry.MessageID, Text: entry.Text, done: func(error) {}}
+		if entry.Selection != nil {
+			message.Selection = &pb.SelectedOption{Id: entry.Selection.ID, Title: entry.Selection.Title, Question: entry.Selection.Question}
+		}
+		turn.Messages = append(turn.Messages, message)
+	}
+
+	for _, phone := range order {
+		batch := turns[phone]
+		logger.Log.Infof("Reintentando el turno pendiente de %s con %d mensaje(s)", phone, len(batch.turn.Messages))
+		conversationExecutor.Submit(phone, func() { replayTurn(rdb, batch) })
+	}
+}
+
+// replayBatch es un turno combinado a partir de los turnos guardados de un usuario.
+type replayBatch struct {
+	turn *conversationTurn
+	// payloads son los turnos guardados que forman el turno, tal como están en la lista de procesamiento.
+	payloads []string
+	// attempts es el mayor número de reintentos fallidos de los turnos guardados.
+	attempts int
+}
+
+// replayTurn responde un turno guardado con los hilos actuales de la sesión del usuario. Solo quita
+// los turnos guardados si se respondió, si ya no tiene sesión o si se agotaron sus reintentos; en otro
+// caso vuelven a la lista de reintentos.
+func replayTurn(rdb *redis.Client, batch *replayBatch) {
+	turn := batch.turn
+	store, err := getSessionStore()
+	if err != nil {
+		logger.Log.Errorf("Error al reintentar el turno de %s: %v", turn.Phone, err)
+		requeueReplay(rdb, batch.payloads, false)
+		return
+	}
+	sess, err := store.Get(ctx, turn.Phone)
+	if errors.Is(err, session.ErrNotFound) {
+		logger.Log.Warnf("Turno pendiente de %s descartado: la sesión ya no existe", turn.Phone)
+		ackReplay(rdb, batch.payloads...)
+		return
+	}
+	if err != nil {
+		logger.Log.Errorf("Error al leer la sesión de %s para reintentar su turno: %v", turn.Phone, err)
+		requeueReplay(rdb, batch.payloads, false)
+		return
+	}
+
+	// Si el servidor de IA vuelve a fallar, replyToTurn guarda el turno combinado y devuelve nil
+	turn.ThreadID, turn.ThreadIDAnalizer = sess.Thread, sess.ThreadAnalizer
+	turn.replayAttempts = batch.attempts
+	err = replyToTurn(turn)
+	switch {
+	case err == nil:
+		ackReplay(rdb, batch.payloads...)
+	case batch.attempts+1 >= maxReplayAttempts:
+		logger.Log.Errorf("Error al reintentar el turno de %s, se descarta tras %d intento(s): %v", turn.Phone, batch.attempts+1, err)
+		ackReplay(rdb, batch.payloads...)
+	default:
+		logger.Log.Errorf("Error al reintentar el turno de %s, se volverá a intentar: %v", turn.Phone, err)
+		requeueReplay(rdb, batch.payloads, true)
+	}
+}
+
+// ackReplay quita de la lista de procesamiento los turnos guardados ya respondidos o descartados.
+func ackReplay(rdb *redis.Client, payloads ...string) {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, payload := range payloads {
+			pipe.LRem(ctx, aiReplayProcessingKey, 1, payload)
+			pipe.HDel(ctx, aiReplayLeasesKey, payload)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Errorf("Error al quitar %d turno(s) reintentado(s); se volverán a procesar: %v", len(payloads), err)
+	}
+}
+
+// requeueReplay devuelve los turnos guardados a la lista de reintentos, sumando un intento fallido si
+// failed es true. Si falla, los turnos vuelven igualmente al vencer su reserva.
+func requeueReplay(rdb *redis.Client, payloads []string, failed bool) {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, payload := range payloads {
+			requeued := payload
+			var entry replayEntry
+			if failed && json.Unmarshal([]byte(payload), &entry) == nil {
+				entry.Attempts++
+				if data, err := json.Marshal(entry); err == nil {
+					requeued = string(data)
+				}
+			}
+			pipe.LRem(ctx, aiReplayProcessingKey, 1, payload)
+			pipe.HDel(ctx, aiReplayLeasesKey, payload)
+			pipe.RPush(ctx, aiReplayKey, requeued)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Errorf("Error al devolver %d turno(s) a la lista de reintentos: %v", len(payloads), err)
+	}
+}
+
+// backendServing consulta el health check del servidor de IA. Un servidor que no implementa el
+// health check se considera disponible si responde.
+func backendServing(ctx context.Context, ai *aibackend.Client) bool {
+	serving, err := ai.Check(ctx)
+	if status.Code(err) == codes.Unimplemented {
+		return true
+	}
+	return err == nil && serving == healthpb.HealthCheckResponse_SERVING
+}
+
+// GetAIHealth informa el estado del circuito y del servidor de IA y el número de turnos pendientes.
+// Responde 503 mientras el circuito está abierto.
+func GetAIHealth(c *gin.Context) {
+	ai, err := getAIBackend()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"estado": "no_configurado", "error": err.Error()})
+		return
+	}
+
+	breaker := ai.Breaker()
+	response := gin.H{
+		"estado": "ok",
+		"circuito": gin.H{
+			"estado":       breaker.State.String(),
+			"fallos":       breaker.Failures,
+			"ultimo_error": breaker.LastError,
+		},
+	}
+	if !breaker.OpenedAt.IsZero() {
+		response["circuito"].(gin.H)["abierto_desde"] = breaker.OpenedAt
+	}
+
+	serving, err := ai.Check(c.Request.Context())
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		response["servidor"] = "sin_health_check"
+	case err != nil:
+		response["servidor"] = "no_disponible"
+	default:
+		response["servidor"] = serving.String()
+	}
+
+	if redisConn, err := db.GetRedisConn(); err == nil {
+		if pending, err := redisConn.LLen(c.Request.Context(), aiReplayKey).Result(); err == nil {
+			response["turnos_pendientes"] = pending
+		}
+	}
+
+	code := http.StatusOK
+	if breaker.State != aibackend.StateClosed {
+		response["estado"] = "degradado"
+	}
+	if breaker.State == aibackend.StateOpen {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, response)
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"chatbot/utils/redistest"
+)
+
+func TestEnqueueReplayKeepsAttempts(t *testing.T) {
+	tests := []struct {
+		name         string
+		turn         *conversationTurn
+		wantAttempts int
+	}{
+		{
+			name:         "turno nuevo",
+			turn:         &conversationTurn{Phone: "5491100000000", Messages: []pendingMessage{{MessageID: "wamid.1", Text: "hola"}}},
+			wantAttempts: 0,
+		},
+		{
+			name: "turno combinado que se estaba reintentando",
+			turn: &conversationTurn{
+				Phone:          "5491100000000",
+				Messages:       []pendingMessage{{MessageID: "wamid.1", Text: "hola"}, {MessageID: "wamid.2", Text: "¿precio?"}},
+				Replay:         true,
+				queuedAt:       time.Now().Add(-time.Hour),
+				replayAttempts: 3,
+			},
+			wantAttempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := redistest.New(t)
+			if err := enqueueReplay(rdb, tt.turn); err != nil {
+				t.Fatal(err)
+			}
+
+			payloads, err := rdb.LRange(context.Background(), aiReplayKey, 0, -1).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(payloads) != 1 {
+				t.Fatalf("la lista de reintentos tiene %d turnos, se esperaba 1", len(payloads))
+			}
+			var entry replayEntry
+			if err := json.Unmarshal([]byte(payloads[0]), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.Attempts != tt.wantAttempts {
+				t.Errorf("reintentos = %d, se esperaban %d", entry.Attempts, tt.wantAttempts)
+			}
+			if entry.Text != tt.turn.Text() || entry.MessageID != tt.turn.LastMessageID() {
+				t.Errorf("turno guardado = %+v", entry)
+			}
+		})
+	}
+}
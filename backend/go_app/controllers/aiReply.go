@@ -0,0 +1,146 @@
+// go_app/controllers/aiReply.go
+
+package controllers
+
+import (
+	"chatbot/logger"
+	"chatbot/utils"
+	"chatbot/utils/whatsapp"
+	"strings"
+
+	pb "chatbot/utils/proto"
+)
+
+// replyContractVersion es la versión de la respuesta estructurada que entiende el bot. Las respuestas
+// con contract_version 0 vienen de servidores que solo envían el texto con el formato "|||".
+const replyContractVersion = 1
+
+// Separadores del formato anterior "respuesta|||pregunta|||opción1|opción2".
+const (
+	legacyPartSeparator   = "|||"
+	legacyOptionSeparator = "|"
+)
+
+// normalizeResponse convierte la respuesta del asistente a la forma estructurada. Las respuestas con el
+// formato anterior se interpretan desde response y las opciones sin id reciben uno según su posición.
+func normalizeResponse(res *pb.GenerateResponseResponse) *pb.GenerateResponseResponse {
+	if res.ContractVersion == 0 {
+		res = parseLegacyResponse(res.Response)
+	} else if res.ContractVersion > replyContractVersion {
+		logger.Log.Warnf("Respuesta con versión de contrato %d, se interpreta como versión %d", res.ContractVersion, replyContractVersion)
+	}
+
+	res.Options = cleanOptions(res.Options)
+	for _, part := range res.Parts {
+		part.Options = cleanOptions(part.Options)
+	}
+	return res
+}
+
+// parseLegacyResponse interpreta una respuesta con el formato "respuesta|||pregunta|||opción1|opción2".
+func parseLegacyResponse(response string) *pb.GenerateResponseResponse {
+	res := &pb.GenerateResponseResponse{Response: response, ContractVersion: replyContractVersion}
+
+	parts := strings.Split(response, legacyPartSeparator)
+	res.Parts = []*pb.ReplyPart{{Kind: pb.ReplyKind_REPLY_KIND_TEXT, Text: parts[0]}}
+	if len(parts) > 1 {
+		res.FollowUpQuestion = strings.TrimSpace(parts[1])
+	}
+	if len(parts) > 2 {
+		for _, title := range strings.Split(parts[2], legacyOptionSeparator) {
+			res.Options = append(res.Options, &pb.ReplyOption{Title: title})
+		}
+	}
+	return res
+}
+
+// cleanOptions descarta las opciones sin título y asigna un id a las que no lo tienen.
+func cleanOptions(options []*pb.ReplyOption) []*pb.ReplyOption {
+	cleaned := options[:0]
+	for _, option := range options {
+		option.Title = strings.TrimSpace(option.Title)
+		if option.Title == "" {
+			continue
+		}
+		cleaned = append(cleaned, option)
+	}
+	for i, option := range cleaned {
+		if option.Id == "" {
+			option.Id = utils.InteractiveButtonID(i)
+		}
+	}
+	return cleaned
+}
+
+// responseText arma el texto de la respuesta que se guarda en la sesión.
+func responseText(res *pb.GenerateResponseResponse) string {
+	var texts []string
+	for _, part := range res.Parts {
+		if text := strings.TrimSpace(part.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// isTextPart indica si la parte se envía como texto simple, que es el que llega en los fragmentos del streaming.
+func isTextPart(part *pb.ReplyPart) bool {
+	return part.Kind == pb.ReplyKind_REPLY_KIND_TEXT || part.Kind == pb.ReplyKind_REPLY_KIND_UNSPECIFIED
+}
+
+// buildReplyMessage convierte una parte de la respuesta en un mensaje de WhatsApp. Devuelve nil si la
+// parte no tiene contenido que enviar.
+func buildReplyMessage(phone string, part *pb.ReplyPart) *whatsapp.OutboundMessage {
+	text := utils.ProcessTextForWhatsApp(part.Text)
+
+	switch part.Kind {
+	case pb.ReplyKind_REPLY_KIND_BUTTONS:
+		if len(part.Options) > 0 {
+			return whatsapp.NewOptionsMessage(phone, text, whatsappOptions(part.Options))
+		}
+	case pb.ReplyKind_REPLY_KIND_LIST:
+		if len(part.Options) > 0 {
+			return whatsapp.NewListOptionsMessage(phone, text, whatsappOptions(part.Options))
+		}
+	case pb.ReplyKind_REPLY_KIND_MEDIA:
+		if part.MediaUrl != "" {
+			mediaType := part.MediaType
+			if mediaType == "" {
+				mediaType = whatsapp.MessageTypeImage
+			}
+			media := whatsapp.OutboundMedia{Link: part.MediaUrl}
+			if whatsapp.HasCaption(mediaType) {
+				media.Caption = text
+			} else if text != "" {
+				logger.Log.Warnf("El texto de la parte de tipo %s para %s se omite: la Cloud API no lo admite", mediaType, phone)
+			}
+			return whatsapp.NewMediaMessage(phone, mediaType, media)
+		}
+	case pb.ReplyKind_REPLY_KIND_TEMPLATE:
+		if part.TemplateName != "" {
+			language := part.TemplateLanguage
+			if language == "" {
+				language = templateLanguage
+			}
+			var components []whatsapp.TemplateComponent
+			if len(part.TemplateParameters) > 0 {
+				components = append(components, whatsapp.NewBodyParameters(part.TemplateParameters...))
+			}
+			return whatsapp.NewTemplateMessage(phone, part.TemplateName, language, components...)
+		}
+	}
+
+	if text == "" {
+		return nil
+	}
+	return whatsapp.NewTextMessage(phone, text)
+}
+
+// whatsappOptions convierte las opciones de la respuesta en opciones de WhatsApp.
+func whatsappOptions(options []*pb.ReplyOption) []whatsapp.Option {
+	choices := make([]whatsapp.Option, len(options))
+	for i, option := range options {
+		choices[i] = whatsapp.Option{ID: option.Id, Title: option.Title, Description: option.Description}
+	}
+	return choices
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"chatbot/logger"
+	"chatbot/utils/whatsapp"
+
+	pb "chatbot/utils/proto"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// replySummary resume la respuesta estructurada para compararla en las pruebas.
+type replySummary struct {
+	Parts    []string
+	Question string
+	Options  []string
+}
+
+func summarize(res *pb.GenerateResponseResponse) replySummary {
+	var summary replySummary
+	for _, part := range res.Parts {
+		summary.Parts = append(summary.Parts, part.Text)
+	}
+	summary.Question = res.FollowUpQuestion
+	for _, option := range res.Options {
+		summary.Options = append(summary.Options, option.Id+"="+option.Title)
+	}
+	return summary
+}
+
+func TestParseLegacyResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     replySummary
+	}{
+		{
+			name:     "solo respuesta",
+			response: "Hola, ¿en qué te ayudo?",
+			want:     replySummary{Parts: []string{"Hola, ¿en qué te ayudo?"}},
+		},
+		{
+			name:     "con pregunta",
+			response: "Tenemos envíos.||| ¿Quieres cotizar? ",
+			want:     replySummary{Parts: []string{"Tenemos envíos."}, Question: "¿Quieres cotizar?"},
+		},
+		{
+			name:     "con pregunta y opciones",
+			response: "Tenemos envíos.|||¿A dónde?|||Norte|Sur|Centro",
+			want:     replySummary{Parts: []string{"Tenemos envíos."}, Question: "¿A dónde?", Options: []string{"=Norte", "=Sur", "=Centro"}},
+		},
+		{
+			name:     "opciones sin pregunta",
+			response: "Elige una opción.||||||Sí|No",
+			want:     replySummary{Parts: []string{"Elige una opción."}, Options: []string{"=Sí", "=No"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := parseLegacyResponse(tt.response)
+			if res.ContractVersion != replyContractVersion || res.Response != tt.response {
+				t.Errorf("versión %d y texto %q, se esperaba la versión %d con el texto original", res.ContractVersion, res.Response, replyContractVersion)
+			}
+			if got := summarize(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLegacyResponse() = %+v, se esperaba %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *pb.GenerateResponseResponse
+		want replySummary
+	}{
+		{
+			name: "formato anterior",
+			res:  &pb.GenerateResponseResponse{Response: "Hola|||¿Seguimos?|||Sí| |No"},
+			want: replySummary{Parts: []string{"Hola"}, Question: "¿Seguimos?", Options: []string{"button_1=Sí", "button_2=No"}},
+		},
+		{
+			name: "respuesta estructurada",
+			res: &pb.GenerateResponseResponse{
+				ContractVersion:  1,
+				Response:         "ignorado|||ignorado",
+				Parts:            []*pb.ReplyPart{{Kind: pb.ReplyKind_REPLY_KIND_TEXT, Text: "Hola"}},
+				FollowUpQuestion: "¿Seguimos?",
+				Options:          []*pb.ReplyOption{{Id: "si", Title: " Sí "}, {Title: "No"}},
+			},
+			want: replySummary{Parts: []string{"Hola"}, Question: "¿Seguimos?", Options: []string{"si=Sí", "button_2=No"}},
+		},
+		{
+			name: "versión de contrato más nueva",
+			res: &pb.GenerateResponseResponse{
+				ContractVersion: replyContractVersion + 1,
+				Parts:           []*pb.ReplyPart{{Kind: pb.ReplyKind_REPLY_KIND_TEXT, Text: "Hola"}},
+			},
+			want: replySummary{Parts: []string{"Hola"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize(normalizeResponse(tt.res)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeResponse() = %+v, se esperaba %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildReplyMessageMediaCaption(t *testing.T) {
+	tests := []struct {
+		name        string
+		mediaType   string
+		wantCaption string
+	}{
+		{name: "imagen", mediaType: whatsapp.MessageTypeImage, wantCaption: "Mira esto"},
+		{name: "sin tipo se envía como imagen", mediaType: "", wantCaption: "Mira esto"},
+		{name: "video", mediaType: whatsapp.MessageTypeVideo, wantCaption: "Mira esto"},
+		{name: "documento", mediaType: whatsapp.MessageTypeDocument, wantCaption: "Mira esto"},
+		{name: "audio", mediaType: whatsapp.MessageTypeAudio},
+		{name: "sticker", mediaType: whatsapp.MessageTypeSticker},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			part := &pb.ReplyPart{Kind: pb.ReplyKind_REPLY_KIND_MEDIA, Text: "Mira esto", MediaUrl: "https://example.com/archivo", MediaType: tt.mediaType}
+			message := buildReplyMessage("5491100000000", part)
+			media := map[string]*whatsapp.OutboundMedia{
+				whatsapp.MessageTypeImage:    message.Image,
+				whatsapp.MessageTypeVideo:    message.Video,
+				whatsapp.MessageTypeDocument: message.Document,
+				whatsapp.MessageTypeAudio:    message.Audio,
+				whatsapp.MessageTypeSticker:  message.Sticker,
+			}[message.Type]
+			if media == nil {
+				t.Fatalf("el mensaje de tipo %s no tiene multimedia", message.Type)
+			}
+			if media.Caption != tt.wantCaption {
+				t.Errorf("texto = %q, se esperaba %q", media.Caption, tt.wantCaption)
+			}
+		})
+	}
+}
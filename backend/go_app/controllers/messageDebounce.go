@@ -0,0 +1,174 @@
+// go_app/controllers/messageDebounce.go
+
+package controllers
+
+import (
+	"chatbot/logger"
+	pb "chatbot/utils/proto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// typingRefreshInterval es cada cuánto se renueva el indicador de escritura, que WhatsApp oculta a los 25 segundos.
+const typingRefreshInterval = 20 * time.Second
+
+// turnDebouncer agrupa los mensajes de cada usuario que llegan dentro de la ventana configurada.
+var turnDebouncer = newMessageDebouncer(0, 0)
+
+// pendingMessage es un mensaje ya registrado en la sesión que espera la respuesta de su turno.
+type pendingMessage struct {
+	MessageID string
+	Text      string
+	Selection *pb.SelectedOption
+	// done se llama con el resultado de la respuesta del turno.
+	done func(error)
+}
+
+// conversationTurn agrupa los mensajes consecutivos de un usuario que se responden con una sola llamada al asistente.
+type conversationTurn struct {
+	Phone            string
+	Name             string
+	ThreadID         string
+	ThreadIDAnalizer string
+	Messages         []pendingMessage
+	// Replay indica que el turno ya recibió la respuesta de contingencia y se está reintentando.
+	Replay bool
+
+	openedAt time.Time
+	queuedAt time.Time
+	timer    *time.Timer
+	// replayAttempts es el número de reintentos fallidos del turno guardado que se está reintentando.
+	replayAttempts int
+}
+
+// Text combina los textos de los mensajes del turno en orden de llegada.
+func (t *conversationTurn) Text() string {
+	texts := make([]string, len(t.Messages))
+	for i, message := range t.Messages {
+		texts[i] = message.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Selection devuelve la última opción elegida en el turno, o nil si ningún mensaje respondió a botones o listas.
+func (t *conversationTurn) Selection() *pb.SelectedOption {
+	for i := len(t.Messages) - 1; i >= 0; i-- {
+		if t.Messages[i].Selection != nil {
+			return t.Messages[i].Selection
+		}
+	}
+	return nil
+}
+
+// LastMessageID devuelve el id del último mensaje del turno.
+func (t *conversationTurn) LastMessageID() string {
+	if len(t.Messages) == 0 {
+		return ""
+	}
+	return t.Messages[len(t.Messages)-1].MessageID
+}
+
+// messageDebouncer mantiene abierto un turno por teléfono mientras sigan llegando mensajes dentro
+// de la ventana y lo responde cuando la ventana se cierra o se alcanza la espera máxima.
+type messageDebouncer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	maxWait time.Duration
+	turns   map[string]*conversationTurn
+	// flush responde un turno cerrado; es flushTurn salvo en las pruebas.
+	flush func(turn *conversationTurn)
+}
+
+// newMessageDebouncer crea un agrupador con la ventana y la espera máxima indicadas. Con una ventana
+// de cero cada mensaje se responde de inmediato.
+func newMessageDebouncer(window, maxWait time.Duration) *messageDebouncer {
+	if maxWait < window {
+		maxWait = window
+	}
+	return &messageDebouncer{window: window, maxWait: maxWait, turns: make(map[string]*conversationTurn), flush: flushTurn}
+}
+
+// Add agrega un mensaje al turno abierto del teléfono, o abre uno nuevo, y reinicia la ventana.
+// Los datos de sesión de turn reemplazan a los del turno abierto.
+func (d *messageDebouncer) Add(turn *conversationTurn, message pendingMessage) {
+	if d.window <= 0 {
+		turn.Messages = []pendingMessage{message}
+		d.flush(turn)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	open, ok := d.turns[turn.Phone]
+	if !ok {
+		open = &conversationTurn{Phone: turn.Phone, openedAt: time.Now()}
+		d.turns[turn.Phone] = open
+	}
+	open.Name, open.ThreadID, open.ThreadIDAnalizer = turn.Name, turn.ThreadID, turn.ThreadIDAnalizer
+	open.Messages = append(open.Messages, message)
+
+	// No extender la ventana más allá de la espera máxima desde el primer mensaje
+	wait := d.window
+	if remaining := d.maxWait - time.Since(open.openedAt); remaining < wait {
+		wait = remaining
+	}
+	if open.timer != nil {
+		open.timer.Stop()
+	}
+	open.timer = time.AfterFunc(wait, func() { d.close(open) })
+
+	logger.Log.Infof("Mensaje %s agregado al turno de %s (%d mensaje(s)), se responderá en %v", message.MessageID, turn.Phone, len(open.Messages), wait)
+}
+
+// close cierra el turno y encola su respuesta detrás de los mensajes pendientes de la misma conversación.
+func (d *messageDebouncer) close(turn *conversationTurn) {
+	d.mu.Lock()
+	if d.turns[turn.Phone] != turn {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.turns, turn.Phone)
+	d.mu.Unlock()
+
+	conversationExecutor.Submit(turn.Phone, func() { d.flush(turn) })
+}
+
+// flushTurn responde el turno y notifica el resultado a cada uno de sus mensajes.
+func flushTurn(turn *conversationTurn) {
+	err := replyToTurn(turn)
+	if err != nil {
+		logger.Log.Errorf("Error al responder el turno de %s con %d mensaje(s): %v", turn.Phone, len(turn.Messages), err)
+	}
+	for _, message := range turn.Messages {
+		message.done(err)
+	}
+}
+
+// markAsRead confirma la lectura de un mensaje de phone y, si typing es true, muestra el indicador de escritura.
+func markAsRead(phone, messageID string, typing bool) {
+	if err := getWhatsAppClient().MarkAsRead(ctx, messageID, typing); err != nil {
+		logger.Log.Warnf("Error al confirmar la lectura del mensaje %s de %s: %v", messageID, phone, err)
+	}
+}
+
+// keepTyping muestra de inmediato el indicador de escritura sobre un mensaje y lo renueva hasta que se
+// llame a la función devuelta.
+func keepTyping(phone, messageID string) func() {
+	stop := make(chan struct{})
+	go func() {
+		markAsRead(phone, messageID, true)
+		ticker := time.NewTicker(typingRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				markAsRead(phone, messageID, true)
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
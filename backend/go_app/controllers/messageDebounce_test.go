@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testDebouncer devuelve un agrupador cuyos turnos cerrados se reciben en el canal devuelto.
+func testDebouncer(window, maxWait time.Duration) (*messageDebouncer, <-chan *conversationTurn) {
+	flushed := make(chan *conversationTurn, 10)
+	d := newMessageDebouncer(window, maxWait)
+	d.flush = func(turn *conversationTurn) { flushed <- turn }
+	return d, flushed
+}
+
+// turnTexts devuelve los textos de los mensajes del turno.
+func turnTexts(turn *conversationTurn) []string {
+	texts := make([]string, len(turn.Messages))
+	for i, message := range turn.Messages {
+		texts[i] = message.Text
+	}
+	return texts
+}
+
+func TestMessageDebouncerGroupsWithinWindow(t *testing.T) {
+	d, flushed := testDebouncer(100*time.Millisecond, time.Second)
+
+	d.Add(&conversationTurn{Phone: "5491100000001", Name: "Ana"}, pendingMessage{MessageID: "wamid.1", Text: "hola"})
+	d.Add(&conversationTurn{Phone: "5491100000002", Name: "Luis"}, pendingMessage{MessageID: "wamid.2", Text: "buenas"})
+	time.Sleep(50 * time.Millisecond)
+	d.Add(&conversationTurn{Phone: "5491100000001", Name: "Ana", ThreadID: "hilo"}, pendingMessage{MessageID: "wamid.3", Text: "¿precio?"})
+
+	want := map[string][]string{
+		"5491100000001": {"hola", "¿precio?"},
+		"5491100000002": {"buenas"},
+	}
+	got := make(map[string][]string)
+	for range want {
+		select {
+		case turn := <-flushed:
+			got[turn.Phone] = turnTexts(turn)
+			if turn.Phone == "5491100000001" && turn.ThreadID != "hilo" {
+				t.Errorf("el turno conserva el hilo %q, se esperaba el del último mensaje", turn.ThreadID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("tiempo agotado esperando los turnos, recibidos: %v", got)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("turnos = %v, se esperaban %v", got, want)
+	}
+}
+
+func TestMessageDebouncerMaxWait(t *testing.T) {
+	window, maxWait := 80*time.Millisecond, 200*time.Millisecond
+	d, flushed := testDebouncer(window, maxWait)
+
+	// Los mensajes siguen llegando dentro de la ventana, pero el turno se cierra al cumplirse la espera máxima
+	start := time.Now()
+	stop := time.After(400 * time.Millisecond)
+	var turn *conversationTurn
+	for turn == nil {
+		select {
+		case turn = <-flushed:
+		case <-stop:
+			t.Fatal("el turno no se cerró al cumplirse la espera máxima")
+		default:
+			d.Add(&conversationTurn{Phone: "5491100000001"}, pendingMessage{Text: "mensaje"})
+			time.Sleep(window / 4)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > maxWait+window {
+		t.Errorf("el turno se cerró a los %v, se esperaba a los %v", elapsed, maxWait)
+	}
+	if len(turn.Messages) < 2 {
+		t.Errorf("el turno tiene %d mensaje(s), se esperaban los recibidos durante la espera máxima", len(turn.Messages))
+	}
+}
+
+func TestMessageDebouncerWithoutWindow(t *testing.T) {
+	d, flushed := testDebouncer(0, 0)
+
+	d.Add(&conversationTurn{Phone: "5491100000001"}, pendingMessage{Text: "hola"})
+	select {
+	case turn := <-flushed:
+		if texts := turnTexts(turn); !reflect.DeepEqual(texts, []string{"hola"}) {
+			t.Errorf("turno = %v, se esperaba solo el mensaje recibido", texts)
+		}
+	default:
+		t.Fatal("sin ventana el turno debe responderse de inmediato")
+	}
+}
@@ -0,0 +1,328 @@
+// go_app/controllers/messageHandlers.go
+
+package controllers
+
+import (
+	"chatbot/logger"
+	pb "chatbot/utils/proto"
+	"chatbot/utils/session"
+	"chatbot/utils/storage"
+	"chatbot/utils/whatsapp"
+	"context"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tipos con los que se guardan los mensajes en la sesión de Redis. La multimedia se guarda
+// con el tipo de la Cloud API (image, audio, video, document, sticker).
+const (
+	sessionTypeIncoming    = "incoming"
+	sessionTypeOutgoing    = "outgoing"
+	sessionTypeLocation    = "location"
+	sessionTypeContacts    = "contacts"
+	sessionTypeReaction    = "reaction"
+	sessionTypeInteractive = "interactive"
+)
+
+// handledMessage es el resultado de interpretar un mensaje entrante.
+type handledMessage struct {
+	// Text es la descripción textual que se guarda en la sesión y se envía al asistente.
+	Text string
+	// Type es el tipo con el que se guarda el mensaje en la sesión.
+	Type string
+	// Reply indica si el mensaje debe generar una respuesta del asistente.
+	Reply bool
+	// Selection es la opción elegida cuando el mensaje responde a botones o listas.
+	Selection *pb.SelectedOption
+	// Metadata son los datos que se guardan en los metadatos de la sesión y no se envían al asistente.
+	Metadata map[string]string
+}
+
+// mediaMetadataPrefix es el prefijo de los metadatos de la sesión con la clave en el almacenamiento de
+// la multimedia de cada mensaje, por id de mensaje.
+const mediaMetadataPrefix = "multimedia:"
+
+// messageHandler interpreta un mensaje entrante de un tipo concreto.
+type messageHandler func(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error)
+
+// messageHandlers asocia cada tipo de mensaje de la Cloud API con su manejador.
+var messageHandlers = map[string]messageHandler{
+	whatsapp.MessageTypeText:        handleTextMessage,
+	whatsapp.MessageTypeImage:       handleMediaMessage,
+	whatsapp.MessageTypeAudio:       handleMediaMessage,
+	whatsapp.MessageTypeVideo:       handleMediaMessage,
+	whatsapp.MessageTypeDocument:    handleMediaMessage,
+	whatsapp.MessageTypeSticker:     handleMediaMessage,
+	whatsapp.MessageTypeLocation:    handleLocationMessage,
+	whatsapp.MessageTypeContacts:    handleContactsMessage,
+	whatsapp.MessageTypeReaction:    handleReactionMessage,
+	whatsapp.MessageTypeInteractive: handleInteractiveMessage,
+	whatsapp.MessageTypeButton:      handleInteractiveMessage,
+}
+
+var (
+	mediaStore      storage.BlobStore
+	mediaStoreMutex sync.Mutex
+
+	whatsappClient      *whatsapp.Client
+	whatsappClientMutex sync.Mutex
+)
+
+// SetWhatsAppClient configura el cliente de la Cloud API con el que se envían mensajes y se descarga multimedia.
+func SetWhatsAppClient(client *whatsapp.Client) {
+	whatsappClientMutex.Lock()
+	defer whatsappClientMutex.Unlock()
+	whatsappClient = client
+}
+
+// getWhatsAppClient devuelve el cliente configurado o crea el definido por las variables de entorno.
+func getWhatsAppClient() *whatsapp.Client {
+	whatsappClientMutex.Lock()
+	defer whatsappClientMutex.Unlock()
+	if whatsappClient == nil {
+		whatsappClient = whatsapp.NewClientFromEnv()
+	}
+	return whatsappClient
+}
+
+// SetMediaStore configura el almacenamiento donde se guardan los archivos multimedia recibidos.
+func SetMediaStore(store storage.BlobStore) {
+	mediaStoreMutex.Lock()
+	defer mediaStoreMutex.Unlock()
+	mediaStore = store
+}
+
+// getMediaStore devuelve el almacenamiento configurado o crea el definido por las variables de entorno.
+func getMediaStore() (storage.BlobStore, error) {
+	mediaStoreMutex.Lock()
+	defer mediaStoreMutex.Unlock()
+	if mediaStore == nil {
+		store, err := storage.NewBlobStoreFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		mediaStore = store
+	}
+	return mediaStore, nil
+}
+
+// handleInboundMessage busca el manejador del tipo del mensaje y lo ejecuta. Devuelve nil si el tipo no está soportado.
+func handleInboundMessage(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error) {
+	handler, ok := messageHandlers[inbound.Message.Type]
+	if !ok {
+		logger.Log.Warnf("Tipo de mensaje no soportado: %s (id %s)", inbound.Message.Type, inbound.Message.ID)
+		return nil, nil
+	}
+	return handler(ctx, inbound)
+}
+
+// handleTextMessage maneja los mensajes de texto. Si el texto es el número de una de las opciones
+// enviadas como texto numerado, se resuelve como la elección de esa opción.
+func handleTextMessage(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error) {
+	text := inbound.Message.TextBody()
+
+	if number, err := strconv.Atoi(strings.TrimSpace(text)); err == nil && number > 0 {
+		question, options, format, err := pendingOptions(ctx, inbound.Phone())
+		if err != nil {
+			return nil, fmt.Errorf("fallo al recuperar las opciones enviadas: %w", err)
+		}
+		if format == session.OptionsFormatNumbered && number <= len(options) {
+			option := options[number-1]
+			selection := &pb.SelectedOption{Id: option.ID, Title: option.Title, Question: question}
+			logger.Log.Infof("Usuario %s eligió la opción numerada %d (%s)", inbound.Phone(), number, option.Title)
+			return &handledMessage{Text: option.Title, Type: sessionTypeInteractive, Reply: true, Selection: selection}, nil
+		}
+	}
+
+	return &handledMessage{Text: text, Type: sessionTypeIncoming, Reply: true}, nil
+}
+
+// handleMediaMessage descarga la multimedia a través de la Graph API, la guarda en el almacenamiento y la describe.
+func handleMediaMessage(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error) {
+	message := inbound.Message
+	media := message.MediaOf()
+	if media == nil {
+		return nil, fmt.Errorf("el mensaje %s de tipo %s no contiene multimedia", message.ID, message.Type)
+	}
+
+	handled := &handledMessage{Text: describeMedia(message.Type, media), Type: message.Type, Reply: true}
+	key, err := storeMedia(ctx, inbound.Phone(), message.ID, media)
+	if err != nil {
+		// La descripción se envía igualmente para que el asistente pueda responder
+		logger.Log.Errorf("Error al guardar multimedia %s del mensaje %s: %v", media.ID, message.ID, err)
+	} else {
+		handled.Metadata = map[string]string{mediaMetadataPrefix + message.ID: key}
+	}
+	// Los stickers no requieren respuesta del asistente
+	if message.Type == whatsapp.MessageTypeSticker {
+		handled.Reply = false
+	}
+	return handled, nil
+}
+
+// storeMedia descarga un archivo multimedia y lo guarda bajo <telefono>/<id de mensaje>.<extensión>.
+// Devuelve la clave con la que se guardó.
+func storeMedia(ctx context.Context, phone, messageID string, media *whatsapp.Media) (string, error) {
+	store, err := getMediaStore()
+	if err != nil {
+		return "", fmt.Errorf("fallo al obtener almacenamiento de multimedia: %w", err)
+	}
+
+	info, err := getWhatsAppClient().GetMediaInfo(ctx, media.ID)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := getWhatsAppClient().DownloadMedia(ctx, info)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	mimeType := info.MimeType
+	if mimeType == "" {
+		mimeType = media.MimeType
+	}
+	key := phone + "/" + messageID + mediaExtension(mimeType, media.Filename)
+	if _, err := store.Save(ctx, key, mimeType, content); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// mediaExtension deduce la extensión de un archivo a partir de su nombre o de su tipo MIME.
+func mediaExtension(mimeType, filename string) string {
+	if idx := strings.LastIndex(filename, "."); idx >= 0 {
+		return filename[idx:]
+	}
+	baseType := strings.TrimSpace(strings.Split(mimeType, ";")[0])
+	if extensions, err := mime.ExtensionsByType(baseType); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ""
+}
+
+// describeMedia genera la descripción textual de un archivo multimedia para el asistente. Solo incluye
+// el tipo y el texto que lo acompaña: el nombre del archivo y dónde se guardó no se envían al modelo.
+func describeMedia(messageType string, media *whatsapp.Media) string {
+	var kind string
+	switch messageType {
+	case whatsapp.MessageTypeImage:
+		kind = "una imagen"
+	case whatsapp.MessageTypeAudio:
+		kind = "un audio"
+		if media.Voice {
+			kind = "una nota de voz"
+		}
+	case whatsapp.MessageTypeVideo:
+		kind = "un video"
+	case whatsapp.MessageTypeDocument:
+		kind = "un documento"
+	case whatsapp.MessageTypeSticker:
+		kind = "un sticker"
+	default:
+		kind = "un archivo"
+	}
+
+	description := fmt.Sprintf("[El usuario envió %s", kind)
+	if media.MimeType != "" {
+		description += fmt.Sprintf(" de tipo %s", media.MimeType)
+	}
+	description += "]"
+	if media.Caption != "" {
+		description += " " + media.Caption
+	}
+	return description
+}
+
+// handleLocationMessage describe una ubicación compartida por el usuario.
+func handleLocationMessage(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error) {
+	loc := inbound.Message.Location
+	description := fmt.Sprintf("[El usuario compartió una ubicación: latitud %.6f, longitud %.6f", loc.Latitude, loc.Longitude)
+	if loc.Name != "" {
+		description += ", lugar: " + loc.Name
+	}
+	if loc.Address != "" {
+		description += ", dirección: " + loc.Address
+	}
+	description += "]"
+	return &handledMessage{Text: description, Type: sessionTypeLocation, Reply: true}, nil
+}
+
+// handleContactsMessage describe las tarjetas de contacto compartidas por el usuario.
+func handleContactsMessage(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error) {
+	var contacts []string
+	for _, contact := range inbound.Message.Contacts {
+		var details []string
+		for _, phone := range contact.Phones {
+			details = append(details, phone.Phone)
+		}
+		for _, email := range contact.Emails {
+			details = append(details, email.Email)
+		}
+		entry := contact.Name.FormattedName
+		if len(details) > 0 {
+			entry += " (" + strings.Join(details, ", ") + ")"
+		}
+		contacts = append(contacts, entry)
+	}
+	description := fmt.Sprintf("[El usuario compartió %d contacto(s): %s]", len(contacts), strings.Join(contacts, "; "))
+	return &handledMessage{Text: description, Type: sessionTypeContacts, Reply: true}, nil
+}
+
+// handleReactionMessage registra una reacción del usuario. Las reacciones no generan respuesta.
+func handleReactionMessage(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error) {
+	reaction := inbound.Message.Reaction
+	description := fmt.Sprintf("[El usuario reaccionó con %s al mensaje %s]", reaction.Emoji, reaction.MessageID)
+	if reaction.Emoji == "" {
+		description = fmt.Sprintf("[El usuario quitó su reacción al mensaje %s]", reaction.MessageID)
+	}
+	return &handledMessage{Text: description, Type: sessionTypeReaction, Reply: false}, nil
+}
+
+// handleInteractiveMessage resuelve la opción elegida en botones, listas o botones de plantilla
+// usando las opciones enviadas que se guardaron en la sesión.
+func handleInteractiveMessage(ctx context.Context, inbound whatsapp.InboundMessage) (*handledMessage, error) {
+	message := inbound.Message
+
+	var replyID, replyTitle string
+	switch {
+	case message.Interactive != nil && message.Interactive.ButtonReply != nil:
+		replyID, replyTitle = message.Interactive.ButtonReply.ID, message.Interactive.ButtonReply.Title
+	case message.Interactive != nil && message.Interactive.ListReply != nil:
+		replyID, replyTitle = message.Interactive.ListReply.ID, message.Interactive.ListReply.Title
+	case message.Button != nil:
+		replyID, replyTitle = message.Button.Payload, message.Button.Text
+	default:
+		logger.Log.Warnf("Respuesta interactiva sin opción reconocible en el mensaje %s", message.ID)
+		return nil, nil
+	}
+
+	question, options, _, err := pendingOptions(ctx, inbound.Phone())
+	if err != nil {
+		return nil, fmt.Errorf("fallo al recuperar las opciones enviadas: %w", err)
+	}
+
+	selection := &pb.SelectedOption{Id: replyID, Title: replyTitle, Question: question}
+	if option, ok := findSessionOption(options, replyID); ok {
+		selection.Title = option.Title
+	} else {
+		logger.Log.Warnf("La opción %s no se encontró entre las enviadas a %s, se usa el título recibido", replyID, inbound.Phone())
+	}
+
+	logger.Log.Infof("Usuario %s eligió la opción %s (%s)", inbound.Phone(), selection.Id, selection.Title)
+	return &handledMessage{Text: selection.Title, Type: sessionTypeInteractive, Reply: true, Selection: selection}, nil
+}
+
+// findSessionOption busca una opción por su id.
+func findSessionOption(options []session.Option, id string) (session.Option, bool) {
+	for _, option := range options {
+		if option.ID == id {
+			return option, true
+		}
+	}
+	return session.Option{}, false
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"chatbot/utils/session"
+	"chatbot/utils/whatsapp"
+)
+
+func TestDescribeMedia(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageType string
+		media       whatsapp.Media
+		want        string
+	}{
+		{
+			name:        "imagen con texto",
+			messageType: whatsapp.MessageTypeImage,
+			media:       whatsapp.Media{MimeType: "image/jpeg", Caption: "¿Tienen este modelo?"},
+			want:        "[El usuario envió una imagen de tipo image/jpeg] ¿Tienen este modelo?",
+		},
+		{
+			name:        "nota de voz",
+			messageType: whatsapp.MessageTypeAudio,
+			media:       whatsapp.Media{MimeType: "audio/ogg", Voice: true},
+			want:        "[El usuario envió una nota de voz de tipo audio/ogg]",
+		},
+		{
+			name:        "el nombre del archivo no se envía",
+			messageType: whatsapp.MessageTypeDocument,
+			media:       whatsapp.Media{MimeType: "application/pdf", Filename: "dni_juan_perez.pdf"},
+			want:        "[El usuario envió un documento de tipo application/pdf]",
+		},
+		{
+			name:        "tipo desconocido sin datos",
+			messageType: "otro",
+			want:        "[El usuario envió un archivo]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeMedia(tt.messageType, &tt.media); got != tt.want {
+				t.Errorf("describeMedia() = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing map[string]string
+		metadata map[string]string
+		want     map[string]string
+	}{
+		{name: "sin datos", existing: nil, metadata: nil, want: nil},
+		{name: "sesión sin metadatos", metadata: map[string]string{"multimedia:1": "549/1.jpg"}, want: map[string]string{"multimedia:1": "549/1.jpg"}},
+		{
+			name:     "conserva los anteriores",
+			existing: map[string]string{"multimedia:1": "549/1.jpg"},
+			metadata: map[string]string{"multimedia:2": "549/2.pdf"},
+			want:     map[string]string{"multimedia:1": "549/1.jpg", "multimedia:2": "549/2.pdf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := session.New("549", "Ana", time.Now())
+			s.Metadata = tt.existing
+			addMetadata(s, tt.metadata)
+			if !reflect.DeepEqual(s.Metadata, tt.want) {
+				t.Errorf("metadatos = %v, se esperaba %v", s.Metadata, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleTextMessageNumberedOption(t *testing.T) {
+	phone := "5491100000000"
+	options := []session.Option{{ID: "categoria_1", Title: "Medicina"}, {ID: "categoria_2", Title: "Derecho"}}
+
+	tests := []struct {
+		name          string
+		format        string
+		text          string
+		wantText      string
+		wantSelection string
+	}{
+		{name: "texto numerado", format: session.OptionsFormatNumbered, text: " 2 ", wantText: "Derecho", wantSelection: "categoria_2"},
+		{name: "número fuera de rango", format: session.OptionsFormatNumbered, text: "3", wantText: "3"},
+		{name: "enviadas como botones", format: session.OptionsFormatButtons, text: "2", wantText: "2"},
+		{name: "enviadas como lista", format: session.OptionsFormatList, text: "1", wantText: "1"},
+		{name: "sesión sin formato", format: "", text: "1", wantText: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSessionStore(session.NewMemoryStore(session.Timeouts{}))
+			t.Cleanup(func() { SetSessionStore(nil) })
+
+			sess := session.New(phone, "Ana", time.Now())
+			sess.PendingQuestion, sess.PendingOptions, sess.PendingFormat = "¿Qué carrera te interesa?", options, tt.format
+			store, _ := getSessionStore()
+			if err := store.Create(context.Background(), sess); err != nil {
+				t.Fatal(err)
+			}
+
+			inbound := whatsapp.InboundMessage{Message: whatsapp.Message{From: phone, Type: whatsapp.MessageTypeText, Text: &whatsapp.Text{Body: tt.text}}}
+			handled, err := handleTextMessage(context.Background(), inbound)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if handled.Text != tt.wantText {
+				t.Errorf("texto = %q, se esperaba %q", handled.Text, tt.wantText)
+			}
+			var selection string
+			if handled.Selection != nil {
+				selection = handled.Selection.Id
+			}
+			if selection != tt.wantSelection {
+				t.Errorf("opción elegida = %q, se esperaba %q", selection, tt.wantSelection)
+			}
+		})
+	}
+}
+
+func TestOptionsFormat(t *testing.T) {
+	options := func(n int) []whatsapp.Option {
+		choices := make([]whatsapp.Option, n)
+		for i := range choices {
+			choices[i] = whatsapp.Option{ID: fmt.Sprintf("opcion_%d", i+1), Title: fmt.Sprintf("Opción %d", i+1)}
+		}
+		return choices
+	}
+
+	tests := []struct {
+		name    string
+		message *whatsapp.OutboundMessage
+		want    string
+	}{
+		{name: "botones", message: whatsapp.NewOptionsMessage("549", "¿Algo más?", options(2)), want: session.OptionsFormatButtons},
+		{name: "lista", message: whatsapp.NewOptionsMessage("549", "¿Algo más?", options(whatsapp.MaxReplyButtons+1)), want: session.OptionsFormatList},
+		{name: "texto numerado", message: whatsapp.NewOptionsMessage("549", "¿Algo más?", options(whatsapp.MaxListRows+1)), want: session.OptionsFormatNumbered},
+		{name: "sin mensaje", message: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := optionsFormat(tt.message); got != tt.want {
+				t.Errorf("optionsFormat() = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleInteractiveMessage(t *testing.T) {
+	type selectedOption struct{ ID, Title, Question string }
+	phone := "5491100000000"
+	question := "¿Qué carrera te interesa?"
+	options := []session.Option{{ID: "categoria_1", Title: "Ingeniería de Sistemas e Informática"}, {ID: "categoria_2", Title: "Derecho"}}
+
+	tests := []struct {
+		name          string
+		message       whatsapp.Message
+		wantNil       bool
+		wantSelection selectedOption
+	}{
+		{
+			name:          "botón de respuesta rápida",
+			message:       whatsapp.Message{Type: whatsapp.MessageTypeInteractive, Interactive: &whatsapp.Interactive{Type: "button_reply", ButtonReply: &whatsapp.InteractiveReply{ID: "categoria_2", Title: "Derecho"}}},
+			wantSelection: selectedOption{ID: "categoria_2", Title: "Derecho", Question: question},
+		},
+		{
+			name:          "fila de lista con título recortado",
+			message:       whatsapp.Message{Type: whatsapp.MessageTypeInteractive, Interactive: &whatsapp.Interactive{Type: "list_reply", ListReply: &whatsapp.InteractiveReply{ID: "categoria_1", Title: "Ingeniería de Sistemas…"}}},
+			wantSelection: selectedOption{ID: "categoria_1", Title: "Ingeniería de Sistemas e Informática", Question: question},
+		},
+		{
+			name:          "botón de plantilla",
+			message:       whatsapp.Message{Type: whatsapp.MessageTypeButton, Button: &whatsapp.Button{Payload: "retomar", Text: "Retomar conversación"}},
+			wantSelection: selectedOption{ID: "retomar", Title: "Retomar conversación", Question: question},
+		},
+		{
+			name:          "opción que no se envió",
+			message:       whatsapp.Message{Type: whatsapp.MessageTypeInteractive, Interactive: &whatsapp.Interactive{Type: "button_reply", ButtonReply: &whatsapp.InteractiveReply{ID: "otra", Title: "Otra"}}},
+			wantSelection: selectedOption{ID: "otra", Title: "Otra", Question: question},
+		},
+		{
+			name:    "sin opción reconocible",
+			message: whatsapp.Message{Type: whatsapp.MessageTypeInteractive, Interactive: &whatsapp.Interactive{Type: "nfm_reply"}},
+			wantNil: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetSessionStore(session.NewMemoryStore(session.Timeouts{}))
+			t.Cleanup(func() { SetSessionStore(nil) })
+
+			sess := session.New(phone, "Ana", time.Now())
+			sess.PendingQuestion, sess.PendingOptions, sess.PendingFormat = question, options, session.OptionsFormatList
+			store, _ := getSessionStore()
+			if err := store.Create(context.Background(), sess); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.message.From, tt.message.ID = phone, "wamid.1"
+			handled, err := handleInteractiveMessage(context.Background(), whatsapp.InboundMessage{Message: tt.message})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if handled != nil {
+					t.Errorf("se esperaba que la respuesta se ignorara, se obtuvo %+v", handled)
+				}
+				return
+			}
+			if handled == nil || handled.Selection == nil {
+				t.Fatalf("respuesta sin opción elegida: %+v", handled)
+			}
+			got := selectedOption{ID: handled.Selection.Id, Title: handled.Selection.Title, Question: handled.Selection.Question}
+			if got != tt.wantSelection {
+				t.Errorf("opción elegida = %+v, se esperaba %+v", got, tt.wantSelection)
+			}
+			if handled.Text != tt.wantSelection.Title || handled.Type != sessionTypeInteractive || !handled.Reply {
+				t.Errorf("mensaje = %+v", handled)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// go_app/controllers/outboundSender.go
+
+package controllers
+
+import (
+	"chatbot/initializers"
+	"chatbot/utils/outbound"
+	"chatbot/utils/whatsapp"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// outboundSender envía los mensajes salientes con reintentos, límite de tasa y outbox.
+var outboundSender *outbound.Sender
+
+// StartOutboundSender crea el remitente de mensajes salientes y lanza el reenvío de su outbox.
+func StartOutboundSender(ctx context.Context, rdb *redis.Client) *outbound.Sender {
+	rate, err := strconv.ParseFloat(initializers.GetEnvString("OUTBOUND_RATE_PER_SECOND", "80"), 64)
+	if err != nil {
+		rate = 80
+	}
+
+	outboundSender = outbound.NewSender(getWhatsAppClient(), rdb, outbound.Config{
+		OutboxKey:         initializers.GetEnvString("OUTBOUND_OUTBOX_KEY", "outbox"),
+		MaxAttempts:       initializers.GetEnvInt("OUTBOUND_MAX_ATTEMPTS", 3),
+		MaxOutboxAttempts: initializers.GetEnvInt("OUTBOUND_MAX_OUTBOX_ATTEMPTS", 10),
+		BaseDelay:         initializers.GetEnvDuration("OUTBOUND_BASE_DELAY", 500*time.Millisecond),
+		MaxDelay:          initializers.GetEnvDuration("OUTBOUND_MAX_DELAY", 30*time.Second),
+		RatePerSecond:     rate,
+		Burst:             initializers.GetEnvInt("OUTBOUND_BURST", 20),
+		PollInterval:      initializers.GetEnvDuration("OUTBOUND_POLL_INTERVAL", 5*time.Second),
+		Lease:             initializers.GetEnvDuration("OUTBOUND_LEASE", 2*time.Minute),
+	})
+	outboundSender.OnSent = func(message *whatsapp.OutboundMessage, messageID string) {
+		recordOutboundMessage(rdb, message.To, messageID, message.Type)
+	}
+	outboundSender.OnFailed = func(message *whatsapp.OutboundMessage, err error) {
+		if message.Type == whatsapp.MessageTypeTemplate {
+			clearReengagement(rdb, message)
+		}
+	}
+	outboundSender.Prepare = func(message *whatsapp.OutboundMessage) (*whatsapp.OutboundMessage, error) {
+		return prepareRedelivery(rdb, message)
+	}
+	outboundSender.Start(ctx)
+
+	templateLanguage = initializers.GetEnvString("TEMPLATE_LANGUAGE", templateLanguage)
+	return outboundSender
+}
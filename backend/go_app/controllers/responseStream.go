@@ -0,0 +1,162 @@
+// go_app/controllers/responseStream.go
+
+package controllers
+
+import (
+	"chatbot/logger"
+	"chatbot/utils"
+	"chatbot/utils/aibackend"
+	"chatbot/utils/outbound"
+	"chatbot/utils/whatsapp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	pb "chatbot/utils/proto"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// paragraphSeparator separa los párrafos que se envían como mensajes independientes.
+const paragraphSeparator = "\n\n"
+
+// paragraphBuffer acumula el texto recibido en streaming y entrega los párrafos a medida que se completan.
+// El texto que sigue a un separador "|||" del formato anterior no se entrega: es la pregunta de
+// seguimiento y las opciones, que se envían al final.
+type paragraphBuffer struct {
+	pending strings.Builder
+	stopped bool
+}
+
+// Write agrega un fragmento y devuelve los párrafos que quedaron completos.
+func (b *paragraphBuffer) Write(delta string) []string {
+	if b.stopped {
+		return nil
+	}
+	b.pending.WriteString(delta)
+	text := b.pending.String()
+
+	// Reservar lo que venga desde un separador "|||"; uno incompleto queda al final del texto pendiente
+	if index := strings.Index(text, legacyPartSeparator); index >= 0 {
+		b.stopped = true
+		b.pending.Reset()
+		return splitParagraphs(text[:index])
+	}
+	complete := strings.LastIndex(text, paragraphSeparator)
+	if complete < 0 {
+		return nil
+	}
+
+	b.pending.Reset()
+	b.pending.WriteString(text[complete+len(paragraphSeparator):])
+	return splitParagraphs(text[:complete])
+}
+
+// Flush devuelve el texto pendiente al terminar el streaming.
+func (b *paragraphBuffer) Flush() []string {
+	text := b.pending.String()
+	b.pending.Reset()
+	if b.stopped {
+		return nil
+	}
+	if index := strings.Index(text, legacyPartSeparator); index >= 0 {
+		text = text[:index]
+	}
+	return splitParagraphs(text)
+}
+
+// splitParagraphs divide el texto en párrafos descartando los vacíos.
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(text, paragraphSeparator) {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// generateResponseStream genera la respuesta con el RPC en streaming y llama a onParagraph con cada
+// párrafo completo a medida que llega. Devuelve la respuesta completa e indica si se entregó algún
+// párrafo durante el streaming. Si el servidor no implementa el streaming usa generateResponse.
+func generateResponseStream(ctx context.Context, ai *aibackend.Client, phone, threadID, messageBody string, selection *pb.SelectedOption, onParagraph func(string)) (*pb.GenerateResponseResponse, bool, error) {
+	request := &pb.GenerateResponseRequest{
+		Phone:          phone,
+		ThreadId:       threadID,
+		MessageBody:    messageBody,
+		SelectedOption: selection,
+	}
+
+	var (
+		buffer    paragraphBuffer
+		assembled strings.Builder
+		final     *pb.GenerateResponseResponse
+		received  bool
+		streamed  bool
+	)
+	deliver := func(paragraphs []string) {
+		for _, paragraph := range paragraphs {
+			streamed = true
+			onParagraph(paragraph)
+		}
+	}
+
+	err := ai.GenerateResponseStream(ctx, request, func(chunk *pb.GenerateResponseChunk) error {
+		received = true
+		assembled.WriteString(chunk.Delta)
+		deliver(buffer.Write(chunk.Delta))
+		if chunk.Final != nil {
+			final = chunk.Final
+		}
+		return nil
+	})
+	switch {
+	case status.Code(err) == codes.Unimplemented && !received:
+		logger.Log.Info("El servidor no implementa el streaming de respuestas, se usa GenerateResponse")
+		res, err := generateResponse(ctx, ai, phone, threadID, messageBody, selection)
+		return res, false, err
+	case err != nil && !streamed:
+		return nil, false, fmt.Errorf("fallo al recibir la respuesta en streaming: %w", err)
+	case err != nil:
+		// Los párrafos enviados ya no se pueden retirar; se conserva la respuesta parcial
+		logger.Log.Errorf("Streaming de la respuesta a %s interrumpido, se conserva la respuesta parcial: %v", phone, err)
+	}
+	deliver(buffer.Flush())
+
+	if final == nil {
+		// Servidor sin respuesta final: el texto acumulado sigue el formato anterior
+		final = &pb.GenerateResponseResponse{Response: assembled.String()}
+	}
+	return normalizeResponse(final), streamed, nil
+}
+
+// streamDelivery envía como mensajes de texto los párrafos recibidos en streaming. Un párrafo diferido
+// en el outbox no detiene el envío: los siguientes quedan en cola detrás de él. Tras un envío fallido
+// o si la ventana de 24 horas del usuario está cerrada deja de enviar.
+type streamDelivery struct {
+	redisConn    *redis.Client
+	phone        string
+	windowClosed bool
+	err          error
+}
+
+// Send envía un párrafo al usuario.
+func (d *streamDelivery) Send(paragraph string) {
+	if d.windowClosed || d.err != nil {
+		return
+	}
+	_, err := sendWhatsAppMessage(d.redisConn, whatsapp.NewTextMessage(d.phone, utils.ProcessTextForWhatsApp(paragraph)))
+	if errors.Is(err, outbound.ErrDeferred) {
+		logger.Log.Warnf("Párrafo de la respuesta a %s diferido en el outbox: %v", d.phone, err)
+		return
+	}
+	if errors.Is(err, errWindowClosed) {
+		logger.Log.Warnf("Respuesta a %s no enviada: %v", d.phone, err)
+		d.windowClosed = true
+		return
+	}
+	d.err = err
+}
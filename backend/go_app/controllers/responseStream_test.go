@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParagraphBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []string
+		// want son los párrafos entregados tras cada fragmento y, en el último elemento, por Flush.
+		want [][]string
+	}{
+		{
+			name:   "un párrafo entregado al final",
+			deltas: []string{"Hola, ", "¿cómo estás?"},
+			want:   [][]string{nil, nil, {"Hola, ¿cómo estás?"}},
+		},
+		{
+			name:   "párrafos a medida que se completan",
+			deltas: []string{"Primero.\n\nSegu", "ndo.\n", "\nTercero."},
+			want:   [][]string{{"Primero."}, nil, {"Segundo."}, {"Tercero."}},
+		},
+		{
+			name:   "varios párrafos en un fragmento",
+			deltas: []string{"Uno.\n\nDos.\n\n\n\nTres"},
+			want:   [][]string{{"Uno.", "Dos."}, {"Tres"}},
+		},
+		{
+			name:   "se detiene en el separador de la pregunta",
+			deltas: []string{"Respuesta.|||¿Pregunta?", "|||Sí|No"},
+			want:   [][]string{{"Respuesta."}, nil, nil},
+		},
+		{
+			name:   "separador partido entre fragmentos",
+			deltas: []string{"Respuesta.|", "|", "|¿Pregunta?"},
+			want:   [][]string{nil, nil, {"Respuesta."}, nil},
+		},
+		{
+			name:   "separador al final del fragmento",
+			deltas: []string{"Respuesta.\n\nFinal|||"},
+			want:   [][]string{{"Respuesta.", "Final"}, nil},
+		},
+		{
+			name:   "sin texto",
+			deltas: []string{"", "  \n\n  "},
+			want:   [][]string{nil, nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer paragraphBuffer
+			var got [][]string
+			for _, delta := range tt.deltas {
+				got = append(got, buffer.Write(delta))
+			}
+			got = append(got, buffer.Flush())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("párrafos = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+// go_app/controllers/sessionStore.go
+
+package controllers
+
+import (
+	"chatbot/logger"
+	"chatbot/utils/session"
+	"chatbot/utils/whatsapp"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	sessionStore      session.SessionStore
+	sessionStoreMutex sync.RWMutex
+)
+
+// SetSessionStore configura el almacén de las sesiones de los usuarios.
+func SetSessionStore(store session.SessionStore) {
+	sessionStoreMutex.Lock()
+	defer sessionStoreMutex.Unlock()
+	sessionStore = store
+}
+
+// getSessionStore devuelve el almacén configurado con SetSessionStore.
+func getSessionStore() (session.SessionStore, error) {
+	sessionStoreMutex.RLock()
+	defer sessionStoreMutex.RUnlock()
+	if sessionStore == nil {
+		return nil, errors.New("almacén de sesiones no configurado")
+	}
+	return sessionStore, nil
+}
+
+// errAlreadyRecorded indica que el mensaje ya se registró en la sesión en una entrega anterior.
+var errAlreadyRecorded = errors.New("el mensaje ya se registró en la sesión")
+
+// recordSessionMessage registra un mensaje del usuario en su sesión y la crea si no existe. Devuelve
+// la sesión resultante. Si el mensaje elige una opción, las opciones pendientes dejan de estarlo.
+// metadata se agrega a los metadatos de la sesión. El registro es idempotente por messageID: si una
+// entrega anterior del mensaje ya lo registró, devuelve la sesión sin modificarla.
+func recordSessionMessage(ctx context.Context, phone, name, messageID, message, messageType string, metadata map[string]string, newSession func() (*session.Session, error)) (*session.Session, bool, error) {
+	store, err := getSessionStore()
+	if err != nil {
+		return nil, false, err
+	}
+
+	sess, err := store.Update(ctx, phone, func(s *session.Session) error {
+		if s.HasRecorded(messageID) {
+			return errAlreadyRecorded
+		}
+		s.AddMessage(name, message, messageType, time.Now())
+		s.MarkRecorded(messageID)
+		if messageType == sessionTypeInteractive {
+			s.PendingQuestion, s.PendingOptions, s.PendingFormat = "", nil, ""
+		}
+		addMetadata(s, metadata)
+		return nil
+	})
+	if errors.Is(err, errAlreadyRecorded) {
+		logger.Log.Infof("El mensaje %s de %s ya está registrado en la sesión, se omite el registro", messageID, phone)
+		sess, err = store.Get(ctx, phone)
+	}
+	if err == nil {
+		return sess, false, nil
+	}
+	if !errors.Is(err, session.ErrNotFound) {
+		return nil, false, fmt.Errorf("fallo al actualizar la sesión: %w", err)
+	}
+
+	if sess, err = newSession(); err != nil || sess == nil {
+		return nil, false, err
+	}
+	sess.AddMessage(name, message, messageType, sess.StartTimestamp)
+	sess.MarkRecorded(messageID)
+	addMetadata(sess, metadata)
+	err = store.Create(ctx, sess)
+	if errors.Is(err, session.ErrExists) {
+		// Otro mensaje del usuario creó la sesión primero
+		return recordSessionMessage(ctx, phone, name, messageID, message, messageType, metadata, newSession)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("fallo al crear la sesión: %w", err)
+	}
+	return sess, true, nil
+}
+
+// addMetadata agrega los datos a los metadatos de la sesión.
+func addMetadata(s *session.Session, metadata map[string]string) {
+	if len(metadata) == 0 {
+		return
+	}
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]string, len(metadata))
+	}
+	for key, value := range metadata {
+		s.Metadata[key] = value
+	}
+}
+
+// recordReply agrega la respuesta del bot a la sesión del usuario. La respuesta reemplaza a la
+// pregunta de seguimiento anterior, por lo que sus opciones dejan de estar pendientes; si la respuesta
+// trae opciones se guardan después con savePendingOptions.
+func recordReply(phone, name, message string) error {
+	store, err := getSessionStore()
+	if err != nil {
+		return err
+	}
+	_, err = store.Update(ctx, phone, func(s *session.Session) error {
+		s.AddMessage(name, message, sessionTypeOutgoing, time.Now())
+		s.PendingQuestion, s.PendingOptions, s.PendingFormat = "", nil, ""
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fallo al actualizar la sesión de %s: %w", phone, err)
+	}
+	logger.Log.Infof("Sesión de %s actualizada", phone)
+	return nil
+}
+
+// savePendingOptions guarda en la sesión la pregunta de seguimiento, las opciones enviadas al usuario
+// y el formato en que se presentaron.
+func savePendingOptions(phone, question, format string, options []session.Option) error {
+	store, err := getSessionStore()
+	if err != nil {
+		return err
+	}
+	_, err = store.Update(ctx, phone, func(s *session.Session) error {
+		s.PendingQuestion, s.PendingOptions, s.PendingFormat = question, options, format
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fallo al guardar las opciones en la sesión de %s: %w", phone, err)
+	}
+	logger.Log.Infof("Opciones guardadas en la sesión de %s. Total de opciones: %d", phone, len(options))
+	return nil
+}
+
+// pendingOptions devuelve la última pregunta de seguimiento guardada en la sesión, sus opciones y el
+// formato en que se presentaron.
+func pendingOptions(ctx context.Context, phone string) (string, []session.Option, string, error) {
+	store, err := getSessionStore()
+	if err != nil {
+		return "", nil, "", err
+	}
+	sess, err := store.Get(ctx, phone)
+	if errors.Is(err, session.ErrNotFound) {
+		return "", nil, "", nil
+	}
+	if err != nil {
+		return "", nil, "", err
+	}
+	return sess.PendingQuestion, sess.PendingOptions, sess.PendingFormat, nil
+}
+
+// optionsFormat devuelve el formato en que el mensaje presenta las opciones.
+func optionsFormat(message *whatsapp.OutboundMessage) string {
+	if message == nil {
+		return ""
+	}
+	if message.Interactive != nil {
+		switch message.Interactive.Type {
+		case whatsapp.InteractiveTypeButton:
+			return session.OptionsFormatButtons
+		case whatsapp.InteractiveTypeList:
+			return session.OptionsFormatList
+		}
+		return ""
+	}
+	if message.Type == whatsapp.MessageTypeText {
+		return session.OptionsFormatNumbered
+	}
+	return ""
+}
+
+// setSessionThreads guarda en la sesión los hilos del asistente y del analizador, para las sesiones
+// que se crearon sin ellos mientras el servidor de IA no estaba disponible.
+func setSessionThreads(phone, threadID, threadAnalizer string) error {
+	store, err := getSessionStore()
+	if err != nil {
+		return err
+	}
+	_, err = store.Update(ctx, phone, func(s *session.Session) error {
+		s.Thread, s.ThreadAnalizer = threadID, threadAnalizer
+		return nil
+	})
+	return err
+}
+
+// lastInbound devuelve la hora del último mensaje recibido del usuario, o la hora cero si no tiene sesión.
+func lastInbound(phone string) (time.Time, error) {
+	store, err := getSessionStore()
+	if err != nil {
+		return time.Time{}, err
+	}
+	sess, err := store.Get(ctx, phone)
+	if errors.Is(err, session.ErrNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sess.LastInboundAt(), nil
+}
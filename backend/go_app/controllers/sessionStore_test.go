@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatbot/utils/session"
+)
+
+func TestRecordSessionMessageIdempotent(t *testing.T) {
+	SetSessionStore(session.NewMemoryStore(session.Timeouts{}))
+	t.Cleanup(func() { SetSessionStore(nil) })
+
+	ctx := context.Background()
+	phone := "5491100000000"
+	newSession := func() (*session.Session, error) { return session.New(phone, "Ana", time.Now()), nil }
+
+	deliveries := []struct {
+		name        string
+		messageID   string
+		text        string
+		wantCreated bool
+	}{
+		{name: "primer mensaje", messageID: "wamid.1", text: "hola", wantCreated: true},
+		{name: "reintento del primer mensaje", messageID: "wamid.1", text: "hola"},
+		{name: "segundo mensaje", messageID: "wamid.2", text: "¿precio?"},
+		{name: "reintento del segundo mensaje", messageID: "wamid.2", text: "¿precio?"},
+	}
+	for _, delivery := range deliveries {
+		sess, created, err := recordSessionMessage(ctx, phone, "Ana", delivery.messageID, delivery.text, sessionTypeIncoming, nil, newSession)
+		if err != nil {
+			t.Fatalf("%s: %v", delivery.name, err)
+		}
+		if sess == nil || created != delivery.wantCreated {
+			t.Errorf("%s: sesión = %v, creada = %v, se esperaba creada = %v", delivery.name, sess, created, delivery.wantCreated)
+		}
+	}
+
+	store, _ := getSessionStore()
+	sess, err := store.Get(ctx, phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sess.Messages) != 2 {
+		t.Fatalf("la sesión tiene %d mensajes, se esperaban 2: %+v", len(sess.Messages), sess.Messages)
+	}
+	if sess.Messages[0].Message != "hola" || sess.Messages[1].Message != "¿precio?" {
+		t.Errorf("mensajes = %+v", sess.Messages)
+	}
+}
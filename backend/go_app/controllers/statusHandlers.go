@@ -0,0 +1,152 @@
+// go_app/controllers/statusHandlers.go
+
+package controllers
+
+import (
+	"chatbot/logger"
+	db "chatbot/utils/db"
+	"chatbot/utils/events"
+	"chatbot/utils/whatsapp"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// messageStatusTTL es el tiempo durante el cual se conservan los estados de los mensajes de una conversación.
+var messageStatusTTL = 7 * 24 * time.Hour
+
+// processStatusUpdates guarda cada actualización de estado del webhook contra el mensaje saliente
+// y publica un evento por cada mensaje fallido.
+func processStatusUpdates(ctx context.Context, payload *whatsapp.WebhookPayload) error {
+	redisConn, err := db.GetRedisConn()
+	if err != nil {
+		return fmt.Errorf("fallo al obtener conexión a Redis: %w", err)
+	}
+
+	var failed int
+	for _, status := range payload.Statuses() {
+		update := db.MessageStatus{
+			MessageID: status.ID,
+			Phone:     status.RecipientID,
+			Status:    status.Status,
+			UpdatedAt: status.Time().Format(time.RFC3339Nano),
+		}
+		if len(status.Errors) > 0 {
+			update.ErrorCode = status.Errors[0].Code
+			update.ErrorTitle = status.Errors[0].Title
+			if status.Errors[0].ErrorData != nil {
+				update.ErrorDetails = status.Errors[0].ErrorData.Details
+			}
+		}
+
+		applied, err := db.UpdateMessageStatus(ctx, redisConn, update, messageStatusTTL)
+		if err != nil {
+			failed++
+			continue
+		}
+		logger.Log.Infof("Estado %s recibido para el mensaje %s de %s", status.Status, status.ID, status.RecipientID)
+
+		// Publicar solo la primera vez para no repetir eventos en las entregas reintentadas
+		if applied && update.Status == db.MessageStatusFailed {
+			publishFailedMessage(update, status.Time())
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("fallaron %d actualizaciones de estado", failed)
+	}
+	return nil
+}
+
+// publishFailedMessage publica el evento de mensaje fallido y, según el código de error, su evento específico.
+func publishFailedMessage(status db.MessageStatus, timestamp time.Time) {
+	logger.Log.Warnf("Mensaje %s a %s fallido con código %d: %s", status.MessageID, status.Phone, status.ErrorCode, status.ErrorTitle)
+
+	event := events.Event{
+		Name:      events.MessageFailed,
+		Phone:     status.Phone,
+		MessageID: status.MessageID,
+		Code:      status.ErrorCode,
+		Title:     status.ErrorTitle,
+		Details:   status.ErrorDetails,
+		Timestamp: timestamp,
+	}
+	events.Publish(event)
+
+	switch status.ErrorCode {
+	case whatsapp.ErrorCodeWindowClosed:
+		event.Name = events.WindowClosed
+		events.Publish(event)
+	case whatsapp.ErrorCodeUndeliverable:
+		event.Name = events.UserBlocked
+		events.Publish(event)
+	}
+}
+
+// sendWhatsAppMessage envía un mensaje y lo registra para asociarle sus estados. Si el remitente está
+// iniciado el envío se reintenta y, ante errores transitorios, el mensaje queda diferido en el outbox
+// devolviendo un error que envuelve outbound.ErrDeferred. Si la ventana de 24 horas del usuario está
+// cerrada, en lugar del mensaje se envía la plantilla de reenganche y se devuelve un error que envuelve
+// errWindowClosed.
+func sendWhatsAppMessage(redisConn *redis.Client, message *whatsapp.OutboundMessage) (string, error) {
+	if message.Type != whatsapp.MessageTypeTemplate {
+		open, err := isWindowOpen(message.To)
+		if err != nil {
+			return "", err
+		}
+		if !open {
+			return "", sendReengagement(redisConn, message.To)
+		}
+	}
+	return deliverWhatsAppMessage(redisConn, message)
+}
+
+// deliverWhatsAppMessage envía un mensaje sin comprobar la ventana de 24 horas.
+func deliverWhatsAppMessage(redisConn *redis.Client, message *whatsapp.OutboundMessage) (string, error) {
+	if outboundSender != nil {
+		return outboundSender.Send(ctx, message)
+	}
+
+	response, err := getWhatsAppClient().Send(ctx, message)
+	if err != nil {
+		return "", err
+	}
+	messageID := response.MessageID()
+	recordOutboundMessage(redisConn, message.To, messageID, message.Type)
+	return messageID, nil
+}
+
+// recordOutboundMessage registra un mensaje enviado para asociarle las actualizaciones de estado.
+func recordOutboundMessage(redisConn *redis.Client, phone, messageID, messageType string) {
+	if messageID == "" {
+		logger.Log.Warnf("La Graph API no devolvió id para el mensaje de tipo %s enviado a %s", messageType, phone)
+		return
+	}
+	if err := db.RegisterOutboundMessage(ctx, redisConn, phone, messageID, messageType, messageStatusTTL); err != nil {
+		logger.Log.Errorf("Error al registrar el mensaje %s enviado a %s: %v", messageID, phone, err)
+	}
+}
+
+// GetConversationStatuses devuelve el estado de entrega de los mensajes enviados a un teléfono.
+func GetConversationStatuses(c *gin.Context) {
+	phone := c.Param("phone")
+
+	redisConn, err := db.GetRedisConn()
+	if err != nil {
+		logger.Log.Errorf("Error al obtener conexión a Redis: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener conexión a Redis"})
+		return
+	}
+
+	statuses, err := db.GetConversationStatuses(c.Request.Context(), redisConn, phone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al recuperar los estados de los mensajes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"phone": phone, "statuses": statuses})
+}
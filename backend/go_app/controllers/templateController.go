@@ -0,0 +1,127 @@
+// go_app/controllers/templateController.go
+
+package controllers
+
+import (
+	"chatbot/initializers"
+	"chatbot/logger"
+	"chatbot/models"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListTemplates devuelve las plantillas registradas, opcionalmente filtradas por propósito.
+func ListTemplates(c *gin.Context) {
+	var plantillas []models.PlantillaMensaje
+	query := initializers.DB.Order("proposito, nombre, idioma")
+	if proposito := c.Query("proposito"); proposito != "" {
+		query = query.Where("proposito = ?", proposito)
+	}
+	if err := query.Find(&plantillas).Error; err != nil {
+		logger.Log.Errorf("Error al listar plantillas: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al listar plantillas"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plantillas": plantillas})
+}
+
+// CreateTemplate registra una nueva plantilla.
+func CreateTemplate(c *gin.Context) {
+	var plantilla models.PlantillaMensaje
+	if err := c.ShouldBindJSON(&plantilla); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitud inválida"})
+		return
+	}
+	if msg := validateTemplate(&plantilla); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := initializers.DB.Create(&plantilla).Error; err != nil {
+		logger.Log.Errorf("Error al crear la plantilla %s: %v", plantilla.Nombre, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear la plantilla"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"plantilla": plantilla})
+}
+
+// UpdateTemplate reemplaza los datos de una plantilla existente.
+func UpdateTemplate(c *gin.Context) {
+	plantilla, ok := findTemplate(c)
+	if !ok {
+		return
+	}
+
+	var request models.PlantillaMensaje
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Solicitud inválida"})
+		return
+	}
+	if msg := validateTemplate(&request); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	plantilla.Nombre = request.Nombre
+	plantilla.Idioma = request.Idioma
+	plantilla.Proposito = request.Proposito
+	plantilla.Componentes = request.Componentes
+	plantilla.MapeoVariables = request.MapeoVariables
+	plantilla.EsActivo = request.EsActivo
+
+	if err := initializers.DB.Save(plantilla).Error; err != nil {
+		logger.Log.Errorf("Error al actualizar la plantilla %d: %v", plantilla.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la plantilla"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plantilla": plantilla})
+}
+
+// DeleteTemplate elimina una plantilla.
+func DeleteTemplate(c *gin.Context) {
+	plantilla, ok := findTemplate(c)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Delete(plantilla).Error; err != nil {
+		logger.Log.Errorf("Error al eliminar la plantilla %d: %v", plantilla.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar la plantilla"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Plantilla eliminada"})
+}
+
+// findTemplate busca la plantilla del parámetro id y responde 404 si no existe.
+func findTemplate(c *gin.Context) (*models.PlantillaMensaje, bool) {
+	var plantilla models.PlantillaMensaje
+	err := initializers.DB.First(&plantilla, c.Param("id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plantilla no encontrada"})
+		return nil, false
+	}
+	if err != nil {
+		logger.Log.Errorf("Error al buscar la plantilla %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar la plantilla"})
+		return nil, false
+	}
+	return &plantilla, true
+}
+
+// validateTemplate verifica los campos obligatorios y el JSON de componentes y variables.
+// Devuelve el mensaje de error o una cadena vacía si la plantilla es válida.
+func validateTemplate(plantilla *models.PlantillaMensaje) string {
+	if plantilla.Nombre == "" || plantilla.Idioma == "" || plantilla.Proposito == "" {
+		return "nombre, idioma y proposito son obligatorios"
+	}
+	if _, err := plantilla.GetComponentes(); err != nil {
+		return "componentes no es un JSON válido"
+	}
+	if _, err := plantilla.GetMapeoVariables(); err != nil {
+		return "mapeo_variables no es un JSON válido"
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+// go_app/controllers/templateSender.go
+
+package controllers
+
+import (
+	"chatbot/initializers"
+	"chatbot/logger"
+	"chatbot/models"
+	db "chatbot/utils/db"
+	"chatbot/utils/outbound"
+	"chatbot/utils/whatsapp"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// customerServiceWindow es el tiempo tras el último mensaje del usuario durante el cual se le puede
+// escribir libremente. Fuera de la ventana Meta solo acepta plantillas aprobadas.
+const customerServiceWindow = 24 * time.Hour
+
+// templateLanguage es el idioma preferido al elegir una plantilla.
+var templateLanguage = "es"
+
+// reengagementKeyPrefix es el prefijo de la clave que recuerda que ya se envió la plantilla de
+// reenganche a un usuario, para enviarla una sola vez por ventana aunque haya varios mensajes pendientes.
+const reengagementKeyPrefix = "plantilla:reenganche:"
+
+// clearReengagementScript elimina la marca KEYS[1] solo si sigue siendo de la plantilla ARGV[1].
+var clearReengagementScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// errWindowClosed indica que el mensaje no se envió porque la ventana de 24 horas del usuario está
+// cerrada. Quien lo recibe no debe enviar el resto de la respuesta.
+var errWindowClosed = errors.New("la ventana de 24 horas está cerrada")
+
+// isWindowOpen indica si la ventana de atención de 24 horas del usuario sigue abierta según el último
+// mensaje recibido registrado en su sesión.
+func isWindowOpen(phone string) (bool, error) {
+	last, err := lastInbound(phone)
+	if err != nil {
+		return false, fmt.Errorf("fallo al obtener el último mensaje recibido de %s: %w", phone, err)
+	}
+	return !last.IsZero() && time.Since(last) < customerServiceWindow, nil
+}
+
+// sendOrTemplate envía el mensaje si la ventana de atención está abierta. Si está cerrada envía en su
+// lugar la plantilla activa del propósito indicado, completando sus variables con variables.
+func sendOrTemplate(redisConn *redis.Client, message *whatsapp.OutboundMessage, proposito string, variables map[string]string) (string, error) {
+	open, err := isWindowOpen(message.To)
+	if err != nil {
+		return "", err
+	}
+	if open {
+		return deliverWhatsAppMessage(redisConn, message)
+	}
+
+	plantilla, err := db.FindActiveTemplate(initializers.DB, proposito, templateLanguage)
+	if err != nil {
+		return "", fmt.Errorf("la ventana de 24 horas de %s está cerrada y no hay plantilla activa para %s: %w", message.To, proposito, err)
+	}
+
+	templateMessage, err := buildTemplateMessage(message.To, plantilla, variables)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Log.Infof("Ventana de 24 horas cerrada para %s, se envía la plantilla %s (%s)", message.To, plantilla.Nombre, plantilla.Idioma)
+	return deliverWhatsAppMessage(redisConn, templateMessage)
+}
+
+// reengagementMessage devuelve la plantilla de reenganche para escribir al usuario con la ventana de
+// 24 horas cerrada, o nil si ya se le envió una en las últimas 24 horas. La marca que evita repetirla
+// se guarda antes del envío para que dos mensajes pendientes no la envíen a la vez; si el envío falla
+// de forma permanente se elimina con clearReengagement.
+func reengagementMessage(redisConn *redis.Client, phone string) (*whatsapp.OutboundMessage, error) {
+	plantilla, err := db.FindActiveTemplate(initializers.DB, models.PropositoReenganche, templateLanguage)
+	if err != nil {
+		return nil, fmt.Errorf("no hay plantilla activa para %s: %w", models.PropositoReenganche, err)
+	}
+	templateMessage, err := buildTemplateMessage(phone, plantilla, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := redisConn.SetNX(ctx, reengagementKeyPrefix+phone, plantilla.Nombre, customerServiceWindow).Result()
+	if err != nil {
+		return nil, fmt.Errorf("fallo al registrar la plantilla de reenganche de %s: %w", phone, err)
+	}
+	if !first {
+		return nil, nil
+	}
+	logger.Log.Infof("Ventana de 24 horas cerrada para %s, se envía la plantilla %s (%s)", phone, plantilla.Nombre, plantilla.Idioma)
+	return templateMessage, nil
+}
+
+// sendReengagement envía la plantilla de reenganche en lugar de un mensaje que ya no se puede enviar
+// porque la ventana de 24 horas del usuario está cerrada. Devuelve siempre un error que envuelve
+// errWindowClosed, junto con el error del envío de la plantilla si falla.
+func sendReengagement(redisConn *redis.Client, phone string) error {
+	templateMessage, err := reengagementMessage(redisConn, phone)
+	if err != nil {
+		return fmt.Errorf("%w para %s y %v", errWindowClosed, phone, err)
+	}
+	if templateMessage == nil {
+		return fmt.Errorf("%w para %s y ya se envió la plantilla de reenganche", errWindowClosed, phone)
+	}
+	if _, err := deliverWhatsAppMessage(redisConn, templateMessage); err != nil && !errors.Is(err, outbound.ErrDeferred) {
+		clearReengagement(redisConn, templateMessage)
+		return fmt.Errorf("%w para %s y falló el envío de la plantilla de reenganche: %v", errWindowClosed, phone, err)
+	}
+	return fmt.Errorf("%w para %s, se envió la plantilla de reenganche", errWindowClosed, phone)
+}
+
+// clearReengagement elimina la marca de la plantilla de reenganche enviada al usuario cuando su envío
+// falla, para que el próximo mensaje pueda volver a enviarla. No hace nada si la marca es de otra
+// plantilla.
+func clearReengagement(redisConn *redis.Client, message *whatsapp.OutboundMessage) {
+	if message.Template == nil {
+		return
+	}
+	if err := clearReengagementScript.Run(ctx, redisConn, []string{reengagementKeyPrefix + message.To}, message.Template.Name).Err(); err != nil {
+		logger.Log.Errorf("Error al eliminar la marca de la plantilla de reenganche de %s: %v", message.To, err)
+	}
+}
+
+// prepareRedelivery comprueba la ventana de 24 horas antes de reenviar un mensaje desde el outbox. Si
+// está cerrada lo reemplaza por la plantilla de reenganche o, si ya se envió, lo descarta.
+func prepareRedelivery(redisConn *redis.Client, message *whatsapp.OutboundMessage) (*whatsapp.OutboundMessage, error) {
+	if message.Type == whatsapp.MessageTypeTemplate {
+		return message, nil
+	}
+	open, err := isWindowOpen(message.To)
+	if err != nil || open {
+		return message, err
+	}
+	return reengagementMessage(redisConn, message.To)
+}
+
+// buildTemplateMessage construye el mensaje de una plantilla reemplazando cada variable de sus
+// componentes por el valor indicado o, si falta, por su valor por defecto.
+func buildTemplateMessage(phone string, plantilla *models.PlantillaMensaje, variables map[string]string) (*whatsapp.OutboundMessage, error) {
+	componentes, err := plantilla.GetComponentes()
+	if err != nil {
+		return nil, fmt.Errorf("componentes inválidos en la plantilla %s: %w", plantilla.Nombre, err)
+	}
+	defaults, err := plantilla.GetMapeoVariables()
+	if err != nil {
+		return nil, fmt.Errorf("mapeo de variables inválido en la plantilla %s: %w", plantilla.Nombre, err)
+	}
+
+	components := make([]whatsapp.TemplateComponent, 0, len(componentes))
+	for _, componente := range componentes {
+		component := whatsapp.TemplateComponent{Type: componente.Tipo, SubType: componente.SubTipo, Index: componente.Indice}
+		for _, variable := range componente.Variables {
+			value, ok := variables[variable]
+			if !ok || value == "" {
+				value = defaults[variable]
+			}
+			if value == "" {
+				return nil, fmt.Errorf("la variable %s de la plantilla %s no tiene valor", variable, plantilla.Nombre)
+			}
+
+			parameter := whatsapp.TemplateParameter{Type: "text", Text: value}
+			if componente.Tipo == "button" && componente.SubTipo == "quick_reply" {
+				parameter = whatsapp.TemplateParameter{Type: "payload", Payload: value}
+			}
+			component.Parameters = append(component.Parameters, parameter)
+		}
+		components = append(components, component)
+	}
+
+	return whatsapp.NewTemplateMessage(phone, plantilla.Nombre, plantilla.Idioma, components...), nil
+}
+
+// NotifyInactiveUser avisa al usuario que su sesión se cerró por inactividad, usando la plantilla de
+// inactividad si su ventana de 24 horas ya se cerró.
+func NotifyInactiveUser(phone, name string) {
+	redisConn, err := db.GetRedisConn()
+	if err != nil {
+		logger.Log.Errorf("Error al obtener conexión a Redis: %v", err)
+		return
+	}
+
+	message := whatsapp.NewTextMessage(phone, "Tu sesión ha sido cerrada debido a inactividad. Si necesitas algo más, escríbenos nuevamente.")
+	if _, err := sendOrTemplate(redisConn, message, models.PropositoInactividad, map[string]string{"nombre": name}); err != nil {
+		logger.Log.Errorf("Error al notificar la inactividad a %s: %v", phone, err)
+	}
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatbot/utils/redistest"
+	"chatbot/utils/session"
+	"chatbot/utils/whatsapp"
+)
+
+func TestIsWindowOpen(t *testing.T) {
+	store := session.NewMemoryStore(session.Timeouts{})
+	SetSessionStore(store)
+	t.Cleanup(func() { SetSessionStore(nil) })
+
+	tests := []struct {
+		name        string
+		lastInbound time.Duration
+		noSession   bool
+		want        bool
+	}{
+		{name: "sin sesión", noSession: true, want: false},
+		{name: "mensaje reciente", lastInbound: time.Minute, want: true},
+		{name: "casi 24 horas", lastInbound: customerServiceWindow - time.Minute, want: true},
+		{name: "más de 24 horas", lastInbound: customerServiceWindow + time.Minute, want: false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phone := "54911000000" + string(rune('0'+i))
+			if !tt.noSession {
+				at := time.Now().Add(-tt.lastInbound)
+				sess := session.New(phone, "Ana", at)
+				sess.AddMessage("Ana", "hola", sessionTypeIncoming, at)
+				if err := store.Create(context.Background(), sess); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			open, err := isWindowOpen(phone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if open != tt.want {
+				t.Errorf("isWindowOpen() = %v, se esperaba %v", open, tt.want)
+			}
+		})
+	}
+}
+
+func TestClearReengagement(t *testing.T) {
+	rdb := redistest.New(t)
+	phone := "5491100000000"
+
+	tests := []struct {
+		name     string
+		marked   string
+		template string
+		wantKept bool
+	}{
+		{name: "misma plantilla", marked: "reenganche_v1", template: "reenganche_v1", wantKept: false},
+		{name: "otra plantilla", marked: "reenganche_v2", template: "reenganche_v1", wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := reengagementKeyPrefix + phone
+			if err := rdb.Set(ctx, key, tt.marked, customerServiceWindow).Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			clearReengagement(rdb, whatsapp.NewTemplateMessage(phone, tt.template, "es"))
+
+			exists, err := rdb.Exists(ctx, key).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (exists == 1) != tt.wantKept {
+				t.Errorf("marca conservada = %v, se esperaba %v", exists == 1, tt.wantKept)
+			}
+		})
+	}
+}
@@ -3,24 +3,26 @@
 package controllers
 
 import (
-	"bytes"
 	"chatbot/logger"
 	"chatbot/utils"
+	"chatbot/utils/aibackend"
 	db "chatbot/utils/db"
+	"chatbot/utils/events"
+	"chatbot/utils/outbound"
 	pb "chatbot/utils/proto"
+	"chatbot/utils/session"
+	"chatbot/utils/whatsapp"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-	"google.golang.org/grpc"
 )
 
 var ctx = context.Background()
@@ -44,7 +46,6 @@ func WebhookGet(c *gin.Context) {
 // WebhookPost maneja las solicitudes entrantes del webhook de WhatsApp.
 func WebhookPost(c *gin.Context) {
 	logger.Log.Info("Recibida solicitud POST para el webhook")
-	var jsonBody map[string]interface{}
 
 	body, exists := c.Get("body")
 	if !exists {
@@ -53,156 +54,452 @@ func WebhookPost(c *gin.Context) {
 		return
 	}
 
-	if err := json.Unmarshal(body.([]byte), &jsonBody); err != nil {
+	// Meta reintenta toda respuesta que no sea 2xx, por lo que los eventos sin nada que procesar se
+	// responden con 200; solo un cuerpo que no es JSON válido se rechaza
+	payload, err := whatsapp.DecodeWebhook(body.([]byte))
+	if errors.Is(err, whatsapp.ErrNotWhatsApp) || errors.Is(err, whatsapp.ErrNoEntries) {
+		logger.Log.Warnf("Evento del webhook ignorado: %v", err)
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
+	if err != nil {
 		logger.Log.Error("Error al deserializar JSON:", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON inválido"})
 		return
 	}
 
-	if utils.IsWhatsAppStatusUpdate(jsonBody) {
-		logger.Log.Info("Recibida actualización de estado de WhatsApp")
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	if !utils.IsWhatsAppStatusUpdate(payload) && !utils.IsValidWhatsAppMessage(payload) {
+		logger.Log.Warn("Evento del webhook ignorado: no contiene mensajes ni actualizaciones de estado")
+		c.JSON(http.StatusOK, gin.H{"status": "ignored"})
+		return
+	}
+
+	// Encolar la entrega para procesarla de forma asíncrona y responder a Meta de inmediato
+	id, err := webhookQueue.Enqueue(c.Request.Context(), body.([]byte))
+	if err != nil {
+		logger.Log.Errorf("Error al encolar la entrega del webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "No se pudo encolar el evento"})
+		return
+	}
+
+	logger.Log.Infof("Entrega del webhook encolada con id %s", id)
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Estados posibles del procesamiento de un mensaje entrante.
+const (
+	outcomeProcessed = "procesado"
+	outcomeIgnored   = "ignorado"
+	outcomeDuplicate = "duplicado"
+	outcomeFailed    = "error"
+)
+
+// messageDedupTTL es el tiempo durante el cual se recuerda el id de un mensaje ya procesado.
+var messageDedupTTL = 24 * time.Hour
+
+// messageClaimTTL es el tiempo durante el cual una entrega se reserva un mensaje mientras lo procesa.
+// Si la instancia se cae, otra entrega del mismo mensaje puede procesarlo cuando vence.
+var messageClaimTTL = 10 * time.Minute
+
+// messageOutcome describe el resultado del procesamiento de un mensaje dentro de un lote.
+type messageOutcome struct {
+	MessageID string `json:"message_id"`
+	Phone     string `json:"phone"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// dispatchWebhookMessages encola cada mensaje de la entrega del webhook en la cola de su conversación
+// y llama a done con el resultado individual de cada uno cuando todos terminan.
+// Los mensajes de un mismo teléfono se procesan uno tras otro en orden de llegada.
+func dispatchWebhookMessages(deliveryID string, messages []whatsapp.InboundMessage, done func([]messageOutcome)) {
+	outcomes := make([]messageOutcome, len(messages))
+	if len(messages) == 0 {
+		done(outcomes)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(messages))
+	for i, inbound := range messages {
+		i, inbound := i, inbound
+		conversationExecutor.Submit(inbound.Phone(), func() {
+			processUniqueMessage(deliveryID, inbound, func(status string, err error) {
+				defer wg.Done()
+				outcome := messageOutcome{MessageID: inbound.Message.ID, Phone: inbound.Phone()}
+				if err != nil {
+					logger.Log.Errorf("Error al procesar mensaje %s de %s: %v", inbound.Message.ID, inbound.Phone(), err)
+					outcome.Status = outcomeFailed
+					outcome.Error = err.Error()
+				} else {
+					outcome.Status = status
+				}
+				outcomes[i] = outcome
+			})
+		})
+	}
+
+	go func() {
+		wg.Wait()
+		logger.Log.Infof("Lote del webhook procesado. Total de mensajes: %d", len(outcomes))
+		done(outcomes)
+	}()
+}
+
+// processUniqueMessage descarta las entregas repetidas de un mensaje ya procesado usando su id de
+// WhatsApp. Mientras se procesa, el mensaje queda reservado para la entrega deliveryID, que puede
+// retomarlo si la cola la vuelve a entregar. Llama a done con el estado del procesamiento cuando
+// termina el turno del que forma parte el mensaje.
+func processUniqueMessage(deliveryID string, inbound whatsapp.InboundMessage, done func(string, error)) {
+	redisConn, err := db.GetRedisConn()
+	if err != nil {
+		done("", fmt.Errorf("fallo al obtener conexión a Redis: %w", err))
 		return
 	}
 
-	if utils.IsValidWhatsAppMessage(jsonBody) {
-		logger.Log.Info("Procesando mensaje de WhatsApp")
-		if err := processWhatsAppMessage(jsonBody); err != nil {
-			logger.Log.Error("Error al procesar mensaje de WhatsApp:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": "Error al procesar el mensaje"})
+	messageID := inbound.Message.ID
+	claim, err := db.ClaimMessage(ctx, redisConn, messageID, deliveryID, messageClaimTTL)
+	if err != nil {
+		done("", fmt.Errorf("fallo al verificar duplicado del mensaje %s: %w", messageID, err))
+		return
+	}
+	switch claim {
+	case db.ClaimProcessed:
+		total, _ := db.CountDuplicateMessage(ctx, redisConn)
+		logger.Log.Warnf("Mensaje duplicado %s de %s descartado. Total de duplicados: %d", messageID, inbound.Phone(), total)
+		done(outcomeDuplicate, nil)
+		return
+	case db.ClaimInProgress:
+		// Otra entrega lo está procesando; si falla o se cae, el reintento de esta lo procesará
+		done("", fmt.Errorf("el mensaje %s lo está procesando otra entrega", messageID))
+		return
+	}
+
+	processWhatsAppMessage(inbound, func(processed bool, err error) {
+		if err != nil {
+			// Liberar el registro para que el reintento de la entrega vuelva a procesar el mensaje
+			db.ReleaseMessage(ctx, redisConn, messageID, deliveryID)
+			done("", err)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	} else {
-		logger.Log.Warn("El evento recibido no es un mensaje válido de WhatsApp")
-		c.JSON(http.StatusNotFound, gin.H{"status": "error", "message": "No es un evento de la API de WhatsApp"})
-	}
+		db.CompleteMessage(ctx, redisConn, messageID, messageDedupTTL)
+
+		if !processed {
+			done(outcomeIgnored, nil)
+			return
+		}
+		done(outcomeProcessed, nil)
+	})
 }
 
-// processWhatsAppMessage procesa el mensaje de WhatsApp.
-func processWhatsAppMessage(body map[string]interface{}) error {
+// processWhatsAppMessage registra un mensaje de WhatsApp en la sesión y lo agrega al turno abierto
+// del usuario. done se llama cuando se responde el turno; processed es false si el mensaje fue ignorado.
+func processWhatsAppMessage(inbound whatsapp.InboundMessage, done func(processed bool, err error)) {
 	logger.Log.Info("Iniciando procesamiento del mensaje de WhatsApp")
 
-	// Extraer datos del mensaje
-	phone, name, messageBody, err := extractMessageData(body)
+	turn, handled, err := recordWhatsAppMessage(inbound)
+	if whatsapp.IsInvalidMessage(err) {
+		// Un reintento no puede corregir un mensaje mal formado: se descarta como ignorado
+		logger.Log.Warnf("Mensaje %s de %s descartado por inválido: %v", inbound.Message.ID, inbound.Phone(), err)
+		done(false, nil)
+		return
+	}
 	if err != nil {
-		return fmt.Errorf("fallo al extraer datos del mensaje: %w", err)
+		done(false, err)
+		return
+	}
+	if handled == nil {
+		done(false, nil)
+		return
 	}
 
-	if messageBody == "" {
-		logger.Log.Warn("Recibido mensaje de WhatsApp con texto vacío")
-		return nil
+	// Confirmar la lectura y mostrar que el bot está escribiendo mientras se completa el turno
+	markAsRead(turn.Phone, inbound.Message.ID, handled.Reply)
+
+	if !handled.Reply {
+		logger.Log.Infof("Mensaje de tipo %s registrado en la sesión sin generar respuesta", handled.Type)
+		done(true, nil)
+		return
 	}
 
-	// Obtener conexión a Redis
-	redisConn, err := db.GetRedisConn()
+	turnDebouncer.Add(turn, pendingMessage{
+		MessageID: inbound.Message.ID,
+		Text:      handled.Text,
+		Selection: handled.Selection,
+		done:      func(err error) { done(err == nil, err) },
+	})
+}
+
+// recordWhatsAppMessage interpreta un mensaje de WhatsApp y lo guarda en la sesión del usuario,
+// creando los hilos si es su primer mensaje. Devuelve un handledMessage nil si el mensaje fue ignorado.
+func recordWhatsAppMessage(inbound whatsapp.InboundMessage) (*conversationTurn, *handledMessage, error) {
+	// Extraer datos del mensaje
+	phone, name, err := extractMessageData(inbound)
 	if err != nil {
-		return fmt.Errorf("fallo al obtener conexión a Redis: %w", err)
+		return nil, nil, fmt.Errorf("fallo al extraer datos del mensaje: %w", err)
 	}
 
-	// Construir la clave de la sesión en Redis
-	sessionKey := "usuario:" + phone
-	logger.Log.Infof("Clave de sesión: %v", sessionKey)
-
-	// Verificar si la sesión existe en Redis
-	exists, sessionDataRaw, err := db.SessionKeyExists(ctx, redisConn, sessionKey)
+	// Interpretar el mensaje según su tipo
+	handled, err := handleInboundMessage(ctx, inbound)
 	if err != nil {
-		return fmt.Errorf("fallo al verificar la clave de sesión en Redis: %w", err)
+		return nil, nil, fmt.Errorf("fallo al manejar mensaje de tipo %s: %w", inbound.Message.Type, err)
+	}
+	if handled == nil {
+		return nil, nil, nil
 	}
 
-	var threadID, threadIDAnalizer string
-	if !exists {
+	messageBody := handled.Text
+	if messageBody == "" {
+		logger.Log.Warn("Recibido mensaje de WhatsApp con texto vacío")
+		return nil, nil, nil
+	}
+
+	// Registrar el mensaje en la sesión; si el usuario no tiene sesión se crea con sus hilos
+	sess, created, err := recordSessionMessage(ctx, phone, name, inbound.Message.ID, messageBody, handled.Type, handled.Metadata, func() (*session.Session, error) {
+		if !handled.Reply {
+			logger.Log.Infof("Mensaje de tipo %s sin sesión activa para %s, se omite", handled.Type, phone)
+			return nil, nil
+		}
 		logger.Log.Info("Usuario no encontrado, creando nuevos hilos en OpenAI")
-		threadID, threadIDAnalizer, err = createNewThreads()
+		ai, err := getAIBackend()
 		if err != nil {
-			return fmt.Errorf("fallo al crear nuevos hilos: %w", err)
+			return nil, err
+		}
+		threadID, threadIDAnalizer, err := createNewThreads(ai)
+		if aibackend.IsUnavailable(err) {
+			// La sesión se crea sin hilos; se crearán al responder el turno cuando el servidor se recupere
+			logger.Log.Warnf("Servidor de IA no disponible, la sesión de %s se crea sin hilos: %v", phone, err)
+			threadID, threadIDAnalizer, err = "", "", nil
 		}
-		db.CreateSession(ctx, redisConn, name, phone, threadID, messageBody, threadIDAnalizer)
+		if err != nil {
+			return nil, fmt.Errorf("fallo al crear nuevos hilos: %w", err)
+		}
+		newSession := session.New(phone, name, time.Now())
+		newSession.Thread, newSession.ThreadAnalizer = threadID, threadIDAnalizer
+		return newSession, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if sess == nil {
+		return nil, nil, nil
+	}
+	if created {
 		logger.Log.Info("Nueva sesión creada en Redis")
 	} else {
-		logger.Log.Info("Usuario encontrado en Redis")
-		threadID, threadIDAnalizer = retrieveThreads(sessionDataRaw)
-		db.UpdateSession(ctx, redisConn, name, phone, messageBody, "incoming")
 		logger.Log.Info("Sesión actualizada en Redis")
 	}
+	threadID, threadIDAnalizer := sess.Thread, sess.ThreadAnalizer
 
-	logger.Log.Infof("Usuario %v: threadID=%v, threadIDAnalizer=%v, mensaje=%v", phone, threadID, threadIDAnalizer, messageBody)
+	turn := &conversationTurn{Phone: phone, Name: name, ThreadID: threadID, ThreadIDAnalizer: threadIDAnalizer}
+	return turn, handled, nil
+}
 
-	// Genera el interés del usuario utilizando el analizador
-	userInterests, err := generateResponseAnalizer(threadIDAnalizer, messageBody)
+// replyToTurn envía el turno combinado al analizador y al asistente y envía la respuesta al usuario.
+func replyToTurn(turn *conversationTurn) error {
+	phone, name, threadID, threadIDAnalizer := turn.Phone, turn.Name, turn.ThreadID, turn.ThreadIDAnalizer
+	messageBody := turn.Text()
+
+	// Mantener el indicador de escritura mientras se genera la respuesta
+	stopTyping := keepTyping(phone, turn.LastMessageID())
+	defer stopTyping()
+
+	redisConn, err := db.GetRedisConn()
 	if err != nil {
-		return fmt.Errorf("fallo al generar respuesta del analizador: %w", err)
+		return fmt.Errorf("fallo al obtener conexión a Redis: %w", err)
 	}
 
-	//if len(userInterests) > 0 {s
-	//	db.UpdateUserInterest(ctx, redisConn, threadIDAnalizer, threadID, userInterests)
-	//	logger.Log.Info("Intereses del usuario actualizados en Redis")
-	//}
+	ai, err := getAIBackend()
+	if err != nil {
+		return err
+	}
 
-	if len(userInterests) > 0 {
-		db.UpdateUserInterest(ctx, redisConn, threadIDAnalizer, threadID, userInterests)
-		logger.Log.Info("Proceso de actualización de intereses del usuario completado")
-	} else {
-		logger.Log.Info("No se encontraron intereses para actualizar en Redis")
+	// Si el servidor de IA no está disponible se responde con la contingencia y el turno se reintenta después
+	if threadID == "" || threadIDAnalizer == "" {
+		threadID, threadIDAnalizer, err = createNewThreads(ai)
+		if aibackend.IsUnavailable(err) {
+			return replyWithFallback(redisConn, turn, err)
+		}
+		if err != nil {
+			return fmt.Errorf("fallo al crear nuevos hilos: %w", err)
+		}
+		if err := setSessionThreads(phone, threadID, threadIDAnalizer); err != nil {
+			return fmt.Errorf("fallo al guardar los hilos en la sesión: %w", err)
+		}
+		turn.ThreadID, turn.ThreadIDAnalizer = threadID, threadIDAnalizer
 	}
 
-	// Genera una respuesta para el usuario
-	response, followUpQuestion, options, err := generateResponse(phone, threadID, messageBody)
+	logger.Log.Infof("Usuario %v: threadID=%v, threadIDAnalizer=%v, mensajes=%d, mensaje=%v", phone, threadID, threadIDAnalizer, len(turn.Messages), messageBody)
+
+	// El analizador y el asistente se consultan a la vez. La respuesta se envía en cuanto el asistente
+	// termina y los intereses se guardan en segundo plano, después del análisis del turno anterior; si
+	// el asistente falla se cancela el análisis.
+	analysisCtx, cancelAnalysis := context.WithCancel(context.Background())
+	analysisExecutor.Submit(phone, func() {
+		analyzeTurn(analysisCtx, cancelAnalysis, ai, redisConn, phone, threadID, threadIDAnalizer, messageBody)
+	})
+
+	// Genera una respuesta para el usuario, enviando cada párrafo completo a medida que se genera
+	delivery := &streamDelivery{redisConn: redisConn, phone: phone}
+	res, streamed, err := generateResponseStream(context.Background(), ai, phone, threadID, messageBody, turn.Selection(), delivery.Send)
+	if aibackend.IsUnavailable(err) {
+		cancelAnalysis()
+		return replyWithFallback(redisConn, turn, err)
+	}
 	if err != nil {
+		cancelAnalysis()
 		return fmt.Errorf("fallo al generar respuesta: %w", err)
 	}
 
-	response = utils.ProcessTextForWhatsApp(response)
-	if response == "" {
+	if len(res.Intents) > 0 {
+		logger.Log.Infof("Intenciones detectadas para %s: %v", phone, res.Intents)
+	}
+	if usage := res.Usage; usage != nil {
+		logger.Log.Infof("Tokens usados para %s: prompt=%d, respuesta=%d, total=%d", phone, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+	}
+
+	var messages []*whatsapp.OutboundMessage
+	for _, part := range res.Parts {
+		if streamed && isTextPart(part) {
+			// El texto ya se envió párrafo a párrafo durante el streaming
+			continue
+		}
+		if message := buildReplyMessage(phone, part); message != nil {
+			messages = append(messages, message)
+		}
+	}
+
+	response := responseText(res)
+	if len(messages) == 0 && !streamed {
 		response = "Disculpa, no pude procesar tu solicitud correctamente."
+		messages = append(messages, whatsapp.NewTextMessage(phone, response))
 	}
 
 	logger.Log.Infof("Respuesta generada: %s", response)
 
-	err = updateSession(redisConn, name, phone, response, "outgoing")
+	err = recordReply(phone, name, response)
 	if err != nil {
 		return fmt.Errorf("fallo al actualizar sesión con la respuesta: %w", err)
 	}
 
-	// Envía la respuesta principal al usuario
-	err = utils.SendMessage(phone, utils.GetTextMessageInput(phone, response))
-	if err != nil {
-		return fmt.Errorf("fallo al enviar respuesta principal: %w", err)
+	if res.Handoff {
+		logger.Log.Infof("El asistente solicita derivar la conversación de %s a un asesor", phone)
+		events.Publish(events.Event{Name: events.HandoffRequested, Phone: phone, Details: strings.Join(res.Intents, ",")})
 	}
 
-	// Si hay una pregunta de seguimiento, envíala con opciones
-	if followUpQuestion != "" {
-		logger.Log.Infof("Enviando pregunta de seguimiento: %s", followUpQuestion)
-		err = utils.SendMessage(phone, utils.GetInteractiveMessageInput(phone, followUpQuestion, options))
+	if delivery.windowClosed {
+		return nil
+	}
+	if delivery.err != nil {
+		return fmt.Errorf("fallo al enviar la respuesta en streaming: %w", delivery.err)
+	}
+
+	// Envía las partes restantes de la respuesta en orden. Si una queda diferida en el outbox, las
+	// siguientes quedan en cola detrás de ella
+	for i, message := range messages {
+		_, err = sendWhatsAppMessage(redisConn, message)
+		if errors.Is(err, outbound.ErrDeferred) {
+			logger.Log.Warnf("Parte %d de la respuesta a %s diferida en el outbox: %v", i+1, phone, err)
+			continue
+		}
+		if errors.Is(err, errWindowClosed) {
+			logger.Log.Warnf("Respuesta a %s no enviada: %v", phone, err)
+			return nil
+		}
 		if err != nil {
+			return fmt.Errorf("fallo al enviar la parte %d de la respuesta: %w", i+1, err)
+		}
+	}
+
+	// Recordar las opciones de botones o listas para resolver la respuesta del usuario
+	question, options, format := "", []*pb.ReplyOption(nil), ""
+	for _, part := range res.Parts {
+		if len(part.Options) > 0 {
+			question, options, format = part.Text, part.Options, optionsFormat(buildReplyMessage(phone, part))
+		}
+	}
+
+	// Si hay una pregunta de seguimiento, envíala con opciones. Si queda diferida en el outbox sus
+	// opciones se guardan igual, porque el usuario la recibirá después de las partes anteriores
+	if res.FollowUpQuestion != "" {
+		logger.Log.Infof("Enviando pregunta de seguimiento: %s", res.FollowUpQuestion)
+		// El formato (botones, lista o texto numerado) depende de la cantidad y el largo de las opciones
+		followUp := whatsapp.NewOptionsMessage(phone, res.FollowUpQuestion, whatsappOptions(res.Options))
+		_, err = sendWhatsAppMessage(redisConn, followUp)
+		if errors.Is(err, outbound.ErrDeferred) {
+			logger.Log.Warnf("Pregunta de seguimiento a %s diferida en el outbox: %v", phone, err)
+		} else if errors.Is(err, errWindowClosed) {
+			logger.Log.Warnf("Pregunta de seguimiento a %s no enviada: %v", phone, err)
+			return nil
+		} else if err != nil {
 			return fmt.Errorf("fallo al enviar pregunta de seguimiento: %w", err)
 		}
+		question, options, format = res.FollowUpQuestion, res.Options, optionsFormat(followUp)
+	}
+
+	if len(options) > 0 {
+		sessionOptions := make([]session.Option, len(options))
+		for i, option := range options {
+			sessionOptions[i] = session.Option{ID: option.Id, Title: option.Title}
+		}
+		if err := savePendingOptions(phone, question, format, sessionOptions); err != nil {
+			logger.Log.Errorf("Error al guardar las opciones enviadas a %s: %v", phone, err)
+		}
 	}
 
 	logger.Log.Info("Mensaje de WhatsApp procesado exitosamente")
 	return nil
 }
 
-// extractMessageData extrae los datos relevantes del mensaje de WhatsApp.
-func extractMessageData(body map[string]interface{}) (string, string, string, error) {
-	entry := body["entry"].([]interface{})[0].(map[string]interface{})
-	changes := entry["changes"].([]interface{})[0].(map[string]interface{})
-	value := changes["value"].(map[string]interface{})
+// analyzeTurn extrae los intereses del usuario con el analizador y los guarda en Redis. Se ejecuta en
+// segundo plano mientras el asistente genera la respuesta y registra sus propios errores, incluido un
+// pánico. Una vez obtenidos, los intereses se guardan aunque se cancele el análisis.
+func analyzeTurn(analysisCtx context.Context, cancel context.CancelFunc, ai *aibackend.Client, redisConn *redis.Client, phone, threadID, threadIDAnalizer, messageBody string) {
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Log.Errorf("Pánico al analizar los intereses de %s: %v", phone, r)
+		}
+	}()
 
-	phone := value["contacts"].([]interface{})[0].(map[string]interface{})["wa_id"].(string)
-	name := value["contacts"].([]interface{})[0].(map[string]interface{})["profile"].(map[string]interface{})["name"].(string)
-	messageBody := value["messages"].([]interface{})[0].(map[string]interface{})["text"].(map[string]interface{})["body"].(string)
+	userInterests, err := generateResponseAnalizer(analysisCtx, ai, threadIDAnalizer, messageBody)
+	if analysisCtx.Err() != nil {
+		logger.Log.Infof("Análisis de intereses de %s cancelado", phone)
+		return
+	}
+	if err != nil {
+		logger.Log.Errorf("Error al analizar los intereses de %s: %v", phone, err)
+		return
+	}
 
-	return phone, name, messageBody, nil
+	if len(userInterests) > 0 {
+		if err := db.UpdateUserInterest(ctx, redisConn, threadIDAnalizer, threadID, userInterests); err != nil {
+			logger.Log.Errorf("Error al guardar los intereses de %s: %v", phone, err)
+			return
+		}
+		logger.Log.Info("Proceso de actualización de intereses del usuario completado")
+	} else {
+		logger.Log.Info("No se encontraron intereses para actualizar en Redis")
+	}
+}
+
+// extractMessageData extrae el teléfono y el nombre del remitente del mensaje de WhatsApp. Si el mensaje
+// no es válido devuelve el error de Validate, que whatsapp.IsInvalidMessage reconoce.
+func extractMessageData(inbound whatsapp.InboundMessage) (string, string, error) {
+	if err := inbound.Message.Validate(); err != nil {
+		return "", "", err
+	}
+
+	return inbound.Phone(), inbound.Name(), nil
 }
 
 // createNewThreads crea nuevos hilos para el usuario y el analizador.
-func createNewThreads() (string, string, error) {
-	threadID, err := createThread()
+func createNewThreads(ai *aibackend.Client) (string, string, error) {
+	threadID, err := createThread(ai)
 	if err != nil {
 		return "", "", fmt.Errorf("fallo al crear hilo principal: %w", err)
 	}
-	threadIDAnalizer, err := createThreadAnalizer()
+	threadIDAnalizer, err := createThreadAnalizer(ai)
 	if err != nil {
 		return "", "", fmt.Errorf("fallo al crear hilo analizador: %w", err)
 	}
@@ -210,102 +507,58 @@ func createNewThreads() (string, string, error) {
 }
 
 // createThread crea un nuevo hilo para el usuario.
-func createThread() (string, error) {
-	logger.Log.Info("Intentando establecer conexión gRPC con el servidor en el puerto 50052")
-	conn, err := grpc.Dial("localhost:50052", grpc.WithInsecure())
-	if err != nil {
-		return "", fmt.Errorf("fallo al conectar con el servidor gRPC: %w", err)
-	}
-	defer conn.Close()
-
-	client := pb.NewWhatsAppServiceClient(conn)
-	logger.Log.Info("Cliente de WhatsAppService creado")
-
+func createThread(ai *aibackend.Client) (string, error) {
 	logger.Log.Info("Llamando al método CreateThread del servicio gRPC")
-	res, err := client.CreateThread(context.Background(), &pb.CreateThreadRequest{})
+	threadID, err := ai.CreateThread(context.Background())
 	if err != nil {
 		return "", fmt.Errorf("fallo al crear el hilo en el servidor gRPC: %w", err)
 	}
 
-	logger.Log.Infof("Hilo creado exitosamente con ID: %s", res.ThreadId)
-	return res.ThreadId, nil
+	logger.Log.Infof("Hilo creado exitosamente con ID: %s", threadID)
+	return threadID, nil
 }
 
 // createThreadAnalizer crea un nuevo hilo para el analizador.
-func createThreadAnalizer() (string, error) {
-	conn, err := grpc.Dial("localhost:50052", grpc.WithInsecure())
-	if err != nil {
-		return "", fmt.Errorf("fallo al conectar con el servidor gRPC: %w", err)
-	}
-	defer conn.Close()
-
-	client := pb.NewWhatsAppServiceClient(conn)
-	res, err := client.CreateThreadAnalizer(context.Background(), &pb.CreateThreadAnalizerRequest{})
+func createThreadAnalizer(ai *aibackend.Client) (string, error) {
+	threadIDAnalizer, err := ai.CreateThreadAnalizer(context.Background())
 	if err != nil {
 		return "", fmt.Errorf("fallo al crear el hilo analizador en el servidor gRPC: %w", err)
 	}
 
-	logger.Log.Infof("Hilo analizador creado exitosamente con ID: %s", res.ThreadIdAnalizer)
-	return res.ThreadIdAnalizer, nil
+	logger.Log.Infof("Hilo analizador creado exitosamente con ID: %s", threadIDAnalizer)
+	return threadIDAnalizer, nil
 }
 
-// generateResponse genera una respuesta para el usuario.
-func generateResponse(phone, threadID, messageBody string) (string, string, []string, error) {
-	conn, err := grpc.Dial("localhost:50052", grpc.WithInsecure())
-	if err != nil {
-		return "", "", nil, fmt.Errorf("fallo al conectar con el servidor gRPC: %w", err)
-	}
-	defer conn.Close()
-
-	client := pb.NewWhatsAppServiceClient(conn)
-	res, err := client.GenerateResponse(context.Background(), &pb.GenerateResponseRequest{
-		Phone:       phone,
-		ThreadId:    threadID,
-		MessageBody: messageBody,
+// generateResponse genera una respuesta para el usuario. Las respuestas con el formato anterior "|||"
+// se convierten a la forma estructurada.
+func generateResponse(ctx context.Context, ai *aibackend.Client, phone, threadID, messageBody string, selection *pb.SelectedOption) (*pb.GenerateResponseResponse, error) {
+	res, err := ai.GenerateResponse(ctx, &pb.GenerateResponseRequest{
+		Phone:          phone,
+		ThreadId:       threadID,
+		MessageBody:    messageBody,
+		SelectedOption: selection,
 	})
 	if err != nil {
-		return "", "", nil, fmt.Errorf("fallo al generar respuesta: %w", err)
+		return nil, fmt.Errorf("fallo al generar respuesta: %w", err)
 	}
 
-	parts := strings.Split(res.Response, "|||")
-	response := parts[0]
-	var followUpQuestion string
-	var options []string
-	if len(parts) > 1 {
-		followUpQuestion = parts[1]
-		if len(parts) > 2 {
-			options = strings.Split(parts[2], "|")
-		}
-	}
-
-	return response, followUpQuestion, options, nil
+	return normalizeResponse(res), nil
 }
 
 // generateResponseAnalizer genera una respuesta del analizador.
-func generateResponseAnalizer(threadIDAnalizer string, messageBody string) ([]string, error) {
+func generateResponseAnalizer(ctx context.Context, ai *aibackend.Client, threadIDAnalizer string, messageBody string) ([]string, error) {
 	logger.Log.Info("Generando respuesta del analizador")
 
 	// Llamada al servicio gRPC para obtener la respuesta del analizador
-	conn, err := grpc.Dial("localhost:50052", grpc.WithInsecure())
-	if err != nil {
-		logger.Log.Errorf("Fallo al conectar con el servidor gRPC: %v", err)
-		return nil, fmt.Errorf("fallo al conectar con el servidor gRPC: %w", err)
-	}
-	defer conn.Close()
-
-	client := pb.NewWhatsAppServiceClient(conn)
-	res, err := client.GenerateResponseAnalizer(context.Background(), &pb.GenerateResponseAnalizerRequest{
-		ThreadIdAnalizer: threadIDAnalizer,
-		MessageBody:      messageBody,
-	})
+	response, err := ai.GenerateResponseAnalizer(ctx, threadIDAnalizer, messageBody)
 	if err != nil {
 		logger.Log.Errorf("Fallo al generar respuesta del analizador: %v", err)
 		return nil, fmt.Errorf("fallo al generar respuesta del analizador: %w", err)
 	}
 
-	logger.Log.Infof("Respuesta cruda del analizador: %s", res.Response)
+	logger.Log.Infof("Respuesta cruda del analizador: %s", response)
 
-	interesesRaw := strings.TrimSpace(res.Response)
+	interesesRaw := strings.TrimSpace(response)
 	if interesesRaw == "" {
 		logger.Log.Info("No se encontraron intereses en la respuesta del analizador")
 		return []string{}, nil
@@ -323,187 +576,3 @@ func generateResponseAnalizer(threadIDAnalizer string, messageBody string) ([]st
 	logger.Log.Infof("Respuesta del analizador procesada. Intereses validados: %v", interesesValidados)
 	return interesesValidados, nil
 }
-
-// retrieveThreads recupera los hilos del usuario y del analizador desde Redis.
-func retrieveThreads(sessionDataRaw string) (string, string) {
-	var sessionData map[string]interface{}
-	if err := json.Unmarshal([]byte(sessionDataRaw), &sessionData); err != nil {
-		logger.Log.Errorf("Error al deserializar datos de sesión: %v", err)
-		return "", ""
-	}
-
-	thread, ok := sessionData["thread"].(string)
-	if !ok {
-		logger.Log.Warn("Clave 'thread' no encontrada en la sesión")
-		thread = ""
-	}
-
-	threadAnalizer, ok := sessionData["thread_analizer"].(string)
-	if !ok {
-		logger.Log.Warn("Clave 'thread_analizer' no encontrada en la sesión")
-		threadAnalizer = ""
-	}
-
-	return thread, threadAnalizer
-}
-
-// updateSession actualiza la sesión del usuario en Redis.
-func updateSession(redisConn *redis.Client, name, phone, message, messageType string) error {
-	sessionKey := "usuario:" + phone
-	sessionDataRaw, err := redisConn.Get(ctx, sessionKey).Result()
-	if err != nil {
-		return fmt.Errorf("fallo al recuperar datos de sesión de Redis: %w", err)
-	}
-
-	var sessionData map[string]interface{}
-	if err := json.Unmarshal([]byte(sessionDataRaw), &sessionData); err != nil {
-		return fmt.Errorf("fallo al deserializar datos de sesión: %w", err)
-	}
-
-	messages := sessionData["messages"].([]interface{})
-	messages = append(messages, map[string]string{
-		"message":   message,
-		"sender":    name,
-		"timestamp": time.Now().Format(time.RFC3339),
-		"type":      messageType,
-	})
-	sessionData["messages"] = messages
-
-	sessionDataBytes, err := json.Marshal(sessionData)
-	if err != nil {
-		return fmt.Errorf("fallo al serializar datos de sesión actualizados: %w", err)
-	}
-
-	if err := redisConn.Set(ctx, sessionKey, sessionDataBytes, 0).Err(); err != nil {
-		return fmt.Errorf("fallo al actualizar sesión en Redis: %w", err)
-	}
-
-	logger.Log.Infof("Sesión actualizada en Redis con clave: %s", sessionKey)
-	return nil
-}
-
-// IsWhatsAppStatusUpdate verifica si el mensaje es una actualización de estado de WhatsApp.
-func IsWhatsAppStatusUpdate(body map[string]interface{}) bool {
-	_, ok := body["entry"].([]interface{})[0].(map[string]interface{})["changes"].([]interface{})[0].(map[string]interface{})["value"].(map[string]interface{})["statuses"]
-	return ok
-}
-
-// GetTextMessageInput prepara los datos en formato JSON para enviar mensajes de texto a través de WhatsApp.
-func GetTextMessageInput(recipient, text string) map[string]interface{} {
-	return map[string]interface{}{
-		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                recipient,
-		"type":              "text",
-		"text": map[string]string{
-			"preview_url": "false",
-			"body":        text,
-		},
-	}
-}
-
-// GetInteractiveMessageInput prepara los datos en formato JSON para enviar mensajes interactivos con botones.
-func GetInteractiveMessageInput(recipient, text string, buttons []string) map[string]interface{} {
-	buttonObjects := make([]map[string]interface{}, len(buttons))
-	for i, button := range buttons {
-		buttonObjects[i] = map[string]interface{}{
-			"type": "reply",
-			"reply": map[string]string{
-				"id":    fmt.Sprintf("button_%d", i+1),
-				"title": button,
-			},
-		}
-	}
-
-	return map[string]interface{}{
-		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                recipient,
-		"type":              "interactive",
-		"interactive": map[string]interface{}{
-			"type": "button",
-			"body": map[string]string{
-				"text": text,
-			},
-			"action": map[string]interface{}{
-				"buttons": buttonObjects,
-			},
-		},
-	}
-}
-
-// SendMessage envía un mensaje a través de la API de WhatsApp.
-func SendMessage(phone string, messageData map[string]interface{}) error {
-	url := fmt.Sprintf("https://graph.facebook.com/%s/%s/messages", os.Getenv("VERSION"), os.Getenv("PHONE_NUMBER_ID"))
-
-	reqBody, err := json.Marshal(messageData)
-	if err != nil {
-		logger.Log.Errorf("Fallo al serializar cuerpo de la solicitud: %v", err)
-		return fmt.Errorf("fallo al serializar cuerpo de la solicitud: %w", err)
-	}
-
-	logger.Log.Infof("Enviando mensaje a la API de WhatsApp. URL: %s, Cuerpo: %s", url, string(reqBody))
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		logger.Log.Errorf("Fallo al crear solicitud: %v", err)
-		return fmt.Errorf("fallo al crear solicitud: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("ACCESS_TOKEN"))
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		logger.Log.Errorf("Fallo al enviar mensaje: %v", err)
-		return fmt.Errorf("fallo al enviar mensaje: %w", err)
-	}
-	defer resp.Body.Close()
-
-	logger.Log.Infof("Código de estado de la respuesta: %d", resp.StatusCode)
-
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		logger.Log.Errorf("Fallo al leer cuerpo de la respuesta: %v", err)
-		return fmt.Errorf("fallo al leer cuerpo de la respuesta: %w", err)
-	}
-	logger.Log.Infof("Cuerpo de la respuesta: %s", string(respBody))
-
-	if resp.StatusCode != http.StatusOK {
-		logger.Log.Errorf("Fallo al enviar mensaje, código de estado: %d", resp.StatusCode)
-		return fmt.Errorf("fallo al enviar mensaje, código de estado: %d", resp.StatusCode)
-	}
-
-	logger.Log.Info("Mensaje enviado exitosamente")
-	return nil
-}
-
-// ProcessTextForWhatsApp formatea el texto para WhatsApp.
-func ProcessTextForWhatsApp(text string) string {
-	logger.Log.Info("Procesando texto para WhatsApp")
-
-	// Crear una expresión regular para encontrar el texto entre ** **
-	re := regexp.MustCompile(`\*\*(.*?)\*\*`)
-
-	// Reemplazar el texto entre ** ** por * *
-	processed := re.ReplaceAllString(text, "*$1*")
-
-	logger.Log.Info("Texto procesado exitosamente")
-	return processed
-}
-
-// IsValidWhatsAppMessage valida la estructura del mensaje de WhatsApp.
-func IsValidWhatsAppMessage(body map[string]interface{}) bool {
-	logger.Log.Info("Validando estructura del mensaje de WhatsApp")
-
-	// Verificar si el mensaje tiene la estructura esperada
-	_, ok := body["entry"].([]interface{})[0].(map[string]interface{})["changes"].([]interface{})[0].(map[string]interface{})["value"].(map[string]interface{})["messages"]
-
-	if ok {
-		logger.Log.Info("Estructura del mensaje de WhatsApp válida")
-	} else {
-		logger.Log.Warn("Estructura del mensaje de WhatsApp inválida")
-	}
-
-	return ok
-}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"chatbot/utils/queue"
+	"chatbot/utils/redistest"
+	"chatbot/utils/whatsapp"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWebhookPostStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rdb := redistest.New(t)
+	previous := webhookQueue
+	webhookQueue = queue.NewStreamQueue(rdb, queue.Config{Stream: "prueba:webhook", Group: "workers"})
+	t.Cleanup(func() { webhookQueue = previous })
+
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantEnqueued int64
+	}{
+		{
+			name:         "mensaje de texto",
+			body:         `{"object":"whatsapp_business_account","entry":[{"id":"1","changes":[{"field":"messages","value":{"messaging_product":"whatsapp","messages":[{"from":"5491100000000","id":"wamid.1","timestamp":"1700000000","type":"text","text":{"body":"hola"}}]}}]}]}`,
+			wantStatus:   http.StatusOK,
+			wantEnqueued: 1,
+		},
+		{
+			name:       "sin entradas",
+			body:       `{"object":"whatsapp_business_account","entry":[]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "sin mensajes ni estados",
+			body:       `{"object":"whatsapp_business_account","entry":[{"id":"1","changes":[{"field":"messages","value":{"messaging_product":"whatsapp"}}]}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "otro objeto",
+			body:       `{"object":"page","entry":[{"id":"1"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "JSON inválido",
+			body:       `{"object":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := rdb.XLen(ctx, "prueba:webhook").Result()
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(tt.body))
+			c.Set("body", []byte(tt.body))
+			WebhookPost(c)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("estado HTTP = %d, se esperaba %d", recorder.Code, tt.wantStatus)
+			}
+			after, _ := rdb.XLen(ctx, "prueba:webhook").Result()
+			if after-before != tt.wantEnqueued {
+				t.Errorf("entregas encoladas = %d, se esperaban %d", after-before, tt.wantEnqueued)
+			}
+		})
+	}
+}
+
+func TestProcessWhatsAppMessageSkipsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		message whatsapp.Message
+	}{
+		{name: "sin remitente", message: whatsapp.Message{ID: "wamid.1", Type: whatsapp.MessageTypeText, Text: &whatsapp.Text{Body: "hola"}}},
+		{name: "texto sin cuerpo", message: whatsapp.Message{ID: "wamid.2", From: "5491100000000", Type: whatsapp.MessageTypeText}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			processWhatsAppMessage(whatsapp.InboundMessage{Message: tt.message}, func(processed bool, err error) {
+				called = true
+				if processed || err != nil {
+					t.Errorf("done(%v, %v), se esperaba el mensaje ignorado sin error", processed, err)
+				}
+			})
+			if !called {
+				t.Error("done no se llamó")
+			}
+		})
+	}
+}
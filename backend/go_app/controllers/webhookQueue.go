@@ -0,0 +1,135 @@
+// go_app/controllers/webhookQueue.go
+
+package controllers
+
+import (
+	"chatbot/initializers"
+	"chatbot/logger"
+	db "chatbot/utils/db"
+	"chatbot/utils/queue"
+	"chatbot/utils/whatsapp"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// webhookQueue es la cola durable donde WebhookPost deja las entregas de Meta.
+var webhookQueue *queue.StreamQueue
+
+// conversationExecutor procesa los mensajes de cada teléfono en orden estricto de llegada,
+// mientras que las conversaciones de distintos usuarios avanzan en paralelo.
+var conversationExecutor = queue.NewKeyedExecutor(1)
+
+// analysisExecutor ejecuta en orden los análisis de intereses de cada teléfono, que siguen en segundo
+// plano cuando el turno ya se respondió, para que dos turnos seguidos no consulten a la vez el hilo
+// del analizador.
+var analysisExecutor = queue.NewKeyedExecutor(1)
+
+// StartWebhookWorkers crea la cola de entregas del webhook y lanza el pool de workers que las procesa.
+func StartWebhookWorkers(ctx context.Context, rdb *redis.Client) (*queue.StreamQueue, error) {
+	workers := initializers.GetEnvInt("WEBHOOK_WORKERS", 4)
+	conversationExecutor = queue.NewKeyedExecutor(workers)
+	analysisExecutor = queue.NewKeyedExecutor(workers)
+
+	// Una entrega inactiva por más de claimIdle se reclama y se vuelve a procesar, por lo que debe
+	// superar lo que puede tardar un turno: la espera de mensajes, la respuesta de la IA y los envíos
+	claimIdle := initializers.GetEnvDuration("WEBHOOK_CLAIM_IDLE", 10*time.Minute)
+	hostname, _ := os.Hostname()
+	webhookQueue = queue.NewStreamQueue(rdb, queue.Config{
+		Stream:           initializers.GetEnvString("WEBHOOK_STREAM", "webhook:entregas"),
+		Group:            initializers.GetEnvString("WEBHOOK_GROUP", "webhook-workers"),
+		DeadLetterStream: initializers.GetEnvString("WEBHOOK_DEAD_LETTER_STREAM", "webhook:entregas:fallidas"),
+		Consumer:         fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		MaxInFlight:      initializers.GetEnvInt("WEBHOOK_MAX_IN_FLIGHT", 100),
+		MaxAttempts:      int64(initializers.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 5)),
+		ClaimIdle:        claimIdle,
+		MaxLen:           int64(initializers.GetEnvInt("WEBHOOK_STREAM_MAX_LEN", 10000)),
+	})
+
+	messageDedupTTL = initializers.GetEnvDuration("MESSAGE_DEDUP_TTL", messageDedupTTL)
+	messageClaimTTL = initializers.GetEnvDuration("MESSAGE_CLAIM_TTL", claimIdle)
+	messageStatusTTL = initializers.GetEnvDuration("MESSAGE_STATUS_TTL", messageStatusTTL)
+	window := initializers.GetEnvDuration("MESSAGE_DEBOUNCE_WINDOW", 3*time.Second)
+	turnDebouncer = newMessageDebouncer(window, initializers.GetEnvDuration("MESSAGE_DEBOUNCE_MAX_WAIT", 4*window))
+
+	if err := webhookQueue.Start(ctx, processDelivery); err != nil {
+		return nil, err
+	}
+	return webhookQueue, nil
+}
+
+// processDelivery reparte una entrega del webhook leída de la cola entre las conversaciones de sus
+// mensajes y la confirma cuando todos terminan. Si alguno falla, registra las partes que terminaron
+// bien para que el reintento de la entrega solo procese las que fallaron.
+func processDelivery(ctx context.Context, delivery queue.Delivery, done func(error)) {
+	logger.Log.Infof("Procesando entrega %s del webhook (intento %d)", delivery.ID, delivery.Attempts)
+
+	payload, err := whatsapp.DecodeWebhook(delivery.Body)
+	if err != nil {
+		// Una entrega que no se puede decodificar nunca tendrá éxito
+		done(queue.Permanent(fmt.Errorf("fallo al decodificar la entrega %s: %w", delivery.ID, err)))
+		return
+	}
+
+	redisConn, err := db.GetRedisConn()
+	if err != nil {
+		done(fmt.Errorf("fallo al obtener conexión a Redis: %w", err))
+		return
+	}
+	acked := map[string]bool{}
+	if delivery.Attempts > 1 {
+		if acked, err = db.DeliveryAcks(ctx, redisConn, delivery.ID); err != nil {
+			done(fmt.Errorf("fallo al obtener las partes confirmadas de la entrega %s: %w", delivery.ID, err))
+			return
+		}
+	}
+	// finish confirma la entrega y olvida sus partes confirmadas
+	finish := func() {
+		if len(acked) > 0 {
+			db.ClearDeliveryAcks(ctx, redisConn, delivery.ID)
+		}
+		done(nil)
+	}
+
+	var succeeded []string
+	if payload.HasStatuses() && !acked[db.DeliveryStatusesAck] {
+		logger.Log.Info("Recibida actualización de estado de WhatsApp")
+		if err := processStatusUpdates(ctx, payload); err != nil {
+			done(fmt.Errorf("fallo al procesar los estados de la entrega %s: %w", delivery.ID, err))
+			return
+		}
+		succeeded = append(succeeded, db.DeliveryStatusesAck)
+	}
+
+	var messages []whatsapp.InboundMessage
+	for _, inbound := range payload.Messages() {
+		if !acked[inbound.Message.ID] {
+			messages = append(messages, inbound)
+		}
+	}
+	if len(messages) == 0 {
+		finish()
+		return
+	}
+
+	dispatchWebhookMessages(delivery.ID, messages, func(outcomes []messageOutcome) {
+		var failed int
+		for _, outcome := range outcomes {
+			if outcome.Status == outcomeFailed {
+				failed++
+				continue
+			}
+			succeeded = append(succeeded, outcome.MessageID)
+		}
+		if failed > 0 {
+			// Si no se pueden registrar, el reintento descarta igualmente los mensajes ya procesados
+			db.AckDeliveryParts(ctx, redisConn, delivery.ID, succeeded, messageDedupTTL)
+			done(fmt.Errorf("fallaron %d de %d mensajes de la entrega %s", failed, len(outcomes), delivery.ID))
+			return
+		}
+		finish()
+	})
+}
@@ -2,6 +2,9 @@ package initializers
 
 import (
 	"chatbot/logger"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,3 +16,35 @@ func LoadEnv() {
 		logger.Log.Fatalf("Error loading .env file")
 	}
 }
+
+// GetEnvInt devuelve la variable de entorno como entero, o el valor por defecto si no está configurada o es inválida
+func GetEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		logger.Log.Infof("%s no configurado, usando valor por defecto: %d", key, defaultValue)
+		return defaultValue
+	}
+	logger.Log.Infof("%s configurado: %d", key, value)
+	return value
+}
+
+// GetEnvDuration devuelve la variable de entorno como duración (por ejemplo "30s" o "5m"), o el valor por defecto
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		logger.Log.Infof("%s no configurado, usando valor por defecto: %v", key, defaultValue)
+		return defaultValue
+	}
+	logger.Log.Infof("%s configurado: %v", key, value)
+	return value
+}
+
+// GetEnvString devuelve la variable de entorno, o el valor por defecto si está vacía
+func GetEnvString(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		logger.Log.Infof("%s no configurado, usando valor por defecto: %s", key, defaultValue)
+		return defaultValue
+	}
+	return value
+}
@@ -18,8 +18,14 @@ func Migrate() error {
 		return err
 	}
 
+	// Aplicar antes los cambios de esquema que AutoMigrate no puede hacer sobre datos existentes
+	if err := MigrateSchema(); err != nil {
+		logger.Log.Errorf("Error al migrar el esquema: %v", err)
+		return err
+	}
+
 	// Realiza la migración de los modelos
-	err := DB.AutoMigrate(&models.User{}, &models.Role{}, &models.UsuarioChat{}, &models.Hilo{}, &models.Mensaje{}, &models.Interes{}, &models.CatalogoInteres{})
+	err := DB.AutoMigrate(&models.User{}, &models.Role{}, &models.UsuarioChat{}, &models.Hilo{}, &models.Mensaje{}, &models.Interes{}, &models.CatalogoInteres{}, &models.PlantillaMensaje{}, &models.RespuestaContingencia{})
 	if err != nil {
 		logger.Log.Errorf("Error al migrar la base de datos: %v", err)
 		return fmt.Errorf("error al migrar la base de datos: %v", err)
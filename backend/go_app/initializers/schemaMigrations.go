@@ -0,0 +1,163 @@
+package initializers
+
+import (
+	"fmt"
+	"time"
+
+	"chatbot/logger"
+
+	"gorm.io/gorm"
+)
+
+// schemaMigration es un cambio de esquema que debe aplicarse al iniciar, como crear las tablas nuevas
+// o cambiar tablas existentes donde AutoMigrate no puede hacerlo por sí solo. Se aplica una sola vez
+// y queda registrado en schema_migrations.
+type schemaMigration struct {
+	// Nombre identifica la migración; no debe cambiar una vez publicada.
+	Nombre string
+	// Tablas son las tablas que deben existir. Si falta alguna la migración se pospone: al crearlas,
+	// AutoMigrate ya deja el esquema final.
+	Tablas []string
+	// Sentencias se ejecutan en orden en una sola transacción.
+	Sentencias []string
+}
+
+// schemaMigrations son las migraciones de esquema en el orden en que se aplican.
+var schemaMigrations = []schemaMigration{
+	{
+		// Proveedor de IA y modelo con que se atiende cada prompt; vacíos usan los predeterminados
+		Nombre: "0001_prompts_proveedor_modelo",
+		Tablas: []string{"prompts"},
+		Sentencias: []string{
+			`ALTER TABLE prompts ADD COLUMN IF NOT EXISTS proveedor text DEFAULT ''`,
+			`ALTER TABLE prompts ADD COLUMN IF NOT EXISTS modelo text DEFAULT ''`,
+		},
+	},
+	{
+		// Los hilos se archivan de forma idempotente por su id, que pasa a ser único. Antes se creaba un
+		// hilo por cada archivo de la sesión, por lo que se fusionan los repetidos en el más antiguo.
+		// Los hilos sin id eran de sesiones distintas y reciben uno propio para no fusionarlos.
+		Nombre: "0002_hilos_hilo_open_ai_unico",
+		Tablas: []string{"hilos", "mensajes", "interes"},
+		Sentencias: []string{
+			`UPDATE hilos SET hilo_open_ai = 'sin_hilo_' || id WHERE hilo_open_ai = ''`,
+			`WITH duplicados AS (SELECT id, MIN(id) OVER (PARTITION BY hilo_open_ai) AS conservar FROM hilos)
+			UPDATE mensajes SET hilo_id = d.conservar FROM duplicados d WHERE mensajes.hilo_id = d.id AND d.id <> d.conservar`,
+			`WITH duplicados AS (SELECT id, MIN(id) OVER (PARTITION BY hilo_open_ai) AS conservar FROM hilos)
+			UPDATE interes SET hilo_id = d.conservar FROM duplicados d WHERE interes.hilo_id = d.id AND d.id <> d.conservar`,
+			`WITH duplicados AS (SELECT id, MIN(id) OVER (PARTITION BY hilo_open_ai) AS conservar FROM hilos)
+			DELETE FROM hilos USING duplicados d WHERE hilos.id = d.id AND d.id <> d.conservar`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_hilos_hilo_open_ai ON hilos (hilo_open_ai)`,
+		},
+	},
+	{
+		// Remitente original de cada mensaje archivado
+		Nombre:     "0003_mensajes_remitente",
+		Tablas:     []string{"mensajes"},
+		Sentencias: []string{`ALTER TABLE mensajes ADD COLUMN IF NOT EXISTS remitente text`},
+	},
+	{
+		// Plantillas con que se escribe al usuario con la ventana de 24 horas cerrada
+		// (models.PlantillaMensaje). Puede existir si ya se ejecutó Migrate.
+		Nombre: "0004_plantilla_mensajes",
+		Sentencias: []string{
+			`CREATE TABLE IF NOT EXISTS plantilla_mensajes (
+				id bigserial PRIMARY KEY,
+				created_at timestamptz,
+				updated_at timestamptz,
+				deleted_at timestamptz,
+				nombre text NOT NULL,
+				idioma text NOT NULL,
+				proposito text NOT NULL,
+				componentes text,
+				mapeo_variables text,
+				es_activo boolean DEFAULT true
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_plantilla_mensajes_deleted_at ON plantilla_mensajes (deleted_at)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_plantilla_nombre_idioma ON plantilla_mensajes (nombre, idioma)`,
+			`CREATE INDEX IF NOT EXISTS idx_plantilla_mensajes_proposito ON plantilla_mensajes (proposito)`,
+		},
+	},
+	{
+		// Respuestas con que el bot contesta cuando el servidor de IA no está disponible
+		// (models.RespuestaContingencia). Puede existir si ya se ejecutó Migrate.
+		Nombre: "0005_respuesta_contingencia",
+		Sentencias: []string{
+			`CREATE TABLE IF NOT EXISTS respuesta_contingencia (
+				id bigserial PRIMARY KEY,
+				created_at timestamptz,
+				updated_at timestamptz,
+				deleted_at timestamptz,
+				mensaje text NOT NULL,
+				incluir_menu boolean DEFAULT true,
+				es_activo boolean DEFAULT true
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_respuesta_contingencia_deleted_at ON respuesta_contingencia (deleted_at)`,
+		},
+	},
+}
+
+// migracionAplicada es el registro de una migración de esquema aplicada.
+type migracionAplicada struct {
+	Nombre     string `gorm:"primaryKey"`
+	AplicadaEn time.Time
+}
+
+// TableName fija el nombre de la tabla de registro de migraciones.
+func (migracionAplicada) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrateSchema aplica las migraciones de esquema pendientes, cada una en su propia transacción. Es
+// seguro ejecutarla en cada inicio y desde varias instancias a la vez.
+func MigrateSchema() error {
+	if DB == nil {
+		return fmt.Errorf("la conexión a PostgreSQL no está inicializada")
+	}
+	if err := DB.AutoMigrate(&migracionAplicada{}); err != nil {
+		return fmt.Errorf("error al crear el registro de migraciones: %w", err)
+	}
+
+	for _, migration := range schemaMigrations {
+		if err := applySchemaMigration(DB, migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySchemaMigration aplica la migración si no está registrada y sus tablas existen.
+func applySchemaMigration(db *gorm.DB, migration schemaMigration) error {
+	for _, table := range migration.Tablas {
+		if !db.Migrator().HasTable(table) {
+			logger.Log.Infof("Migración %s pospuesta: la tabla %s no existe.", migration.Nombre, table)
+			return nil
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Serializar las instancias que migran a la vez; el bloqueo se libera al terminar la transacción
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))").Error; err != nil {
+			return fmt.Errorf("error al bloquear las migraciones: %w", err)
+		}
+
+		var applied int64
+		if err := tx.Model(&migracionAplicada{}).Where("nombre = ?", migration.Nombre).Count(&applied).Error; err != nil {
+			return fmt.Errorf("error al consultar la migración %s: %w", migration.Nombre, err)
+		}
+		if applied > 0 {
+			return nil
+		}
+
+		for _, statement := range migration.Sentencias {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("error en la migración %s: %w", migration.Nombre, err)
+			}
+		}
+		if err := tx.Create(&migracionAplicada{Nombre: migration.Nombre, AplicadaEn: time.Now()}).Error; err != nil {
+			return fmt.Errorf("error al registrar la migración %s: %w", migration.Nombre, err)
+		}
+		logger.Log.Infof("Migración de esquema %s aplicada.", migration.Nombre)
+		return nil
+	})
+}
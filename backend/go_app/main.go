@@ -6,9 +6,33 @@ import (
 	"chatbot/initializers"
 	"chatbot/logger"
 	"chatbot/middlewares"
+	"chatbot/services"
+	"chatbot/utils"
+	"chatbot/utils/aibackend"
+	"chatbot/utils/db"
+	"chatbot/utils/session"
+	"chatbot/utils/storage"
+	"chatbot/utils/whatsapp"
+	"context"
+	"errors"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+)
+
+// sessionStore es el almacén de las sesiones de los usuarios, compartido por los controladores y el
+// job de inactividad, y sessionTimeouts los tiempos de inactividad de cada canal. aiServer es el
+// servidor de IA integrado, si se configura.
+var (
+	sessionStore    session.SessionStore
+	sessionTimeouts session.Timeouts
+	aiServer        *grpc.Server
 )
 
 // init se ejecuta antes de main y se usa para cargar variables de entorno e inicializar conexiones
@@ -27,12 +51,41 @@ func init() {
 	}
 	logger.Log.Info("Pool de conexiones de PostGres inicializado.")
 
+	// Aplicar los cambios de esquema pendientes antes de escribir en las tablas
+	if err := initializers.MigrateSchema(); err != nil {
+		logger.Log.Fatalf("Error al migrar el esquema de la base de datos: %v", err)
+	}
+	logger.Log.Info("Migraciones de esquema completadas.")
+
 	// Inicializar conexión a Redis
 	if err := initializers.InitRedis(); err != nil {
 		logger.Log.Fatalf("No se pudo inicializar Redis: %v", err)
 	}
 	logger.Log.Info("Pool de conexiones de Redis inicializado.")
 
+	// Inicializar el almacén de las sesiones de los usuarios
+	rdb, err := initializers.GetRedisConn()
+	if err != nil {
+		logger.Log.Fatalf("No se pudo obtener la conexión a Redis: %v", err)
+	}
+	// El historial reciente se guarda en Redis y los mensajes anteriores pasan a Postgres
+	sessionTimeouts = utils.SessionTimeoutsFromEnv()
+	redisStore := session.NewRedisStore(rdb, session.RedisConfig{
+		HistoryLimit: initializers.GetEnvInt("SESSION_HISTORY_LIMIT", session.DefaultHistoryLimit),
+		Spill:        db.SpillSessionMessages(initializers.DB),
+		Timeouts:     sessionTimeouts,
+	})
+	sessionStore = redisStore
+	controllers.SetSessionStore(sessionStore)
+
+	// Indexar el vencimiento de las sesiones creadas antes de que existiera el índice
+	go func() {
+		if err := redisStore.Reindex(context.Background()); err != nil {
+			logger.Log.Errorf("Error al indexar el vencimiento de las sesiones: %v", err)
+		}
+	}()
+	logger.Log.Info("Almacén de sesiones inicializado.")
+
 	// Migrar la base de datos (opcional, si es necesario)
 	//if err := initializers.Migrate(); err != nil {
 	//	logger.Log.Fatalf("Error al migrar la base de datos: %v", err)
@@ -45,15 +98,69 @@ func init() {
 	}
 	logger.Log.Info("Migraciones de Cache de la base de datos completadas.")
 
+	// Inicializar el almacenamiento de multimedia recibida por WhatsApp
+	mediaStore, err := storage.NewBlobStoreFromEnv()
+	if err != nil {
+		logger.Log.Fatalf("Error al inicializar el almacenamiento de multimedia: %v", err)
+	}
+	controllers.SetMediaStore(mediaStore)
+	logger.Log.Info("Almacenamiento de multimedia inicializado.")
+
+	// Inicializar el cliente de la Cloud API de WhatsApp
+	controllers.SetWhatsAppClient(whatsapp.NewClientFromEnv())
+	logger.Log.Info("Cliente de WhatsApp inicializado.")
+
+	// Iniciar el servidor de IA en este mismo proceso en lugar del servicio de Python, si se configura
+	if strings.EqualFold(os.Getenv("AI_BACKEND_EMBEDDED"), "true") {
+		if aiServer, err = services.StartGRPCServer(); err != nil {
+			logger.Log.Fatalf("No se pudo iniciar el servidor de IA integrado: %v", err)
+		}
+		logger.Log.Info("Servidor de IA integrado iniciado.")
+	}
+
+	// Inicializar el cliente del servidor de IA, que comparte una conexión para todas las solicitudes
+	aiClient, err := aibackend.NewClientFromEnv()
+	if err != nil {
+		logger.Log.Fatalf("Error al inicializar el cliente del servidor de IA: %v", err)
+	}
+	controllers.SetAIBackend(aiClient)
+	logger.Log.Info("Cliente del servidor de IA inicializado.")
 }
 
 // main es el punto de entrada principal de la aplicación
 func main() {
 	logger.Log.Info("Iniciando el servidor...")
 
-	// Iniciar el job de verificación de inactividad (si es necesario)
-	// utils.StartInactivityCheck(pgdb, rdb)
-	// logger.Log.Info("Job de verificación de inactividad iniciado.")
+	// Detener el servidor y los procesos en segundo plano al recibir SIGINT o SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Iniciar los workers que procesan las entregas del webhook encoladas en Redis
+	rdb, err := initializers.GetRedisConn()
+	if err != nil {
+		logger.Log.Fatalf("No se pudo obtener la conexión a Redis: %v", err)
+	}
+	sender := controllers.StartOutboundSender(ctx, rdb)
+	logger.Log.Info("Remitente de mensajes salientes iniciado.")
+
+	webhookQueue, err := controllers.StartWebhookWorkers(ctx, rdb)
+	if err != nil {
+		logger.Log.Fatalf("No se pudieron iniciar los workers del webhook: %v", err)
+	}
+	logger.Log.Info("Workers del webhook iniciados.")
+
+	// Reintentar los turnos respondidos con la contingencia cuando el servidor de IA se recupere
+	controllers.StartAIReplay(ctx, rdb)
+
+	// Iniciar el job que archiva las sesiones vencidas, si se configura; es seguro en varias instancias
+	utils.InactivityNotifier = controllers.NotifyInactiveUser
+	var inactivityJob *utils.InactivityJob
+	if strings.EqualFold(os.Getenv("SESSION_ARCHIVE_ENABLED"), "true") {
+		if inactivityJob, err = utils.StartInactivityCheck(ctx, initializers.DB, rdb, sessionStore, sessionTimeouts); err != nil {
+			logger.Log.Fatalf("No se pudo iniciar el job de verificación de inactividad: %v", err)
+		}
+		logger.Log.Info("Job de verificación de inactividad iniciado.")
+	}
 
 	// Crear un nuevo router de Gin
 	router := gin.New()
@@ -73,8 +180,43 @@ func main() {
 
 	// Iniciar el servidor en el puerto 8000
 	logger.Log.Info("Iniciando servidor en :8000")
-	if err := router.Run(":8000"); err != nil {
-		logger.Log.Fatalf("No se pudo iniciar el servidor: %v", err)
+	server := &http.Server{Addr: ":8000", Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Log.Fatalf("No se pudo iniciar el servidor: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Log.Info("Deteniendo el servidor...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), initializers.GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Log.Errorf("Error al detener el servidor HTTP: %v", err)
+	}
+
+	// Esperar a que los procesos en segundo plano terminen el trabajo en curso
+	done := make(chan struct{})
+	go func() {
+		webhookQueue.Wait()
+		sender.Wait()
+		if inactivityJob != nil {
+			inactivityJob.Wait()
+		}
+		// El servidor de IA integrado se detiene al final, porque los workers lo usan hasta terminar
+		if aiServer != nil {
+			aiServer.GracefulStop()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		logger.Log.Info("Servidor detenido.")
+	case <-shutdownCtx.Done():
+		logger.Log.Warn("Tiempo de espera agotado al detener los procesos en segundo plano.")
+		if aiServer != nil {
+			aiServer.Stop()
+		}
 	}
 }
 
@@ -101,6 +243,15 @@ func setupRoutes(router *gin.Engine) {
 	{
 		adminGroup.GET("/dashboard", controllers.AdminDashboard)
 		logger.Log.Info("Ruta GET /admin/dashboard configurada.")
+
+		adminGroup.GET("/conversaciones/:phone/estados", controllers.GetConversationStatuses)
+		logger.Log.Info("Ruta GET /admin/conversaciones/:phone/estados configurada.")
+
+		adminGroup.GET("/plantillas", controllers.ListTemplates)
+		adminGroup.POST("/plantillas", controllers.CreateTemplate)
+		adminGroup.PUT("/plantillas/:id", controllers.UpdateTemplate)
+		adminGroup.DELETE("/plantillas/:id", controllers.DeleteTemplate)
+		logger.Log.Info("Rutas /admin/plantillas configuradas.")
 	}
 
 	// Rutas que requieren autenticación y roles específicos para usuarios
@@ -111,6 +262,10 @@ func setupRoutes(router *gin.Engine) {
 		logger.Log.Info("Ruta GET /user/dashboard configurada.")
 	}
 
+	// Estado del servidor de IA y de su circuit breaker
+	router.GET("/health/ai", controllers.GetAIHealth)
+	logger.Log.Info("Ruta GET /health/ai configurada.")
+
 	// Rutas para procesar mensajes de WhatsApp con verificación de firma
 	router.GET("/webhook", controllers.WebhookGet)
 	logger.Log.Info("Ruta GET /webhook configurada.")
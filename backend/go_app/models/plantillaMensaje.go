@@ -0,0 +1,60 @@
+// models/plantillaMensaje.go
+
+package models
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// Propósitos con los que el bot elige una plantilla cuando la ventana de 24 horas está cerrada.
+const (
+	PropositoReenganche  = "reenganche"
+	PropositoInactividad = "inactividad"
+)
+
+// PlantillaMensaje representa una plantilla aprobada por Meta para escribir al usuario fuera de la
+// ventana de atención de 24 horas.
+type PlantillaMensaje struct {
+	gorm.Model
+	// Nombre es el nombre de la plantilla en WhatsApp Manager.
+	Nombre string `gorm:"uniqueIndex:idx_plantilla_nombre_idioma;not null" json:"nombre"`
+	// Idioma es el código de idioma de la plantilla, por ejemplo "es" o "es_PE".
+	Idioma string `gorm:"uniqueIndex:idx_plantilla_nombre_idioma;not null" json:"idioma"`
+	// Proposito indica para qué se usa la plantilla, por ejemplo "reenganche" o "inactividad".
+	Proposito string `gorm:"index;not null" json:"proposito"`
+	// Componentes es un JSON con los componentes y el nombre de la variable de cada parámetro.
+	Componentes string `gorm:"type:text" json:"componentes"`
+	// MapeoVariables es un JSON con el valor por defecto de cada variable.
+	MapeoVariables string `gorm:"type:text" json:"mapeo_variables"`
+	EsActivo       bool   `gorm:"default:true" json:"es_activo"`
+}
+
+// ComponentePlantilla describe un componente de la plantilla y las variables de sus parámetros en orden.
+type ComponentePlantilla struct {
+	Tipo      string   `json:"tipo"`
+	SubTipo   string   `json:"sub_tipo,omitempty"`
+	Indice    string   `json:"indice,omitempty"`
+	Variables []string `json:"variables"`
+}
+
+// GetComponentes deserializa los componentes de la plantilla.
+func (p *PlantillaMensaje) GetComponentes() ([]ComponentePlantilla, error) {
+	var componentes []ComponentePlantilla
+	if p.Componentes == "" {
+		return componentes, nil
+	}
+	err := json.Unmarshal([]byte(p.Componentes), &componentes)
+	return componentes, err
+}
+
+// GetMapeoVariables deserializa los valores por defecto de las variables de la plantilla.
+func (p *PlantillaMensaje) GetMapeoVariables() (map[string]string, error) {
+	mapeo := map[string]string{}
+	if p.MapeoVariables == "" {
+		return mapeo, nil
+	}
+	err := json.Unmarshal([]byte(p.MapeoVariables), &mapeo)
+	return mapeo, err
+}
@@ -16,6 +16,8 @@ type Prompt struct {
 	CreadorID   uint            `gorm:"not null"`
 	Creador     User            `gorm:"foreignKey:CreadorID"`
 	EsActivo    bool            `gorm:"default:true"`
+	Proveedor   string          // Proveedor de IA que atiende el prompt; vacío usa el predeterminado
+	Modelo      string          // Modelo del proveedor; vacío usa el configurado en el servidor
 	Etiquetas   []PromptTag     `gorm:"many2many:prompt_tags;"`
 	Versiones   []PromptVersion `gorm:"foreignKey:PromptID"`
 	Tests       []PromptTest    `gorm:"foreignKey:PromptID"`
@@ -0,0 +1,16 @@
+// models/respuestaContingencia.go
+
+package models
+
+import "gorm.io/gorm"
+
+// RespuestaContingencia es el mensaje con el que el bot responde cuando el servidor de IA no está
+// disponible. Se usa la activa más reciente.
+type RespuestaContingencia struct {
+	gorm.Model
+	// Mensaje es el texto que se envía al usuario.
+	Mensaje string `gorm:"type:text;not null" json:"mensaje"`
+	// IncluirMenu agrega como opciones las carreras del catálogo de intereses.
+	IncluirMenu bool `gorm:"default:true" json:"incluir_menu"`
+	EsActivo    bool `gorm:"default:true" json:"es_activo"`
+}
@@ -49,7 +49,7 @@ type UsuarioChat struct {
 type Hilo struct {
 	ID             uint   `gorm:"primaryKey"`
 	UsuarioID      uint   `gorm:"not null"`
-	HiloOpenAI     string `gorm:"not null"`
+	HiloOpenAI     string `gorm:"not null;uniqueIndex"`
 	HiloAnalizador string
 	EstadoHilo     string    `gorm:"default:archivado"`
 	FechaInicio    time.Time `gorm:"default:CURRENT_TIMESTAMP"`
@@ -62,6 +62,7 @@ type Mensaje struct {
 	HiloID        uint      `gorm:"not null"`
 	TextoMensaje  string    `gorm:"not null"`
 	TipoMensaje   string    `gorm:"not null"`
+	Remitente     string    // Nombre del usuario que envió el mensaje, o "bot" si lo envió el bot
 	FechaCreacion time.Time `gorm:"default:CURRENT_TIMESTAMP"`
 }
 
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeEmbeddingSize es la dimensión de los vectores del proveedor simulado.
+const fakeEmbeddingSize = 8
+
+// FakeReply es una respuesta programada del proveedor simulado. Si Err no es nil la solicitud falla
+// con ese error.
+type FakeReply struct {
+	Content   string
+	ToolCalls []ToolCall
+	Err       error
+}
+
+// FakeProvider es un proveedor simulado para pruebas que no se conecta a ningún servicio. Devuelve las
+// respuestas programadas en orden y guarda las solicitudes recibidas. Las respuestas en streaming se
+// entregan palabra por palabra y los vectores se derivan del texto, de modo que los resultados son
+// siempre los mismos.
+type FakeProvider struct {
+	name string
+
+	mu       sync.Mutex
+	replies  []FakeReply
+	repeat   *FakeReply
+	requests []ChatRequest
+}
+
+// NewFakeProvider crea un proveedor simulado con las respuestas indicadas.
+func NewFakeProvider(name string, replies ...FakeReply) *FakeProvider {
+	return &FakeProvider{name: name, replies: replies}
+}
+
+// Script agrega respuestas programadas al final de las pendientes.
+func (p *FakeProvider) Script(replies ...FakeReply) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replies = append(p.replies, replies...)
+}
+
+// Repeat fija la respuesta que se devuelve cuando no quedan respuestas programadas.
+func (p *FakeProvider) Repeat(reply FakeReply) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.repeat = &reply
+}
+
+// Requests devuelve las solicitudes recibidas.
+func (p *FakeProvider) Requests() []ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ChatRequest{}, p.requests...)
+}
+
+func (p *FakeProvider) Name() string {
+	return p.name
+}
+
+func (p *FakeProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	reply, err := p.next(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return p.response(req, reply), nil
+}
+
+func (p *FakeProvider) ChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	reply, err := p.next(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range strings.SplitAfter(reply.Content, " ") {
+		if word == "" {
+			continue
+		}
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+	return p.response(req, reply), nil
+}
+
+func (p *FakeProvider) Embeddings(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	vectors := make([][]float32, len(inputs))
+	for i, input := range inputs {
+		vector := make([]float32, fakeEmbeddingSize)
+		for j := range vector {
+			hash := fnv.New32a()
+			hash.Write([]byte{byte(j)})
+			hash.Write([]byte(input))
+			vector[j] = float32(hash.Sum32()%1000) / 1000
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func (p *FakeProvider) CountTokens(model string, messages []ChatMessage) int {
+	return estimateTokens(messages)
+}
+
+// next guarda la solicitud y devuelve la siguiente respuesta programada.
+func (p *FakeProvider) next(ctx context.Context, req ChatRequest) (FakeReply, error) {
+	if err := ctx.Err(); err != nil {
+		return FakeReply{}, completionError(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	if len(p.replies) == 0 && p.repeat != nil {
+		return *p.repeat, p.repeat.Err
+	}
+	if len(p.replies) == 0 {
+		return FakeReply{}, status.Errorf(codes.Internal, "el proveedor simulado %s no tiene más respuestas programadas", p.name)
+	}
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return reply, reply.Err
+}
+
+// response arma la respuesta con el uso de tokens estimado.
+func (p *FakeProvider) response(req ChatRequest, reply FakeReply) *ChatResponse {
+	message := ChatMessage{Role: RoleAssistant, Content: reply.Content, ToolCalls: reply.ToolCalls}
+	prompt := estimateTokens(req.Messages)
+	completion := estimateTokens([]ChatMessage{message})
+	return &ChatResponse{
+		Message: message,
+		Usage:   Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion},
+	}
+}
@@ -2,51 +2,344 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"strings"
+	"time"
 
+	"chatbot/initializers"
 	"chatbot/logger"
+	"chatbot/utils"
+	"chatbot/utils/cache"
 	pb "chatbot/utils/proto"
 
+	"github.com/go-redis/redis/v8"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
 )
 
 const (
 	port = ":50052"
+
+	// replyContractVersion es la versión de la respuesta estructurada que devuelve el servidor.
+	replyContractVersion = 1
+
+	// Separadores del formato de respuesta que se pide al modelo
+	replyPartSeparator   = "|||"
+	replyOptionSeparator = "|"
 )
 
+// serverConfig define los modelos, los prompts y el historial del servidor.
+type serverConfig struct {
+	Model             string
+	AnalyzerModel     string
+	AssistantPrompt   string
+	AnalyzerPrompt    string
+	ThreadTTL         time.Duration
+	MaxThreadMessages int
+	PromptCacheTTL    time.Duration
+}
+
+// serverConfigFromEnv lee la configuración de las variables OPENAI_* y AI_*.
+func serverConfigFromEnv() serverConfig {
+	model := initializers.GetEnvString("OPENAI_MODEL", "gpt-4o-mini")
+	return serverConfig{
+		Model:             model,
+		AnalyzerModel:     initializers.GetEnvString("OPENAI_ANALYZER_MODEL", model),
+		AssistantPrompt:   initializers.GetEnvString("AI_PROMPT_ASISTENTE", "asistente"),
+		AnalyzerPrompt:    initializers.GetEnvString("AI_PROMPT_ANALIZADOR", "analizador"),
+		ThreadTTL:         initializers.GetEnvDuration("AI_THREAD_TTL", 48*time.Hour),
+		MaxThreadMessages: initializers.GetEnvInt("AI_THREAD_MAX_MESSAGES", 40),
+		PromptCacheTTL:    initializers.GetEnvDuration("AI_PROMPT_CACHE_TTL", time.Minute),
+	}
+}
+
+// server implementa el servicio de IA con los proveedores de modelos configurados. El historial de
+// cada hilo se guarda en Redis y los prompts, con el proveedor que los atiende, se leen de las tablas
+// de prompts.
 type server struct {
 	pb.UnimplementedWhatsAppServiceServer
+
+	cfg       serverConfig
+	threads   *threadStore
+	prompts   *promptStore
+	providers providerRegistry
+}
+
+// newServer crea el servidor con las conexiones y los proveedores indicados.
+func newServer(cfg serverConfig, gormDB *gorm.DB, rdb *redis.Client, providers providerRegistry) *server {
+	return &server{
+		cfg:       cfg,
+		threads:   newThreadStore(rdb, cfg.ThreadTTL, cfg.MaxThreadMessages),
+		prompts:   newPromptStore(gormDB, cfg.PromptCacheTTL),
+		providers: providers,
+	}
+}
+
+// newServerFromEnv crea el servidor con las conexiones a Postgres y Redis ya inicializadas y los
+// proveedores configurados en el entorno.
+func newServerFromEnv() (*server, error) {
+	if initializers.DB == nil {
+		return nil, fmt.Errorf("la conexión a Postgres no está inicializada")
+	}
+	rdb, err := initializers.GetRedisConn()
+	if err != nil {
+		return nil, err
+	}
+	providers, err := providersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return newServer(serverConfigFromEnv(), initializers.DB, rdb, providers), nil
+}
+
+// chatRequest elige el proveedor y el modelo del prompt y arma la solicitud.
+func (s *server) chatRequest(prompt promptConfig, defaultModel string, messages []ChatMessage) (LLMProvider, ChatRequest, error) {
+	provider, err := s.providers.Get(prompt.Provider)
+	if err != nil {
+		return nil, ChatRequest{}, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	model := prompt.Model
+	if model == "" {
+		model = defaultModel
+	}
+	return provider, ChatRequest{Model: model, Messages: messages}, nil
 }
 
 func (s *server) CreateThread(ctx context.Context, in *pb.CreateThreadRequest) (*pb.CreateThreadResponse, error) {
-	// Implementación de CreateThread
-	return &pb.CreateThreadResponse{ThreadId: "nuevo_thread_id"}, nil
+	threadID := s.threads.Create("hilo_")
+	logger.Log.Infof("Hilo %s creado", threadID)
+	return &pb.CreateThreadResponse{ThreadId: threadID}, nil
 }
 
 func (s *server) CreateThreadAnalizer(ctx context.Context, in *pb.CreateThreadAnalizerRequest) (*pb.CreateThreadAnalizerResponse, error) {
-	// Implementación de CreateThreadAnalizer
-	return &pb.CreateThreadAnalizerResponse{ThreadIdAnalizer: "nuevo_thread_analizer_id"}, nil
+	threadID := s.threads.Create("analizador_")
+	logger.Log.Infof("Hilo analizador %s creado", threadID)
+	return &pb.CreateThreadAnalizerResponse{ThreadIdAnalizer: threadID}, nil
 }
 
 func (s *server) GenerateResponse(ctx context.Context, in *pb.GenerateResponseRequest) (*pb.GenerateResponseResponse, error) {
-	// Implementación de GenerateResponse
-	return &pb.GenerateResponseResponse{Response: "respuesta_generada"}, nil
+	provider, req, userMessage, err := s.assistantRequest(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := provider.ChatCompletion(ctx, req)
+	if err != nil {
+		logger.Log.Errorf("Error al generar la respuesta del hilo %s: %v", in.ThreadId, err)
+		return nil, err
+	}
+	return s.saveReply(ctx, in.ThreadId, userMessage, result), nil
+}
+
+func (s *server) GenerateResponseStream(in *pb.GenerateResponseRequest, stream pb.WhatsAppService_GenerateResponseStreamServer) error {
+	ctx := stream.Context()
+	provider, req, userMessage, err := s.assistantRequest(ctx, in)
+	if err != nil {
+		return err
+	}
+
+	// Solo se envían los fragmentos de la respuesta; la pregunta y las opciones llegan en el final
+	cutter := &replyCutter{}
+	result, err := provider.ChatCompletionStream(ctx, req, func(delta string) error {
+		if text := cutter.Write(delta); text != "" {
+			return stream.Send(&pb.GenerateResponseChunk{Delta: text})
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Errorf("Error al generar la respuesta en streaming del hilo %s: %v", in.ThreadId, err)
+		return err
+	}
+	if text := cutter.Flush(); text != "" {
+		if err := stream.Send(&pb.GenerateResponseChunk{Delta: text}); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&pb.GenerateResponseChunk{Final: s.saveReply(ctx, in.ThreadId, userMessage, result)})
 }
 
 func (s *server) GenerateResponseAnalizer(ctx context.Context, in *pb.GenerateResponseAnalizerRequest) (*pb.GenerateResponseAnalizerResponse, error) {
-	// Implementación de GenerateResponseAnalizer
-	return &pb.GenerateResponseAnalizerResponse{Response: "respuesta_analizer_generada"}, nil
+	if in.ThreadIdAnalizer == "" {
+		return nil, status.Error(codes.InvalidArgument, "falta el id del hilo analizador")
+	}
+	intereses := cache.ObtenerInteresCache()
+	if len(intereses) == 0 {
+		return &pb.GenerateResponseAnalizerResponse{}, nil
+	}
+
+	history, err := s.threads.History(ctx, in.ThreadIdAnalizer)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	userMessage := ChatMessage{Role: RoleUser, Content: in.MessageBody}
+	prompt := s.prompts.Get(s.cfg.AnalyzerPrompt, defaultAnalyzerPrompt)
+
+	// El historial del analizador solo guarda los mensajes del usuario: cada análisis considera toda
+	// la conversación y no depende de los resultados anteriores
+	messages := append([]ChatMessage{{Role: RoleSystem, Content: analyzerInstructions(prompt.Content, intereses)}}, history...)
+	provider, req, err := s.chatRequest(prompt, s.cfg.AnalyzerModel, append(messages, userMessage))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := provider.ChatCompletion(ctx, req)
+	if err != nil {
+		logger.Log.Errorf("Error al analizar el hilo %s: %v", in.ThreadIdAnalizer, err)
+		return nil, err
+	}
+	if err := s.threads.Append(ctx, in.ThreadIdAnalizer, userMessage); err != nil {
+		logger.Log.Errorf("Error al guardar el mensaje del hilo analizador: %v", err)
+	}
+	return &pb.GenerateResponseAnalizerResponse{Response: filterInterests(result.Message.Content)}, nil
+}
+
+// assistantRequest arma la solicitud al proveedor del asistente: las instrucciones, el historial del
+// hilo y el mensaje nuevo del usuario, que se devuelve aparte para guardarlo con la respuesta.
+func (s *server) assistantRequest(ctx context.Context, in *pb.GenerateResponseRequest) (LLMProvider, ChatRequest, ChatMessage, error) {
+	userMessage := ChatMessage{Role: RoleUser, Content: userContent(in)}
+	if in.ThreadId == "" {
+		return nil, ChatRequest{}, userMessage, status.Error(codes.InvalidArgument, "falta el id del hilo")
+	}
+
+	history, err := s.threads.History(ctx, in.ThreadId)
+	if err != nil {
+		return nil, ChatRequest{}, userMessage, status.Error(codes.Unavailable, err.Error())
+	}
+	prompt := s.prompts.Get(s.cfg.AssistantPrompt, defaultAssistantPrompt)
+
+	messages := append([]ChatMessage{{Role: RoleSystem, Content: assistantInstructions(prompt.Content)}}, history...)
+	provider, req, err := s.chatRequest(prompt, s.cfg.Model, append(messages, userMessage))
+	return provider, req, userMessage, err
+}
+
+// saveReply guarda el mensaje y la respuesta en el historial del hilo y arma la respuesta estructurada.
+// Un fallo al guardar no impide responder.
+func (s *server) saveReply(ctx context.Context, threadID string, userMessage ChatMessage, result *ChatResponse) *pb.GenerateResponseResponse {
+	reply := ChatMessage{Role: RoleAssistant, Content: result.Message.Content}
+	if err := s.threads.Append(ctx, threadID, userMessage, reply); err != nil {
+		logger.Log.Errorf("Error al guardar la respuesta en el hilo %s: %v", threadID, err)
+	}
+
+	res := parseReply(result.Message.Content)
+	res.Usage = &pb.TokenUsage{
+		PromptTokens:     int32(result.Usage.PromptTokens),
+		CompletionTokens: int32(result.Usage.CompletionTokens),
+		TotalTokens:      int32(result.Usage.TotalTokens),
+	}
+	return res
+}
+
+// userContent arma el mensaje del usuario e indica la opción elegida si responde a un mensaje interactivo.
+func userContent(in *pb.GenerateResponseRequest) string {
+	option := in.SelectedOption
+	if option == nil {
+		return in.MessageBody
+	}
+	content := fmt.Sprintf("Elegí la opción \"%s\"", option.Title)
+	if option.Question != "" {
+		content += fmt.Sprintf(" a la pregunta \"%s\"", option.Question)
+	}
+	if in.MessageBody != "" && in.MessageBody != option.Title {
+		content += "\n" + in.MessageBody
+	}
+	return content
 }
 
-func StartGRPCServer() {
+// parseReply convierte el texto del modelo en la respuesta estructurada: un párrafo por parte, la
+// pregunta de seguimiento y sus opciones. El texto original se conserva en Response.
+func parseReply(text string) *pb.GenerateResponseResponse {
+	res := &pb.GenerateResponseResponse{Response: text, ContractVersion: replyContractVersion}
+
+	sections := strings.Split(text, replyPartSeparator)
+	for _, paragraph := range strings.Split(sections[0], "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			res.Parts = append(res.Parts, &pb.ReplyPart{Kind: pb.ReplyKind_REPLY_KIND_TEXT, Text: paragraph})
+		}
+	}
+	if len(sections) > 1 {
+		res.FollowUpQuestion = strings.TrimSpace(sections[1])
+	}
+	if len(sections) > 2 {
+		for _, title := range strings.Split(sections[2], replyOptionSeparator) {
+			if title = strings.TrimSpace(title); title != "" {
+				res.Options = append(res.Options, &pb.ReplyOption{Id: utils.InteractiveButtonID(len(res.Options)), Title: title})
+			}
+		}
+	}
+	return res
+}
+
+// replyCutter deja pasar el texto en streaming hasta el separador de la pregunta de seguimiento. Retiene
+// las barras del final de cada fragmento hasta saber si son parte del separador.
+type replyCutter struct {
+	pending string
+	done    bool
+}
+
+// Write agrega un fragmento y devuelve el texto que ya se puede enviar.
+func (c *replyCutter) Write(delta string) string {
+	if c.done {
+		return ""
+	}
+	text := c.pending + delta
+	if index := strings.Index(text, replyPartSeparator); index >= 0 {
+		c.done = true
+		c.pending = ""
+		return text[:index]
+	}
+	keep := len(text) - len(strings.TrimRight(text, replyOptionSeparator))
+	c.pending = text[len(text)-keep:]
+	return text[:len(text)-keep]
+}
+
+// Flush devuelve el texto retenido al terminar la respuesta.
+func (c *replyCutter) Flush() string {
+	text := c.pending
+	c.pending = ""
+	if c.done {
+		return ""
+	}
+	return text
+}
+
+// StartGRPCServer inicia el servidor de IA y atiende las solicitudes en segundo plano. Devuelve el
+// servidor para detenerlo con GracefulStop. Requiere las conexiones a Postgres y Redis ya
+// inicializadas y el catálogo de intereses cargado en caché.
+func StartGRPCServer() (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
-		logger.Log.Fatalf("failed to listen: %v", err)
+		return nil, fmt.Errorf("fallo al escuchar en %s: %w", port, err)
 	}
-	s := grpc.NewServer()
-	pb.RegisterWhatsAppServiceServer(s, &server{})
-	logger.Log.Infof("gRPC server is running on port %v", port)
-	if err := s.Serve(lis); err != nil {
-		logger.Log.Fatalf("failed to serve: %v", err)
+	aiServer, err := newServerFromEnv()
+	if err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("fallo al crear el servidor de IA: %w", err)
 	}
+
+	// Aceptar los pings de keepalive de los clientes, que por defecto se rechazan si son de menos de 5 minutos
+	s := grpc.NewServer(grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             30 * time.Second,
+		PermitWithoutStream: true,
+	}))
+	pb.RegisterWhatsAppServiceServer(s, aiServer)
+
+	// Responder al protocolo estándar de health check de gRPC
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(pb.WhatsAppService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	logger.Log.Infof("gRPC server is running on port %v (modelo %s)", port, aiServer.cfg.Model)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			logger.Log.Errorf("El servidor de IA dejó de atender solicitudes: %v", err)
+		}
+	}()
+	return s, nil
 }
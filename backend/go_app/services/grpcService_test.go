@@ -0,0 +1,94 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	pb "chatbot/utils/proto"
+)
+
+func TestReplyCutter(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []string
+		// want es el texto entregado tras cada fragmento y, en el último elemento, por Flush.
+		want []string
+	}{
+		{
+			name:   "sin separador",
+			deltas: []string{"Hola, ", "¿cómo estás?"},
+			want:   []string{"Hola, ", "¿cómo estás?", ""},
+		},
+		{
+			name:   "corta en el separador",
+			deltas: []string{"Respuesta.|||¿Pregunta?", "|||Sí|No"},
+			want:   []string{"Respuesta.", "", ""},
+		},
+		{
+			name:   "separador partido entre fragmentos",
+			deltas: []string{"Respuesta.|", "|", "|¿Pregunta?"},
+			want:   []string{"Respuesta.", "", "", ""},
+		},
+		{
+			name:   "barras que no forman el separador",
+			deltas: []string{"Uno |", "| dos"},
+			want:   []string{"Uno ", "|| dos", ""},
+		},
+		{
+			name:   "barras al terminar",
+			deltas: []string{"Uno ||"},
+			want:   []string{"Uno ", "||"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cutter replyCutter
+			var got []string
+			for _, delta := range tt.deltas {
+				got = append(got, cutter.Write(delta))
+			}
+			got = append(got, cutter.Flush())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("texto entregado = %q, se esperaba %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantParts    []string
+		wantQuestion string
+		wantOptions  []string
+	}{
+		{name: "un párrafo", text: "Hola", wantParts: []string{"Hola"}},
+		{name: "varios párrafos", text: "Uno.\n\n\n\nDos.\n\n", wantParts: []string{"Uno.", "Dos."}},
+		{name: "pregunta y opciones", text: "Hola|||¿Seguimos?|||Sí| |No", wantParts: []string{"Hola"}, wantQuestion: "¿Seguimos?", wantOptions: []string{"button_1=Sí", "button_2=No"}},
+		{name: "sin texto", text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := parseReply(tt.text)
+			if res.Response != tt.text || res.ContractVersion != replyContractVersion {
+				t.Errorf("texto %q con versión %d, se esperaba el original con la versión %d", res.Response, res.ContractVersion, replyContractVersion)
+			}
+			var parts, options []string
+			for _, part := range res.Parts {
+				if part.Kind != pb.ReplyKind_REPLY_KIND_TEXT {
+					t.Errorf("parte de tipo %v, se esperaba texto", part.Kind)
+				}
+				parts = append(parts, part.Text)
+			}
+			for _, option := range res.Options {
+				options = append(options, option.Id+"="+option.Title)
+			}
+			if !reflect.DeepEqual(parts, tt.wantParts) || res.FollowUpQuestion != tt.wantQuestion || !reflect.DeepEqual(options, tt.wantOptions) {
+				t.Errorf("partes %q, pregunta %q, opciones %q; se esperaba %q, %q, %q", parts, res.FollowUpQuestion, options, tt.wantParts, tt.wantQuestion, tt.wantOptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"chatbot/initializers"
+)
+
+// Roles de los mensajes de una conversación
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// defaultProvider es el proveedor de los prompts que no indican otro.
+const defaultProvider = "openai"
+
+// fakeProviderName es el nombre con el que se configura en LLM_PROVIDERS el proveedor simulado, que
+// responde siempre LLM_FAKE_REPLY sin conectarse a ningún servicio.
+const fakeProviderName = "fake"
+
+// defaultFakeReply es la respuesta del proveedor simulado si no se configura LLM_FAKE_REPLY.
+const defaultFakeReply = "Respuesta simulada."
+
+// ChatMessage es un mensaje de la conversación que se envía al modelo. Las respuestas del asistente
+// pueden pedir llamadas a herramientas y las respuestas de las herramientas indican a cuál responden.
+type ChatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Name       string     `json:"name,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool es una función que el modelo puede pedir que se ejecute. Parameters es su JSON Schema.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// ToolCall es una llamada a una herramienta pedida por el modelo, con sus argumentos en JSON.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ChatRequest es una solicitud de continuación de una conversación.
+type ChatRequest struct {
+	Model    string
+	Messages []ChatMessage
+	Tools    []Tool
+}
+
+// Usage es el número de tokens usados en una solicitud.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// ChatResponse es la respuesta del modelo a una solicitud.
+type ChatResponse struct {
+	Message ChatMessage
+	Usage   Usage
+}
+
+// LLMProvider es un proveedor de modelos de lenguaje. Los errores que devuelve son errores de gRPC,
+// de modo que el servidor los pueda devolver a sus clientes tal cual.
+type LLMProvider interface {
+	// Name devuelve el nombre del proveedor con el que se elige en los prompts.
+	Name() string
+	// ChatCompletion devuelve la respuesta del modelo a la conversación.
+	ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// ChatCompletionStream devuelve la respuesta del modelo a la conversación y llama a onDelta con
+	// cada fragmento de texto a medida que se genera.
+	ChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (*ChatResponse, error)
+	// Embeddings devuelve un vector por cada texto.
+	Embeddings(ctx context.Context, model string, inputs []string) ([][]float32, error)
+	// CountTokens estima los tokens que ocupan los mensajes en el modelo.
+	CountTokens(model string, messages []ChatMessage) int
+}
+
+// estimateTokens estima los tokens de los mensajes con la aproximación habitual de unos cuatro
+// caracteres por token más un costo fijo por mensaje. Sirve para decidir cuánto historial cabe, no
+// para facturar.
+func estimateTokens(messages []ChatMessage) int {
+	const tokensPerMessage = 4
+	total := 3
+	for _, message := range messages {
+		chars := utf8.RuneCountInString(message.Content) + utf8.RuneCountInString(message.Name)
+		for _, call := range message.ToolCalls {
+			chars += utf8.RuneCountInString(call.Name) + utf8.RuneCountInString(call.Arguments)
+		}
+		total += tokensPerMessage + (chars+3)/4
+	}
+	return total
+}
+
+// providerRegistry guarda los proveedores disponibles por nombre.
+type providerRegistry map[string]LLMProvider
+
+// Get devuelve el proveedor con el nombre indicado o el predeterminado si el nombre está vacío.
+func (r providerRegistry) Get(name string) (LLMProvider, error) {
+	if name == "" {
+		name = defaultProvider
+	}
+	provider, ok := r[name]
+	if !ok {
+		return nil, fmt.Errorf("proveedor de IA %q no configurado", name)
+	}
+	return provider, nil
+}
+
+// providersFromEnv crea los proveedores compatibles con la API de OpenAI configurados en el entorno.
+// El proveedor "openai" usa OPENAI_API_KEY y OPENAI_BASE_URL; los indicados en LLM_PROVIDERS,
+// separados por comas, usan LLM_<NOMBRE>_API_KEY y LLM_<NOMBRE>_BASE_URL. El nombre "fake" configura
+// el proveedor simulado, para ejecutar el servidor sin credenciales.
+func providersFromEnv() (providerRegistry, error) {
+	providers := providerRegistry{}
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		providers[defaultProvider] = NewOpenAIProvider(OpenAIConfig{
+			Name:    defaultProvider,
+			APIKey:  apiKey,
+			BaseURL: os.Getenv("OPENAI_BASE_URL"),
+		})
+	}
+
+	var first string
+	for _, name := range strings.Split(os.Getenv("LLM_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == defaultProvider {
+			continue
+		}
+		if first == "" {
+			first = name
+		}
+		if name == fakeProviderName {
+			fake := NewFakeProvider(name)
+			fake.Repeat(FakeReply{Content: initializers.GetEnvString("LLM_FAKE_REPLY", defaultFakeReply)})
+			providers[name] = fake
+			continue
+		}
+		prefix := "LLM_" + strings.ToUpper(name) + "_"
+		baseURL := os.Getenv(prefix + "BASE_URL")
+		if baseURL == "" {
+			return nil, fmt.Errorf("falta %sBASE_URL para el proveedor de IA %s", prefix, name)
+		}
+		providers[name] = NewOpenAIProvider(OpenAIConfig{
+			Name:    name,
+			APIKey:  os.Getenv(prefix + "API_KEY"),
+			BaseURL: baseURL,
+		})
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no hay proveedores de IA configurados: falta OPENAI_API_KEY o LLM_PROVIDERS")
+	}
+	if _, ok := providers[defaultProvider]; !ok {
+		// Sin OpenAI, el primer proveedor configurado atiende los prompts que no indican otro
+		providers[defaultProvider] = providers[first]
+	}
+	return providers, nil
+}
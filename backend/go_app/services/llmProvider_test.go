@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chatbot/logger"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestProvidersFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantErr   string
+		providers []string
+		defaultTo string
+	}{
+		{
+			name:    "sin proveedores",
+			env:     map[string]string{},
+			wantErr: "no hay proveedores de IA configurados",
+		},
+		{
+			name:      "proveedor simulado como predeterminado",
+			env:       map[string]string{"LLM_PROVIDERS": "fake"},
+			providers: []string{"fake"},
+			defaultTo: "fake",
+		},
+		{
+			name:      "openai sigue siendo el predeterminado",
+			env:       map[string]string{"OPENAI_API_KEY": "sk-prueba", "LLM_PROVIDERS": " fake ,otro", "LLM_OTRO_BASE_URL": "http://localhost:8000/v1"},
+			providers: []string{"fake", "otro"},
+			defaultTo: "openai",
+		},
+		{
+			name:    "proveedor sin url",
+			env:     map[string]string{"LLM_PROVIDERS": "otro"},
+			wantErr: "LLM_OTRO_BASE_URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"OPENAI_API_KEY", "OPENAI_BASE_URL", "LLM_PROVIDERS", "LLM_OTRO_BASE_URL", "LLM_FAKE_REPLY"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			providers, err := providersFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, se esperaba uno con %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error inesperado: %v", err)
+			}
+			for _, name := range tt.providers {
+				provider, err := providers.Get(name)
+				if err != nil {
+					t.Fatalf("Get(%q): %v", name, err)
+				}
+				if provider.Name() != name {
+					t.Errorf("Get(%q).Name() = %q", name, provider.Name())
+				}
+			}
+			provider, err := providers.Get("")
+			if err != nil {
+				t.Fatalf("Get(\"\"): %v", err)
+			}
+			if provider.Name() != tt.defaultTo {
+				t.Errorf("proveedor predeterminado = %q, se esperaba %q", provider.Name(), tt.defaultTo)
+			}
+			if _, err := providers.Get("desconocido"); err == nil {
+				t.Error("Get de un proveedor no configurado no devolvió error")
+			}
+		})
+	}
+}
+
+func TestFakeProviderFromEnvRepeatsReply(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("LLM_PROVIDERS", "fake")
+	t.Setenv("LLM_FAKE_REPLY", "Hola desde el simulador")
+
+	providers, err := providersFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := providers.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := provider.ChatCompletion(context.Background(), ChatRequest{Messages: []ChatMessage{{Role: RoleUser, Content: "hola"}}})
+		if err != nil {
+			t.Fatalf("llamada %d: %v", i+1, err)
+		}
+		if res.Message.Content != "Hola desde el simulador" {
+			t.Errorf("llamada %d: respuesta %q", i+1, res.Message.Content)
+		}
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	failure := status.Error(codes.Unavailable, "caído")
+	tests := []struct {
+		name     string
+		replies  []FakeReply
+		stream   bool
+		want     string
+		deltas   []string
+		wantCode codes.Code
+	}{
+		{name: "respuesta programada", replies: []FakeReply{{Content: "uno dos"}}, want: "uno dos"},
+		{name: "streaming por palabras", replies: []FakeReply{{Content: "uno dos tres"}}, stream: true, want: "uno dos tres", deltas: []string{"uno ", "dos ", "tres"}},
+		{name: "error programado", replies: []FakeReply{{Err: failure}}, wantCode: codes.Unavailable},
+		{name: "sin respuestas", wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewFakeProvider("fake", tt.replies...)
+			req := ChatRequest{Model: "modelo", Messages: []ChatMessage{{Role: RoleUser, Content: "hola"}}}
+
+			var deltas []string
+			var res *ChatResponse
+			var err error
+			if tt.stream {
+				res, err = provider.ChatCompletionStream(context.Background(), req, func(delta string) error {
+					deltas = append(deltas, delta)
+					return nil
+				})
+			} else {
+				res, err = provider.ChatCompletion(context.Background(), req)
+			}
+
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("código = %v, se esperaba %v (%v)", status.Code(err), tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Message.Content != tt.want || res.Message.Role != RoleAssistant {
+				t.Errorf("mensaje = %+v, se esperaba %q del asistente", res.Message, tt.want)
+			}
+			if strings.Join(deltas, "|") != strings.Join(tt.deltas, "|") {
+				t.Errorf("fragmentos = %q, se esperaba %q", deltas, tt.deltas)
+			}
+			if res.Usage.TotalTokens != res.Usage.PromptTokens+res.Usage.CompletionTokens || res.Usage.PromptTokens == 0 {
+				t.Errorf("uso de tokens inconsistente: %+v", res.Usage)
+			}
+			if requests := provider.Requests(); len(requests) != 1 || requests[0].Model != "modelo" {
+				t.Errorf("solicitudes guardadas = %+v", requests)
+			}
+		})
+	}
+}
+
+func TestChatRequestUsesPromptProvider(t *testing.T) {
+	s := &server{providers: providerRegistry{
+		defaultProvider: NewFakeProvider(defaultProvider),
+		"local":         NewFakeProvider("local"),
+	}}
+	messages := []ChatMessage{{Role: RoleUser, Content: "hola"}}
+
+	tests := []struct {
+		name         string
+		prompt       promptConfig
+		wantProvider string
+		wantModel    string
+		wantCode     codes.Code
+	}{
+		{name: "predeterminados", prompt: promptConfig{}, wantProvider: defaultProvider, wantModel: "gpt-por-defecto"},
+		{name: "proveedor y modelo del prompt", prompt: promptConfig{Provider: "local", Model: "llama"}, wantProvider: "local", wantModel: "llama"},
+		{name: "proveedor no configurado", prompt: promptConfig{Provider: "otro"}, wantCode: codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, req, err := s.chatRequest(tt.prompt, "gpt-por-defecto", messages)
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("código = %v, se esperaba %v", status.Code(err), tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if provider.Name() != tt.wantProvider || req.Model != tt.wantModel || len(req.Messages) != 1 {
+				t.Errorf("proveedor %q, solicitud %+v; se esperaba %q con el modelo %q", provider.Name(), req, tt.wantProvider, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestFakeProviderEmbeddings(t *testing.T) {
+	provider := NewFakeProvider("fake")
+	inputs := []string{"hola", "adiós", "hola"}
+
+	vectors, err := provider.Embeddings(context.Background(), "modelo", inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != len(inputs) {
+		t.Fatalf("%d vectores, se esperaban %d", len(vectors), len(inputs))
+	}
+	for i, vector := range vectors {
+		if len(vector) != fakeEmbeddingSize {
+			t.Errorf("vector %d de dimensión %d, se esperaba %d", i, len(vector), fakeEmbeddingSize)
+		}
+	}
+	if !reflect.DeepEqual(vectors[0], vectors[2]) {
+		t.Errorf("el mismo texto dio vectores distintos: %v y %v", vectors[0], vectors[2])
+	}
+	if reflect.DeepEqual(vectors[0], vectors[1]) {
+		t.Errorf("textos distintos dieron el mismo vector: %v", vectors[0])
+	}
+}
+
+func TestOpenAIProviderEmbeddings(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		want     [][]float32
+		wantCode codes.Code
+	}{
+		{
+			name:   "vectores en el orden de los textos",
+			status: http.StatusOK,
+			body:   `{"object":"list","data":[{"object":"embedding","index":1,"embedding":[0.3,0.4]},{"object":"embedding","index":0,"embedding":[0.1,0.2]}]}`,
+			want:   [][]float32{{0.1, 0.2}, {0.3, 0.4}},
+		},
+		{
+			name:     "límite de uso",
+			status:   http.StatusTooManyRequests,
+			body:     `{"error":{"message":"demasiadas solicitudes","type":"rate_limit"}}`,
+			wantCode: codes.ResourceExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct {
+				Input []string `json:"input"`
+				Model string   `json:"model"`
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/embeddings" {
+					t.Errorf("ruta %q, se esperaba /embeddings", r.URL.Path)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("solicitud inválida: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			provider := NewOpenAIProvider(OpenAIConfig{APIKey: "sk-prueba", BaseURL: server.URL + "/"})
+			vectors, err := provider.Embeddings(context.Background(), "modelo-vectores", []string{"uno", "dos"})
+			if tt.wantCode != codes.OK {
+				if status.Code(err) != tt.wantCode {
+					t.Fatalf("código = %v, se esperaba %v (%v)", status.Code(err), tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Model != "modelo-vectores" || !reflect.DeepEqual(got.Input, []string{"uno", "dos"}) {
+				t.Errorf("solicitud enviada = %+v", got)
+			}
+			if !reflect.DeepEqual(vectors, tt.want) {
+				t.Errorf("vectores = %v, se esperaba %v", vectors, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []ChatMessage
+		want     int
+	}{
+		{name: "sin mensajes", want: 3},
+		{name: "un mensaje", messages: []ChatMessage{{Role: RoleUser, Content: "hola"}}, want: 3 + 4 + 1},
+		{name: "caracteres multibyte", messages: []ChatMessage{{Role: RoleUser, Content: "¿qué tal?"}}, want: 3 + 4 + 3},
+		{
+			name: "llamadas a herramientas",
+			messages: []ChatMessage{
+				{Role: RoleSystem, Content: "Eres un asistente."},
+				{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "1", Name: "buscar", Arguments: `{"q":"envíos"}`}}},
+			},
+			want: 3 + (4 + 5) + (4 + 5),
+		},
+	}
+
+	providers := []LLMProvider{NewFakeProvider("fake"), NewOpenAIProvider(OpenAIConfig{APIKey: "sk-prueba"})}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, provider := range providers {
+				if got := provider.CountTokens("modelo", tt.messages); got != tt.want {
+					t.Errorf("%s: CountTokens() = %d, se esperaba %d", provider.Name(), got, tt.want)
+				}
+			}
+		})
+	}
+}
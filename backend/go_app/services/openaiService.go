@@ -1,165 +1,220 @@
 package services
 
 import (
-	"chatbot/logger"
 	"context"
-	"os"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
 
-	"github.com/joho/godotenv"
 	openai "github.com/sashabaranov/go-openai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-var client *openai.Client
-
-func init() {
-	// Cargar variables de entorno
-	err := godotenv.Load()
-	if err != nil {
-		logger.Log.Fatalf("Error al cargar el archivo .env: %v", err)
-	}
-
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		logger.Log.Fatalf("OPENAI_API_KEY no está configurada en el archivo .env")
-	}
-
-	client = openai.NewClient(apiKey)
+// OpenAIConfig define un proveedor compatible con la API de OpenAI.
+type OpenAIConfig struct {
+	// Name es el nombre con el que los prompts eligen el proveedor.
+	Name   string
+	APIKey string
+	// BaseURL reemplaza la dirección de la API, por ejemplo para Azure, un proxy o un servidor local
+	// compatible. Vacía usa la API de OpenAI.
+	BaseURL string
 }
 
-// CreateThread simula la creación de un hilo utilizando la API de OpenAI
-func CreateThread() string {
-	logger.Log.Info("Creando hilo...")
-	// Simulación de la creación de un hilo
-	threadID := "new_thread_id"
-	logger.Log.Infof("Hilo %s creado.", threadID)
-	return threadID
+// openAIProvider implementa LLMProvider con la API de chat de OpenAI o una compatible.
+type openAIProvider struct {
+	name   string
+	client *openai.Client
 }
 
-/*
-// RetrieveThread simula la recuperación de un hilo utilizando la API de OpenAI
-func RetrieveThread(threadID string) *openai.ChatCompletion {
-	logger.Log.Infof("Recuperando hilo %s...", threadID)
-	// Simulación de la recuperación de un hilo
-	return nil
-}
-*/
-
-// CreateThreadAnalizer simula la creación de un hilo analizador utilizando la API de OpenAI
-func CreateThreadAnalizer() string {
-	logger.Log.Info("Creando hilo analizador...")
-	// Simulación de la creación de un hilo analizador
-	threadID := "new_thread_analizer_id"
-	logger.Log.Infof("Hilo analizador %s creado.", threadID)
-	return threadID
-}
-
-/*
-// RetrieveThreadAnalizer simula la recuperación de un hilo analizador utilizando la API de OpenAI
-func RetrieveThreadAnalizer(threadID string) *openai.ChatCompletion {
-	logger.Log.Infof("Recuperando hilo analizador %s...", threadID)
-	// Simulación de la recuperación de un hilo analizador
-	return nil
+// NewOpenAIProvider crea un proveedor compatible con la API de OpenAI.
+func NewOpenAIProvider(cfg OpenAIConfig) LLMProvider {
+	config := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		config.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	name := cfg.Name
+	if name == "" {
+		name = defaultProvider
+	}
+	return &openAIProvider{name: name, client: openai.NewClientWithConfig(config)}
 }
-*/
 
-// DeleteThread simula la eliminación de un hilo utilizando la API de OpenAI
-func DeleteThread(threadID string) {
-	logger.Log.Infof("Eliminando hilo %s debido a inactividad...", threadID)
-	// Simulación de la eliminación de un hilo
-	logger.Log.Infof("Hilo %s eliminado.", threadID)
+func (p *openAIProvider) Name() string {
+	return p.name
 }
 
-// RetrieveThreadContext simula la recuperación de mensajes de un hilo utilizando la API de OpenAI
-func RetrieveThreadContext(threadID string) []*openai.ChatCompletionMessage {
-	logger.Log.Infof("Recuperando el contexto del hilo %s...", threadID)
-	// Simulación de la recuperación de mensajes de un hilo
-	messages := []*openai.ChatCompletionMessage{
-		{Role: "user", Content: "Ejemplo de mensaje"},
+func (p *openAIProvider) ChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, chatCompletionRequest(req))
+	if err != nil {
+		return nil, completionError(err)
 	}
-	for _, message := range messages {
-		logger.Log.Infof("Rol: %s, Contenido: %s", message.Role, message.Content)
+	if len(resp.Choices) == 0 {
+		return nil, status.Error(codes.Internal, "el modelo no devolvió ninguna respuesta")
 	}
-	return messages
+	return &ChatResponse{Message: fromOpenAIMessage(resp.Choices[0].Message), Usage: fromOpenAIUsage(resp.Usage)}, nil
 }
 
-// RunAssistant ejecuta el asistente en un hilo de conversación y recupera el mensaje generado
-func RunAssistant(threadID string) string {
-	RetrieveThreadContext(threadID)
-
-	logger.Log.Info("Ejecutando asistente...")
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "text-davinci-003",
-			Messages: []openai.ChatCompletionMessage{
-				{Role: "user", Content: "Hola, ¿cómo estás?"},
-			},
-		},
-	)
+func (p *openAIProvider) ChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (*ChatResponse, error) {
+	request := chatCompletionRequest(req)
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
 	if err != nil {
-		logger.Log.Errorf("Error al ejecutar asistente: %v", err)
-		return "Lo siento, ocurrió un error al procesar tu solicitud."
+		return nil, completionError(err)
 	}
-
-	newMessage := resp.Choices[0].Message.Content
-	logger.Log.Infof("Mensaje generado: %s", newMessage)
-	return newMessage
+	defer stream.Close()
+
+	var text strings.Builder
+	var calls []ToolCall
+	result := &ChatResponse{Message: ChatMessage{Role: RoleAssistant}}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, completionError(err)
+		}
+		if resp.Usage != nil {
+			result.Usage = fromOpenAIUsage(*resp.Usage)
+		}
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		delta := resp.Choices[0].Delta
+		// Los argumentos de las llamadas a herramientas llegan repartidos entre fragmentos con el mismo índice
+		for _, call := range delta.ToolCalls {
+			index := len(calls) - 1
+			if call.Index != nil {
+				index = *call.Index
+			}
+			if index < 0 {
+				index = 0
+			}
+			for len(calls) <= index {
+				calls = append(calls, ToolCall{})
+			}
+			if call.ID != "" {
+				calls[index].ID = call.ID
+			}
+			calls[index].Name += call.Function.Name
+			calls[index].Arguments += call.Function.Arguments
+		}
+		if delta.Content == "" {
+			continue
+		}
+		text.WriteString(delta.Content)
+		if err := onDelta(delta.Content); err != nil {
+			return nil, err
+		}
+	}
+	result.Message.Content = text.String()
+	result.Message.ToolCalls = calls
+	return result, nil
 }
 
-// RunAssistantAnalizer ejecuta el asistente analizador en un hilo de conversación y recupera el mensaje generado
-func RunAssistantAnalizer(threadID string) string {
-	RetrieveThreadContext(threadID)
-
-	logger.Log.Info("Ejecutando asistente analizador...")
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: "text-davinci-003",
-			Messages: []openai.ChatCompletionMessage{
-				{Role: "user", Content: "Analiza este mensaje"},
-			},
-		},
-	)
+func (p *openAIProvider) Embeddings(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: inputs,
+		Model: openai.EmbeddingModel(model),
+	})
 	if err != nil {
-		logger.Log.Errorf("Error al ejecutar asistente analizador: %v", err)
-		return "Lo siento, ocurrió un error al procesar tu solicitud."
+		return nil, completionError(err)
+	}
+	vectors := make([][]float32, len(inputs))
+	for _, embedding := range resp.Data {
+		if embedding.Index < len(vectors) {
+			vectors[embedding.Index] = embedding.Embedding
+		}
 	}
+	return vectors, nil
+}
 
-	newMessage := resp.Choices[0].Message.Content
-	logger.Log.Infof("Mensaje generado: %s", newMessage)
-	return newMessage
+func (p *openAIProvider) CountTokens(model string, messages []ChatMessage) int {
+	return estimateTokens(messages)
 }
 
-// GenerateResponse genera una respuesta basada en un mensaje de usuario, utilizando el asistente de OpenAI
-func GenerateResponse(name, phone, threadID, messageBody string) string {
-	logger.Log.Infof("Pregunta del usuario %s con hilo %s: %s", phone, threadID, messageBody)
-	response := RunAssistant(threadID)
-	logger.Log.Infof("Última actividad para el hilo %s fue actualizada.", threadID)
-	return response
+// chatCompletionRequest convierte la solicitud al formato de la API de OpenAI.
+func chatCompletionRequest(req ChatRequest) openai.ChatCompletionRequest {
+	request := openai.ChatCompletionRequest{Model: req.Model}
+	for _, message := range req.Messages {
+		converted := openai.ChatCompletionMessage{
+			Role:       message.Role,
+			Content:    message.Content,
+			Name:       message.Name,
+			ToolCallID: message.ToolCallID,
+		}
+		for _, call := range message.ToolCalls {
+			converted.ToolCalls = append(converted.ToolCalls, openai.ToolCall{
+				ID:       call.ID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+		request.Messages = append(request.Messages, converted)
+	}
+	for _, tool := range req.Tools {
+		function := &openai.FunctionDefinition{Name: tool.Name, Description: tool.Description}
+		if len(tool.Parameters) > 0 {
+			function.Parameters = tool.Parameters
+		} else {
+			function.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		request.Tools = append(request.Tools, openai.Tool{Type: openai.ToolTypeFunction, Function: function})
+	}
+	return request
 }
 
-// GenerateResponseAnalizer genera una respuesta analizador basada en un mensaje de usuario, utilizando el asistente de OpenAI
-func GenerateResponseAnalizer(threadID, messageBody string) string {
-	logger.Log.Infof("Pregunta del hilo %s para analizar: %s", threadID, messageBody)
-	response := RunAssistantAnalizer(threadID)
-	logger.Log.Infof("Última actividad para el hilo %s fue actualizada.", threadID)
-	return response
+// fromOpenAIMessage convierte un mensaje de la API de OpenAI.
+func fromOpenAIMessage(message openai.ChatCompletionMessage) ChatMessage {
+	converted := ChatMessage{Role: message.Role, Content: message.Content, Name: message.Name, ToolCallID: message.ToolCallID}
+	for _, call := range message.ToolCalls {
+		converted.ToolCalls = append(converted.ToolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return converted
 }
 
-// ListThreads simula la lista de todos los hilos
-func ListThreads() []string {
-	logger.Log.Info("Obteniendo todos los hilos...")
-	threads := []string{"thread_1", "thread_2", "thread_3"}
-	logger.Log.Infof("Threads listados correctamente, cantidad: %d", len(threads))
-	return threads
+// fromOpenAIUsage convierte el uso de tokens de la API de OpenAI.
+func fromOpenAIUsage(usage openai.Usage) Usage {
+	return Usage{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens, TotalTokens: usage.TotalTokens}
 }
 
-// DeleteAllThreads elimina todos los hilos simulando la función
-func DeleteAllThreads() {
-	logger.Log.Info("Eliminando todos los hilos...")
-	threads := ListThreads()
-	for _, threadID := range threads {
-		DeleteThread(threadID)
+// completionError convierte un error de la API de OpenAI en un error de gRPC, de modo que el cliente
+// distinga los fallos del proveedor, que abren su circuito, de los errores de la solicitud.
+func completionError(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	statusCode := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		statusCode = reqErr.HTTPStatusCode
+	}
+
+	var netErr net.Error
+	switch {
+	case statusCode == 429:
+		return status.Errorf(codes.ResourceExhausted, "límite de uso del proveedor de IA: %v", err)
+	case statusCode == 401 || statusCode == 403:
+		return status.Errorf(codes.PermissionDenied, "credenciales del proveedor de IA rechazadas: %v", err)
+	case statusCode >= 400 && statusCode < 500:
+		return status.Errorf(codes.InvalidArgument, "solicitud rechazada por el proveedor de IA: %v", err)
+	case statusCode >= 500, errors.As(err, &netErr):
+		return status.Errorf(codes.Unavailable, "proveedor de IA no disponible: %v", err)
+	default:
+		return status.Errorf(codes.Unknown, "error del proveedor de IA: %v", err)
 	}
-	logger.Log.Info("Todos los hilos eliminados.")
 }
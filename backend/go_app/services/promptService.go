@@ -0,0 +1,129 @@
+package services
+
+import (
+	"chatbot/logger"
+	"chatbot/models"
+	"chatbot/utils/cache"
+	db "chatbot/utils/db"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultAssistantPrompt es el prompt del asistente cuando no hay uno activo en la base de datos.
+const defaultAssistantPrompt = "Eres el asistente de admisión de la universidad y atiendes a los postulantes por WhatsApp. " +
+	"Responde en español, con un tono cordial y mensajes breves. Si no conoces un dato, dilo y ofrece derivar la consulta a un asesor."
+
+// defaultAnalyzerPrompt es el prompt del analizador cuando no hay uno activo en la base de datos.
+const defaultAnalyzerPrompt = "Analiza los mensajes del usuario e identifica en qué temas del catálogo está interesado."
+
+// replyFormatInstructions describe el formato de respuesta que el servidor interpreta. Se agrega al
+// prompt del asistente para que no dependa de cómo esté redactado en la base de datos.
+const replyFormatInstructions = `Formato de la respuesta:
+- Escribe la respuesta en uno o más párrafos separados por una línea en blanco.
+- Si quieres continuar la conversación con una pregunta, agrega después de la respuesta "|||" y la pregunta.
+- Si la pregunta tiene respuestas posibles, agrega después de la pregunta "|||" y hasta tres opciones cortas separadas por "|".
+Ejemplo: Tenemos clases de lunes a viernes.|||¿Quieres conocer los costos?|||Sí|No`
+
+// analyzerFormatInstructions describe el formato de respuesta del analizador, el mismo que espera
+// utils.ProcesarInteresesUsuario.
+const analyzerFormatInstructions = `Responde solo con los intereses del catálogo que correspondan a la conversación, uno por línea, ` +
+	`con el código y la descripción exactamente como aparecen en el catálogo y terminados en ";". ` +
+	`Si ninguno corresponde, responde con un texto vacío.`
+
+// promptStore obtiene los prompts activos de la base de datos y los guarda en memoria durante ttl para
+// no consultarla en cada mensaje.
+type promptStore struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu     sync.Mutex
+	cached map[string]cachedPrompt
+}
+
+// promptConfig es el contenido de un prompt y el proveedor y modelo que lo atienden. Provider y Model
+// vacíos usan los predeterminados del servidor.
+type promptConfig struct {
+	Content  string
+	Provider string
+	Model    string
+}
+
+// cachedPrompt es un prompt guardado en memoria.
+type cachedPrompt struct {
+	prompt   promptConfig
+	loadedAt time.Time
+}
+
+// newPromptStore crea el almacén de prompts.
+func newPromptStore(db *gorm.DB, ttl time.Duration) *promptStore {
+	return &promptStore{db: db, ttl: ttl, cached: make(map[string]cachedPrompt)}
+}
+
+// Get devuelve el prompt activo con el nombre indicado o uno con el contenido fallback si no existe.
+// Si la base de datos falla se sigue usando la última versión leída.
+func (s *promptStore) Get(nombre, fallback string) promptConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached, ok := s.cached[nombre]
+	if ok && time.Since(cached.loadedAt) < s.ttl {
+		return cached.prompt
+	}
+
+	config := promptConfig{Content: fallback}
+	prompt, content, err := db.FindActivePrompt(s.db, nombre)
+	switch {
+	case err == nil:
+		config = promptConfig{Content: content, Provider: prompt.Proveedor, Model: prompt.Modelo}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		logger.Log.Warnf("No hay un prompt activo con el nombre %s, se usa el predeterminado", nombre)
+	default:
+		logger.Log.Errorf("Error al obtener el prompt %s: %v", nombre, err)
+		if ok {
+			config = cached.prompt
+		}
+	}
+
+	s.cached[nombre] = cachedPrompt{prompt: config, loadedAt: time.Now()}
+	return config
+}
+
+// assistantInstructions arma las instrucciones del asistente con el formato de respuesta.
+func assistantInstructions(prompt string) string {
+	return prompt + "\n\n" + replyFormatInstructions
+}
+
+// analyzerInstructions arma las instrucciones del analizador con el catálogo de intereses.
+func analyzerInstructions(prompt string, intereses []models.CatalogoInteres) string {
+	var b strings.Builder
+	b.WriteString(prompt)
+	b.WriteString("\n\nCatálogo de intereses:\n")
+	for _, interes := range intereses {
+		fmt.Fprintf(&b, "%s %s\n", interes.Codigo, interes.Descripcion)
+	}
+	b.WriteString("\n")
+	b.WriteString(analyzerFormatInstructions)
+	return b.String()
+}
+
+// filterInterests conserva solo las líneas de la respuesta del analizador que están en el catálogo.
+func filterInterests(response string) string {
+	valid := make(map[string]bool)
+	for _, interes := range cache.ObtenerInteresCache() {
+		valid[interes.Codigo+" "+interes.Descripcion] = true
+	}
+
+	var lines []string
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimSpace(line)
+		if valid[strings.TrimSuffix(line, ";")] {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// threadKeyPrefix es el prefijo de las claves de Redis con el historial de cada hilo.
+const threadKeyPrefix = "ia:hilo:"
+
+// threadStore guarda el historial de los hilos de conversación en Redis en lugar de los hilos de
+// OpenAI. Cada hilo es una lista con sus mensajes más recientes que expira tras un tiempo sin uso.
+type threadStore struct {
+	rdb         *redis.Client
+	ttl         time.Duration
+	maxMessages int64
+}
+
+// newThreadStore crea el almacén de hilos.
+func newThreadStore(rdb *redis.Client, ttl time.Duration, maxMessages int) *threadStore {
+	return &threadStore{rdb: rdb, ttl: ttl, maxMessages: int64(maxMessages)}
+}
+
+// Create genera el id de un hilo nuevo con el prefijo indicado. El historial se guarda con el primer mensaje.
+func (s *threadStore) Create(prefix string) string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return prefix + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return prefix + hex.EncodeToString(buf)
+}
+
+// History devuelve los mensajes guardados del hilo, del más antiguo al más reciente. Un hilo sin
+// mensajes o que ya expiró devuelve un historial vacío.
+func (s *threadStore) History(ctx context.Context, threadID string) ([]ChatMessage, error) {
+	payloads, err := s.rdb.LRange(ctx, threadKeyPrefix+threadID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("fallo al leer el historial del hilo %s: %w", threadID, err)
+	}
+
+	messages := make([]ChatMessage, 0, len(payloads))
+	for _, payload := range payloads {
+		var message ChatMessage
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// Append agrega mensajes al hilo, conserva solo los más recientes y renueva su expiración.
+func (s *threadStore) Append(ctx context.Context, threadID string, messages ...ChatMessage) error {
+	values := make([]interface{}, len(messages))
+	for i, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		values[i] = data
+	}
+
+	key := threadKeyPrefix + threadID
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, values...)
+		pipe.LTrim(ctx, key, -s.maxMessages, -1)
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fallo al guardar el historial del hilo %s: %w", threadID, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// chatbot/utils/aibackend/breaker.go
+
+package aibackend
+
+import (
+	"chatbot/logger"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen indica que la llamada no se hizo porque el circuito está abierto tras fallos repetidos
+// del servidor de IA.
+var ErrCircuitOpen = errors.New("circuito del servidor de IA abierto")
+
+// BreakerState es el estado del circuito.
+type BreakerState int
+
+const (
+	// StateClosed deja pasar todas las llamadas.
+	StateClosed BreakerState = iota
+	// StateOpen rechaza las llamadas hasta que pase el tiempo de espera.
+	StateOpen
+	// StateHalfOpen deja pasar una llamada de prueba; si tiene éxito el circuito se cierra.
+	StateHalfOpen
+)
+
+// String devuelve el nombre del estado.
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "abierto"
+	case StateHalfOpen:
+		return "semiabierto"
+	default:
+		return "cerrado"
+	}
+}
+
+// BreakerSnapshot es el estado del circuito en un momento dado.
+type BreakerSnapshot struct {
+	State     BreakerState
+	Failures  int
+	OpenedAt  time.Time
+	LastError string
+}
+
+// Breaker es un circuit breaker que se abre tras varios fallos consecutivos del servidor y, pasado
+// el tiempo de espera, deja pasar una llamada de prueba para decidir si vuelve a cerrarse.
+type Breaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+}
+
+// NewBreaker crea un circuito que se abre tras threshold fallos consecutivos y espera openTimeout
+// antes de probar de nuevo.
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 5
+	}
+	if openTimeout <= 0 {
+		openTimeout = 30 * time.Second
+	}
+	return &Breaker{threshold: threshold, openTimeout: openTimeout}
+}
+
+// Allow indica si se puede hacer una llamada y si es la llamada de prueba del circuito semiabierto.
+// Devuelve ErrCircuitOpen si el circuito está abierto o si ya hay una llamada de prueba en curso.
+func (b *Breaker) Allow() (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false, ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		logger.Log.Info("Circuito del servidor de IA semiabierto, se prueba una llamada")
+		return true, nil
+	case StateHalfOpen:
+		if b.probing {
+			return false, ErrCircuitOpen
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// Record registra el resultado de una llamada permitida por Allow, indicando si era la llamada de
+// prueba. Solo cuentan como fallo los errores que indican que el servidor no está disponible. Con el
+// circuito abierto o semiabierto solo cuenta la llamada de prueba: las que empezaron antes de abrirse
+// no deciden si vuelve a cerrarse.
+func (b *Breaker) Record(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateClosed && !(probe && b.state == StateHalfOpen) {
+		return
+	}
+	if probe {
+		b.probing = false
+	}
+
+	// Una llamada cancelada por quien la hizo no dice nada del servidor
+	if status.Code(err) == codes.Canceled {
+		return
+	}
+
+	if !isBackendFailure(err) {
+		if b.state != StateClosed {
+			logger.Log.Info("Circuito del servidor de IA cerrado, el servidor volvió a responder")
+		}
+		b.state = StateClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.threshold) {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+		logger.Log.Warnf("Circuito del servidor de IA abierto tras %d fallo(s): %v", b.failures, err)
+	}
+}
+
+// Snapshot devuelve el estado actual del circuito.
+func (b *Breaker) Snapshot() BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return BreakerSnapshot{State: b.state, Failures: b.failures, OpenedAt: b.openedAt, LastError: b.lastError}
+}
+
+// isBackendFailure indica si el error muestra que el servidor no está disponible o no responde a
+// tiempo. Los errores de la solicitud, como un argumento inválido, no abren el circuito.
+func isBackendFailure(err error) bool {
+	s, ok := status.FromError(err)
+	if err == nil || !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsUnavailable indica si el error se debe a que el servidor de IA no está disponible, ya sea porque
+// el circuito está abierto o porque la llamada falló por el servidor.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || isBackendFailure(err)
+}
@@ -0,0 +1,169 @@
+package aibackend
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"chatbot/logger"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// breakerStep es una llamada al circuito: se pide permiso con Allow y, si se concede y record es true,
+// se registra su resultado.
+type breakerStep struct {
+	// wait es el tiempo que se espera antes de la llamada.
+	wait   time.Duration
+	err    error
+	record bool
+	// hold deja la llamada en curso para registrarla en un paso posterior con recordHeld.
+	hold       bool
+	recordHeld bool
+
+	wantAllowErr error
+	wantProbe    bool
+	wantState    BreakerState
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "servidor caído")
+	invalid := status.Error(codes.InvalidArgument, "solicitud inválida")
+	canceled := status.Error(codes.Canceled, "cancelada")
+	const openTimeout = 20 * time.Millisecond
+
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{
+			name: "se abre tras el umbral de fallos consecutivos",
+			steps: []breakerStep{
+				{err: unavailable, record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateOpen},
+				{wantAllowErr: ErrCircuitOpen, wantState: StateOpen},
+			},
+		},
+		{
+			name: "un éxito reinicia la cuenta de fallos",
+			steps: []breakerStep{
+				{err: unavailable, record: true, wantState: StateClosed},
+				{record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateClosed},
+			},
+		},
+		{
+			name: "los errores de la solicitud y las cancelaciones no cuentan",
+			steps: []breakerStep{
+				{err: invalid, record: true, wantState: StateClosed},
+				{err: canceled, record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateClosed},
+				{err: invalid, record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateClosed},
+			},
+		},
+		{
+			name: "la prueba exitosa cierra el circuito",
+			steps: []breakerStep{
+				{err: unavailable, record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateOpen},
+				{wait: openTimeout, record: true, wantProbe: true, wantState: StateClosed},
+			},
+		},
+		{
+			name: "la prueba fallida vuelve a abrirlo",
+			steps: []breakerStep{
+				{err: unavailable, record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateOpen},
+				{wait: openTimeout, err: unavailable, record: true, wantProbe: true, wantState: StateOpen},
+				{wantAllowErr: ErrCircuitOpen, wantState: StateOpen},
+			},
+		},
+		{
+			name: "solo una llamada de prueba a la vez",
+			steps: []breakerStep{
+				{err: unavailable, record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateOpen},
+				{wait: openTimeout, hold: true, wantProbe: true, wantState: StateHalfOpen},
+				{wantAllowErr: ErrCircuitOpen, wantState: StateHalfOpen},
+				{recordHeld: true, wantState: StateClosed},
+			},
+		},
+		{
+			name: "una llamada anterior a la apertura no cierra el circuito",
+			steps: []breakerStep{
+				{hold: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateClosed},
+				{err: unavailable, record: true, wantState: StateOpen},
+				{recordHeld: true, wantState: StateOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(2, openTimeout)
+			var held struct {
+				probe bool
+				err   error
+			}
+			for i, step := range tt.steps {
+				time.Sleep(step.wait)
+				if step.recordHeld {
+					b.Record(held.probe, held.err)
+				} else {
+					probe, err := b.Allow()
+					if !errors.Is(err, step.wantAllowErr) {
+						t.Fatalf("paso %d: Allow() error = %v, se esperaba %v", i+1, err, step.wantAllowErr)
+					}
+					if probe != step.wantProbe {
+						t.Fatalf("paso %d: Allow() probe = %v, se esperaba %v", i+1, probe, step.wantProbe)
+					}
+					switch {
+					case err != nil:
+					case step.hold:
+						held.probe, held.err = probe, step.err
+					case step.record:
+						b.Record(probe, step.err)
+					}
+				}
+				if state := b.Snapshot().State; state != step.wantState {
+					t.Fatalf("paso %d: estado = %v, se esperaba %v", i+1, state, step.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "sin error"},
+		{name: "circuito abierto", err: ErrCircuitOpen, want: true},
+		{name: "servidor no disponible", err: status.Error(codes.Unavailable, "caído"), want: true},
+		{name: "tiempo agotado", err: status.Error(codes.DeadlineExceeded, "lento"), want: true},
+		{name: "solicitud inválida", err: status.Error(codes.InvalidArgument, "mal"), want: false},
+		{name: "error que no es de gRPC", err: errors.New("otro"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUnavailable(tt.err); got != tt.want {
+				t.Errorf("IsUnavailable(%v) = %v, se esperaba %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// chatbot/utils/aibackend/client.go
+
+package aibackend
+
+import (
+	"chatbot/logger"
+	"context"
+	"fmt"
+	"io"
+
+	pb "chatbot/utils/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/health" // Activa el health check del lado del cliente
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+)
+
+// serviceName es el nombre completo del servicio de IA en el proto.
+const serviceName = "whatsapp.WhatsAppService"
+
+// Client mantiene una única conexión con el servidor de IA y aplica un plazo a cada llamada. Las
+// llamadas pasan por un circuit breaker que, tras fallos repetidos, las rechaza con ErrCircuitOpen
+// sin esperar al servidor. Es seguro usarlo desde varias goroutines.
+type Client struct {
+	cfg     Config
+	conn    *grpc.ClientConn
+	rpc     pb.WhatsAppServiceClient
+	health  healthpb.HealthClient
+	breaker *Breaker
+}
+
+// NewClient crea el cliente con la configuración indicada. La conexión se establece en segundo plano
+// y se restablece sola si se pierde.
+func NewClient(cfg Config) (*Client, error) {
+	cfg = cfg.withDefaults()
+
+	creds := insecure.NewCredentials()
+	if cfg.TLS {
+		var err error
+		if creds, err = cfg.transportCredentials(); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := grpc.Dial(cfg.Target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(cfg.serviceConfig()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    cfg.KeepaliveTime,
+			Timeout: cfg.KeepaliveTimeout,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("fallo al crear la conexión con el servidor de IA %s: %w", cfg.Target, err)
+	}
+
+	logger.Log.Infof("Cliente del servidor de IA creado para %s (TLS: %v)", cfg.Target, cfg.TLS)
+	return &Client{
+		cfg:     cfg,
+		conn:    conn,
+		rpc:     pb.NewWhatsAppServiceClient(conn),
+		health:  healthpb.NewHealthClient(conn),
+		breaker: NewBreaker(cfg.BreakerFailures, cfg.BreakerOpenTimeout),
+	}, nil
+}
+
+// NewClientFromEnv crea el cliente con la configuración de las variables AI_BACKEND_*.
+func NewClientFromEnv() (*Client, error) {
+	return NewClient(ConfigFromEnv())
+}
+
+// Close cierra la conexión.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Breaker devuelve el estado del circuit breaker.
+func (c *Client) Breaker() BreakerSnapshot {
+	return c.breaker.Snapshot()
+}
+
+// guard ejecuta la llamada si el circuito lo permite y registra su resultado.
+func (c *Client) guard(call func() error) error {
+	probe, err := c.breaker.Allow()
+	if err != nil {
+		return err
+	}
+	err = call()
+	c.breaker.Record(probe, err)
+	return err
+}
+
+// CreateThread crea un hilo de conversación para el asistente y devuelve su id.
+func (c *Client) CreateThread(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var res *pb.CreateThreadResponse
+	err := c.guard(func() (err error) {
+		res, err = c.rpc.CreateThread(ctx, &pb.CreateThreadRequest{})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.ThreadId, nil
+}
+
+// CreateThreadAnalizer crea un hilo de conversación para el analizador y devuelve su id.
+func (c *Client) CreateThreadAnalizer(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	var res *pb.CreateThreadAnalizerResponse
+	err := c.guard(func() (err error) {
+		res, err = c.rpc.CreateThreadAnalizer(ctx, &pb.CreateThreadAnalizerRequest{})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.ThreadIdAnalizer, nil
+}
+
+// GenerateResponse genera la respuesta del asistente a un mensaje.
+func (c *Client) GenerateResponse(ctx context.Context, req *pb.GenerateResponseRequest) (*pb.GenerateResponseResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.GenerateTimeout)
+	defer cancel()
+
+	var res *pb.GenerateResponseResponse
+	err := c.guard(func() (err error) {
+		res, err = c.rpc.GenerateResponse(ctx, req)
+		return err
+	})
+	return res, err
+}
+
+// GenerateResponseStream genera la respuesta del asistente en streaming y llama a onChunk con cada
+// fragmento. Devuelve el error de la llamada o el primero que devuelva onChunk.
+func (c *Client) GenerateResponseStream(ctx context.Context, req *pb.GenerateResponseRequest, onChunk func(*pb.GenerateResponseChunk) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.StreamTimeout)
+	defer cancel()
+
+	return c.guard(func() error {
+		stream, err := c.rpc.GenerateResponseStream(ctx, req)
+		if err != nil {
+			return err
+		}
+		for {
+			chunk, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := onChunk(chunk); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// GenerateResponseAnalizer envía un mensaje al analizador y devuelve su respuesta sin procesar.
+func (c *Client) GenerateResponseAnalizer(ctx context.Context, threadIDAnalizer, messageBody string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.GenerateTimeout)
+	defer cancel()
+
+	var res *pb.GenerateResponseAnalizerResponse
+	err := c.guard(func() (err error) {
+		res, err = c.rpc.GenerateResponseAnalizer(ctx, &pb.GenerateResponseAnalizerRequest{
+			ThreadIdAnalizer: threadIDAnalizer,
+			MessageBody:      messageBody,
+		})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.Response, nil
+}
+
+// Check consulta el estado del servidor con el protocolo estándar de health check de gRPC.
+func (c *Client) Check(ctx context.Context) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	res, err := c.health.Check(ctx, &healthpb.HealthCheckRequest{Service: c.cfg.HealthService})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	return res.Status, nil
+}
@@ -0,0 +1,142 @@
+package aibackend
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "chatbot/utils/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAIServer es un servidor de IA de prueba. CreateThread y GenerateResponse fallan con UNAVAILABLE
+// las primeras failures veces y CreateThreadAnalizer no responde hasta que vence el plazo de la
+// llamada.
+type fakeAIServer struct {
+	pb.UnimplementedWhatsAppServiceServer
+	failures int32
+	calls    int32
+}
+
+func (s *fakeAIServer) CreateThread(ctx context.Context, req *pb.CreateThreadRequest) (*pb.CreateThreadResponse, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "servidor reiniciándose")
+	}
+	return &pb.CreateThreadResponse{ThreadId: "hilo_1"}, nil
+}
+
+func (s *fakeAIServer) GenerateResponse(ctx context.Context, req *pb.GenerateResponseRequest) (*pb.GenerateResponseResponse, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "servidor reiniciándose")
+	}
+	return &pb.GenerateResponseResponse{}, nil
+}
+
+func (s *fakeAIServer) CreateThreadAnalizer(ctx context.Context, req *pb.CreateThreadAnalizerRequest) (*pb.CreateThreadAnalizerResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// startFakeAIServer inicia el servidor de prueba con el health check estándar y devuelve un cliente
+// conectado a él con cfg.
+func startFakeAIServer(t *testing.T, ai *fakeAIServer, cfg Config) (*Client, *health.Server) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterWhatsAppServiceServer(server, ai)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	cfg.Target = lis.Addr().String()
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, healthServer
+}
+
+func TestClientRetriesUnavailable(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		failures    int32
+		wantCalls   int32
+		wantCode    codes.Code
+	}{
+		{name: "se recupera dentro de los intentos", maxAttempts: 3, failures: 2, wantCalls: 3, wantCode: codes.OK},
+		{name: "agota los intentos", maxAttempts: 2, failures: 5, wantCalls: 2, wantCode: codes.Unavailable},
+		{name: "sin reintentos", maxAttempts: 1, failures: 1, wantCalls: 1, wantCode: codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai := &fakeAIServer{failures: tt.failures}
+			client, _ := startFakeAIServer(t, ai, Config{MaxAttempts: tt.maxAttempts, Timeout: 5 * time.Second, BreakerFailures: 10})
+
+			threadID, err := client.CreateThread(context.Background())
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("CreateThread() error = %v, se esperaba el código %v", err, tt.wantCode)
+			}
+			if err == nil && threadID != "hilo_1" {
+				t.Errorf("hilo = %q, se esperaba %q", threadID, "hilo_1")
+			}
+			if calls := atomic.LoadInt32(&ai.calls); calls != tt.wantCalls {
+				t.Errorf("el servidor recibió %d llamada(s), se esperaban %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientDoesNotRetryGenerateResponse(t *testing.T) {
+	ai := &fakeAIServer{failures: 1}
+	client, _ := startFakeAIServer(t, ai, Config{MaxAttempts: 3, Timeout: 5 * time.Second, BreakerFailures: 10})
+
+	_, err := client.GenerateResponse(context.Background(), &pb.GenerateResponseRequest{ThreadId: "hilo_1", MessageBody: "hola"})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Fatalf("GenerateResponse() error = %v, se esperaba UNAVAILABLE", err)
+	}
+	if calls := atomic.LoadInt32(&ai.calls); calls != 1 {
+		t.Errorf("el servidor recibió %d llamadas, se esperaba 1 sin reintentos", calls)
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	client, _ := startFakeAIServer(t, &fakeAIServer{}, Config{Timeout: 100 * time.Millisecond, BreakerFailures: 10})
+
+	start := time.Now()
+	_, err := client.CreateThreadAnalizer(context.Background())
+	if code := status.Code(err); code != codes.DeadlineExceeded {
+		t.Fatalf("CreateThreadAnalizer() error = %v, se esperaba DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("la llamada tardó %v con un plazo de 100ms", elapsed)
+	}
+}
+
+func TestClientCheck(t *testing.T) {
+	client, healthServer := startFakeAIServer(t, &fakeAIServer{}, Config{Timeout: 5 * time.Second})
+
+	for _, want := range []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_SERVING, healthpb.HealthCheckResponse_NOT_SERVING} {
+		healthServer.SetServingStatus("", want)
+		got, err := client.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Check() = %v, se esperaba %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// chatbot/utils/aibackend/config.go
+
+package aibackend
+
+import (
+	"chatbot/initializers"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// DefaultTarget es la dirección del servidor de IA cuando no se configura otra.
+const DefaultTarget = "localhost:50052"
+
+// Config define la conexión con el servidor de IA.
+type Config struct {
+	// Target es la dirección del servidor en el formato de gRPC, por ejemplo "localhost:50052" o "dns:///ia:50052".
+	Target string
+
+	// TLS activa TLS. CAFile verifica el certificado del servidor y, si se indican CertFile y KeyFile,
+	// el cliente se autentica con su propio certificado (mTLS). ServerName reemplaza el nombre esperado.
+	TLS        bool
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+
+	// Timeout es el plazo de las llamadas cortas, como crear hilos o consultar el estado.
+	Timeout time.Duration
+	// GenerateTimeout es el plazo de las llamadas que generan una respuesta.
+	GenerateTimeout time.Duration
+	// StreamTimeout es el plazo total de una respuesta en streaming.
+	StreamTimeout time.Duration
+
+	// MaxAttempts es el número de intentos de una llamada idempotente que falla con UNAVAILABLE (como
+	// máximo 5). Las llamadas que generan respuestas no se reintentan.
+	MaxAttempts int
+
+	// KeepaliveTime es cada cuánto se verifica la conexión durante una llamada. El servidor debe
+	// permitir pings con esa frecuencia; los servidores gRPC rechazan por defecto los de menos de 5 minutos.
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+
+	// BreakerFailures es el número de fallos consecutivos que abre el circuito y BreakerOpenTimeout el
+	// tiempo que permanece abierto antes de probar de nuevo.
+	BreakerFailures    int
+	BreakerOpenTimeout time.Duration
+
+	// HealthService es el servicio cuyo estado se consulta con el protocolo estándar de health check de
+	// gRPC. Vacío consulta el estado general del servidor.
+	HealthService string
+}
+
+// ConfigFromEnv lee la configuración de las variables AI_BACKEND_*.
+func ConfigFromEnv() Config {
+	return Config{
+		Target:             initializers.GetEnvString("AI_BACKEND_TARGET", DefaultTarget),
+		TLS:                strings.EqualFold(os.Getenv("AI_BACKEND_TLS"), "true"),
+		CAFile:             os.Getenv("AI_BACKEND_CA_FILE"),
+		CertFile:           os.Getenv("AI_BACKEND_CERT_FILE"),
+		KeyFile:            os.Getenv("AI_BACKEND_KEY_FILE"),
+		ServerName:         os.Getenv("AI_BACKEND_SERVER_NAME"),
+		Timeout:            initializers.GetEnvDuration("AI_BACKEND_TIMEOUT", 10*time.Second),
+		GenerateTimeout:    initializers.GetEnvDuration("AI_BACKEND_GENERATE_TIMEOUT", 60*time.Second),
+		StreamTimeout:      initializers.GetEnvDuration("AI_BACKEND_STREAM_TIMEOUT", 120*time.Second),
+		MaxAttempts:        initializers.GetEnvInt("AI_BACKEND_MAX_ATTEMPTS", 3),
+		KeepaliveTime:      initializers.GetEnvDuration("AI_BACKEND_KEEPALIVE_TIME", 5*time.Minute),
+		KeepaliveTimeout:   initializers.GetEnvDuration("AI_BACKEND_KEEPALIVE_TIMEOUT", 20*time.Second),
+		BreakerFailures:    initializers.GetEnvInt("AI_BREAKER_FAILURES", 5),
+		BreakerOpenTimeout: initializers.GetEnvDuration("AI_BREAKER_OPEN_TIMEOUT", 30*time.Second),
+		HealthService:      os.Getenv("AI_BACKEND_HEALTH_SERVICE"),
+	}
+}
+
+// withDefaults completa los valores no configurados.
+func (c Config) withDefaults() Config {
+	if c.Target == "" {
+		c.Target = DefaultTarget
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.GenerateTimeout <= 0 {
+		c.GenerateTimeout = 60 * time.Second
+	}
+	if c.StreamTimeout <= 0 {
+		c.StreamTimeout = 2 * c.GenerateTimeout
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 1
+	}
+	if c.MaxAttempts > 5 {
+		c.MaxAttempts = 5
+	}
+	if c.KeepaliveTime <= 0 {
+		c.KeepaliveTime = 5 * time.Minute
+	}
+	if c.KeepaliveTimeout <= 0 {
+		c.KeepaliveTimeout = 20 * time.Second
+	}
+	return c
+}
+
+// transportCredentials crea las credenciales TLS o mTLS de la configuración.
+func (c Config) transportCredentials() (credentials.TransportCredentials, error) {
+	tlsConfig := &tls.Config{ServerName: c.ServerName, MinVersion: tls.VersionTLS12}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("fallo al leer la CA %s: %w", c.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("la CA %s no contiene certificados válidos", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("fallo al cargar el certificado del cliente: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// serviceConfig arma la configuración de servicio con la política de reintentos y el health check.
+// Solo se reintentan las llamadas idempotentes: crear hilos y el health check. GenerateResponse y
+// GenerateResponseAnalizer no, porque un reintento tras un fallo a mitad de camino puede agregar el
+// mensaje dos veces al hilo.
+func (c Config) serviceConfig() string {
+	methodConfig := map[string]interface{}{
+		"name": []map[string]string{
+			{"service": serviceName, "method": "CreateThread"},
+			{"service": serviceName, "method": "CreateThreadAnalizer"},
+			{"service": "grpc.health.v1.Health", "method": "Check"},
+		},
+	}
+	// gRPC ignora con una advertencia las políticas de un solo intento
+	if c.MaxAttempts > 1 {
+		methodConfig["retryPolicy"] = map[string]interface{}{
+			"maxAttempts":          c.MaxAttempts,
+			"initialBackoff":       "0.2s",
+			"maxBackoff":           "2s",
+			"backoffMultiplier":    2,
+			"retryableStatusCodes": []string{"UNAVAILABLE"},
+		}
+	}
+
+	config, _ := json.Marshal(map[string]interface{}{
+		"loadBalancingConfig": []map[string]interface{}{{"round_robin": map[string]interface{}{}}},
+		"healthCheckConfig":   map[string]string{"serviceName": c.HealthService},
+		"methodConfig":        []interface{}{methodConfig},
+	})
+	return string(config)
+}
@@ -0,0 +1,151 @@
+// go_app/utils/db/dedupUtils.go
+package db
+
+import (
+	"context"
+	"time"
+
+	"chatbot/logger"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	processedMessagePrefix = "mensaje_procesado:"
+	duplicateCounterKey    = "metricas:mensajes_duplicados"
+)
+
+// Resultados de ClaimMessage
+const (
+	// ClaimAcquired indica que el mensaje quedó reservado para la entrega y debe procesarse.
+	ClaimAcquired = iota
+	// ClaimProcessed indica que el mensaje ya se procesó: la entrega es un duplicado.
+	ClaimProcessed
+	// ClaimInProgress indica que otra entrega del mismo mensaje lo está procesando.
+	ClaimInProgress
+)
+
+// Valores del registro de un mensaje
+const (
+	messageProcessing = "procesando:"
+	messageProcessed  = "procesado"
+)
+
+// claimMessageScript reserva KEYS[1] para la entrega ARGV[1] durante ARGV[2] milisegundos. Devuelve
+// ClaimProcessed si el mensaje ya se procesó, ClaimInProgress si lo tiene otra entrega y
+// ClaimAcquired si la reserva queda a nombre de ARGV[1], aunque ya lo estuviera, como cuando la cola
+// vuelve a entregar una entrega reclamada.
+var claimMessageScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current == ARGV[3] then
+	return 1
+end
+if current and current ~= ARGV[1] then
+	return 2
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 0
+`)
+
+// releaseMessageScript elimina KEYS[1] solo si sigue reservado por la entrega ARGV[1].
+var releaseMessageScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// ClaimMessage reserva el id de un mensaje entrante para la entrega indicada antes de procesarlo. La
+// reserva dura ttl, de modo que si la instancia se cae otra entrega puede procesarlo después, y la
+// misma entrega puede retomarla siempre. La cola no vuelve a entregar una entrega mientras su handler
+// sigue en proceso, por lo que retomarla no lo procesa dos veces a la vez. Solo un mensaje ya
+// procesado es un duplicado.
+func ClaimMessage(ctx context.Context, redisConn *redis.Client, messageID, deliveryID string, ttl time.Duration) (int, error) {
+	result, err := claimMessageScript.Run(ctx, redisConn, []string{processedMessagePrefix + messageID},
+		messageProcessing+deliveryID, ttl.Milliseconds(), messageProcessed).Int()
+	if err != nil {
+		logger.Log.Errorf("Error al registrar el mensaje %s para deduplicación: %v", messageID, err)
+		return ClaimInProgress, err
+	}
+	return result, nil
+}
+
+// CompleteMessage marca un mensaje como procesado durante ttl, para descartar sus entregas repetidas.
+func CompleteMessage(ctx context.Context, redisConn *redis.Client, messageID string, ttl time.Duration) error {
+	err := redisConn.Set(ctx, processedMessagePrefix+messageID, messageProcessed, ttl).Err()
+	if err != nil {
+		logger.Log.Errorf("Error al marcar el mensaje %s como procesado: %v", messageID, err)
+	}
+	return err
+}
+
+// ReleaseMessage elimina la reserva de un mensaje cuyo procesamiento falló, para que un reintento lo
+// procese. No hace nada si la reserva ya no es de la entrega.
+func ReleaseMessage(ctx context.Context, redisConn *redis.Client, messageID, deliveryID string) error {
+	err := releaseMessageScript.Run(ctx, redisConn, []string{processedMessagePrefix + messageID}, messageProcessing+deliveryID).Err()
+	if err != nil {
+		logger.Log.Errorf("Error al liberar el registro del mensaje %s: %v", messageID, err)
+	}
+	return err
+}
+
+// CountDuplicateMessage incrementa el contador global de entregas duplicadas y devuelve el total.
+func CountDuplicateMessage(ctx context.Context, redisConn *redis.Client) (int64, error) {
+	total, err := redisConn.Incr(ctx, duplicateCounterKey).Result()
+	if err != nil {
+		logger.Log.Errorf("Error al incrementar el contador de mensajes duplicados: %v", err)
+	}
+	return total, err
+}
+
+// deliveryAcksPrefix es el prefijo del conjunto con las partes confirmadas de una entrega del webhook.
+const deliveryAcksPrefix = "entrega_confirmada:"
+
+// DeliveryStatusesAck es la parte de una entrega que corresponde a sus actualizaciones de estado.
+const DeliveryStatusesAck = "estados"
+
+// AckDeliveryParts registra las partes de una entrega que terminaron bien, por el id de cada mensaje o
+// DeliveryStatusesAck, para que un reintento de la entrega solo procese las que fallaron. El registro
+// dura ttl.
+func AckDeliveryParts(ctx context.Context, redisConn *redis.Client, deliveryID string, parts []string, ttl time.Duration) error {
+	if len(parts) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(parts))
+	for i, part := range parts {
+		members[i] = part
+	}
+	key := deliveryAcksPrefix + deliveryID
+	_, err := redisConn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		logger.Log.Errorf("Error al registrar las partes confirmadas de la entrega %s: %v", deliveryID, err)
+	}
+	return err
+}
+
+// DeliveryAcks devuelve las partes de una entrega confirmadas por intentos anteriores.
+func DeliveryAcks(ctx context.Context, redisConn *redis.Client, deliveryID string) (map[string]bool, error) {
+	parts, err := redisConn.SMembers(ctx, deliveryAcksPrefix+deliveryID).Result()
+	if err != nil {
+		logger.Log.Errorf("Error al obtener las partes confirmadas de la entrega %s: %v", deliveryID, err)
+		return nil, err
+	}
+	acked := make(map[string]bool, len(parts))
+	for _, part := range parts {
+		acked[part] = true
+	}
+	return acked, nil
+}
+
+// ClearDeliveryAcks elimina el registro de las partes confirmadas de una entrega que ya terminó.
+func ClearDeliveryAcks(ctx context.Context, redisConn *redis.Client, deliveryID string) error {
+	err := redisConn.Del(ctx, deliveryAcksPrefix+deliveryID).Err()
+	if err != nil {
+		logger.Log.Errorf("Error al eliminar las partes confirmadas de la entrega %s: %v", deliveryID, err)
+	}
+	return err
+}
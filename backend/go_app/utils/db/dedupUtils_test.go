@@ -0,0 +1,197 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"chatbot/utils/redistest"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDeliveryAcks(t *testing.T) {
+	rdb := redistest.New(t)
+	ctx := context.Background()
+	deliveryID := fmt.Sprintf("prueba-%d", time.Now().UnixNano())
+	t.Cleanup(func() { ClearDeliveryAcks(context.Background(), rdb, deliveryID) })
+
+	// Cada intento agrega las partes que terminaron bien a las de los anteriores
+	attempts := [][]string{
+		{DeliveryStatusesAck, "wamid.1"},
+		nil,
+		{"wamid.3"},
+	}
+	want := map[string]bool{}
+	for i, parts := range attempts {
+		if err := AckDeliveryParts(ctx, rdb, deliveryID, parts, time.Minute); err != nil {
+			t.Fatalf("intento %d: %v", i+1, err)
+		}
+		for _, part := range parts {
+			want[part] = true
+		}
+		acked, err := DeliveryAcks(ctx, rdb, deliveryID)
+		if err != nil {
+			t.Fatalf("intento %d: %v", i+1, err)
+		}
+		if !reflect.DeepEqual(acked, want) {
+			t.Errorf("intento %d: partes confirmadas = %v, se esperaba %v", i+1, acked, want)
+		}
+	}
+
+	if err := ClearDeliveryAcks(ctx, rdb, deliveryID); err != nil {
+		t.Fatal(err)
+	}
+	acked, err := DeliveryAcks(ctx, rdb, deliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acked) != 0 {
+		t.Errorf("partes confirmadas tras terminar la entrega = %v", acked)
+	}
+}
+
+func TestClaimMessage(t *testing.T) {
+	const messageID = "wamid.1"
+	key := processedMessagePrefix + messageID
+
+	tests := []struct {
+		name string
+		// setup prepara el registro del mensaje antes de reservarlo.
+		setup      func(t *testing.T, rdb *redis.Client)
+		deliveryID string
+		// wait es el tiempo que pasa en el servidor antes de reservar.
+		wait           time.Duration
+		want           int
+		wantValue      string
+		wantDuplicates int64
+	}{
+		{
+			name:       "mensaje nuevo",
+			deliveryID: "entrega-1",
+			want:       ClaimAcquired,
+			wantValue:  messageProcessing + "entrega-1",
+		},
+		{
+			name: "mensaje ya procesado",
+			setup: func(t *testing.T, rdb *redis.Client) {
+				if err := CompleteMessage(context.Background(), rdb, messageID, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			},
+			deliveryID:     "entrega-2",
+			want:           ClaimProcessed,
+			wantValue:      messageProcessed,
+			wantDuplicates: 1,
+		},
+		{
+			name:       "reservado por otra entrega",
+			setup:      claimAs("entrega-1"),
+			deliveryID: "entrega-2",
+			want:       ClaimInProgress,
+			wantValue:  messageProcessing + "entrega-1",
+		},
+		{
+			name:       "la misma entrega lo retoma",
+			setup:      claimAs("entrega-1"),
+			deliveryID: "entrega-1",
+			want:       ClaimAcquired,
+			wantValue:  messageProcessing + "entrega-1",
+		},
+		{
+			name:       "otra entrega lo toma al vencer la reserva",
+			setup:      claimAs("entrega-1"),
+			wait:       2 * time.Minute,
+			deliveryID: "entrega-2",
+			want:       ClaimAcquired,
+			wantValue:  messageProcessing + "entrega-2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, rdb := redistest.NewServer(t)
+			ctx := context.Background()
+			if tt.setup != nil {
+				tt.setup(t, rdb)
+			}
+			server.FastForward(tt.wait)
+
+			got, err := ClaimMessage(ctx, rdb, messageID, tt.deliveryID, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ClaimMessage() = %d, se esperaba %d", got, tt.want)
+			}
+			// Solo un mensaje ya procesado se cuenta como duplicado y no se vuelve a responder
+			if got == ClaimProcessed {
+				if _, err := CountDuplicateMessage(ctx, rdb); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if value, _ := server.Get(key); value != tt.wantValue {
+				t.Errorf("registro del mensaje = %q, se esperaba %q", value, tt.wantValue)
+			}
+			if duplicates, _ := rdb.Get(ctx, duplicateCounterKey).Int64(); duplicates != tt.wantDuplicates {
+				t.Errorf("duplicados = %d, se esperaban %d", duplicates, tt.wantDuplicates)
+			}
+		})
+	}
+}
+
+func TestReleaseMessage(t *testing.T) {
+	const messageID = "wamid.1"
+	key := processedMessagePrefix + messageID
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, rdb *redis.Client)
+		deliveryID string
+		wantValue  string
+	}{
+		{name: "la entrega dueña la libera", setup: claimAs("entrega-1"), deliveryID: "entrega-1", wantValue: ""},
+		{name: "otra entrega no la libera", setup: claimAs("entrega-1"), deliveryID: "entrega-2", wantValue: messageProcessing + "entrega-1"},
+		{
+			name: "un mensaje procesado no se libera",
+			setup: func(t *testing.T, rdb *redis.Client) {
+				if err := CompleteMessage(context.Background(), rdb, messageID, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			},
+			deliveryID: "entrega-1",
+			wantValue:  messageProcessed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, rdb := redistest.NewServer(t)
+			tt.setup(t, rdb)
+
+			if err := ReleaseMessage(context.Background(), rdb, messageID, tt.deliveryID); err != nil {
+				t.Fatal(err)
+			}
+			value := ""
+			if server.Exists(key) {
+				value, _ = server.Get(key)
+			}
+			if value != tt.wantValue {
+				t.Errorf("registro del mensaje = %q, se esperaba %q", value, tt.wantValue)
+			}
+		})
+	}
+}
+
+// claimAs reserva el mensaje "wamid.1" para la entrega indicada durante un minuto.
+func claimAs(deliveryID string) func(t *testing.T, rdb *redis.Client) {
+	return func(t *testing.T, rdb *redis.Client) {
+		t.Helper()
+		claim, err := ClaimMessage(context.Background(), rdb, "wamid.1", deliveryID, time.Minute)
+		if err != nil || claim != ClaimAcquired {
+			t.Fatalf("no se pudo reservar el mensaje para %s: %d, %v", deliveryID, claim, err)
+		}
+	}
+}
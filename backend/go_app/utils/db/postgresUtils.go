@@ -3,106 +3,293 @@ package db
 import (
 	"chatbot/logger"
 	"chatbot/models"
+	"chatbot/utils/session"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// SaveOfRedisToPostgres guarda los datos de Redis en la base de datos relacional
-func SaveOfRedisToPostgres(db *gorm.DB, sessionData map[string]interface{}) error {
-	userInfo := sessionData["user_info"].(map[string]interface{})
-	var usuario models.UsuarioChat
+// Estados de los hilos guardados en Postgres
+const (
+	hiloActivo   = "activo"
+	hiloInactivo = "inactivo"
+)
 
-	// Intentar obtener el usuario de la base de datos
-	if err := db.Where("telefono = ?", userInfo["phone"]).First(&usuario).Error; err != nil {
-		// Si no se encuentra, crear un nuevo usuario
-		usuario = models.UsuarioChat{
-			Telefono: userInfo["phone"].(string),
-			Nombre:   userInfo["name"].(string),
-			WaID:     userInfo["phone"].(string),
-			Email:    "email_defecto@example.com",
-			Dni:      "12345678",
-		}
-		if err := db.Create(&usuario).Error; err != nil {
-			logger.Log.Errorf("Error al crear el usuario: %v", err)
-			return err
+// remitenteBot es el remitente de los mensajes enviados por el bot.
+const remitenteBot = "bot"
+
+// archiveBatchSize es el número de filas que se insertan por sentencia al guardar una sesión.
+const archiveBatchSize = 100
+
+// SpillSessionMessages devuelve la función que guarda en Postgres los mensajes antiguos que salen del
+// historial de la sesión en Redis. Los mensajes se asocian al hilo de la sesión, que se crea si aún no
+// existe, y conservan la hora en que se enviaron. Omite los que no son posteriores al último mensaje
+// guardado del hilo, de modo que reintentar un desborde que no se llegó a quitar de Redis no los
+// duplica.
+func SpillSessionMessages(db *gorm.DB) session.SpillFunc {
+	return func(ctx context.Context, sess *session.Session, messages []session.Message) error {
+		if sess.Thread == "" {
+			return fmt.Errorf("la sesión de %s no tiene hilo", sess.UserInfo.Phone)
 		}
-		logger.Log.Infof("Usuario %s creado exitosamente.", usuario.Telefono)
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			usuario, err := findOrCreateUsuario(tx, sess.UserInfo)
+			if err != nil {
+				return err
+			}
+			hilo, created, err := findOrCreateHilo(tx, usuario, sess, sess.Thread, hiloActivo)
+			if err != nil {
+				return err
+			}
+			if !created {
+				if messages, err = unsavedMessages(tx, hilo, messages); err != nil {
+					return err
+				}
+			}
+			if err := createMensajes(tx, hilo, messages); err != nil {
+				return fmt.Errorf("fallo al guardar el historial antiguo del hilo %s: %w", hilo.HiloOpenAI, err)
+			}
+			return nil
+		})
 	}
+}
 
-	// Crear un nuevo hilo
-	hilo := models.Hilo{
-		UsuarioID:      usuario.ID,
-		HiloOpenAI:     sessionData["thread"].(string),
-		HiloAnalizador: sessionData["thread_analizer"].(string),
-		EstadoHilo:     "inactivo",
-		FechaInicio:    time.Now(),
-		FechaFin:       time.Now(),
-	}
-	if err := db.Create(&hilo).Error; err != nil {
-		logger.Log.Errorf("Error al crear el hilo: %v", err)
+// SaveOfRedisToPostgres guarda la sesión de Redis en la base de datos relacional en una sola
+// transacción, con sus mensajes y los intereses detectados. Es idempotente por hilo: si el hilo ya se
+// archivó, solo guarda los mensajes posteriores a su fecha de fin, de modo que se puede reintentar sin
+// duplicar datos y una sesión que siguió abierta tras archivarse se completa al volver a vencer. Los
+// mensajes que ya se guardaron al salir del historial reciente se omiten.
+func SaveOfRedisToPostgres(db *gorm.DB, sess *session.Session) error {
+	// Leer los intereses antes de abrir la transacción para no mantenerla abierta esperando a Redis
+	interests, err := sessionInterests(sess.ThreadAnalizer)
+	if err != nil {
 		return err
 	}
-	logger.Log.Infof("Hilo %s creado exitosamente para el usuario %s.", hilo.HiloOpenAI, usuario.Telefono)
+	threadID := archiveThreadID(sess)
 
-	// Crear los mensajes asociados al hilo
-	for _, msg := range sessionData["messages"].([]interface{}) {
-		message := msg.(map[string]interface{})
-		mensaje := models.Mensaje{
-			HiloID:        hilo.ID,
-			TextoMensaje:  message["message"].(string),
-			TipoMensaje:   message["type"].(string),
-			FechaCreacion: time.Now(),
+	return db.Transaction(func(tx *gorm.DB) error {
+		usuario, err := findOrCreateUsuario(tx, sess.UserInfo)
+		if err != nil {
+			return err
 		}
-		if err := db.Create(&mensaje).Error; err != nil {
-			logger.Log.Errorf("Error al crear el mensaje: %v", err)
+
+		// Obtener el hilo, que ya existe si se guardó parte del historial, y marcarlo como inactivo
+		hilo, created, err := findOrCreateHilo(tx, usuario, sess, threadID, hiloInactivo)
+		if err != nil {
 			return err
 		}
+		messages := sess.Messages
+		if !created {
+			if hilo.EstadoHilo == hiloInactivo {
+				if !sess.LastActivity.Truncate(time.Microsecond).After(hilo.FechaFin) {
+					logger.Log.Infof("El hilo %s ya estaba archivado, no se vuelve a guardar.", hilo.HiloOpenAI)
+					return nil
+				}
+				// La sesión siguió abierta tras archivarse; guardar solo lo posterior
+				messages = messagesAfter(sess.Messages, hilo.FechaFin)
+				if interests, err = newInterests(tx, hilo, interests); err != nil {
+					return err
+				}
+			} else {
+				// El hilo tiene el historial antiguo guardado al desbordar; omitir lo ya guardado
+				if messages, err = unsavedMessages(tx, hilo, messages); err != nil {
+					return err
+				}
+			}
+			err := tx.Model(&hilo).Updates(map[string]interface{}{"estado_hilo": hiloInactivo, "fecha_fin": sess.LastActivity}).Error
+			if err != nil {
+				return fmt.Errorf("fallo al actualizar el hilo %s: %w", hilo.HiloOpenAI, err)
+			}
+		}
+
+		// Crear los mensajes asociados al hilo
+		if err := createMensajes(tx, hilo, messages); err != nil {
+			return fmt.Errorf("fallo al guardar los mensajes del hilo %s: %w", hilo.HiloOpenAI, err)
+		}
+
+		// Guardar los intereses detectados por el analizador
+		intereses := make([]models.Interes, 0, len(interests))
+		for _, interest := range interests {
+			intereses = append(intereses, models.Interes{
+				HiloID:        hilo.ID,
+				Interes:       interest,
+				Estado:        hiloInactivo,
+				FechaCreacion: time.Now(),
+			})
+		}
+		if len(intereses) > 0 {
+			if err := tx.CreateInBatches(intereses, archiveBatchSize).Error; err != nil {
+				return fmt.Errorf("fallo al guardar los intereses del hilo %s: %w", hilo.HiloOpenAI, err)
+			}
+		}
+
+		logger.Log.Infof("Hilo %s archivado con %d mensaje(s) y %d interés(es).", hilo.HiloOpenAI, len(messages), len(intereses))
+		return nil
+	})
+}
+
+// messagesAfter devuelve los mensajes posteriores a la hora indicada, guardada en Postgres con
+// precisión de microsegundos.
+func messagesAfter(messages []session.Message, after time.Time) []session.Message {
+	var newer []session.Message
+	for _, message := range messages {
+		if message.Timestamp.Truncate(time.Microsecond).After(after) {
+			newer = append(newer, message)
+		}
+	}
+	return newer
+}
+
+// unsavedMessages devuelve los mensajes posteriores al último mensaje guardado en el hilo. Los mensajes
+// se guardan en orden, por lo que los anteriores ya están en el hilo.
+func unsavedMessages(tx *gorm.DB, hilo models.Hilo, messages []session.Message) ([]session.Message, error) {
+	var last []time.Time
+	err := tx.Model(&models.Mensaje{}).Where("hilo_id = ?", hilo.ID).Order("fecha_creacion DESC").Limit(1).Pluck("fecha_creacion", &last).Error
+	if err != nil {
+		return nil, fmt.Errorf("fallo al obtener el último mensaje del hilo %s: %w", hilo.HiloOpenAI, err)
+	}
+	if len(last) == 0 {
+		return messages, nil
+	}
+	return messagesAfter(messages, last[0]), nil
+}
+
+// newInterests devuelve los intereses que aún no están guardados en el hilo.
+func newInterests(tx *gorm.DB, hilo models.Hilo, interests []string) ([]string, error) {
+	if len(interests) == 0 {
+		return nil, nil
+	}
+	var saved []string
+	if err := tx.Model(&models.Interes{}).Where("hilo_id = ?", hilo.ID).Pluck("interes", &saved).Error; err != nil {
+		return nil, fmt.Errorf("fallo al obtener los intereses del hilo %s: %w", hilo.HiloOpenAI, err)
+	}
+	existing := make(map[string]bool, len(saved))
+	for _, interest := range saved {
+		existing[interest] = true
+	}
+	var pending []string
+	for _, interest := range interests {
+		if !existing[interest] {
+			pending = append(pending, interest)
+		}
 	}
-	logger.Log.Infof("Mensajes para el hilo %s guardados exitosamente.", hilo.HiloOpenAI)
+	return pending, nil
+}
 
-	// Recuperar y guardar los intereses desde Redis
-	threadAnalizer := sessionData["thread_analizer"].(string)
-	interestsKey := "thread_analizer:" + threadAnalizer
+// archiveThreadID devuelve el id con el que se archiva el hilo de la sesión. Las sesiones creadas sin
+// hilos mientras el servidor de IA no estaba disponible usan un id derivado del usuario y del inicio
+// de la sesión, que también es estable entre reintentos.
+func archiveThreadID(sess *session.Session) string {
+	if sess.Thread != "" {
+		return sess.Thread
+	}
+	return fmt.Sprintf("sin_hilo_%s_%d", sess.UserInfo.Phone, sess.StartTimestamp.Unix())
+}
 
-	// Conexión a Redis para obtener los intereses
+// sessionInterests devuelve los intereses guardados en Redis por el analizador del hilo.
+func sessionInterests(threadAnalizer string) ([]string, error) {
+	if threadAnalizer == "" {
+		return nil, nil
+	}
 	redisConn, err := GetRedisConn()
 	if err != nil {
-		logger.Log.Errorf("Error al conectar con Redis: %v", err)
-		return err
+		return nil, fmt.Errorf("fallo al conectar con Redis: %w", err)
+	}
+	interestsDataRaw, err := redisConn.Get(context.Background(), "thread_analizer:"+threadAnalizer).Result()
+	if err == redis.Nil {
+		return nil, nil
 	}
-	interestsDataRaw, err := redisConn.Get(context.Background(), interestsKey).Result()
 	if err != nil {
-		logger.Log.Errorf("Error al obtener los intereses desde Redis: %v", err)
-		return err
+		return nil, fmt.Errorf("fallo al obtener los intereses desde Redis: %w", err)
 	}
 
-	var interestsData map[string]interface{}
+	var interestsData struct {
+		Interests []string `json:"interests"`
+	}
 	if err := json.Unmarshal([]byte(interestsDataRaw), &interestsData); err != nil {
-		logger.Log.Errorf("Error al deserializar los datos de intereses: %v", err)
-		return err
+		return nil, fmt.Errorf("fallo al deserializar los datos de intereses: %w", err)
 	}
+	return interestsData.Interests, nil
+}
 
-	interests, ok := interestsData["interests"].([]interface{})
-	if !ok || len(interests) == 0 {
-		logger.Log.Infof("No se encontraron intereses para el hilo %s.", hilo.HiloOpenAI)
+// findOrCreateUsuario devuelve el usuario de chat con el teléfono indicado y lo crea si no existe.
+func findOrCreateUsuario(tx *gorm.DB, userInfo session.UserInfo) (models.UsuarioChat, error) {
+	nuevo := models.UsuarioChat{
+		Telefono: userInfo.Phone,
+		Nombre:   userInfo.Name,
+		WaID:     userInfo.Phone,
+	}
+	// Si otra transacción lo crea a la vez, se usa el suyo
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&nuevo)
+	if result.Error != nil {
+		return nuevo, fmt.Errorf("fallo al crear el usuario %s: %w", userInfo.Phone, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		logger.Log.Infof("Usuario %s creado exitosamente.", nuevo.Telefono)
+	}
+
+	var usuario models.UsuarioChat
+	if err := tx.Where("telefono = ?", userInfo.Phone).First(&usuario).Error; err != nil {
+		return usuario, fmt.Errorf("fallo al obtener el usuario %s: %w", userInfo.Phone, err)
+	}
+	return usuario, nil
+}
+
+// findOrCreateHilo devuelve el hilo con el id indicado, bloqueado hasta el final de la transacción, y
+// lo crea con el estado indicado si no existe. Indica si se creó. Así el historial guardado antes de
+// cerrar la sesión y el guardado al cerrarla quedan en el mismo hilo, y nunca se duplica.
+func findOrCreateHilo(tx *gorm.DB, usuario models.UsuarioChat, sess *session.Session, threadID, estado string) (models.Hilo, bool, error) {
+	nuevo := models.Hilo{
+		UsuarioID:      usuario.ID,
+		HiloOpenAI:     threadID,
+		HiloAnalizador: sess.ThreadAnalizer,
+		EstadoHilo:     estado,
+		FechaInicio:    sess.StartTimestamp,
+		FechaFin:       sess.LastActivity,
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&nuevo)
+	if result.Error != nil {
+		return nuevo, false, fmt.Errorf("fallo al crear el hilo %s: %w", threadID, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		logger.Log.Infof("Hilo %s creado exitosamente para el usuario %s.", threadID, usuario.Telefono)
+		return nuevo, true, nil
+	}
+
+	var hilo models.Hilo
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&models.Hilo{HiloOpenAI: threadID}).First(&hilo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return hilo, false, fmt.Errorf("el hilo %s no se creó ni existe", threadID)
+	}
+	if err != nil {
+		return hilo, false, fmt.Errorf("fallo al obtener el hilo %s: %w", threadID, err)
+	}
+	return hilo, false, nil
+}
+
+// createMensajes guarda los mensajes en el hilo por lotes, con la hora y el remitente originales.
+func createMensajes(tx *gorm.DB, hilo models.Hilo, messages []session.Message) error {
+	if len(messages) == 0 {
 		return nil
 	}
-	for _, interest := range interests {
-		interes := models.Interes{
-			HiloID:        hilo.ID,
-			Interes:       interest.(string),
-			Estado:        "inactivo",
-			FechaCreacion: time.Now(),
-		}
-		if err := db.Create(&interes).Error; err != nil {
-			logger.Log.Errorf("Error al crear el interés: %v", err)
-			return err
+	mensajes := make([]models.Mensaje, 0, len(messages))
+	for _, message := range messages {
+		remitente := message.Sender
+		if message.Type == session.MessageTypeOutgoing {
+			remitente = remitenteBot
 		}
+		mensajes = append(mensajes, models.Mensaje{
+			HiloID:        hilo.ID,
+			TextoMensaje:  message.Message,
+			TipoMensaje:   message.Type,
+			Remitente:     remitente,
+			FechaCreacion: message.Timestamp,
+		})
 	}
-	logger.Log.Infof("Intereses para el hilo %s guardados exitosamente.", hilo.HiloOpenAI)
-
-	return nil
+	return tx.CreateInBatches(mensajes, archiveBatchSize).Error
 }
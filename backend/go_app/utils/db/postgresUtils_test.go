@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"chatbot/models"
+	"chatbot/utils/redistest"
+	"chatbot/utils/session"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// testArchiveDB crea una base de datos SQLite propia de la prueba con las tablas del archivo de
+// sesiones. El driver de SQLite requiere cgo.
+func testArchiveDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "archivo.db")), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.UsuarioChat{}, &models.Hilo{}, &models.Mensaje{}, &models.Interes{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// archivedMessage resume un mensaje guardado para compararlo en las pruebas.
+type archivedMessage struct {
+	Texto     string
+	Remitente string
+	Fecha     time.Time
+}
+
+// archivedThread devuelve el hilo guardado con sus mensajes en orden y sus intereses.
+func archivedThread(t *testing.T, db *gorm.DB, threadID string) (models.Hilo, []archivedMessage, []string) {
+	t.Helper()
+	var hilos []models.Hilo
+	if err := db.Where("hilo_open_ai = ?", threadID).Find(&hilos).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(hilos) != 1 {
+		t.Fatalf("hay %d hilo(s) %s, se esperaba 1", len(hilos), threadID)
+	}
+	var mensajes []models.Mensaje
+	if err := db.Where("hilo_id = ?", hilos[0].ID).Order("fecha_creacion").Find(&mensajes).Error; err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]archivedMessage, len(mensajes))
+	for i, mensaje := range mensajes {
+		messages[i] = archivedMessage{Texto: mensaje.TextoMensaje, Remitente: mensaje.Remitente, Fecha: mensaje.FechaCreacion.UTC()}
+	}
+	var intereses []string
+	if err := db.Model(&models.Interes{}).Where("hilo_id = ?", hilos[0].ID).Order("id").Pluck("interes", &intereses).Error; err != nil {
+		t.Fatal(err)
+	}
+	return hilos[0], messages, intereses
+}
+
+func TestSaveOfRedisToPostgresIdempotent(t *testing.T) {
+	// Los intereses se leen del Redis compartido de la aplicación
+	server, rdb := redistest.NewServer(t)
+	t.Setenv("REDIS_ADDR", server.Addr())
+	db := testArchiveDB(t)
+	ctx := context.Background()
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	sess := session.New("5491100000000", "Ana", start)
+	sess.Thread, sess.ThreadAnalizer = "hilo_1", "hilo_analizador_1"
+	sess.AddMessage("Ana", "hola", "text", start.Add(time.Second))
+	sess.AddMessage("Ana", "¡Hola! ¿Qué carrera te interesa?", session.MessageTypeOutgoing, start.Add(2*time.Second))
+	sess.AddMessage("Ana", "Medicina", "interactive", start.Add(3*time.Second))
+	if err := rdb.Set(ctx, "thread_analizer:hilo_analizador_1", `{"interests":["Medicina"]}`, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantMessages := []archivedMessage{
+		{Texto: "hola", Remitente: "Ana", Fecha: start.Add(time.Second)},
+		{Texto: "¡Hola! ¿Qué carrera te interesa?", Remitente: remitenteBot, Fecha: start.Add(2 * time.Second)},
+		{Texto: "Medicina", Remitente: "Ana", Fecha: start.Add(3 * time.Second)},
+	}
+
+	// Reintentar el archivo no duplica el hilo, los mensajes ni los intereses
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := SaveOfRedisToPostgres(db, sess); err != nil {
+			t.Fatalf("intento %d: %v", attempt, err)
+		}
+		hilo, messages, interests := archivedThread(t, db, "hilo_1")
+		if hilo.EstadoHilo != hiloInactivo {
+			t.Errorf("intento %d: estado del hilo = %q, se esperaba %q", attempt, hilo.EstadoHilo, hiloInactivo)
+		}
+		if !reflect.DeepEqual(messages, wantMessages) {
+			t.Errorf("intento %d: mensajes = %+v, se esperaban %+v", attempt, messages, wantMessages)
+		}
+		if !reflect.DeepEqual(interests, []string{"Medicina"}) {
+			t.Errorf("intento %d: intereses = %v", attempt, interests)
+		}
+	}
+
+	// La sesión siguió abierta tras archivarse: solo se agrega lo posterior
+	sess.AddMessage("Ana", "¿y Derecho?", "text", start.Add(time.Hour))
+	if err := rdb.Set(ctx, "thread_analizer:hilo_analizador_1", `{"interests":["Medicina","Derecho"]}`, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveOfRedisToPostgres(db, sess); err != nil {
+		t.Fatal(err)
+	}
+	_, messages, interests := archivedThread(t, db, "hilo_1")
+	wantMessages = append(wantMessages, archivedMessage{Texto: "¿y Derecho?", Remitente: "Ana", Fecha: start.Add(time.Hour)})
+	if !reflect.DeepEqual(messages, wantMessages) {
+		t.Errorf("mensajes tras reabrirse = %+v, se esperaban %+v", messages, wantMessages)
+	}
+	if !reflect.DeepEqual(interests, []string{"Medicina", "Derecho"}) {
+		t.Errorf("intereses tras reabrirse = %v", interests)
+	}
+
+	var usuarios int64
+	if err := db.Model(&models.UsuarioChat{}).Count(&usuarios).Error; err != nil || usuarios != 1 {
+		t.Errorf("hay %d usuario(s) (%v), se esperaba 1", usuarios, err)
+	}
+}
+
+func TestSaveOfRedisToPostgresAfterSpill(t *testing.T) {
+	db := testArchiveDB(t)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	sess := session.New("5491100000000", "Ana", start)
+	sess.Thread = "hilo_1"
+	for i, text := range []string{"uno", "dos", "tres", "cuatro"} {
+		sess.AddMessage("Ana", text, "text", start.Add(time.Duration(i+1)*time.Second))
+	}
+
+	// Los dos primeros salieron del historial reciente; el desborde se reintenta antes de quitarse de Redis
+	spill := SpillSessionMessages(db)
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := spill(context.Background(), sess, sess.Messages[:2]); err != nil {
+			t.Fatalf("desborde %d: %v", attempt, err)
+		}
+	}
+	hilo, messages, _ := archivedThread(t, db, "hilo_1")
+	if hilo.EstadoHilo != hiloActivo || len(messages) != 2 {
+		t.Fatalf("tras el desborde el hilo está %q con %d mensaje(s), se esperaba activo con 2", hilo.EstadoHilo, len(messages))
+	}
+
+	// Al archivar, la sesión aún tiene los mensajes del desborde y no se vuelven a guardar
+	if err := SaveOfRedisToPostgres(db, sess); err != nil {
+		t.Fatal(err)
+	}
+	hilo, messages, _ = archivedThread(t, db, "hilo_1")
+	var texts []string
+	for _, message := range messages {
+		texts = append(texts, message.Texto)
+	}
+	if hilo.EstadoHilo != hiloInactivo || !reflect.DeepEqual(texts, []string{"uno", "dos", "tres", "cuatro"}) {
+		t.Errorf("hilo %q con mensajes %v, se esperaba inactivo con los cuatro mensajes una vez", hilo.EstadoHilo, texts)
+	}
+}
@@ -0,0 +1,30 @@
+// go_app/utils/db/promptUtils.go
+package db
+
+import (
+	"chatbot/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// FindActivePrompt busca el prompt activo con el nombre indicado y devuelve el contenido de su versión
+// vigente. Si la versión indicada en el prompt no está registrada se usa el contenido del propio prompt.
+func FindActivePrompt(db *gorm.DB, nombre string) (*models.Prompt, string, error) {
+	var prompt models.Prompt
+	if err := db.Where("nombre = ? AND es_activo = ?", nombre, true).First(&prompt).Error; err != nil {
+		return nil, "", err
+	}
+
+	var version models.PromptVersion
+	err := db.Where("prompt_id = ? AND version_numero = ?", prompt.ID, prompt.Version).
+		Order("fecha_creacion DESC").First(&version).Error
+	switch {
+	case err == nil:
+		return &prompt, version.Contenido, nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &prompt, prompt.Contenido, nil
+	default:
+		return nil, "", err
+	}
+}
@@ -4,6 +4,8 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"chatbot/initializers"
@@ -17,27 +19,6 @@ func GetRedisConn() (*redis.Client, error) {
 	return initializers.GetRedisConn()
 }
 
-// SessionKeyExists verifica si una clave de sesión existe en Redis y devuelve sus datos
-func SessionKeyExists(ctx context.Context, redisConn *redis.Client, sessionKey string) (bool, string, error) {
-	logger.Log.Infof("Verificando existencia de la clave de sesión: %s", sessionKey)
-	result, err := redisConn.Exists(ctx, sessionKey).Result()
-	if err != nil {
-		logger.Log.Errorf("Error al verificar la existencia de la clave de sesión en Redis: %v", err)
-		return false, "", err
-	}
-	if result > 0 {
-		sessionDataRaw, err := redisConn.Get(ctx, sessionKey).Result()
-		if err != nil {
-			logger.Log.Errorf("Error al obtener los datos de sesión de Redis: %v", err)
-			return false, "", err
-		}
-		logger.Log.Infof("La clave de sesión %s existe en Redis", sessionKey)
-		return true, sessionDataRaw, nil
-	}
-	logger.Log.Infof("La clave de sesión %s no existe en Redis", sessionKey)
-	return false, "", nil
-}
-
 // SaveMessage guarda un mensaje en Redis utilizando la conexión de Redis
 func SaveMessage(ctx context.Context, redisConn *redis.Client, sessionID, waID, message, sender string) (bool, string) {
 	key := "session:" + sessionID + ":messages"
@@ -115,135 +96,112 @@ func GetMessages(ctx context.Context, redisConn *redis.Client, waID string) ([]m
 	return allMessages, nil
 }
 
-// CreateSession crea una nueva sesión de usuario en Redis utilizando la conexión de Redis
-func CreateSession(ctx context.Context, redisConn *redis.Client, name, phone, threadID, message, threadAnalizer string) {
-	sessionKey := "usuario:" + phone
-	currentTime := time.Now().Format(time.RFC3339)
-	sessionData := map[string]interface{}{
-		"user_info":       map[string]string{"phone": phone, "name": name},
-		"thread":          threadID,
-		"state":           "active",
-		"thread_analizer": threadAnalizer,
-		"messages":        []map[string]string{{"message": message, "sender": name, "timestamp": currentTime, "type": "incoming"}},
-		"start_timestamp": currentTime,
-		"last_activity":   currentTime,
-	}
-	sessionDataBytes, _ := json.Marshal(sessionData)
-	err := redisConn.Set(ctx, sessionKey, sessionDataBytes, 0).Err()
-	if err != nil {
-		logger.Log.Errorf("Error al crear la sesión en Redis: %v", err)
-		return
-	}
-	logger.Log.Infof("Sesión creada en Redis con la clave: %s", sessionKey)
-}
-
-// UpdateSession actualiza una sesión de usuario existente en Redis utilizando la conexión de Redis
-func UpdateSession(ctx context.Context, redisConn *redis.Client, name, phone, message, messageType string) {
-	sessionKey := "usuario:" + phone
-	logger.Log.Infof("Actualizando sesión para la clave: %s", sessionKey)
+// UpdateUserInterest actualiza los intereses del usuario en Redis, agregando los nuevos a los ya
+// guardados sin repetirlos. La actualización es una transacción optimista: si otro análisis del mismo
+// hilo modifica la clave a la vez, se vuelve a leer y combinar, hasta maxStatusAttempts veces.
+func UpdateUserInterest(ctx context.Context, redisConn *redis.Client, threadIDAnalizer, threadID string, userInterests []string) error {
+	logger.Log.Info("Actualizando intereses del usuario en Redis")
+	messageKey := "thread_analizer:" + threadIDAnalizer
 
-	sessionDataRaw, err := redisConn.Get(ctx, sessionKey).Result()
-	if err != nil {
-		logger.Log.Errorf("Error al recuperar los datos de la sesión de Redis: %v", err)
-		return
-	}
-	var sessionData map[string]interface{}
-	if err := json.Unmarshal([]byte(sessionDataRaw), &sessionData); err != nil {
-		logger.Log.Errorf("Error al deserializar datos de la sesión: %v", err)
-		return
-	}
-	messages := sessionData["messages"].([]interface{})
-	messages = append(messages, map[string]string{
-		"message":   message,
-		"sender":    name,
-		"timestamp": time.Now().Format(time.RFC3339),
-		"type":      messageType,
-	})
-	sessionData["messages"] = messages
-	sessionData["last_activity"] = time.Now().Format(time.RFC3339)
-	sessionDataBytes, _ := json.Marshal(sessionData)
-	err = redisConn.Set(ctx, sessionKey, sessionDataBytes, 0).Err()
-	if err != nil {
-		logger.Log.Errorf("Error al actualizar la sesión en Redis: %v", err)
-		return
+	var err error
+	for attempt := 0; attempt < maxStatusAttempts; attempt++ {
+		err = watchUserInterest(ctx, redisConn, messageKey, threadIDAnalizer, threadID, userInterests)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
 	}
-	logger.Log.Infof("Sesión actualizada en Redis con la clave: %s", sessionKey)
+	return err
 }
 
-// UpdateUserInterest actualiza los intereses del usuario en Redis.
-func UpdateUserInterest(ctx context.Context, redisConn *redis.Client, threadIDAnalizer, threadID string, userInterests []string) {
-	logger.Log.Info("Actualizando intereses del usuario en Redis")
-	messageKey := "thread_analizer:" + threadIDAnalizer
-	currentTime := time.Now().Format(time.RFC3339)
-
-	// Intentar obtener datos existentes
-	messageDataRaw, err := redisConn.Get(ctx, messageKey).Result()
-	var messageData map[string]interface{}
-
-	if err == redis.Nil {
-		logger.Log.Info("No se encontraron datos previos, creando nuevo registro")
-		// Filtrar intereses vacíos
-		// No hay datos previos, crear nuevo registro
-		if len(userInterests) == 0 {
-			logger.Log.Warn("No hay intereses para guardar, operación cancelada")
-			return
-		}
-		messageData = map[string]interface{}{
-			"thread_analizer": threadIDAnalizer,
-			"thread":          threadID,
-			"interests":       userInterests,
-			"start_timestamp": currentTime,
-			"last_activity":   currentTime,
-		}
-	} else if err != nil {
-		logger.Log.Errorf("Error al recuperar datos del mensaje de Redis: %v", err)
-		return
-	} else {
-		// Datos existentes encontrados, actualizar
-		logger.Log.Info("Datos previos encontrados, actualizando registro")
-		if err := json.Unmarshal([]byte(messageDataRaw), &messageData); err != nil {
-			logger.Log.Errorf("Error al deserializar datos del mensaje: %v", err)
-			return
-		}
+// watchUserInterest hace un intento de la transacción de UpdateUserInterest. Devuelve
+// redis.TxFailedErr si la clave cambió antes de guardar.
+func watchUserInterest(ctx context.Context, redisConn *redis.Client, messageKey, threadIDAnalizer, threadID string, userInterests []string) error {
+	return redisConn.Watch(ctx, func(tx *redis.Tx) error {
+		currentTime := time.Now().Format(time.RFC3339)
+
+		// Intentar obtener datos existentes
+		messageDataRaw, err := tx.Get(ctx, messageKey).Result()
+		var messageData map[string]interface{}
+		var updatedInterests []string
+
+		if err == redis.Nil {
+			logger.Log.Info("No se encontraron datos previos, creando nuevo registro")
+			// No hay datos previos, crear nuevo registro
+			if len(userInterests) == 0 {
+				logger.Log.Warn("No hay intereses para guardar, operación cancelada")
+				return nil
+			}
+			updatedInterests = userInterests
+			messageData = map[string]interface{}{
+				"thread_analizer": threadIDAnalizer,
+				"thread":          threadID,
+				"interests":       updatedInterests,
+				"start_timestamp": currentTime,
+				"last_activity":   currentTime,
+			}
+		} else if err != nil {
+			return fmt.Errorf("fallo al recuperar los intereses guardados en %s: %w", messageKey, err)
+		} else {
+			// Datos existentes encontrados, actualizar
+			logger.Log.Info("Datos previos encontrados, actualizando registro")
+			if err := json.Unmarshal([]byte(messageDataRaw), &messageData); err != nil {
+				return fmt.Errorf("fallo al deserializar los intereses guardados en %s: %w", messageKey, err)
+			}
+			if messageData == nil {
+				return fmt.Errorf("los datos guardados en %s no son un objeto", messageKey)
+			}
 
-		// Combinar intereses existentes con nuevos
-		existingInterests := messageData["interests"].([]interface{})
-		updatedInterests := make([]string, 0)
-		interestMap := make(map[string]bool)
-
-		// Añadir intereses existentes
-		for _, ei := range existingInterests {
-			interest := ei.(string)
-			if !interestMap[interest] {
-				updatedInterests = append(updatedInterests, interest)
-				interestMap[interest] = true
+			// Combinar intereses existentes con nuevos
+			var existingInterests []interface{}
+			if raw, ok := messageData["interests"]; ok && raw != nil {
+				if existingInterests, ok = raw.([]interface{}); !ok {
+					return fmt.Errorf("los intereses guardados en %s no son una lista: %T", messageKey, raw)
+				}
+			}
+			interestMap := make(map[string]bool)
+
+			// Añadir intereses existentes
+			for _, ei := range existingInterests {
+				interest, ok := ei.(string)
+				if !ok {
+					return fmt.Errorf("interés guardado en %s inválido: %v", messageKey, ei)
+				}
+				if !interestMap[interest] {
+					updatedInterests = append(updatedInterests, interest)
+					interestMap[interest] = true
+				}
 			}
-		}
 
-		// Añadir nuevos intereses
-		for _, ni := range userInterests {
-			if !interestMap[ni] {
-				updatedInterests = append(updatedInterests, ni)
-				interestMap[ni] = true
+			// Añadir nuevos intereses
+			for _, ni := range userInterests {
+				if !interestMap[ni] {
+					updatedInterests = append(updatedInterests, ni)
+					interestMap[ni] = true
+				}
 			}
-		}
 
-		messageData["interests"] = updatedInterests
-		messageData["last_activity"] = currentTime
-	}
+			messageData["interests"] = updatedInterests
+			messageData["last_activity"] = currentTime
+		}
 
-	// Serializar y guardar datos actualizados
-	messageDataBytes, err := json.Marshal(messageData)
-	if err != nil {
-		logger.Log.Errorf("Error al serializar datos del mensaje: %v", err)
-		return
-	}
+		// Serializar y guardar datos actualizados
+		messageDataBytes, err := json.Marshal(messageData)
+		if err != nil {
+			return fmt.Errorf("fallo al serializar los intereses de %s: %w", messageKey, err)
+		}
 
-	err = redisConn.Set(ctx, messageKey, messageDataBytes, 0).Err()
-	if err != nil {
-		logger.Log.Errorf("Error al actualizar los intereses del usuario en Redis: %v", err)
-		return
-	}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, messageKey, messageDataBytes, 0)
+			return nil
+		})
+		if errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("fallo al guardar los intereses en %s: %w", messageKey, err)
+		}
 
-	logger.Log.Infof("Intereses del usuario actualizados exitosamente en Redis. Clave: %s, Total intereses: %d", messageKey, len(messageData["interests"].([]string)))
+		logger.Log.Infof("Intereses del usuario actualizados exitosamente en Redis. Clave: %s, Total intereses: %d", messageKey, len(updatedInterests))
+		return nil
+	}, messageKey)
 }
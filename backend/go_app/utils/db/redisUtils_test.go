@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"chatbot/utils/redistest"
+)
+
+func TestUpdateUserInterest(t *testing.T) {
+	tests := []struct {
+		name          string
+		stored        string
+		interests     []string
+		wantInterests []string
+		wantErr       bool
+	}{
+		{name: "sin datos previos", interests: []string{"Medicina"}, wantInterests: []string{"Medicina"}},
+		{
+			name:          "combina sin repetir",
+			stored:        `{"thread":"hilo","interests":["Medicina","Derecho"]}`,
+			interests:     []string{"Derecho", "Arquitectura"},
+			wantInterests: []string{"Medicina", "Derecho", "Arquitectura"},
+		},
+		{name: "datos previos sin intereses", stored: `{"thread":"hilo"}`, interests: []string{"Derecho"}, wantInterests: []string{"Derecho"}},
+		{name: "intereses guardados que no son una lista", stored: `{"interests":"Medicina"}`, interests: []string{"Derecho"}, wantErr: true},
+		{name: "interés guardado que no es texto", stored: `{"interests":["Medicina",3]}`, interests: []string{"Derecho"}, wantErr: true},
+		{name: "datos previos inválidos", stored: `no es json`, interests: []string{"Derecho"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := redistest.New(t)
+			ctx := context.Background()
+			key := "thread_analizer:hilo_analizador"
+			if tt.stored != "" {
+				if err := rdb.Set(ctx, key, tt.stored, 0).Err(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := UpdateUserInterest(ctx, rdb, "hilo_analizador", "hilo", tt.interests)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateUserInterest() error = %v, se esperaba error = %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if raw, _ := rdb.Get(ctx, key).Result(); raw != tt.stored {
+					t.Errorf("los datos guardados cambiaron tras el error: %s", raw)
+				}
+				return
+			}
+
+			raw, err := rdb.Get(ctx, key).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var data struct {
+				Interests []string `json:"interests"`
+			}
+			if err := json.Unmarshal([]byte(raw), &data); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data.Interests, tt.wantInterests) {
+				t.Errorf("intereses = %v, se esperaban %v", data.Interests, tt.wantInterests)
+			}
+		})
+	}
+}
+
+func TestUpdateUserInterestConcurrent(t *testing.T) {
+	rdb := redistest.New(t)
+	ctx := context.Background()
+	key := "thread_analizer:hilo_analizador"
+	if err := rdb.Set(ctx, key, `{"thread":"hilo","interests":["Medicina"]}`, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Los análisis de turnos seguidos del mismo usuario guardan sus intereses a la vez
+	want := []string{"Medicina"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 1; i <= 5; i++ {
+		interest := fmt.Sprintf("Carrera %d", i)
+		want = append(want, interest)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- UpdateUserInterest(ctx, rdb, "hilo_analizador", "hilo", []string{interest})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw, err := rdb.Get(ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Interests []string `json:"interests"`
+	}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(data.Interests)
+	sort.Strings(want)
+	if !reflect.DeepEqual(data.Interests, want) {
+		t.Errorf("intereses = %v, se esperaban %v", data.Interests, want)
+	}
+}
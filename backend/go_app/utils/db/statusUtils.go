@@ -0,0 +1,171 @@
+// go_app/utils/db/statusUtils.go
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"chatbot/logger"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const messageStatusPrefix = "estados_mensajes:"
+
+// maxStatusAttempts es el número de veces que se reintenta guardar un estado que choca con otra escritura
+// de la misma conversación.
+const maxStatusAttempts = 10
+
+// Estados de un mensaje saliente. accepted es el estado inicial al recibir el id de la Graph API.
+const (
+	MessageStatusAccepted  = "accepted"
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+	MessageStatusFailed    = "failed"
+)
+
+// messageStatusRank ordena los estados para ignorar las actualizaciones que llegan desordenadas.
+var messageStatusRank = map[string]int{
+	MessageStatusAccepted:  0,
+	MessageStatusSent:      1,
+	MessageStatusDelivered: 2,
+	MessageStatusRead:      3,
+	MessageStatusFailed:    4,
+}
+
+// statusAdvances indica si pasar del estado guardado al nuevo avanza la entrega. Un mensaje sin estado
+// acepta cualquiera.
+func statusAdvances(current, next string) bool {
+	return current == "" || messageStatusRank[next] > messageStatusRank[current]
+}
+
+// MessageStatus es el estado de entrega de un mensaje saliente.
+type MessageStatus struct {
+	MessageID    string `json:"message_id"`
+	Phone        string `json:"phone"`
+	Type         string `json:"type,omitempty"`
+	Status       string `json:"status"`
+	ErrorCode    int    `json:"error_code,omitempty"`
+	ErrorTitle   string `json:"error_title,omitempty"`
+	ErrorDetails string `json:"error_details,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// RegisterOutboundMessage guarda un mensaje saliente recién aceptado por la Graph API en la conversación del teléfono.
+func RegisterOutboundMessage(ctx context.Context, redisConn *redis.Client, phone, messageID, messageType string, ttl time.Duration) error {
+	now := time.Now().Format(time.RFC3339Nano)
+	return saveMessageStatus(ctx, redisConn, phone, messageID, ttl, func(current *MessageStatus) bool {
+		current.Type = messageType
+		if current.Status == "" {
+			current.Status = MessageStatusAccepted
+			current.UpdatedAt = now
+		}
+		return true
+	})
+}
+
+// UpdateMessageStatus aplica una actualización de estado recibida por el webhook. Las actualizaciones
+// de un estado anterior al guardado se ignoran. Devuelve false si la actualización fue ignorada.
+func UpdateMessageStatus(ctx context.Context, redisConn *redis.Client, update MessageStatus, ttl time.Duration) (bool, error) {
+	var applied bool
+	err := saveMessageStatus(ctx, redisConn, update.Phone, update.MessageID, ttl, func(current *MessageStatus) bool {
+		if !statusAdvances(current.Status, update.Status) {
+			return false
+		}
+		current.Status = update.Status
+		current.ErrorCode = update.ErrorCode
+		current.ErrorTitle = update.ErrorTitle
+		current.ErrorDetails = update.ErrorDetails
+		current.UpdatedAt = update.UpdatedAt
+		applied = true
+		return true
+	})
+	return applied, err
+}
+
+// saveMessageStatus lee, modifica y guarda el estado de un mensaje dentro de una transacción optimista.
+// Los estados de los mensajes de una conversación comparten la clave, por lo que si otra escritura la
+// modifica a la vez se vuelve a leer y aplicar, hasta maxStatusAttempts veces.
+func saveMessageStatus(ctx context.Context, redisConn *redis.Client, phone, messageID string, ttl time.Duration, apply func(*MessageStatus) bool) error {
+	key := messageStatusPrefix + phone
+
+	var err error
+	for attempt := 0; attempt < maxStatusAttempts; attempt++ {
+		err = watchMessageStatus(ctx, redisConn, key, phone, messageID, ttl, apply)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		logger.Log.Errorf("Error al guardar el estado del mensaje %s de %s: %v", messageID, phone, err)
+		return err
+	}
+	return nil
+}
+
+// watchMessageStatus hace un intento de la transacción de saveMessageStatus. Devuelve redis.TxFailedErr
+// si la clave cambió antes de guardar.
+func watchMessageStatus(ctx context.Context, redisConn *redis.Client, key, phone, messageID string, ttl time.Duration, apply func(*MessageStatus) bool) error {
+	return redisConn.Watch(ctx, func(tx *redis.Tx) error {
+		current := MessageStatus{MessageID: messageID, Phone: phone, CreatedAt: time.Now().Format(time.RFC3339Nano)}
+		raw, err := tx.HGet(ctx, key, messageID).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal([]byte(raw), &current); err != nil {
+				return fmt.Errorf("fallo al deserializar estado del mensaje %s: %w", messageID, err)
+			}
+		}
+
+		if !apply(&current) {
+			return nil
+		}
+
+		data, err := json.Marshal(current)
+		if err != nil {
+			return fmt.Errorf("fallo al serializar estado del mensaje %s: %w", messageID, err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, messageID, data)
+			if ttl > 0 {
+				pipe.Expire(ctx, key, ttl)
+			}
+			return nil
+		})
+		return err
+	}, key)
+}
+
+// GetConversationStatuses devuelve el estado de los mensajes salientes de una conversación, del más antiguo al más reciente.
+func GetConversationStatuses(ctx context.Context, redisConn *redis.Client, phone string) ([]MessageStatus, error) {
+	values, err := redisConn.HGetAll(ctx, messageStatusPrefix+phone).Result()
+	if err != nil {
+		logger.Log.Errorf("Error al recuperar los estados de los mensajes de %s: %v", phone, err)
+		return nil, err
+	}
+
+	statuses := make([]MessageStatus, 0, len(values))
+	for messageID, raw := range values {
+		var status MessageStatus
+		if err := json.Unmarshal([]byte(raw), &status); err != nil {
+			logger.Log.Warnf("Estado inválido del mensaje %s de %s: %v", messageID, phone, err)
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		createdI, _ := time.Parse(time.RFC3339Nano, statuses[i].CreatedAt)
+		createdJ, _ := time.Parse(time.RFC3339Nano, statuses[j].CreatedAt)
+		return createdI.Before(createdJ)
+	})
+	return statuses, nil
+}
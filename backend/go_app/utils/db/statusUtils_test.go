@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"chatbot/logger"
+	"chatbot/utils/redistest"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestStatusAdvances(t *testing.T) {
+	tests := []struct {
+		current, next string
+		want          bool
+	}{
+		{current: "", next: MessageStatusAccepted, want: true},
+		{current: "", next: MessageStatusRead, want: true},
+		{current: MessageStatusAccepted, next: MessageStatusSent, want: true},
+		{current: MessageStatusSent, next: MessageStatusDelivered, want: true},
+		{current: MessageStatusDelivered, next: MessageStatusRead, want: true},
+		{current: MessageStatusAccepted, next: MessageStatusRead, want: true},
+		{current: MessageStatusRead, next: MessageStatusFailed, want: true},
+		{current: MessageStatusSent, next: MessageStatusSent, want: false},
+		{current: MessageStatusDelivered, next: MessageStatusSent, want: false},
+		{current: MessageStatusRead, next: MessageStatusDelivered, want: false},
+		{current: MessageStatusFailed, next: MessageStatusRead, want: false},
+		{current: MessageStatusSent, next: "desconocido", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.current+"→"+tt.next, func(t *testing.T) {
+			if got := statusAdvances(tt.current, tt.next); got != tt.want {
+				t.Errorf("statusAdvances(%q, %q) = %v, se esperaba %v", tt.current, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveMessageStatusRetriesConflicts(t *testing.T) {
+	rdb := redistest.New(t)
+	ctx := context.Background()
+	phone := fmt.Sprintf("prueba-%d", time.Now().UnixNano())
+	defer rdb.Del(ctx, messageStatusPrefix+phone)
+
+	// Los estados de una conversación comparten la clave, por lo que las escrituras simultáneas chocan
+	const messages = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, messages)
+	for i := 0; i < messages; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- RegisterOutboundMessage(ctx, rdb, phone, fmt.Sprintf("wamid.%d", i), "text", time.Minute)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("error al registrar un mensaje: %v", err)
+		}
+	}
+
+	statuses, err := GetConversationStatuses(ctx, rdb, phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != messages {
+		t.Errorf("%d estados guardados, se esperaban %d", len(statuses), messages)
+	}
+}
@@ -0,0 +1,37 @@
+// go_app/utils/db/templateUtils.go
+package db
+
+import (
+	"chatbot/logger"
+	"chatbot/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// FindActiveTemplate busca la plantilla activa más reciente para el propósito indicado en el idioma
+// pedido y, si no existe, en cualquier otro idioma.
+func FindActiveTemplate(db *gorm.DB, proposito, idioma string) (*models.PlantillaMensaje, error) {
+	var plantilla models.PlantillaMensaje
+	query := db.Where("proposito = ? AND es_activo = ?", proposito, true).Order("updated_at DESC")
+
+	err := query.Session(&gorm.Session{}).Where("idioma = ?", idioma).First(&plantilla).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = query.Session(&gorm.Session{}).First(&plantilla).Error
+	}
+	if err != nil {
+		logger.Log.Errorf("Error al buscar plantilla activa para el propósito %s: %v", proposito, err)
+		return nil, err
+	}
+	return &plantilla, nil
+}
+
+// FindActiveFallback busca la respuesta de contingencia activa más reciente.
+func FindActiveFallback(db *gorm.DB) (*models.RespuestaContingencia, error) {
+	var respuesta models.RespuestaContingencia
+	err := db.Where("es_activo = ?", true).Order("updated_at DESC").First(&respuesta).Error
+	if err != nil {
+		return nil, err
+	}
+	return &respuesta, nil
+}
@@ -0,0 +1,94 @@
+// chatbot/utils/events/bus.go
+
+package events
+
+import (
+	"chatbot/logger"
+	"sync"
+	"time"
+)
+
+// Nombres de los eventos publicados a partir de los estados de los mensajes salientes.
+const (
+	// MessageFailed se publica para cualquier mensaje saliente con estado failed.
+	MessageFailed = "mensaje.fallido"
+	// WindowClosed se publica cuando el mensaje no se entregó porque la ventana de 24 horas está cerrada.
+	WindowClosed = "mensaje.ventana_cerrada"
+	// UserBlocked se publica cuando el mensaje no se pudo entregar al usuario, por ejemplo porque bloqueó al negocio.
+	UserBlocked = "mensaje.usuario_bloqueado"
+)
+
+// HandoffRequested se publica cuando el asistente indica que la conversación debe pasar a un asesor humano.
+const HandoffRequested = "conversacion.derivacion"
+
+// Event es un suceso del sistema al que otros componentes pueden reaccionar.
+type Event struct {
+	Name      string
+	Phone     string
+	MessageID string
+	Code      int
+	Title     string
+	Details   string
+	Timestamp time.Time
+}
+
+// Handler reacciona a un evento publicado.
+type Handler func(Event)
+
+// Bus distribuye eventos en memoria a los manejadores suscritos a su nombre.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// NewBus crea un bus de eventos vacío.
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe registra un manejador para los eventos con el nombre indicado.
+func (b *Bus) Subscribe(name string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], handler)
+}
+
+// Publish entrega el evento a sus manejadores en el orden en que se suscribieron.
+// El pánico de un manejador se registra y no impide ejecutar los demás.
+func (b *Bus) Publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := append([]Handler(nil), b.handlers[event.Name]...)
+	b.mu.RUnlock()
+
+	logger.Log.Infof("Evento %s publicado para %s (mensaje %s, código %d)", event.Name, event.Phone, event.MessageID, event.Code)
+	for _, handler := range handlers {
+		dispatch(handler, event)
+	}
+}
+
+// dispatch ejecuta un manejador recuperándose de un posible pánico.
+func dispatch(handler Handler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Log.Errorf("Pánico en el manejador del evento %s: %v", event.Name, r)
+		}
+	}()
+	handler(event)
+}
+
+// defaultBus es el bus compartido por toda la aplicación.
+var defaultBus = NewBus()
+
+// Subscribe registra un manejador en el bus compartido.
+func Subscribe(name string, handler Handler) {
+	defaultBus.Subscribe(name, handler)
+}
+
+// Publish publica un evento en el bus compartido.
+func Publish(event Event) {
+	defaultBus.Publish(event)
+}
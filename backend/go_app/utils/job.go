@@ -3,10 +3,17 @@
 package utils
 
 import (
+	"chatbot/initializers"
 	"chatbot/logger"
 	postgresUtils "chatbot/utils/db"
+	"chatbot/utils/session"
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -15,91 +22,248 @@ import (
 )
 
 var (
-	ctx                     = context.Background()
-	MAX_INACTIVITY_DURATION = time.Minute * 60 // Duración máxima de inactividad configurada a 2 minutos
+	ctx = context.Background()
+
+	// InactivityNotifier envía el aviso de cierre de sesión al usuario; lo configura main para evitar
+	// que utils dependa de controllers.
+	InactivityNotifier func(phone, name string)
 )
 
-// StartInactivityCheck inicia la verificación de inactividad de los usuarios
-func StartInactivityCheck(db *gorm.DB, rdb *redis.Client) {
+// sessionTimeoutPrefix es el prefijo de las variables de entorno con el tiempo de inactividad de cada
+// canal, por ejemplo SESSION_TIMEOUT_WHATSAPP=30m.
+const sessionTimeoutPrefix = "SESSION_TIMEOUT_"
+
+// ExpiryNotifier entrega los teléfonos de las sesiones a medida que vencen.
+type ExpiryNotifier interface {
+	ExpiryNotifications(ctx context.Context) <-chan string
+}
+
+// SessionTimeoutsFromEnv lee el tiempo de inactividad de las sesiones de SESSION_TIMEOUT y el de cada
+// canal de SESSION_TIMEOUT_<CANAL>.
+func SessionTimeoutsFromEnv() session.Timeouts {
+	timeouts := session.Timeouts{
+		Default:    initializers.GetEnvDuration("SESSION_TIMEOUT", session.DefaultTimeout),
+		PerChannel: make(map[string]time.Duration),
+	}
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, sessionTimeoutPrefix) {
+			continue
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			logger.Log.Warnf("%s inválido, se ignora: %q", key, value)
+			continue
+		}
+		channel := strings.ToLower(strings.TrimPrefix(key, sessionTimeoutPrefix))
+		timeouts.PerChannel[channel] = timeout
+		logger.Log.Infof("%s configurado: %v", key, timeout)
+	}
+	return timeouts
+}
+
+// archiveClaimSuffix es el sufijo de la clave con la que una instancia se reserva el archivo de una
+// sesión vencida.
+const archiveClaimSuffix = ":archivo"
+
+// leaderLeaseKey es la clave con la que una instancia se reserva la búsqueda de sesiones vencidas.
+const leaderLeaseKey = "job:inactividad:lider"
+
+// InactivityJob archiva las sesiones vencidas. Puede ejecutarse en varias instancias: cada sesión se
+// reserva en Redis antes de archivarla, de modo que la archiva una sola, y la búsqueda periódica la
+// hace solo la instancia que tiene la reserva de líder.
+type InactivityJob struct {
+	db       *gorm.DB
+	rdb      *redis.Client
+	store    session.SessionStore
+	timeouts session.Timeouts
+	owner    string
+	claimTTL time.Duration
+	leader   *RedisLease
+	attempts uint64
+	wg       sync.WaitGroup
+}
+
+// StartInactivityCheck inicia el archivo de las sesiones vencidas hasta que se cancele ctx. Si el
+// almacén notifica los vencimientos, cada sesión se archiva al vencer; además, cada
+// SESSION_EXPIRY_SWEEP el líder busca en el índice de vencimientos las sesiones cuya notificación se
+// perdió, sin recorrer las claves.
+func StartInactivityCheck(ctx context.Context, db *gorm.DB, rdb *redis.Client, store session.SessionStore, timeouts session.Timeouts) (*InactivityJob, error) {
 	logger.Log.Info("Iniciando el job de verificación de inactividad.")
 
-	// Crear un nuevo scheduler de cron para ejecutar tareas periódicas
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	sweep := initializers.GetEnvDuration("SESSION_EXPIRY_SWEEP", time.Minute)
+	j := &InactivityJob{
+		db:       db,
+		rdb:      rdb,
+		store:    store,
+		timeouts: timeouts,
+		owner:    owner,
+		claimTTL: initializers.GetEnvDuration("SESSION_ARCHIVE_CLAIM_TTL", 5*time.Minute),
+		leader:   NewRedisLease(rdb, leaderLeaseKey, owner, initializers.GetEnvDuration("SESSION_ARCHIVE_LEADER_LEASE", 3*sweep)),
+	}
+
+	// Crear un nuevo scheduler de cron para buscar las sesiones vencidas no notificadas
 	c := cron.New()
-	_, err := c.AddFunc("@every 30s", func() {
-		CheckAndHandleInactiveThreads(db, rdb)
-	})
-	if err != nil {
-		logger.Log.Fatalf("Error iniciando el job de verificación de inactividad: %v", err)
+	if _, err := c.AddFunc(fmt.Sprintf("@every %s", sweep), j.sweep); err != nil {
+		return nil, fmt.Errorf("error iniciando el job de verificación de inactividad: %w", err)
 	}
 	c.Start()
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		<-ctx.Done()
+		// Esperar a que termine la búsqueda en curso y ceder el liderazgo a otra instancia
+		<-c.Stop().Done()
+		if err := j.leader.Release(context.Background()); err != nil {
+			logger.Log.Errorf("Error liberando el liderazgo del job de inactividad: %v", err)
+		}
+		logger.Log.Info("Job de verificación de inactividad detenido.")
+	}()
+
+	if notifier, ok := store.(ExpiryNotifier); ok {
+		j.wg.Add(1)
+		go func() {
+			defer j.wg.Done()
+			for phone := range notifier.ExpiryNotifications(ctx) {
+				j.ArchiveExpiredSession(phone)
+			}
+		}()
+	}
+	return j, nil
+}
+
+// Wait bloquea hasta que el job se detenga y terminen los archivos en curso.
+func (j *InactivityJob) Wait() {
+	j.wg.Wait()
 }
 
-// CheckAndHandleInactiveThreads verifica y maneja los hilos inactivos almacenados en Redis
-func CheckAndHandleInactiveThreads(db *gorm.DB, rdb *redis.Client) {
-	currentTime := time.Now()
-	sessionKeys, err := rdb.Keys(ctx, "usuario:*").Result()
+// sweep archiva las sesiones vencidas según el índice de vencimientos si esta instancia es el líder.
+func (j *InactivityJob) sweep() {
+	leader, err := j.leader.Acquire(ctx)
 	if err != nil {
-		logger.Log.Fatalf("Error obteniendo claves de sesión de Redis: %v", err)
+		logger.Log.Errorf("Error obteniendo el liderazgo del job de inactividad: %v", err)
+		return
 	}
+	if !leader {
+		return
+	}
+	j.CheckAndHandleInactiveThreads()
+}
 
-	for _, sessionKey := range sessionKeys {
-		sessionData, err := rdb.Get(ctx, sessionKey).Result()
-		if err != nil {
-			logger.Log.Errorf("Error obteniendo datos de sesión para %s: %v", sessionKey, err)
-			continue
-		}
-
-		var session map[string]interface{}
-		if err := json.Unmarshal([]byte(sessionData), &session); err != nil {
-			logger.Log.Errorf("Error deserializando datos de sesión para %s: %v", sessionKey, err)
-			continue
-		}
+// CheckAndHandleInactiveThreads archiva las sesiones vencidas según el índice de vencimientos del almacén
+func (j *InactivityJob) CheckAndHandleInactiveThreads() {
+	phones, err := j.store.Expired(ctx, time.Now())
+	if err != nil {
+		logger.Log.Errorf("Error obteniendo las sesiones vencidas: %v", err)
+		return
+	}
+	for _, phone := range phones {
+		j.ArchiveExpiredSession(phone)
+	}
+}
 
-		// Obtener el último tiempo de actividad de la sesión
-		lastActivityStr, ok := session["last_activity"].(string)
-		if !ok {
-			logger.Log.Infof("Campo 'last_activity' no encontrado en la sesión %s", sessionKey)
-			continue
+// ArchiveExpiredSession guarda en Postgres la sesión vencida, la elimina de Redis y avisa al usuario
+// del cierre. No hace nada si la sesión tuvo actividad después de vencer, si otra instancia la está
+// archivando o si se está guardando su historial antiguo, que se archiva en la próxima revisión.
+// Solo la elimina si no cambió desde que se leyó, y solo avisa al usuario una vez eliminada, de modo
+// que un fallo al guardar o una respuesta del usuario mientras se archiva no le envían un aviso de
+// cierre de una sesión que sigue abierta.
+func (j *InactivityJob) ArchiveExpiredSession(phone string) {
+	// Cada intento tiene su propio dueño para que la búsqueda y las notificaciones de esta instancia
+	// tampoco archiven la misma sesión a la vez
+	owner := fmt.Sprintf("%s-%d", j.owner, atomic.AddUint64(&j.attempts, 1))
+	claim := NewRedisLease(j.rdb, session.KeyPrefix+phone+archiveClaimSuffix, owner, j.claimTTL)
+	claimed, err := claim.Acquire(ctx)
+	if err != nil {
+		logger.Log.Errorf("Error reservando el archivo de la sesión de %s: %v", phone, err)
+		return
+	}
+	if !claimed {
+		logger.Log.Infof("La sesión de %s ya se está archivando", phone)
+		return
+	}
+	defer func() {
+		if err := claim.Release(ctx); err != nil {
+			logger.Log.Errorf("Error liberando el archivo de la sesión de %s: %v", phone, err)
 		}
+	}()
 
-		lastActivity, err := time.Parse(time.RFC3339, lastActivityStr)
-		if err != nil {
-			logger.Log.Errorf("Error parseando 'last_activity' para %s: %v", sessionKey, err)
-			continue
-		}
+	// Reservar el desborde de la sesión para que ninguna escritura guarde los mismos mensajes antiguos
+	// mientras se archiva
+	var sess *session.Session
+	err = j.store.WithSpillLock(ctx, phone, func() error {
+		sess = j.archiveSession(phone)
+		return nil
+	})
+	if errors.Is(err, session.ErrSpillInProgress) {
+		logger.Log.Infof("El historial antiguo de la sesión de %s se está guardando, se archivará en la próxima revisión", phone)
+		return
+	}
+	if err != nil {
+		logger.Log.Errorf("Error reservando el historial antiguo de la sesión de %s: %v", phone, err)
+		return
+	}
+	if sess == nil {
+		return
+	}
 
-		// Verificar si la sesión ha estado inactiva por más del tiempo permitido
-		if currentTime.Sub(lastActivity) > MAX_INACTIVITY_DURATION {
-			logger.Log.Infof("Se encontró sesión sin actividad: %s", sessionKey)
+	// Eliminar los intereses del usuario de Redis
+	threadAnalyzerKey := "thread_analizer:" + sess.ThreadAnalizer
+	if err := j.rdb.Del(ctx, threadAnalyzerKey).Err(); err != nil {
+		logger.Log.Errorf("Error eliminando los intereses del usuario %s de Redis: %v", threadAnalyzerKey, err)
+	}
 
-			phone := sessionKey[len("usuario:"):]
-			NotifyUserOfInactivity(phone)
-			logger.Log.Infof("La sesion ha eliminar es %v", session)
-			if err := postgresUtils.SaveOfRedisToPostgres(db, session); err != nil {
-				logger.Log.Errorf("Error guardando sesión %s en Postgres: %v", sessionKey, err)
-				continue
-			}
+	NotifyUserOfInactivity(phone, sess.UserInfo.Name)
+	logger.Log.Infof("Sesión y datos asociados eliminados correctamente para usuario %s.", phone)
+}
 
-			// Eliminar la sesión de Redis
-			if err := rdb.Del(ctx, sessionKey).Err(); err != nil {
-				logger.Log.Errorf("Error eliminando sesión %s de Redis: %v", sessionKey, err)
-				continue
-			}
+// archiveSession guarda en Postgres la sesión vencida y la elimina de Redis si no cambió desde que se
+// leyó. Devuelve la sesión eliminada, o nil si no se archivó.
+func (j *InactivityJob) archiveSession(phone string) *session.Session {
+	sess, err := j.store.Get(ctx, phone)
+	if errors.Is(err, session.ErrNotFound) {
+		// Quitar el vencimiento de una sesión que ya no existe
+		if err := j.store.Delete(ctx, phone); err != nil {
+			logger.Log.Errorf("Error eliminando el vencimiento de la sesión de %s: %v", phone, err)
+		}
+		return nil
+	}
+	if err != nil {
+		logger.Log.Errorf("Error obteniendo datos de sesión para %s: %v", phone, err)
+		return nil
+	}
+	if j.timeouts.ExpiresAt(sess).After(time.Now()) {
+		return nil
+	}
+	logger.Log.Infof("Se encontró sesión sin actividad: %s", phone)
 
-			// Eliminar los intereses del usuario de Redis
-			threadAnalyzerKey := "thread_analizer:" + session["thread_analizer"].(string)
-			if err := rdb.Del(ctx, threadAnalyzerKey).Err(); err != nil {
-				logger.Log.Errorf("Error eliminando los intereses del usuario %s de Redis: %v", threadAnalyzerKey, err)
-				continue
-			}
+	if err := postgresUtils.SaveOfRedisToPostgres(j.db, sess); err != nil {
+		logger.Log.Errorf("Error guardando sesión de %s en Postgres: %v", phone, err)
+		return nil
+	}
 
-			logger.Log.Infof("Sesión y datos asociados eliminados correctamente para usuario %s.", phone)
-		}
+	// Eliminar la sesión de Redis si el usuario no escribió mientras se guardaba; si lo hizo, la
+	// sesión sigue abierta y lo nuevo se guarda cuando vuelva a vencer
+	deleted, err := j.store.DeleteIfUnchanged(ctx, phone, sess.Version)
+	if err != nil {
+		logger.Log.Errorf("Error eliminando sesión de %s de Redis: %v", phone, err)
+		return nil
 	}
+	if !deleted {
+		logger.Log.Infof("La sesión de %s tuvo actividad mientras se archivaba, se mantiene abierta", phone)
+		return nil
+	}
+	return sess
 }
 
 // NotifyUserOfInactivity notifica al usuario sobre la inactividad de la sesión
-func NotifyUserOfInactivity(phone string) {
-	//message := "Tu sesión ha sido cerrada debido a inactividad. Por favor, inicia nuevamente."
-	//SendMessage(phone, message)
+func NotifyUserOfInactivity(phone, name string) {
+	if InactivityNotifier == nil {
+		logger.Log.Warnf("No hay notificador de inactividad configurado para %s", phone)
+		return
+	}
+	InactivityNotifier(phone, name)
 }
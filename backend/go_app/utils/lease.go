@@ -0,0 +1,59 @@
+// chatbot/utils
+
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// acquireLeaseScript reserva KEYS[1] para ARGV[1] durante ARGV[2] milisegundos. Si ya es suya,
+// renueva el vencimiento. Devuelve 1 si la reserva queda a nombre de ARGV[1].
+var acquireLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// releaseLeaseScript elimina KEYS[1] solo si sigue reservada por ARGV[1].
+var releaseLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLease es una reserva en Redis con dueño y vencimiento, para que un trabajo lo haga una sola
+// instancia. Si la instancia se cae sin liberarla, la reserva vence y otra puede tomarla.
+type RedisLease struct {
+	rdb   *redis.Client
+	key   string
+	owner string
+	ttl   time.Duration
+}
+
+// NewRedisLease crea una reserva de la clave a nombre de owner que dura ttl desde que se toma o renueva.
+func NewRedisLease(rdb *redis.Client, key, owner string, ttl time.Duration) *RedisLease {
+	return &RedisLease{rdb: rdb, key: key, owner: owner, ttl: ttl}
+}
+
+// Acquire toma la reserva o la renueva si ya es propia. Devuelve false si la tiene otra instancia.
+func (l *RedisLease) Acquire(ctx context.Context) (bool, error) {
+	acquired, err := acquireLeaseScript.Run(ctx, l.rdb, []string{l.key}, l.owner, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return acquired == 1, nil
+}
+
+// Release libera la reserva si sigue siendo propia.
+func (l *RedisLease) Release(ctx context.Context) error {
+	return releaseLeaseScript.Run(ctx, l.rdb, []string{l.key}, l.owner).Err()
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chatbot/utils/redistest"
+)
+
+func TestRedisLease(t *testing.T) {
+	ctx := context.Background()
+	server, rdb := redistest.NewServer(t)
+	first := NewRedisLease(rdb, "prueba:reserva", "instancia-1", time.Minute)
+	second := NewRedisLease(rdb, "prueba:reserva", "instancia-2", time.Minute)
+
+	steps := []struct {
+		name        string
+		lease       *RedisLease
+		release     bool
+		wait        time.Duration
+		wantAcquire bool
+		wantOwner   string
+	}{
+		{name: "reserva libre", lease: first, wantAcquire: true, wantOwner: "instancia-1"},
+		{name: "reservada por otra instancia", lease: second, wantAcquire: false, wantOwner: "instancia-1"},
+		{name: "renovación propia", lease: first, wait: 40 * time.Second, wantAcquire: true, wantOwner: "instancia-1"},
+		{name: "la renovación extiende el vencimiento", lease: second, wait: 40 * time.Second, wantAcquire: false, wantOwner: "instancia-1"},
+		{name: "otra instancia no la libera", lease: second, release: true, wantOwner: "instancia-1"},
+		{name: "liberación propia", lease: first, release: true, wantOwner: ""},
+		{name: "otra instancia la toma tras liberarse", lease: second, wantAcquire: true, wantOwner: "instancia-2"},
+		{name: "la toma otra instancia al vencer", lease: first, wait: 2 * time.Minute, wantAcquire: true, wantOwner: "instancia-1"},
+	}
+
+	for _, step := range steps {
+		server.FastForward(step.wait)
+		if step.release {
+			if err := step.lease.Release(ctx); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		} else {
+			acquired, err := step.lease.Acquire(ctx)
+			if err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			if acquired != step.wantAcquire {
+				t.Errorf("%s: Acquire() = %v, se esperaba %v", step.name, acquired, step.wantAcquire)
+			}
+		}
+
+		owner := ""
+		if server.Exists("prueba:reserva") {
+			owner, _ = server.Get("prueba:reserva")
+		}
+		if owner != step.wantOwner {
+			t.Errorf("%s: dueño = %q, se esperaba %q", step.name, owner, step.wantOwner)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+// chatbot/utils/outbound/outbox.go
+
+package outbound
+
+import (
+	"chatbot/logger"
+	"chatbot/utils/whatsapp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// OutboxEntry es un mensaje saliente guardado hasta que se confirma su envío.
+type OutboxEntry struct {
+	ID            string                    `json:"id"`
+	PhoneNumberID string                    `json:"phone_number_id"`
+	Message       *whatsapp.OutboundMessage `json:"message"`
+	Attempts      int                       `json:"attempts"`
+	LastError     string                    `json:"last_error,omitempty"`
+	CreatedAt     time.Time                 `json:"created_at"`
+}
+
+// outbox guarda los mensajes pendientes en Redis: un hash con las entradas, un sorted set con la
+// hora del próximo intento de cada una y un hash con el dueño de la concesión de cada una. Mientras
+// dura la concesión nadie más reclama la entrada, y solo su dueño puede renovarla, reprogramarla o
+// terminarla, de modo que una instancia cuya concesión venció no pisa a la que la reclamó después.
+//
+// Los mensajes de cada destinatario forman una cola: un hash guarda la última entrada de cada
+// destinatario y otro la entrada anterior de cada una, que debe terminar antes de enviarla.
+type outbox struct {
+	rdb          *redis.Client
+	entries      string
+	schedule     string
+	leases       string
+	deadLetter   string
+	tails        string
+	predecessors string
+}
+
+// newOutbox crea un outbox con las claves derivadas de key.
+func newOutbox(rdb *redis.Client, key string) *outbox {
+	return &outbox{
+		rdb:          rdb,
+		entries:      key + ":mensajes",
+		schedule:     key + ":pendientes",
+		leases:       key + ":concesiones",
+		deadLetter:   key + ":fallidos",
+		tails:        key + ":colas",
+		predecessors: key + ":anteriores",
+	}
+}
+
+// saveScript guarda la entrada ARGV[1] con los datos ARGV[2] al final de la cola del destinatario
+// ARGV[5]. Si la última entrada de la cola sigue pendiente, la registra como anterior y programa la
+// entrada para ARGV[6] sin concesión; si no, la reserva para ARGV[3] hasta ARGV[4]. Devuelve el id de
+// la entrada anterior o ” si no hay ninguna.
+var saveScript = redis.NewScript(`
+local previous = redis.call('HGET', KEYS[4], ARGV[5])
+if previous and redis.call('HEXISTS', KEYS[1], previous) == 0 then
+	previous = false
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+if previous then
+	redis.call('HSET', KEYS[5], ARGV[1], previous)
+	redis.call('ZADD', KEYS[2], ARGV[6], ARGV[1])
+else
+	redis.call('ZADD', KEYS[2], ARGV[4], ARGV[1])
+	redis.call('HSET', KEYS[3], ARGV[1], ARGV[3])
+end
+redis.call('HSET', KEYS[4], ARGV[5], ARGV[1])
+return previous or ''
+`)
+
+// claimDueScript obtiene hasta ARGV[3] entradas vencidas y las reprograma para ARGV[2] a nombre de
+// ARGV[4] de forma atómica, de modo que cada entrada la reclame una sola instancia mientras dura la
+// concesión.
+var claimDueScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+	redis.call('HSET', KEYS[2], id, ARGV[4])
+end
+return ids
+`)
+
+// renewScript extiende hasta ARGV[3] la concesión de la entrada ARGV[1] si sigue siendo de ARGV[2].
+var renewScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+return 1
+`)
+
+// rescheduleScript guarda los datos ARGV[3] de la entrada ARGV[1] y la programa para ARGV[4] si su
+// concesión sigue siendo de ARGV[2].
+var rescheduleScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[1])
+return 1
+`)
+
+// finishScript elimina la entrada ARGV[1] si su concesión sigue siendo de ARGV[2] y, si se indica
+// ARGV[3], la agrega a la lista de fallidos. Si era la última de la cola del destinatario ARGV[4], la
+// cola queda vacía.
+var finishScript = redis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+if ARGV[3] ~= '' then
+	redis.call('RPUSH', KEYS[4], ARGV[3])
+end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[6], ARGV[1])
+if redis.call('HGET', KEYS[5], ARGV[4]) == ARGV[1] then
+	redis.call('HDEL', KEYS[5], ARGV[4])
+end
+return 1
+`)
+
+// ErrLeaseLost indica que la concesión de una entrada del outbox venció y la reclamó otra instancia.
+var ErrLeaseLost = errors.New("la concesión de la entrada del outbox la tiene otra instancia")
+
+// newEntryID genera un id aleatorio para una entrada del outbox.
+func newEntryID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Save guarda una entrada nueva al final de la cola de su destinatario, reservada a nombre de owner
+// hasta until. Si la cola tiene una entrada pendiente la entrada no se reserva, queda programada para
+// enviarse cuando esa termine y se devuelve su id.
+func (o *outbox) Save(ctx context.Context, entry *OutboxEntry, owner string, until time.Time) (string, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("fallo al serializar la entrada %s del outbox: %w", entry.ID, err)
+	}
+
+	previous, err := saveScript.Run(ctx, o.rdb, []string{o.entries, o.schedule, o.leases, o.tails, o.predecessors},
+		entry.ID, data, owner, until.UnixMilli(), entry.Message.To, time.Now().UnixMilli()).Text()
+	if err != nil {
+		return "", fmt.Errorf("fallo al guardar la entrada %s en el outbox: %w", entry.ID, err)
+	}
+	return previous, nil
+}
+
+// Waiting devuelve el id de la entrada anterior de la cola que sigue pendiente, o "" si la entrada ya
+// se puede enviar.
+func (o *outbox) Waiting(ctx context.Context, id string) (string, error) {
+	previous, err := o.rdb.HGet(ctx, o.predecessors, id).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("fallo al leer la entrada anterior a %s en el outbox: %w", id, err)
+	}
+	pending, err := o.rdb.HExists(ctx, o.entries, previous).Result()
+	if err != nil {
+		return "", fmt.Errorf("fallo al leer la entrada anterior a %s en el outbox: %w", id, err)
+	}
+	if !pending {
+		o.rdb.HDel(ctx, o.predecessors, id)
+		return "", nil
+	}
+	return previous, nil
+}
+
+// Renew extiende hasta until la concesión de owner sobre la entrada. Devuelve ErrLeaseLost si la
+// concesión ya es de otra instancia.
+func (o *outbox) Renew(ctx context.Context, id, owner string, until time.Time) error {
+	renewed, err := renewScript.Run(ctx, o.rdb, []string{o.schedule, o.leases}, id, owner, until.UnixMilli()).Int()
+	if err != nil {
+		return fmt.Errorf("fallo al renovar la entrada %s del outbox: %w", id, err)
+	}
+	if renewed == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Reschedule guarda la entrada y la programa para intentarse en at, si su concesión sigue siendo de owner.
+func (o *outbox) Reschedule(ctx context.Context, entry *OutboxEntry, owner string, at time.Time) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("fallo al serializar la entrada %s del outbox: %w", entry.ID, err)
+	}
+	return o.run(ctx, rescheduleScript, []string{o.entries, o.schedule, o.leases}, entry.ID, owner, data, at.UnixMilli())
+}
+
+// Remove elimina una entrada enviada o descartada, si su concesión sigue siendo de owner.
+func (o *outbox) Remove(ctx context.Context, entry *OutboxEntry, owner string) error {
+	return o.run(ctx, finishScript, o.finishKeys(), entry.ID, owner, "", entry.Message.To)
+}
+
+// DeadLetter mueve una entrada a la lista de mensajes que no se pudieron enviar, si su concesión
+// sigue siendo de owner.
+func (o *outbox) DeadLetter(ctx context.Context, entry *OutboxEntry, owner string) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("fallo al serializar la entrada %s del outbox: %w", entry.ID, err)
+	}
+	if err := o.run(ctx, finishScript, o.finishKeys(), entry.ID, owner, data, entry.Message.To); err != nil {
+		return fmt.Errorf("fallo al mover la entrada %s a fallidos: %w", entry.ID, err)
+	}
+	return nil
+}
+
+// finishKeys devuelve las claves que usa finishScript.
+func (o *outbox) finishKeys() []string {
+	return []string{o.entries, o.schedule, o.leases, o.deadLetter, o.tails, o.predecessors}
+}
+
+// run ejecuta un script condicionado a la concesión de la entrada ARGV[1] y devuelve ErrLeaseLost si
+// no se aplicó.
+func (o *outbox) run(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) error {
+	applied, err := script.Run(ctx, o.rdb, keys, args...).Int()
+	if err != nil {
+		return fmt.Errorf("fallo al actualizar la entrada %v del outbox: %w", args[0], err)
+	}
+	if applied == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ClaimDue reclama hasta limit entradas vencidas a nombre de owner, reservándolas durante lease.
+func (o *outbox) ClaimDue(ctx context.Context, limit int, owner string, lease time.Duration) ([]*OutboxEntry, error) {
+	now := time.Now()
+	ids, err := claimDueScript.Run(ctx, o.rdb, []string{o.schedule, o.leases},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), limit, owner).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("fallo al reclamar entradas vencidas del outbox: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	values, err := o.rdb.HMGet(ctx, o.entries, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("fallo al leer entradas del outbox: %w", err)
+	}
+
+	entries := make([]*OutboxEntry, 0, len(values))
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			// La entrada ya fue eliminada; limpiar su programación
+			o.rdb.ZRem(ctx, o.schedule, ids[i])
+			o.rdb.HDel(ctx, o.leases, ids[i])
+			o.rdb.HDel(ctx, o.predecessors, ids[i])
+			continue
+		}
+		var entry OutboxEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			// Una entrada ilegible nunca se podrá enviar; apartarla para revisión manual
+			logger.Log.Errorf("Entrada %s del outbox inválida, se mueve a fallidos: %v", ids[i], err)
+			o.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.RPush(ctx, o.deadLetter, raw)
+				pipe.HDel(ctx, o.entries, ids[i])
+				pipe.ZRem(ctx, o.schedule, ids[i])
+				pipe.HDel(ctx, o.leases, ids[i])
+				pipe.HDel(ctx, o.predecessors, ids[i])
+				return nil
+			})
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,88 @@
+package outbound
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"chatbot/logger"
+	"chatbot/utils/redistest"
+	"chatbot/utils/whatsapp"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testOutbox devuelve un outbox con claves propias de la prueba.
+func testOutbox(t *testing.T) *outbox {
+	t.Helper()
+	rdb := redistest.New(t)
+	o := newOutbox(rdb, "prueba-outbox-"+newEntryID())
+	t.Cleanup(func() {
+		rdb.Del(context.Background(), o.entries, o.schedule, o.leases, o.deadLetter, o.tails, o.predecessors)
+	})
+	return o
+}
+
+func TestOutboxQueuesPerRecipient(t *testing.T) {
+	ctx := context.Background()
+	o := testOutbox(t)
+	until := time.Now().Add(time.Minute)
+	newEntry := func(to string) *OutboxEntry {
+		return &OutboxEntry{ID: newEntryID(), Message: whatsapp.NewTextMessage(to, "hola"), CreatedAt: time.Now()}
+	}
+
+	first, second, other := newEntry("5491100000001"), newEntry("5491100000001"), newEntry("5491100000002")
+	for _, tt := range []struct {
+		name         string
+		entry        *OutboxEntry
+		wantPrevious string
+	}{
+		{name: "cola vacía", entry: first},
+		{name: "detrás del mensaje pendiente", entry: second, wantPrevious: first.ID},
+		{name: "otro destinatario", entry: other},
+	} {
+		previous, err := o.Save(ctx, tt.entry, "dueño", until)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous != tt.wantPrevious {
+			t.Errorf("%s: anterior = %q, se esperaba %q", tt.name, previous, tt.wantPrevious)
+		}
+	}
+
+	if previous, err := o.Waiting(ctx, second.ID); err != nil || previous != first.ID {
+		t.Errorf("el segundo mensaje espera a %q (%v), se esperaba %q", previous, err, first.ID)
+	}
+	if err := o.Remove(ctx, first, "dueño"); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err := o.Waiting(ctx, second.ID); err != nil || previous != "" {
+		t.Errorf("el segundo mensaje espera a %q (%v) tras enviarse el primero", previous, err)
+	}
+
+	// Un mensaje nuevo sigue en cola detrás del segundo mientras esté pendiente
+	third := newEntry("5491100000001")
+	if previous, err := o.Save(ctx, third, "dueño", until); err != nil || previous != second.ID {
+		t.Errorf("anterior del tercer mensaje = %q (%v), se esperaba %q", previous, err, second.ID)
+	}
+	if _, err := o.ClaimDue(ctx, 10, "dueño", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.DeadLetter(ctx, second, "dueño"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Remove(ctx, third, "dueño"); err != nil {
+		t.Fatal(err)
+	}
+	if previous, err := o.Save(ctx, newEntry("5491100000001"), "dueño", until); err != nil || previous != "" {
+		t.Errorf("anterior con la cola vacía = %q (%v)", previous, err)
+	}
+}
@@ -0,0 +1,326 @@
+// chatbot/utils/outbound/sender.go
+
+package outbound
+
+import (
+	"chatbot/logger"
+	"chatbot/utils/whatsapp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrDeferred indica que el mensaje no se pudo enviar por un error transitorio, o que espera a un
+// mensaje anterior al mismo destinatario, y quedó en el outbox para reenviarse más tarde.
+var ErrDeferred = errors.New("mensaje diferido en el outbox")
+
+// Config define los parámetros del remitente de mensajes salientes.
+type Config struct {
+	// OutboxKey es el prefijo de las claves de Redis del outbox.
+	OutboxKey string
+	// MaxAttempts es el número de intentos inmediatos antes de diferir el mensaje al outbox.
+	MaxAttempts int
+	// MaxOutboxAttempts es el número total de intentos antes de mover el mensaje a fallidos.
+	MaxOutboxAttempts int
+	// BaseDelay y MaxDelay acotan la espera exponencial entre intentos.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// RatePerSecond y Burst definen el token bucket de cada número de teléfono del negocio.
+	RatePerSecond float64
+	Burst         int
+	// PollInterval es cada cuánto se revisa el outbox en busca de mensajes vencidos.
+	PollInterval time.Duration
+	// Lease es el tiempo durante el cual una instancia se reserva un mensaje del outbox. Se renueva
+	// antes de cada intento, por lo que debe superar lo que tarda un intento con su espera.
+	Lease time.Duration
+}
+
+// Sender envía mensajes con reintentos, espera exponencial con jitter y límite de tasa por número,
+// guardándolos en un outbox de Redis hasta confirmar su envío.
+type Sender struct {
+	client *whatsapp.Client
+	outbox *outbox
+	cfg    Config
+
+	mu       sync.Mutex
+	limiters map[string]*tokenBucket
+
+	// OnSent se llama con cada mensaje enviado, tanto inmediato como reenviado desde el outbox.
+	OnSent func(message *whatsapp.OutboundMessage, messageID string)
+	// OnFailed se llama con cada mensaje que el outbox descarta al fallar su reenvío por un error
+	// permanente o por agotar los intentos.
+	OnFailed func(message *whatsapp.OutboundMessage, err error)
+	// Prepare se llama antes de reenviar un mensaje desde el outbox y devuelve el mensaje a enviar, que
+	// puede reemplazar al original, o nil para descartarlo. Si falla, el reenvío se reprograma.
+	Prepare func(message *whatsapp.OutboundMessage) (*whatsapp.OutboundMessage, error)
+
+	wg sync.WaitGroup
+}
+
+// NewSender crea un remitente con la configuración indicada.
+func NewSender(client *whatsapp.Client, rdb *redis.Client, cfg Config) *Sender {
+	if cfg.OutboxKey == "" {
+		cfg.OutboxKey = "outbox"
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.MaxOutboxAttempts < cfg.MaxAttempts {
+		cfg.MaxOutboxAttempts = cfg.MaxAttempts
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = 500 * time.Millisecond
+	}
+	if cfg.MaxDelay < cfg.BaseDelay {
+		cfg.MaxDelay = cfg.BaseDelay
+	}
+	if cfg.RatePerSecond <= 0 {
+		cfg.RatePerSecond = 80
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 2 * time.Minute
+	}
+	return &Sender{
+		client:   client,
+		outbox:   newOutbox(rdb, cfg.OutboxKey),
+		cfg:      cfg,
+		limiters: make(map[string]*tokenBucket),
+	}
+}
+
+// Send guarda el mensaje en el outbox y lo envía con reintentos. Si se agotan los intentos inmediatos
+// por errores transitorios devuelve un error que envuelve ErrDeferred y el mensaje se reenviará desde
+// el outbox. Los errores permanentes se devuelven sin reintentar. Si un mensaje anterior al mismo
+// destinatario sigue en el outbox, el mensaje queda en cola detrás de él sin intentarse y también se
+// devuelve un error que envuelve ErrDeferred.
+func (s *Sender) Send(ctx context.Context, message *whatsapp.OutboundMessage) (string, error) {
+	entry := &OutboxEntry{
+		ID:            newEntryID(),
+		PhoneNumberID: s.client.PhoneNumberID,
+		Message:       message,
+		CreatedAt:     time.Now(),
+	}
+
+	// Reservar la entrada mientras se intenta el envío para que el outbox no la reenvíe en paralelo
+	owner := newEntryID()
+	persisted := true
+	previous, err := s.outbox.Save(ctx, entry, owner, time.Now().Add(s.cfg.Lease))
+	if err != nil {
+		logger.Log.Errorf("Error al guardar el mensaje para %s en el outbox, se envía sin respaldo: %v", message.To, err)
+		persisted = false
+	}
+	if previous != "" {
+		logger.Log.Infof("Mensaje %s a %s en cola detrás del mensaje %s del outbox", entry.ID, message.To, previous)
+		return "", fmt.Errorf("%w: en cola detrás del mensaje %s", ErrDeferred, previous)
+	}
+
+	for attempt := 1; attempt <= s.cfg.MaxAttempts; attempt++ {
+		// Renovar la reserva antes de cada intento; si otra instancia la tomó, el envío es suyo
+		if persisted {
+			if renewErr := s.outbox.Renew(ctx, entry.ID, owner, time.Now().Add(s.cfg.Lease)); errors.Is(renewErr, ErrLeaseLost) {
+				logger.Log.Warnf("El mensaje %s a %s lo reenvía otra instancia desde el outbox", entry.ID, message.To)
+				return "", fmt.Errorf("%w: %v", ErrDeferred, renewErr)
+			}
+		}
+
+		var messageID string
+		messageID, err = s.deliver(ctx, entry)
+		if err == nil {
+			if persisted {
+				s.outbox.Remove(ctx, entry, owner)
+			}
+			return messageID, nil
+		}
+		if !whatsapp.IsTemporary(err) {
+			break
+		}
+		if attempt < s.cfg.MaxAttempts {
+			delay := s.backoff(entry.Attempts)
+			logger.Log.Warnf("Error transitorio al enviar mensaje a %s (intento %d de %d), se reintenta en %v: %v", message.To, attempt, s.cfg.MaxAttempts, delay, err)
+			if waitErr := sleep(ctx, delay); waitErr != nil {
+				break
+			}
+		}
+	}
+
+	if !whatsapp.IsTemporary(err) || !persisted {
+		if persisted {
+			s.outbox.Remove(ctx, entry, owner)
+		}
+		return "", err
+	}
+
+	if saveErr := s.outbox.Reschedule(ctx, entry, owner, time.Now().Add(s.backoff(entry.Attempts))); saveErr != nil {
+		return "", fmt.Errorf("%v; además %w", err, saveErr)
+	}
+	logger.Log.Warnf("Mensaje a %s diferido en el outbox tras %d intento(s): %v", message.To, entry.Attempts, err)
+	return "", fmt.Errorf("%w: %v", ErrDeferred, err)
+}
+
+// Start lanza el proceso que reenvía los mensajes vencidos del outbox, incluidos los que quedaron
+// pendientes antes de un reinicio. Se detiene cuando se cancela ctx.
+func (s *Sender) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go s.redeliver(ctx)
+	logger.Log.Infof("Outbox %s iniciado con %v mensajes por segundo por número", s.cfg.OutboxKey, s.cfg.RatePerSecond)
+}
+
+// Wait bloquea hasta que termine el proceso de reenvío.
+func (s *Sender) Wait() {
+	s.wg.Wait()
+}
+
+// redeliver revisa periódicamente el outbox y reenvía los mensajes vencidos.
+func (s *Sender) redeliver(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		owner := newEntryID()
+		entries, err := s.outbox.ClaimDue(ctx, 50, owner, s.cfg.Lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.Errorf("Error al revisar el outbox %s: %v", s.cfg.OutboxKey, err)
+			}
+			continue
+		}
+
+		for _, entry := range entries {
+			s.redeliverEntry(ctx, entry, owner)
+		}
+	}
+}
+
+// redeliverEntry intenta reenviar una entrada del outbox reclamada por owner y la reprograma o la
+// descarta según el resultado.
+func (s *Sender) redeliverEntry(ctx context.Context, entry *OutboxEntry, owner string) {
+	// Las entradas del lote se envían una tras otra; renovar la reserva antes de cada una
+	if err := s.outbox.Renew(ctx, entry.ID, owner, time.Now().Add(s.cfg.Lease)); err != nil {
+		if !errors.Is(err, ErrLeaseLost) {
+			logger.Log.Error(err)
+		}
+		return
+	}
+
+	// Los mensajes al mismo destinatario se envían en orden; esperar a que termine el anterior
+	previous, err := s.outbox.Waiting(ctx, entry.ID)
+	if err != nil {
+		logger.Log.Error(err)
+	}
+	if previous != "" || err != nil {
+		if err := s.outbox.Reschedule(ctx, entry, owner, time.Now().Add(s.cfg.PollInterval)); err != nil {
+			logger.Log.Error(err)
+		}
+		return
+	}
+
+	if s.Prepare != nil {
+		message, err := s.Prepare(entry.Message)
+		if err != nil {
+			delay := s.backoff(entry.Attempts)
+			logger.Log.Warnf("No se pudo preparar el reenvío del mensaje %s a %s, se reintenta en %v: %v", entry.ID, entry.Message.To, delay, err)
+			if err := s.outbox.Reschedule(ctx, entry, owner, time.Now().Add(delay)); err != nil {
+				logger.Log.Error(err)
+			}
+			return
+		}
+		if message == nil {
+			logger.Log.Warnf("Mensaje %s a %s descartado antes de reenviarlo desde el outbox", entry.ID, entry.Message.To)
+			s.outbox.Remove(ctx, entry, owner)
+			return
+		}
+		entry.Message = message
+	}
+
+	_, err = s.deliver(ctx, entry)
+	switch {
+	case err == nil:
+		logger.Log.Infof("Mensaje %s a %s reenviado desde el outbox tras %d intento(s)", entry.ID, entry.Message.To, entry.Attempts)
+		s.outbox.Remove(ctx, entry, owner)
+	case !whatsapp.IsTemporary(err) || entry.Attempts >= s.cfg.MaxOutboxAttempts:
+		logger.Log.Errorf("Mensaje %s a %s descartado tras %d intento(s): %v", entry.ID, entry.Message.To, entry.Attempts, err)
+		if err := s.outbox.DeadLetter(ctx, entry, owner); err != nil {
+			logger.Log.Error(err)
+		}
+		if s.OnFailed != nil {
+			s.OnFailed(entry.Message, err)
+		}
+	default:
+		delay := s.backoff(entry.Attempts)
+		logger.Log.Warnf("Error transitorio al reenviar el mensaje %s a %s, se reintenta en %v: %v", entry.ID, entry.Message.To, delay, err)
+		if err := s.outbox.Reschedule(ctx, entry, owner, time.Now().Add(delay)); err != nil {
+			logger.Log.Error(err)
+		}
+	}
+}
+
+// deliver espera un token del número del negocio y hace un intento de envío.
+func (s *Sender) deliver(ctx context.Context, entry *OutboxEntry) (string, error) {
+	if err := s.limiter(entry.PhoneNumberID).Wait(ctx); err != nil {
+		return "", err
+	}
+
+	entry.Attempts++
+	response, err := s.client.Send(ctx, entry.Message)
+	if err != nil {
+		entry.LastError = err.Error()
+		return "", err
+	}
+
+	messageID := response.MessageID()
+	if s.OnSent != nil {
+		s.OnSent(entry.Message, messageID)
+	}
+	return messageID, nil
+}
+
+// limiter devuelve el token bucket de un número de teléfono del negocio.
+func (s *Sender) limiter(phoneNumberID string) *tokenBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.limiters[phoneNumberID]
+	if !ok {
+		bucket = newTokenBucket(s.cfg.RatePerSecond, s.cfg.Burst)
+		s.limiters[phoneNumberID] = bucket
+	}
+	return bucket
+}
+
+// backoff calcula la espera tras el intento indicado con crecimiento exponencial y jitter completo.
+func (s *Sender) backoff(attempts int) time.Duration {
+	delay := s.cfg.MaxDelay
+	if attempts < 30 {
+		if exp := s.cfg.BaseDelay << uint(attempts); exp > 0 && exp < delay {
+			delay = exp
+		}
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// sleep espera la duración indicada o hasta que se cancele ctx.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
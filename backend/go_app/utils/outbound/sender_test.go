@@ -0,0 +1,60 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chatbot/utils/redistest"
+	"chatbot/utils/whatsapp"
+)
+
+// testSender crea un remitente cuyo cliente envía a un servidor de prueba que responde con status y body.
+func testSender(t *testing.T, status int, body string) *Sender {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	client := whatsapp.NewClient(server.URL, "v19.0", "123", "token")
+	return NewSender(client, redistest.New(t), Config{OutboxKey: "prueba-outbox-" + newEntryID(), BaseDelay: time.Millisecond})
+}
+
+func TestRedeliverEntryReportsFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantFailed bool
+	}{
+		{name: "enviado", status: http.StatusOK, body: `{"messages":[{"id":"wamid.1"}]}`},
+		{name: "plantilla rechazada", status: http.StatusBadRequest, body: `{"error":{"message":"Template name does not exist","code":132001}}`, wantFailed: true},
+		{name: "error transitorio", status: http.StatusServiceUnavailable, body: `{"error":{"message":"Service unavailable","code":2}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := testSender(t, tt.status, tt.body)
+			var failed *whatsapp.OutboundMessage
+			s.OnFailed = func(message *whatsapp.OutboundMessage, err error) { failed = message }
+
+			entry := &OutboxEntry{ID: newEntryID(), PhoneNumberID: "123", Message: whatsapp.NewTemplateMessage("5491100000000", "reenganche", "es"), CreatedAt: time.Now()}
+			if _, err := s.outbox.Save(ctx, entry, "dueño", time.Now().Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			s.redeliverEntry(ctx, entry, "dueño")
+
+			if (failed != nil) != tt.wantFailed {
+				t.Fatalf("OnFailed llamado = %v, se esperaba %v", failed != nil, tt.wantFailed)
+			}
+			if failed != nil && failed.Template.Name != "reenganche" {
+				t.Errorf("OnFailed recibió la plantilla %q", failed.Template.Name)
+			}
+		})
+	}
+}
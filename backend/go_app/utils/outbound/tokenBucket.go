@@ -0,0 +1,55 @@
+// chatbot/utils/outbound/tokenBucket.go
+
+package outbound
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket limita la tasa de envío: se recargan rate tokens por segundo hasta capacity.
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket crea un bucket lleno con la tasa y la ráfaga indicadas.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, capacity: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait bloquea hasta obtener un token o hasta que se cancele ctx.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
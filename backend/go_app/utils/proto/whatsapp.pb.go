@@ -22,6 +22,65 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Tipo de una parte de la respuesta del asistente
+type ReplyKind int32
+
+const (
+	ReplyKind_REPLY_KIND_UNSPECIFIED ReplyKind = 0
+	ReplyKind_REPLY_KIND_TEXT        ReplyKind = 1
+	ReplyKind_REPLY_KIND_BUTTONS     ReplyKind = 2
+	ReplyKind_REPLY_KIND_LIST        ReplyKind = 3
+	ReplyKind_REPLY_KIND_MEDIA       ReplyKind = 4
+	ReplyKind_REPLY_KIND_TEMPLATE    ReplyKind = 5
+)
+
+// Enum value maps for ReplyKind.
+var (
+	ReplyKind_name = map[int32]string{
+		0: "REPLY_KIND_UNSPECIFIED",
+		1: "REPLY_KIND_TEXT",
+		2: "REPLY_KIND_BUTTONS",
+		3: "REPLY_KIND_LIST",
+		4: "REPLY_KIND_MEDIA",
+		5: "REPLY_KIND_TEMPLATE",
+	}
+	ReplyKind_value = map[string]int32{
+		"REPLY_KIND_UNSPECIFIED": 0,
+		"REPLY_KIND_TEXT":        1,
+		"REPLY_KIND_BUTTONS":     2,
+		"REPLY_KIND_LIST":        3,
+		"REPLY_KIND_MEDIA":       4,
+		"REPLY_KIND_TEMPLATE":    5,
+	}
+)
+
+func (x ReplyKind) Enum() *ReplyKind {
+	p := new(ReplyKind)
+	*p = x
+	return p
+}
+
+func (x ReplyKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ReplyKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_whatsapp_proto_enumTypes[0].Descriptor()
+}
+
+func (ReplyKind) Type() protoreflect.EnumType {
+	return &file_whatsapp_proto_enumTypes[0]
+}
+
+func (x ReplyKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ReplyKind.Descriptor instead.
+func (ReplyKind) EnumDescriptor() ([]byte, []int) {
+	return file_whatsapp_proto_rawDescGZIP(), []int{0}
+}
+
 // Mensajes para la creación de hilos
 type CreateThreadRequest struct {
 	state         protoimpl.MessageState
@@ -202,6 +261,8 @@ type GenerateResponseRequest struct {
 	Phone       string `protobuf:"bytes,1,opt,name=phone,proto3" json:"phone,omitempty"`
 	ThreadId    string `protobuf:"bytes,2,opt,name=thread_id,json=threadId,proto3" json:"thread_id,omitempty"`
 	MessageBody string `protobuf:"bytes,3,opt,name=message_body,json=messageBody,proto3" json:"message_body,omitempty"`
+	// Opción elegida por el usuario en un mensaje interactivo, si el mensaje es una respuesta a botones o listas
+	SelectedOption *SelectedOption `protobuf:"bytes,4,opt,name=selected_option,json=selectedOption,proto3" json:"selected_option,omitempty"`
 }
 
 func (x *GenerateResponseRequest) Reset() {
@@ -257,18 +318,337 @@ func (x *GenerateResponseRequest) GetMessageBody() string {
 	return ""
 }
 
+func (x *GenerateResponseRequest) GetSelectedOption() *SelectedOption {
+	if x != nil {
+		return x.SelectedOption
+	}
+	return nil
+}
+
+// Opción de un mensaje interactivo elegida por el usuario
+type SelectedOption struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id    string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Title string `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	// Pregunta de seguimiento a la que responde la opción
+	Question string `protobuf:"bytes,3,opt,name=question,proto3" json:"question,omitempty"`
+}
+
+func (x *SelectedOption) Reset() {
+	*x = SelectedOption{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_whatsapp_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SelectedOption) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SelectedOption) ProtoMessage() {}
+
+func (x *SelectedOption) ProtoReflect() protoreflect.Message {
+	mi := &file_whatsapp_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SelectedOption.ProtoReflect.Descriptor instead.
+func (*SelectedOption) Descriptor() ([]byte, []int) {
+	return file_whatsapp_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SelectedOption) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SelectedOption) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *SelectedOption) GetQuestion() string {
+	if x != nil {
+		return x.Question
+	}
+	return ""
+}
+
+// Opción que se ofrece al usuario; el id vuelve en SelectedOption cuando la elige
+type ReplyOption struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id          string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Title       string `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	Description string `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+}
+
+func (x *ReplyOption) Reset() {
+	*x = ReplyOption{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_whatsapp_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReplyOption) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplyOption) ProtoMessage() {}
+
+func (x *ReplyOption) ProtoReflect() protoreflect.Message {
+	mi := &file_whatsapp_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplyOption.ProtoReflect.Descriptor instead.
+func (*ReplyOption) Descriptor() ([]byte, []int) {
+	return file_whatsapp_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReplyOption) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ReplyOption) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *ReplyOption) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+// Parte de la respuesta que se envía como un mensaje de WhatsApp
+type ReplyPart struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Kind ReplyKind `protobuf:"varint,1,opt,name=kind,proto3,enum=whatsapp.ReplyKind" json:"kind,omitempty"`
+	// Texto del mensaje, cuerpo de los botones o la lista, o pie de la multimedia
+	Text string `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	// Opciones de los botones o la lista
+	Options []*ReplyOption `protobuf:"bytes,3,rep,name=options,proto3" json:"options,omitempty"`
+	// Enlace y tipo (image, audio, video, document) de la multimedia
+	MediaUrl  string `protobuf:"bytes,4,opt,name=media_url,json=mediaUrl,proto3" json:"media_url,omitempty"`
+	MediaType string `protobuf:"bytes,5,opt,name=media_type,json=mediaType,proto3" json:"media_type,omitempty"`
+	// Nombre, idioma y parámetros del cuerpo de la plantilla
+	TemplateName       string   `protobuf:"bytes,6,opt,name=template_name,json=templateName,proto3" json:"template_name,omitempty"`
+	TemplateLanguage   string   `protobuf:"bytes,7,opt,name=template_language,json=templateLanguage,proto3" json:"template_language,omitempty"`
+	TemplateParameters []string `protobuf:"bytes,8,rep,name=template_parameters,json=templateParameters,proto3" json:"template_parameters,omitempty"`
+}
+
+func (x *ReplyPart) Reset() {
+	*x = ReplyPart{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_whatsapp_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReplyPart) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplyPart) ProtoMessage() {}
+
+func (x *ReplyPart) ProtoReflect() protoreflect.Message {
+	mi := &file_whatsapp_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplyPart.ProtoReflect.Descriptor instead.
+func (*ReplyPart) Descriptor() ([]byte, []int) {
+	return file_whatsapp_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ReplyPart) GetKind() ReplyKind {
+	if x != nil {
+		return x.Kind
+	}
+	return ReplyKind_REPLY_KIND_UNSPECIFIED
+}
+
+func (x *ReplyPart) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *ReplyPart) GetOptions() []*ReplyOption {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *ReplyPart) GetMediaUrl() string {
+	if x != nil {
+		return x.MediaUrl
+	}
+	return ""
+}
+
+func (x *ReplyPart) GetMediaType() string {
+	if x != nil {
+		return x.MediaType
+	}
+	return ""
+}
+
+func (x *ReplyPart) GetTemplateName() string {
+	if x != nil {
+		return x.TemplateName
+	}
+	return ""
+}
+
+func (x *ReplyPart) GetTemplateLanguage() string {
+	if x != nil {
+		return x.TemplateLanguage
+	}
+	return ""
+}
+
+func (x *ReplyPart) GetTemplateParameters() []string {
+	if x != nil {
+		return x.TemplateParameters
+	}
+	return nil
+}
+
+// Tokens consumidos al generar la respuesta
+type TokenUsage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PromptTokens     int32 `protobuf:"varint,1,opt,name=prompt_tokens,json=promptTokens,proto3" json:"prompt_tokens,omitempty"`
+	CompletionTokens int32 `protobuf:"varint,2,opt,name=completion_tokens,json=completionTokens,proto3" json:"completion_tokens,omitempty"`
+	TotalTokens      int32 `protobuf:"varint,3,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+}
+
+func (x *TokenUsage) Reset() {
+	*x = TokenUsage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_whatsapp_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TokenUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TokenUsage) ProtoMessage() {}
+
+func (x *TokenUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_whatsapp_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TokenUsage.ProtoReflect.Descriptor instead.
+func (*TokenUsage) Descriptor() ([]byte, []int) {
+	return file_whatsapp_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TokenUsage) GetPromptTokens() int32 {
+	if x != nil {
+		return x.PromptTokens
+	}
+	return 0
+}
+
+func (x *TokenUsage) GetCompletionTokens() int32 {
+	if x != nil {
+		return x.CompletionTokens
+	}
+	return 0
+}
+
+func (x *TokenUsage) GetTotalTokens() int32 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
 type GenerateResponseResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
+	// Respuesta con el formato anterior "respuesta|||pregunta|||opción1|opción2". Solo se usa si contract_version es 0
 	Response string `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// Versión del contrato de la respuesta estructurada; 0 indica un servidor que solo envía response
+	ContractVersion  int32          `protobuf:"varint,2,opt,name=contract_version,json=contractVersion,proto3" json:"contract_version,omitempty"`
+	Parts            []*ReplyPart   `protobuf:"bytes,3,rep,name=parts,proto3" json:"parts,omitempty"`
+	FollowUpQuestion string         `protobuf:"bytes,4,opt,name=follow_up_question,json=followUpQuestion,proto3" json:"follow_up_question,omitempty"`
+	Options          []*ReplyOption `protobuf:"bytes,5,rep,name=options,proto3" json:"options,omitempty"`
+	// Intenciones detectadas en el mensaje del usuario
+	Intents []string `protobuf:"bytes,6,rep,name=intents,proto3" json:"intents,omitempty"`
+	// Indica que la conversación debe pasar a un asesor humano
+	Handoff bool        `protobuf:"varint,7,opt,name=handoff,proto3" json:"handoff,omitempty"`
+	Usage   *TokenUsage `protobuf:"bytes,8,opt,name=usage,proto3" json:"usage,omitempty"`
 }
 
 func (x *GenerateResponseResponse) Reset() {
 	*x = GenerateResponseResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_whatsapp_proto_msgTypes[5]
+		mi := &file_whatsapp_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -281,7 +661,7 @@ func (x *GenerateResponseResponse) String() string {
 func (*GenerateResponseResponse) ProtoMessage() {}
 
 func (x *GenerateResponseResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_whatsapp_proto_msgTypes[5]
+	mi := &file_whatsapp_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -294,7 +674,7 @@ func (x *GenerateResponseResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateResponseResponse.ProtoReflect.Descriptor instead.
 func (*GenerateResponseResponse) Descriptor() ([]byte, []int) {
-	return file_whatsapp_proto_rawDescGZIP(), []int{5}
+	return file_whatsapp_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *GenerateResponseResponse) GetResponse() string {
@@ -304,6 +684,55 @@ func (x *GenerateResponseResponse) GetResponse() string {
 	return ""
 }
 
+func (x *GenerateResponseResponse) GetContractVersion() int32 {
+	if x != nil {
+		return x.ContractVersion
+	}
+	return 0
+}
+
+func (x *GenerateResponseResponse) GetParts() []*ReplyPart {
+	if x != nil {
+		return x.Parts
+	}
+	return nil
+}
+
+func (x *GenerateResponseResponse) GetFollowUpQuestion() string {
+	if x != nil {
+		return x.FollowUpQuestion
+	}
+	return ""
+}
+
+func (x *GenerateResponseResponse) GetOptions() []*ReplyOption {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *GenerateResponseResponse) GetIntents() []string {
+	if x != nil {
+		return x.Intents
+	}
+	return nil
+}
+
+func (x *GenerateResponseResponse) GetHandoff() bool {
+	if x != nil {
+		return x.Handoff
+	}
+	return false
+}
+
+func (x *GenerateResponseResponse) GetUsage() *TokenUsage {
+	if x != nil {
+		return x.Usage
+	}
+	return nil
+}
+
 type GenerateResponseAnalizerRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -316,7 +745,7 @@ type GenerateResponseAnalizerRequest struct {
 func (x *GenerateResponseAnalizerRequest) Reset() {
 	*x = GenerateResponseAnalizerRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_whatsapp_proto_msgTypes[6]
+		mi := &file_whatsapp_proto_msgTypes[10]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -329,7 +758,7 @@ func (x *GenerateResponseAnalizerRequest) String() string {
 func (*GenerateResponseAnalizerRequest) ProtoMessage() {}
 
 func (x *GenerateResponseAnalizerRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_whatsapp_proto_msgTypes[6]
+	mi := &file_whatsapp_proto_msgTypes[10]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -342,7 +771,7 @@ func (x *GenerateResponseAnalizerRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateResponseAnalizerRequest.ProtoReflect.Descriptor instead.
 func (*GenerateResponseAnalizerRequest) Descriptor() ([]byte, []int) {
-	return file_whatsapp_proto_rawDescGZIP(), []int{6}
+	return file_whatsapp_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *GenerateResponseAnalizerRequest) GetThreadIdAnalizer() string {
@@ -370,7 +799,7 @@ type GenerateResponseAnalizerResponse struct {
 func (x *GenerateResponseAnalizerResponse) Reset() {
 	*x = GenerateResponseAnalizerResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_whatsapp_proto_msgTypes[7]
+		mi := &file_whatsapp_proto_msgTypes[11]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -383,7 +812,7 @@ func (x *GenerateResponseAnalizerResponse) String() string {
 func (*GenerateResponseAnalizerResponse) ProtoMessage() {}
 
 func (x *GenerateResponseAnalizerResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_whatsapp_proto_msgTypes[7]
+	mi := &file_whatsapp_proto_msgTypes[11]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -396,7 +825,7 @@ func (x *GenerateResponseAnalizerResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GenerateResponseAnalizerResponse.ProtoReflect.Descriptor instead.
 func (*GenerateResponseAnalizerResponse) Descriptor() ([]byte, []int) {
-	return file_whatsapp_proto_rawDescGZIP(), []int{7}
+	return file_whatsapp_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *GenerateResponseAnalizerResponse) GetResponse() string {
@@ -406,6 +835,64 @@ func (x *GenerateResponseAnalizerResponse) GetResponse() string {
 	return ""
 }
 
+// Fragmento de una respuesta generada en streaming
+type GenerateResponseChunk struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Texto nuevo de las partes TEXT de la respuesta, a continuación del fragmento anterior
+	Delta string `protobuf:"bytes,1,opt,name=delta,proto3" json:"delta,omitempty"`
+	// Respuesta completa; solo la trae el último fragmento
+	Final *GenerateResponseResponse `protobuf:"bytes,2,opt,name=final,proto3" json:"final,omitempty"`
+}
+
+func (x *GenerateResponseChunk) Reset() {
+	*x = GenerateResponseChunk{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_whatsapp_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GenerateResponseChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerateResponseChunk) ProtoMessage() {}
+
+func (x *GenerateResponseChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_whatsapp_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerateResponseChunk.ProtoReflect.Descriptor instead.
+func (*GenerateResponseChunk) Descriptor() ([]byte, []int) {
+	return file_whatsapp_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GenerateResponseChunk) GetDelta() string {
+	if x != nil {
+		return x.Delta
+	}
+	return ""
+}
+
+func (x *GenerateResponseChunk) GetFinal() *GenerateResponseResponse {
+	if x != nil {
+		return x.Final
+	}
+	return nil
+}
+
 var File_whatsapp_proto protoreflect.FileDescriptor
 
 var file_whatsapp_proto_rawDesc = []byte{
@@ -422,56 +909,138 @@ var file_whatsapp_proto_rawDesc = []byte{
 	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2c, 0x0a, 0x12, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x5f,
 	0x69, 0x64, 0x5f, 0x61, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28,
 	0x09, 0x52, 0x10, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x49, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69,
-	0x7a, 0x65, 0x72, 0x22, 0x6f, 0x0a, 0x17, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52,
-	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14,
-	0x0a, 0x05, 0x70, 0x68, 0x6f, 0x6e, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x70,
-	0x68, 0x6f, 0x6e, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x5f, 0x69,
-	0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x49,
-	0x64, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x62, 0x6f, 0x64,
-	0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
-	0x42, 0x6f, 0x64, 0x79, 0x22, 0x36, 0x0a, 0x18, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65,
-	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x72, 0x0a, 0x1f,
-	0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
-	0x2c, 0x0a, 0x12, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x5f, 0x69, 0x64, 0x5f, 0x61, 0x6e, 0x61,
-	0x6c, 0x69, 0x7a, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x74, 0x68, 0x72,
-	0x65, 0x61, 0x64, 0x49, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x12, 0x21, 0x0a,
-	0x0c, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x0b, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x42, 0x6f, 0x64, 0x79,
-	0x22, 0x3e, 0x0a, 0x20, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70,
-	0x6f, 0x6e, 0x73, 0x65, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70,
-	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x32, 0x95, 0x03, 0x0a, 0x0f, 0x57, 0x68, 0x61, 0x74, 0x73, 0x41, 0x70, 0x70, 0x53, 0x65, 0x72,
-	0x76, 0x69, 0x63, 0x65, 0x12, 0x4d, 0x0a, 0x0c, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68,
-	0x72, 0x65, 0x61, 0x64, 0x12, 0x1d, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e,
-	0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72, 0x65, 0x61, 0x64, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x43,
-	0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72, 0x65, 0x61, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f,
-	0x6e, 0x73, 0x65, 0x12, 0x65, 0x0a, 0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72,
-	0x65, 0x61, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x12, 0x25, 0x2e, 0x77, 0x68,
-	0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72,
-	0x65, 0x61, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x1a, 0x26, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x43, 0x72,
-	0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72, 0x65, 0x61, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a,
-	0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x59, 0x0a, 0x10, 0x47, 0x65,
-	0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x21,
-	0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61,
-	0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x1a, 0x22, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e,
-	0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x71, 0x0a, 0x18, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74,
-	0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65,
-	0x72, 0x12, 0x29, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e,
-	0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x41, 0x6e, 0x61,
-	0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x2a, 0x2e, 0x77,
-	0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65,
+	0x7a, 0x65, 0x72, 0x22, 0xb2, 0x01, 0x0a, 0x17, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x14, 0x0a, 0x05, 0x70, 0x68, 0x6f, 0x6e, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x70, 0x68, 0x6f, 0x6e, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x5f,
+	0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64,
+	0x49, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x62, 0x6f,
+	0x64, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x42, 0x6f, 0x64, 0x79, 0x12, 0x41, 0x0a, 0x0f, 0x73, 0x65, 0x6c, 0x65, 0x63, 0x74, 0x65,
+	0x64, 0x5f, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18,
+	0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x53, 0x65, 0x6c, 0x65, 0x63, 0x74,
+	0x65, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0e, 0x73, 0x65, 0x6c, 0x65, 0x63, 0x74,
+	0x65, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x52, 0x0a, 0x0e, 0x53, 0x65, 0x6c, 0x65,
+	0x63, 0x74, 0x65, 0x64, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x69,
+	0x74, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x71, 0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x71, 0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x55, 0x0a, 0x0b,
+	0x52, 0x65, 0x70, 0x6c, 0x79, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a, 0x02, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x74,
+	0x69, 0x74, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x69, 0x74, 0x6c,
+	0x65, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x22, 0xb8, 0x02, 0x0a, 0x09, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x50, 0x61, 0x72,
+	0x74, 0x12, 0x27, 0x0a, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x13, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x4b, 0x69, 0x6e, 0x64, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x65,
+	0x78, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x65, 0x78, 0x74, 0x12, 0x2f,
+	0x0a, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x15, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x52, 0x65, 0x70, 0x6c, 0x79,
+	0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12,
+	0x1b, 0x0a, 0x09, 0x6d, 0x65, 0x64, 0x69, 0x61, 0x5f, 0x75, 0x72, 0x6c, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x6d, 0x65, 0x64, 0x69, 0x61, 0x55, 0x72, 0x6c, 0x12, 0x1d, 0x0a, 0x0a,
+	0x6d, 0x65, 0x64, 0x69, 0x61, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x6d, 0x65, 0x64, 0x69, 0x61, 0x54, 0x79, 0x70, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x74,
+	0x65, 0x6d, 0x70, 0x6c, 0x61, 0x74, 0x65, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0c, 0x74, 0x65, 0x6d, 0x70, 0x6c, 0x61, 0x74, 0x65, 0x4e, 0x61, 0x6d, 0x65,
+	0x12, 0x2b, 0x0a, 0x11, 0x74, 0x65, 0x6d, 0x70, 0x6c, 0x61, 0x74, 0x65, 0x5f, 0x6c, 0x61, 0x6e,
+	0x67, 0x75, 0x61, 0x67, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x74, 0x65, 0x6d,
+	0x70, 0x6c, 0x61, 0x74, 0x65, 0x4c, 0x61, 0x6e, 0x67, 0x75, 0x61, 0x67, 0x65, 0x12, 0x2f, 0x0a,
+	0x13, 0x74, 0x65, 0x6d, 0x70, 0x6c, 0x61, 0x74, 0x65, 0x5f, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x65,
+	0x74, 0x65, 0x72, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x09, 0x52, 0x12, 0x74, 0x65, 0x6d, 0x70,
+	0x6c, 0x61, 0x74, 0x65, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x73, 0x22, 0x81,
+	0x01, 0x0a, 0x0a, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x55, 0x73, 0x61, 0x67, 0x65, 0x12, 0x23, 0x0a,
+	0x0d, 0x70, 0x72, 0x6f, 0x6d, 0x70, 0x74, 0x5f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x70, 0x72, 0x6f, 0x6d, 0x70, 0x74, 0x54, 0x6f, 0x6b, 0x65,
+	0x6e, 0x73, 0x12, 0x2b, 0x0a, 0x11, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x69, 0x6f, 0x6e,
+	0x5f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x10, 0x63,
+	0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x12,
+	0x21, 0x0a, 0x0c, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0b, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x54, 0x6f, 0x6b, 0x65,
+	0x6e, 0x73, 0x22, 0xcb, 0x02, 0x0a, 0x18, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x29, 0x0a, 0x10, 0x63,
+	0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0f, 0x63, 0x6f, 0x6e, 0x74, 0x72, 0x61, 0x63, 0x74, 0x56,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x29, 0x0a, 0x05, 0x70, 0x61, 0x72, 0x74, 0x73, 0x18,
+	0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70,
+	0x2e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x50, 0x61, 0x72, 0x74, 0x52, 0x05, 0x70, 0x61, 0x72, 0x74,
+	0x73, 0x12, 0x2c, 0x0a, 0x12, 0x66, 0x6f, 0x6c, 0x6c, 0x6f, 0x77, 0x5f, 0x75, 0x70, 0x5f, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x66,
+	0x6f, 0x6c, 0x6c, 0x6f, 0x77, 0x55, 0x70, 0x51, 0x75, 0x65, 0x73, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x2f, 0x0a, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x15, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x07, 0x6f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73,
+	0x12, 0x18, 0x0a, 0x07, 0x69, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x07, 0x69, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x68, 0x61,
+	0x6e, 0x64, 0x6f, 0x66, 0x66, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x68, 0x61, 0x6e,
+	0x64, 0x6f, 0x66, 0x66, 0x12, 0x2a, 0x0a, 0x05, 0x75, 0x73, 0x61, 0x67, 0x65, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x54,
+	0x6f, 0x6b, 0x65, 0x6e, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x05, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x22, 0x72, 0x0a, 0x1f, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x2c, 0x0a, 0x12, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x5f, 0x69, 0x64,
+	0x5f, 0x61, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x10, 0x74, 0x68, 0x72, 0x65, 0x61, 0x64, 0x49, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65,
+	0x72, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f, 0x62, 0x6f, 0x64,
+	0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x42, 0x6f, 0x64, 0x79, 0x22, 0x3e, 0x0a, 0x20, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65,
 	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72,
-	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x15, 0x5a, 0x13, 0x63, 0x68, 0x61, 0x74,
-	0x62, 0x6f, 0x74, 0x2f, 0x75, 0x74, 0x69, 0x6c, 0x73, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
-	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x67, 0x0a, 0x15, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x12, 0x14, 0x0a,
+	0x05, 0x64, 0x65, 0x6c, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x64, 0x65,
+	0x6c, 0x74, 0x61, 0x12, 0x38, 0x0a, 0x05, 0x66, 0x69, 0x6e, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x22, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65,
+	0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x05, 0x66, 0x69, 0x6e, 0x61, 0x6c, 0x2a, 0x98, 0x01,
+	0x0a, 0x09, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x4b, 0x69, 0x6e, 0x64, 0x12, 0x1a, 0x0a, 0x16, 0x52,
+	0x45, 0x50, 0x4c, 0x59, 0x5f, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43,
+	0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x13, 0x0a, 0x0f, 0x52, 0x45, 0x50, 0x4c, 0x59,
+	0x5f, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x54, 0x45, 0x58, 0x54, 0x10, 0x01, 0x12, 0x16, 0x0a, 0x12,
+	0x52, 0x45, 0x50, 0x4c, 0x59, 0x5f, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x42, 0x55, 0x54, 0x54, 0x4f,
+	0x4e, 0x53, 0x10, 0x02, 0x12, 0x13, 0x0a, 0x0f, 0x52, 0x45, 0x50, 0x4c, 0x59, 0x5f, 0x4b, 0x49,
+	0x4e, 0x44, 0x5f, 0x4c, 0x49, 0x53, 0x54, 0x10, 0x03, 0x12, 0x14, 0x0a, 0x10, 0x52, 0x45, 0x50,
+	0x4c, 0x59, 0x5f, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x4d, 0x45, 0x44, 0x49, 0x41, 0x10, 0x04, 0x12,
+	0x17, 0x0a, 0x13, 0x52, 0x45, 0x50, 0x4c, 0x59, 0x5f, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x54, 0x45,
+	0x4d, 0x50, 0x4c, 0x41, 0x54, 0x45, 0x10, 0x05, 0x32, 0xf5, 0x03, 0x0a, 0x0f, 0x57, 0x68, 0x61,
+	0x74, 0x73, 0x41, 0x70, 0x70, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x4d, 0x0a, 0x0c,
+	0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72, 0x65, 0x61, 0x64, 0x12, 0x1d, 0x2e, 0x77,
+	0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68,
+	0x72, 0x65, 0x61, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x77, 0x68,
+	0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72,
+	0x65, 0x61, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x65, 0x0a, 0x14, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72, 0x65, 0x61, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69,
+	0x7a, 0x65, 0x72, 0x12, 0x25, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72, 0x65, 0x61, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69,
+	0x7a, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x77, 0x68, 0x61,
+	0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x68, 0x72, 0x65,
+	0x61, 0x64, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x59, 0x0a, 0x10, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x21, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70,
+	0x70, 0x2e, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22, 0x2e, 0x77, 0x68, 0x61, 0x74,
+	0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x71, 0x0a,
+	0x18, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x12, 0x29, 0x2e, 0x77, 0x68, 0x61, 0x74,
+	0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x2a, 0x2e, 0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e,
+	0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x41, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x5e, 0x0a, 0x16, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x21, 0x2e, 0x77, 0x68, 0x61,
+	0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e,
+	0x77, 0x68, 0x61, 0x74, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74,
+	0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x43, 0x68, 0x75, 0x6e, 0x6b, 0x30, 0x01,
+	0x42, 0x15, 0x5a, 0x13, 0x63, 0x68, 0x61, 0x74, 0x62, 0x6f, 0x74, 0x2f, 0x75, 0x74, 0x69, 0x6c,
+	0x73, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -486,31 +1055,47 @@ func file_whatsapp_proto_rawDescGZIP() []byte {
 	return file_whatsapp_proto_rawDescData
 }
 
-var file_whatsapp_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_whatsapp_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_whatsapp_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_whatsapp_proto_goTypes = []interface{}{
-	(*CreateThreadRequest)(nil),              // 0: whatsapp.CreateThreadRequest
-	(*CreateThreadResponse)(nil),             // 1: whatsapp.CreateThreadResponse
-	(*CreateThreadAnalizerRequest)(nil),      // 2: whatsapp.CreateThreadAnalizerRequest
-	(*CreateThreadAnalizerResponse)(nil),     // 3: whatsapp.CreateThreadAnalizerResponse
-	(*GenerateResponseRequest)(nil),          // 4: whatsapp.GenerateResponseRequest
-	(*GenerateResponseResponse)(nil),         // 5: whatsapp.GenerateResponseResponse
-	(*GenerateResponseAnalizerRequest)(nil),  // 6: whatsapp.GenerateResponseAnalizerRequest
-	(*GenerateResponseAnalizerResponse)(nil), // 7: whatsapp.GenerateResponseAnalizerResponse
+	(ReplyKind)(0),                           // 0: whatsapp.ReplyKind
+	(*CreateThreadRequest)(nil),              // 1: whatsapp.CreateThreadRequest
+	(*CreateThreadResponse)(nil),             // 2: whatsapp.CreateThreadResponse
+	(*CreateThreadAnalizerRequest)(nil),      // 3: whatsapp.CreateThreadAnalizerRequest
+	(*CreateThreadAnalizerResponse)(nil),     // 4: whatsapp.CreateThreadAnalizerResponse
+	(*GenerateResponseRequest)(nil),          // 5: whatsapp.GenerateResponseRequest
+	(*SelectedOption)(nil),                   // 6: whatsapp.SelectedOption
+	(*ReplyOption)(nil),                      // 7: whatsapp.ReplyOption
+	(*ReplyPart)(nil),                        // 8: whatsapp.ReplyPart
+	(*TokenUsage)(nil),                       // 9: whatsapp.TokenUsage
+	(*GenerateResponseResponse)(nil),         // 10: whatsapp.GenerateResponseResponse
+	(*GenerateResponseAnalizerRequest)(nil),  // 11: whatsapp.GenerateResponseAnalizerRequest
+	(*GenerateResponseAnalizerResponse)(nil), // 12: whatsapp.GenerateResponseAnalizerResponse
+	(*GenerateResponseChunk)(nil),            // 13: whatsapp.GenerateResponseChunk
 }
 var file_whatsapp_proto_depIdxs = []int32{
-	0, // 0: whatsapp.WhatsAppService.CreateThread:input_type -> whatsapp.CreateThreadRequest
-	2, // 1: whatsapp.WhatsAppService.CreateThreadAnalizer:input_type -> whatsapp.CreateThreadAnalizerRequest
-	4, // 2: whatsapp.WhatsAppService.GenerateResponse:input_type -> whatsapp.GenerateResponseRequest
-	6, // 3: whatsapp.WhatsAppService.GenerateResponseAnalizer:input_type -> whatsapp.GenerateResponseAnalizerRequest
-	1, // 4: whatsapp.WhatsAppService.CreateThread:output_type -> whatsapp.CreateThreadResponse
-	3, // 5: whatsapp.WhatsAppService.CreateThreadAnalizer:output_type -> whatsapp.CreateThreadAnalizerResponse
-	5, // 6: whatsapp.WhatsAppService.GenerateResponse:output_type -> whatsapp.GenerateResponseResponse
-	7, // 7: whatsapp.WhatsAppService.GenerateResponseAnalizer:output_type -> whatsapp.GenerateResponseAnalizerResponse
-	4, // [4:8] is the sub-list for method output_type
-	0, // [0:4] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	6,  // 0: whatsapp.GenerateResponseRequest.selected_option:type_name -> whatsapp.SelectedOption
+	0,  // 1: whatsapp.ReplyPart.kind:type_name -> whatsapp.ReplyKind
+	7,  // 2: whatsapp.ReplyPart.options:type_name -> whatsapp.ReplyOption
+	8,  // 3: whatsapp.GenerateResponseResponse.parts:type_name -> whatsapp.ReplyPart
+	7,  // 4: whatsapp.GenerateResponseResponse.options:type_name -> whatsapp.ReplyOption
+	9,  // 5: whatsapp.GenerateResponseResponse.usage:type_name -> whatsapp.TokenUsage
+	10, // 6: whatsapp.GenerateResponseChunk.final:type_name -> whatsapp.GenerateResponseResponse
+	1,  // 7: whatsapp.WhatsAppService.CreateThread:input_type -> whatsapp.CreateThreadRequest
+	3,  // 8: whatsapp.WhatsAppService.CreateThreadAnalizer:input_type -> whatsapp.CreateThreadAnalizerRequest
+	5,  // 9: whatsapp.WhatsAppService.GenerateResponse:input_type -> whatsapp.GenerateResponseRequest
+	11, // 10: whatsapp.WhatsAppService.GenerateResponseAnalizer:input_type -> whatsapp.GenerateResponseAnalizerRequest
+	5,  // 11: whatsapp.WhatsAppService.GenerateResponseStream:input_type -> whatsapp.GenerateResponseRequest
+	2,  // 12: whatsapp.WhatsAppService.CreateThread:output_type -> whatsapp.CreateThreadResponse
+	4,  // 13: whatsapp.WhatsAppService.CreateThreadAnalizer:output_type -> whatsapp.CreateThreadAnalizerResponse
+	10, // 14: whatsapp.WhatsAppService.GenerateResponse:output_type -> whatsapp.GenerateResponseResponse
+	12, // 15: whatsapp.WhatsAppService.GenerateResponseAnalizer:output_type -> whatsapp.GenerateResponseAnalizerResponse
+	13, // 16: whatsapp.WhatsAppService.GenerateResponseStream:output_type -> whatsapp.GenerateResponseChunk
+	12, // [12:17] is the sub-list for method output_type
+	7,  // [7:12] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_whatsapp_proto_init() }
@@ -580,7 +1165,7 @@ func file_whatsapp_proto_init() {
 			}
 		}
 		file_whatsapp_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*GenerateResponseResponse); i {
+			switch v := v.(*SelectedOption); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -592,7 +1177,7 @@ func file_whatsapp_proto_init() {
 			}
 		}
 		file_whatsapp_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*GenerateResponseAnalizerRequest); i {
+			switch v := v.(*ReplyOption); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -604,6 +1189,54 @@ func file_whatsapp_proto_init() {
 			}
 		}
 		file_whatsapp_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReplyPart); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_whatsapp_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TokenUsage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_whatsapp_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GenerateResponseResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_whatsapp_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GenerateResponseAnalizerRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_whatsapp_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*GenerateResponseAnalizerResponse); i {
 			case 0:
 				return &v.state
@@ -615,19 +1248,32 @@ func file_whatsapp_proto_init() {
 				return nil
 			}
 		}
+		file_whatsapp_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GenerateResponseChunk); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_whatsapp_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   8,
+			NumEnums:      1,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_whatsapp_proto_goTypes,
 		DependencyIndexes: file_whatsapp_proto_depIdxs,
+		EnumInfos:         file_whatsapp_proto_enumTypes,
 		MessageInfos:      file_whatsapp_proto_msgTypes,
 	}.Build()
 	File_whatsapp_proto = out.File
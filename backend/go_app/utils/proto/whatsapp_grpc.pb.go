@@ -25,6 +25,7 @@ const (
 	WhatsAppService_CreateThreadAnalizer_FullMethodName     = "/whatsapp.WhatsAppService/CreateThreadAnalizer"
 	WhatsAppService_GenerateResponse_FullMethodName         = "/whatsapp.WhatsAppService/GenerateResponse"
 	WhatsAppService_GenerateResponseAnalizer_FullMethodName = "/whatsapp.WhatsAppService/GenerateResponseAnalizer"
+	WhatsAppService_GenerateResponseStream_FullMethodName   = "/whatsapp.WhatsAppService/GenerateResponseStream"
 )
 
 // WhatsAppServiceClient is the client API for WhatsAppService service.
@@ -35,6 +36,7 @@ type WhatsAppServiceClient interface {
 	CreateThreadAnalizer(ctx context.Context, in *CreateThreadAnalizerRequest, opts ...grpc.CallOption) (*CreateThreadAnalizerResponse, error)
 	GenerateResponse(ctx context.Context, in *GenerateResponseRequest, opts ...grpc.CallOption) (*GenerateResponseResponse, error)
 	GenerateResponseAnalizer(ctx context.Context, in *GenerateResponseAnalizerRequest, opts ...grpc.CallOption) (*GenerateResponseAnalizerResponse, error)
+	GenerateResponseStream(ctx context.Context, in *GenerateResponseRequest, opts ...grpc.CallOption) (WhatsAppService_GenerateResponseStreamClient, error)
 }
 
 type whatsAppServiceClient struct {
@@ -81,6 +83,38 @@ func (c *whatsAppServiceClient) GenerateResponseAnalizer(ctx context.Context, in
 	return out, nil
 }
 
+func (c *whatsAppServiceClient) GenerateResponseStream(ctx context.Context, in *GenerateResponseRequest, opts ...grpc.CallOption) (WhatsAppService_GenerateResponseStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &WhatsAppService_ServiceDesc.Streams[0], WhatsAppService_GenerateResponseStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &whatsAppServiceGenerateResponseStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type WhatsAppService_GenerateResponseStreamClient interface {
+	Recv() (*GenerateResponseChunk, error)
+	grpc.ClientStream
+}
+
+type whatsAppServiceGenerateResponseStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *whatsAppServiceGenerateResponseStreamClient) Recv() (*GenerateResponseChunk, error) {
+	m := new(GenerateResponseChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // WhatsAppServiceServer is the server API for WhatsAppService service.
 // All implementations must embed UnimplementedWhatsAppServiceServer
 // for forward compatibility
@@ -89,6 +123,7 @@ type WhatsAppServiceServer interface {
 	CreateThreadAnalizer(context.Context, *CreateThreadAnalizerRequest) (*CreateThreadAnalizerResponse, error)
 	GenerateResponse(context.Context, *GenerateResponseRequest) (*GenerateResponseResponse, error)
 	GenerateResponseAnalizer(context.Context, *GenerateResponseAnalizerRequest) (*GenerateResponseAnalizerResponse, error)
+	GenerateResponseStream(*GenerateResponseRequest, WhatsAppService_GenerateResponseStreamServer) error
 	mustEmbedUnimplementedWhatsAppServiceServer()
 }
 
@@ -108,6 +143,9 @@ func (UnimplementedWhatsAppServiceServer) GenerateResponse(context.Context, *Gen
 func (UnimplementedWhatsAppServiceServer) GenerateResponseAnalizer(context.Context, *GenerateResponseAnalizerRequest) (*GenerateResponseAnalizerResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GenerateResponseAnalizer not implemented")
 }
+func (UnimplementedWhatsAppServiceServer) GenerateResponseStream(*GenerateResponseRequest, WhatsAppService_GenerateResponseStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method GenerateResponseStream not implemented")
+}
 func (UnimplementedWhatsAppServiceServer) mustEmbedUnimplementedWhatsAppServiceServer() {}
 
 // UnsafeWhatsAppServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -193,6 +231,27 @@ func _WhatsAppService_GenerateResponseAnalizer_Handler(srv interface{}, ctx cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _WhatsAppService_GenerateResponseStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GenerateResponseRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WhatsAppServiceServer).GenerateResponseStream(m, &whatsAppServiceGenerateResponseStreamServer{stream})
+}
+
+type WhatsAppService_GenerateResponseStreamServer interface {
+	Send(*GenerateResponseChunk) error
+	grpc.ServerStream
+}
+
+type whatsAppServiceGenerateResponseStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *whatsAppServiceGenerateResponseStreamServer) Send(m *GenerateResponseChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // WhatsAppService_ServiceDesc is the grpc.ServiceDesc for WhatsAppService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -217,6 +276,12 @@ var WhatsAppService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _WhatsAppService_GenerateResponseAnalizer_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GenerateResponseStream",
+			Handler:       _WhatsAppService_GenerateResponseStream_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "whatsapp.proto",
 }
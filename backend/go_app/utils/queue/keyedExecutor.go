@@ -0,0 +1,66 @@
+// chatbot/utils/queue/keyedExecutor.go
+
+package queue
+
+import "sync"
+
+// KeyedExecutor ejecuta trabajos en orden estricto de llegada para una misma clave,
+// mientras que trabajos de claves distintas se ejecutan en paralelo hasta un límite de concurrencia.
+type KeyedExecutor struct {
+	mu     sync.Mutex
+	queues map[string][]func()
+	sem    chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewKeyedExecutor crea un ejecutor que corre como máximo concurrency trabajos a la vez.
+func NewKeyedExecutor(concurrency int) *KeyedExecutor {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &KeyedExecutor{
+		queues: make(map[string][]func()),
+		sem:    make(chan struct{}, concurrency),
+	}
+}
+
+// Submit encola un trabajo para la clave indicada. Los trabajos de una misma clave se ejecutan
+// uno tras otro en el orden en que fueron encolados.
+func (e *KeyedExecutor) Submit(key string, job func()) {
+	e.mu.Lock()
+	pending, running := e.queues[key]
+	e.queues[key] = append(pending, job)
+	e.mu.Unlock()
+
+	if !running {
+		e.wg.Add(1)
+		go e.drain(key)
+	}
+}
+
+// Wait bloquea hasta que no queden trabajos pendientes.
+func (e *KeyedExecutor) Wait() {
+	e.wg.Wait()
+}
+
+// drain ejecuta los trabajos de una clave hasta vaciar su cola.
+func (e *KeyedExecutor) drain(key string) {
+	defer e.wg.Done()
+
+	for {
+		e.mu.Lock()
+		jobs := e.queues[key]
+		if len(jobs) == 0 {
+			delete(e.queues, key)
+			e.mu.Unlock()
+			return
+		}
+		job := jobs[0]
+		e.queues[key] = jobs[1:]
+		e.mu.Unlock()
+
+		e.sem <- struct{}{}
+		job()
+		<-e.sem
+	}
+}
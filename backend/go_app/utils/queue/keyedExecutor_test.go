@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedExecutorOrdersJobsPerKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		keys        int
+		jobsPerKey  int
+	}{
+		{name: "una clave", concurrency: 4, keys: 1, jobsPerKey: 50},
+		{name: "varias claves en paralelo", concurrency: 4, keys: 8, jobsPerKey: 25},
+		{name: "sin concurrencia", concurrency: 1, keys: 5, jobsPerKey: 10},
+		{name: "concurrencia inválida", concurrency: 0, keys: 3, jobsPerKey: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := NewKeyedExecutor(tt.concurrency)
+			var mu sync.Mutex
+			done := make(map[string][]int)
+			limit := tt.concurrency
+			if limit <= 0 {
+				limit = 1
+			}
+			var exceeded, active int32
+
+			// Se intercalan las claves para que sus trabajos compitan por la concurrencia
+			for job := 0; job < tt.jobsPerKey; job++ {
+				for k := 0; k < tt.keys; k++ {
+					key, job := fmt.Sprintf("clave-%d", k), job
+					executor.Submit(key, func() {
+						if n := atomic.AddInt32(&active, 1); int(n) > limit {
+							atomic.StoreInt32(&exceeded, n)
+						}
+						time.Sleep(50 * time.Microsecond)
+						mu.Lock()
+						done[key] = append(done[key], job)
+						mu.Unlock()
+						atomic.AddInt32(&active, -1)
+					})
+				}
+			}
+			executor.Wait()
+
+			if n := atomic.LoadInt32(&exceeded); n != 0 {
+				t.Errorf("%d trabajos a la vez, el límite es %d", n, limit)
+			}
+			want := make([]int, tt.jobsPerKey)
+			for i := range want {
+				want[i] = i
+			}
+			if len(done) != tt.keys {
+				t.Fatalf("se ejecutaron trabajos de %d claves, se esperaban %d", len(done), tt.keys)
+			}
+			for key, jobs := range done {
+				if !reflect.DeepEqual(jobs, want) {
+					t.Errorf("orden de %s = %v, se esperaba %v", key, jobs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyedExecutorRunsKeysInParallel(t *testing.T) {
+	executor := NewKeyedExecutor(2)
+	release := make(chan struct{})
+	started := make(chan string, 2)
+
+	// La primera clave queda bloqueada; la segunda debe ejecutarse igual
+	executor.Submit("a", func() {
+		started <- "a"
+		<-release
+	})
+	executor.Submit("b", func() { started <- "b" })
+
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		select {
+		case key := <-started:
+			seen[key] = true
+		case <-time.After(time.Second):
+			close(release)
+			t.Fatalf("solo empezaron %v, una clave bloqueada detuvo a las demás", seen)
+		}
+	}
+	close(release)
+	executor.Wait()
+}
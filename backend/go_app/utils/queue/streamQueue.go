@@ -0,0 +1,379 @@
+// chatbot/utils/queue/streamQueue.go
+
+package queue
+
+import (
+	"chatbot/logger"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ackTimeout es el tiempo máximo para confirmar una entrega o moverla al dead-letter.
+const ackTimeout = 5 * time.Second
+
+// Config define los parámetros de una cola basada en Redis Streams.
+type Config struct {
+	// Stream es la clave del stream donde se encolan las entregas.
+	Stream string
+	// Group es el grupo de consumidores que procesa el stream.
+	Group string
+	// DeadLetterStream recibe las entregas que superan MaxAttempts.
+	DeadLetterStream string
+	// Consumer es el prefijo del nombre de consumidor de esta instancia.
+	Consumer string
+	// MaxInFlight es el número máximo de entregas leídas que pueden estar en proceso a la vez.
+	MaxInFlight int
+	// MaxAttempts es el número de intentos antes de enviar una entrega al dead-letter.
+	MaxAttempts int64
+	// ClaimIdle es el tiempo que una entrega pendiente debe estar inactiva para ser reclamada.
+	ClaimIdle time.Duration
+	// MaxLen es la longitud aproximada máxima del stream.
+	MaxLen int64
+}
+
+// Delivery es una entrega leída del stream.
+type Delivery struct {
+	ID       string
+	Body     []byte
+	Attempts int64
+}
+
+// Handler procesa una entrega y llama a done exactamente una vez al terminar, posiblemente desde
+// otra goroutine. Si done recibe un error la entrega queda pendiente y se reintenta.
+type Handler func(ctx context.Context, delivery Delivery, done func(error))
+
+// permanentError marca un error que no debe reintentarse.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent envuelve un error para que la entrega se envíe directamente al dead-letter sin reintentos.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// StreamQueue es una cola durable sobre Redis Streams con grupo de consumidores,
+// reclamación de entregas pendientes y dead-letter. Cada instancia lee el stream con un único
+// lector para entregar las entradas al Handler en el orden en que llegaron. Mientras el Handler
+// procesa una entrega, la cola renueva su entrada pendiente para que ninguna instancia la reclame.
+type StreamQueue struct {
+	rdb      *redis.Client
+	cfg      Config
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+
+	// active tiene el consumidor de cada entrega que el Handler está procesando en esta instancia.
+	active   map[string]string
+	activeMu sync.Mutex
+}
+
+// NewStreamQueue crea una cola con la configuración indicada.
+func NewStreamQueue(rdb *redis.Client, cfg Config) *StreamQueue {
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.ClaimIdle <= 0 {
+		cfg.ClaimIdle = time.Minute
+	}
+	if cfg.DeadLetterStream == "" {
+		cfg.DeadLetterStream = cfg.Stream + ":dead"
+	}
+	return &StreamQueue{rdb: rdb, cfg: cfg, inFlight: make(chan struct{}, cfg.MaxInFlight), active: make(map[string]string)}
+}
+
+// Enqueue agrega una entrega al stream y devuelve su id.
+func (q *StreamQueue) Enqueue(ctx context.Context, body []byte) (string, error) {
+	args := &redis.XAddArgs{
+		Stream: q.cfg.Stream,
+		Values: map[string]interface{}{
+			"body":        body,
+			"received_at": time.Now().Format(time.RFC3339Nano),
+		},
+	}
+	if q.cfg.MaxLen > 0 {
+		args.MaxLen = q.cfg.MaxLen
+		args.Approx = true
+	}
+
+	id, err := q.rdb.XAdd(ctx, args).Result()
+	if err != nil {
+		return "", fmt.Errorf("fallo al encolar en el stream %s: %w", q.cfg.Stream, err)
+	}
+	return id, nil
+}
+
+// Start crea el grupo de consumidores si no existe y lanza el lector, el reclamador y la renovación
+// de las entregas en proceso. Los tres se detienen cuando se cancela ctx.
+func (q *StreamQueue) Start(ctx context.Context, handler Handler) error {
+	err := q.rdb.XGroupCreateMkStream(ctx, q.cfg.Stream, q.cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("fallo al crear el grupo %s en el stream %s: %w", q.cfg.Group, q.cfg.Stream, err)
+	}
+
+	q.wg.Add(3)
+	go q.read(ctx, handler, q.cfg.Consumer)
+	go q.reclaim(ctx, handler, q.cfg.Consumer+"-reclaimer")
+	go q.renew(ctx)
+
+	logger.Log.Infof("Cola %s iniciada en el grupo %s con hasta %d entregas en proceso", q.cfg.Stream, q.cfg.Group, q.cfg.MaxInFlight)
+	return nil
+}
+
+// Wait bloquea hasta que el lector, el reclamador, la renovación y las entregas en proceso terminen.
+func (q *StreamQueue) Wait() {
+	q.wg.Wait()
+}
+
+// read lee entregas nuevas del stream en orden y las entrega al handler.
+func (q *StreamQueue) read(ctx context.Context, handler Handler, consumer string) {
+	defer q.wg.Done()
+
+	for ctx.Err() == nil {
+		// Esperar un hueco libre antes de leer para no acumular entregas sin procesar
+		select {
+		case q.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		streams, err := q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    q.cfg.Group,
+			Consumer: consumer,
+			Streams:  []string{q.cfg.Stream, ">"},
+			Count:    1,
+			Block:    5 * time.Second,
+		}).Result()
+		if err == redis.Nil {
+			<-q.inFlight
+			continue
+		}
+		if err != nil {
+			<-q.inFlight
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Log.Errorf("Error al leer del stream %s: %v", q.cfg.Stream, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				q.handle(ctx, handler, consumer, message, 1)
+			}
+		}
+	}
+}
+
+// reclaim reclama periódicamente las entregas pendientes de consumidores caídos y envía al
+// dead-letter las que superan el número máximo de intentos.
+func (q *StreamQueue) reclaim(ctx context.Context, handler Handler, consumer string) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.cfg.ClaimIdle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pending, err := q.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: q.cfg.Stream,
+			Group:  q.cfg.Group,
+			Idle:   q.cfg.ClaimIdle,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.Errorf("Error al consultar entregas pendientes de %s: %v", q.cfg.Stream, err)
+			}
+			continue
+		}
+
+		for _, entry := range pending {
+			if q.isActive(entry.ID) {
+				// El handler de esta instancia sigue procesándola; renew la mantiene activa
+				continue
+			}
+			if entry.RetryCount >= q.cfg.MaxAttempts {
+				q.deadLetter(ctx, entry.ID, entry.RetryCount, "se superó el número máximo de intentos")
+				continue
+			}
+
+			messages, err := q.rdb.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   q.cfg.Stream,
+				Group:    q.cfg.Group,
+				Consumer: consumer,
+				MinIdle:  q.cfg.ClaimIdle,
+				Messages: []string{entry.ID},
+			}).Result()
+			if err != nil {
+				logger.Log.Errorf("Error al reclamar la entrega %s: %v", entry.ID, err)
+				continue
+			}
+			for _, message := range messages {
+				logger.Log.Infof("Entrega %s reclamada de %s (intento %d)", message.ID, entry.Consumer, entry.RetryCount+1)
+				select {
+				case q.inFlight <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				q.handle(ctx, handler, consumer, message, entry.RetryCount+1)
+			}
+		}
+	}
+}
+
+// handle entrega el mensaje al handler y, cuando este termina, confirma la entrega si tuvo éxito.
+// Mientras el handler la procesa, la entrega queda registrada como activa a nombre de consumer. El
+// llamador debe haber ocupado un hueco en inFlight, que se libera al terminar.
+func (q *StreamQueue) handle(ctx context.Context, handler Handler, consumer string, message redis.XMessage, attempts int64) {
+	body, _ := message.Values["body"].(string)
+
+	q.wg.Add(1)
+	q.setActive(message.ID, consumer)
+	var once sync.Once
+	handler(ctx, Delivery{ID: message.ID, Body: []byte(body), Attempts: attempts}, func(err error) {
+		once.Do(func() {
+			defer q.wg.Done()
+			defer func() { <-q.inFlight }()
+			defer q.clearActive(message.ID)
+			q.complete(ctx, message.ID, attempts, err)
+		})
+	})
+}
+
+// renew reinicia periódicamente el tiempo de inactividad de las entregas que el handler de esta
+// instancia sigue procesando, para que el reclamador de otra instancia no las tome mientras tanto.
+func (q *StreamQueue) renew(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.cfg.ClaimIdle / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for consumer, ids := range q.activeByConsumer() {
+			// JUSTID no incrementa el número de intentos de la entrega
+			err := q.rdb.XClaimJustID(ctx, &redis.XClaimArgs{
+				Stream:   q.cfg.Stream,
+				Group:    q.cfg.Group,
+				Consumer: consumer,
+				Messages: ids,
+			}).Err()
+			if err != nil && ctx.Err() == nil {
+				logger.Log.Errorf("Error al renovar las entregas en proceso de %s: %v", consumer, err)
+			}
+		}
+	}
+}
+
+// setActive registra que el handler está procesando la entrega a nombre de consumer.
+func (q *StreamQueue) setActive(id, consumer string) {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+	q.active[id] = consumer
+}
+
+// clearActive registra que el handler terminó de procesar la entrega.
+func (q *StreamQueue) clearActive(id string) {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+	delete(q.active, id)
+}
+
+// isActive indica si el handler de esta instancia está procesando la entrega.
+func (q *StreamQueue) isActive(id string) bool {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+	_, ok := q.active[id]
+	return ok
+}
+
+// activeByConsumer devuelve las entregas en proceso agrupadas por consumidor.
+func (q *StreamQueue) activeByConsumer() map[string][]string {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+	byConsumer := make(map[string][]string)
+	for id, consumer := range q.active {
+		byConsumer[consumer] = append(byConsumer[consumer], id)
+	}
+	return byConsumer
+}
+
+// complete confirma, reintenta o envía al dead-letter una entrega según el resultado del handler.
+// Usa su propio contexto para confirmar también las entregas que terminan durante el apagado.
+func (q *StreamQueue) complete(_ context.Context, id string, attempts int64, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+	defer cancel()
+
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		if err := q.rdb.XAck(ctx, q.cfg.Stream, q.cfg.Group, id).Err(); err != nil {
+			logger.Log.Errorf("Error al confirmar la entrega %s: %v", id, err)
+		}
+	case errors.As(err, &permanent):
+		logger.Log.Errorf("Error permanente al procesar la entrega %s: %v", id, err)
+		q.deadLetter(ctx, id, attempts, err.Error())
+	default:
+		logger.Log.Errorf("Error al procesar la entrega %s (intento %d de %d), se reintentará: %v", id, attempts, q.cfg.MaxAttempts, err)
+	}
+}
+
+// deadLetter copia la entrega al stream de dead-letter y la confirma en el stream original. Usa su
+// propio contexto para no dejar la copia a medias si se cancela el del worker.
+func (q *StreamQueue) deadLetter(_ context.Context, id string, attempts int64, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+	defer cancel()
+
+	messages, err := q.rdb.XRange(ctx, q.cfg.Stream, id, id).Result()
+	if err != nil {
+		logger.Log.Errorf("Error al leer la entrega %s para el dead-letter: %v", id, err)
+		return
+	}
+
+	values := map[string]interface{}{
+		"original_id": id,
+		"attempts":    attempts,
+		"reason":      reason,
+		"failed_at":   time.Now().Format(time.RFC3339Nano),
+	}
+	if len(messages) > 0 {
+		values["body"] = messages[0].Values["body"]
+		values["received_at"] = messages[0].Values["received_at"]
+	}
+
+	if err := q.rdb.XAdd(ctx, &redis.XAddArgs{Stream: q.cfg.DeadLetterStream, Values: values}).Err(); err != nil {
+		logger.Log.Errorf("Error al mover la entrega %s al dead-letter %s: %v", id, q.cfg.DeadLetterStream, err)
+		return
+	}
+	if err := q.rdb.XAck(ctx, q.cfg.Stream, q.cfg.Group, id).Err(); err != nil {
+		logger.Log.Errorf("Error al confirmar la entrega %s movida al dead-letter: %v", id, err)
+		return
+	}
+
+	logger.Log.Warnf("Entrega %s movida al dead-letter %s tras %d intento(s): %s", id, q.cfg.DeadLetterStream, attempts, reason)
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chatbot/logger"
+	"chatbot/utils/redistest"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// startTestQueue inicia una cola sobre el Redis de pruebas con handler y la detiene al terminar la
+// prueba.
+func startTestQueue(t *testing.T, rdb *redis.Client, cfg Config, handler Handler) *StreamQueue {
+	t.Helper()
+	q := NewStreamQueue(rdb, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := q.Start(ctx, handler); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		q.Wait()
+	})
+	return q
+}
+
+// waitFor espera hasta que cond se cumpla o falla la prueba tras timeout.
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("tiempo agotado esperando %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamQueueDoesNotReclaimActiveDelivery(t *testing.T) {
+	rdb := redistest.New(t)
+	cfg := Config{Stream: "prueba:activa", Group: "workers", Consumer: "instancia", MaxInFlight: 3, ClaimIdle: 150 * time.Millisecond}
+
+	var calls int32
+	release := make(chan struct{})
+	q := startTestQueue(t, rdb, cfg, func(ctx context.Context, delivery Delivery, done func(error)) {
+		atomic.AddInt32(&calls, 1)
+		go func() {
+			<-release
+			done(nil)
+		}()
+	})
+	var releaseOnce sync.Once
+	finish := func() { releaseOnce.Do(func() { close(release) }) }
+	t.Cleanup(finish)
+
+	if _, err := q.Enqueue(context.Background(), []byte("mensaje")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, time.Second, "la primera entrega", func() bool { return atomic.LoadInt32(&calls) == 1 })
+
+	// El handler sigue en proceso durante varios periodos de inactividad
+	time.Sleep(6 * cfg.ClaimIdle)
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("el handler recibió la entrega %d veces mientras la procesaba", got)
+	}
+
+	finish()
+	waitFor(t, time.Second, "la confirmación", func() bool {
+		pending, err := rdb.XPending(context.Background(), cfg.Stream, cfg.Group).Result()
+		return err == nil && pending.Count == 0
+	})
+}
+
+func TestStreamQueueDeadLetters(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int32
+	}{
+		{name: "error permanente", err: Permanent(errors.New("mensaje inválido")), wantAttempts: 1},
+		{name: "error transitorio hasta el máximo de intentos", err: errors.New("servidor caído"), wantAttempts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := redistest.New(t)
+			cfg := Config{Stream: "prueba:fallida", Group: "workers", Consumer: "instancia", MaxInFlight: 2, MaxAttempts: 2, ClaimIdle: 100 * time.Millisecond}
+
+			var calls int32
+			q := startTestQueue(t, rdb, cfg, func(ctx context.Context, delivery Delivery, done func(error)) {
+				atomic.AddInt32(&calls, 1)
+				done(tt.err)
+			})
+			if _, err := q.Enqueue(context.Background(), []byte("mensaje")); err != nil {
+				t.Fatal(err)
+			}
+
+			waitFor(t, 3*time.Second, "el dead-letter", func() bool {
+				n, err := rdb.XLen(context.Background(), cfg.Stream+":dead").Result()
+				return err == nil && n == 1
+			})
+			if got := atomic.LoadInt32(&calls); got != tt.wantAttempts {
+				t.Errorf("el handler recibió la entrega %d veces, se esperaban %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
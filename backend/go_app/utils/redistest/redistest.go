@@ -0,0 +1,44 @@
+// chatbot/utils/redistest/redistest.go
+
+// Package redistest provee el Redis de las pruebas. Por defecto es un miniredis en memoria, de modo
+// que las pruebas con Redis, incluidos sus scripts Lua, corren con go test sin servicios externos.
+package redistest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// AddrEnv es la variable con la dirección de un Redis real para las pruebas. Si está configurada se
+// usa en lugar de miniredis.
+const AddrEnv = "REDIS_TEST_ADDR"
+
+// New devuelve un cliente del Redis de pruebas, que se cierra al terminar la prueba. Sin AddrEnv cada
+// prueba recibe un miniredis propio y vacío.
+func New(t testing.TB) *redis.Client {
+	t.Helper()
+	addr := os.Getenv(AddrEnv)
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("no se pudo conectar al Redis de pruebas en %s: %v", addr, err)
+	}
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// NewServer inicia un miniredis para las pruebas que necesitan controlar el reloj del servidor, por
+// ejemplo para hacer vencer claves con FastForward, y devuelve el servidor y un cliente conectado.
+func NewServer(t testing.TB) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return server, rdb
+}
@@ -0,0 +1,150 @@
+// chatbot/utils/session/memoryStore.go
+
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore guarda las sesiones en memoria, para pruebas y para ejecutar sin Redis. Guarda copias,
+// de modo que modificar una sesión devuelta no cambia la guardada.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string][]byte
+	timeouts Timeouts
+}
+
+// NewMemoryStore crea un almacén de sesiones en memoria vacío cuyas sesiones vencen según timeouts.
+func NewMemoryStore(timeouts Timeouts) *MemoryStore {
+	return &MemoryStore{sessions: make(map[string][]byte), timeouts: timeouts}
+}
+
+// Get devuelve una copia de la sesión del usuario.
+func (s *MemoryStore) Get(ctx context.Context, phone string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(phone)
+}
+
+// get deserializa la sesión guardada. Se llama con el mutex tomado.
+func (s *MemoryStore) get(phone string) (*Session, error) {
+	data, ok := s.sessions[phone]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Create guarda una copia de la sesión si el usuario no tiene una.
+func (s *MemoryStore) Create(ctx context.Context, session *Session) error {
+	session.Version++
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[session.UserInfo.Phone]; ok {
+		return ErrExists
+	}
+	s.sessions[session.UserInfo.Phone] = data
+	return nil
+}
+
+// Update aplica fn a la sesión con el almacén bloqueado, por lo que nunca hay conflictos.
+func (s *MemoryStore) Update(ctx context.Context, phone string, fn func(*Session) error) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.get(phone)
+	if err != nil {
+		return nil, err
+	}
+	history := session.Messages
+	session.Messages = nil
+	if err := fn(session); err != nil {
+		return nil, err
+	}
+	added := session.Messages
+	session.Messages = append(history, added...)
+	session.Version++
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions[phone] = data
+	session.Messages = added
+	return session, nil
+}
+
+// Delete elimina la sesión del usuario.
+func (s *MemoryStore) Delete(ctx context.Context, phone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, phone)
+	return nil
+}
+
+// DeleteIfUnchanged elimina la sesión del usuario si su versión sigue siendo version.
+func (s *MemoryStore) DeleteIfUnchanged(ctx context.Context, phone string, version int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, err := s.get(phone)
+	if errors.Is(err, ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if session.Version != version {
+		return false, nil
+	}
+	delete(s.sessions, phone)
+	return true, nil
+}
+
+// Phones devuelve los teléfonos de los usuarios con sesión en orden.
+func (s *MemoryStore) Phones(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	phones := make([]string, 0, len(s.sessions))
+	for phone := range s.sessions {
+		phones = append(phones, phone)
+	}
+	sort.Strings(phones)
+	return phones, nil
+}
+
+// Expired devuelve en orden los teléfonos de las sesiones que vencieron antes de la hora indicada.
+func (s *MemoryStore) Expired(ctx context.Context, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var phones []string
+	for phone := range s.sessions {
+		session, err := s.get(phone)
+		if err != nil {
+			return nil, err
+		}
+		if s.timeouts.ExpiresAt(session).Before(before) {
+			phones = append(phones, phone)
+		}
+	}
+	sort.Strings(phones)
+	return phones, nil
+}
+
+// WithSpillLock ejecuta fn. El almacén en memoria guarda todo el historial, por lo que no hay desborde
+// que reservar.
+func (s *MemoryStore) WithSpillLock(ctx context.Context, phone string, fn func() error) error {
+	return fn()
+}
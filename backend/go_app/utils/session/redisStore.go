@@ -0,0 +1,675 @@
+// chatbot/utils/session/redisStore.go
+
+package session
+
+import (
+	"chatbot/logger"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// maxUpdateAttempts es el número de veces que se reintenta una actualización que choca con otra escritura.
+const maxUpdateAttempts = 10
+
+// DefaultHistoryLimit es el número de mensajes recientes que se guardan en Redis por sesión.
+const DefaultHistoryLimit = 50
+
+// spillLockTTL es el tiempo máximo que una instancia reserva el desborde de una sesión para guardarlo.
+const spillLockTTL = 30 * time.Second
+
+// releaseSpillLockScript elimina la reserva del desborde KEYS[1] solo si sigue siendo de ARGV[1], para
+// no liberar la de otra instancia si la propia ya venció.
+var releaseSpillLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisConfig define el historial de las sesiones en Redis.
+type RedisConfig struct {
+	// HistoryLimit es el número de mensajes recientes que se conservan en Redis. Los anteriores se
+	// entregan a Spill.
+	HistoryLimit int
+	// Spill guarda los mensajes que salen del historial reciente. Sin Spill se descartan.
+	Spill SpillFunc
+	// Timeouts son los tiempos de inactividad tras los que vencen las sesiones de cada canal.
+	Timeouts Timeouts
+}
+
+// RedisStore guarda los datos de cada sesión en el hash usuario:<teléfono> y sus mensajes en la lista
+// usuario:<teléfono>:mensajes, de modo que agregar un mensaje no reescribe la conversación. Solo se
+// conservan los mensajes más recientes; los anteriores pasan a la lista usuario:<teléfono>:desborde
+// hasta que Spill los guarda. Las actualizaciones usan WATCH/MULTI para no pisar las escrituras
+// concurrentes. Las sesiones guardadas como un único JSON se migran al leerlas o actualizarlas.
+//
+// Cada escritura renueva el vencimiento de la sesión en el sorted set ActivityIndexKey y en la clave
+// usuario:<teléfono>:expira, que tiene el tiempo de inactividad como TTL. Los datos no vencen, de modo
+// que al expirar esa clave la sesión sigue disponible para archivarla.
+type RedisStore struct {
+	rdb *redis.Client
+	cfg RedisConfig
+}
+
+// NewRedisStore crea el almacén de sesiones en Redis.
+func NewRedisStore(rdb *redis.Client, cfg RedisConfig) *RedisStore {
+	if cfg.HistoryLimit <= 0 {
+		cfg.HistoryLimit = DefaultHistoryLimit
+	}
+	return &RedisStore{rdb: rdb, cfg: cfg}
+}
+
+// sessionKeys son las claves de Redis de una sesión.
+type sessionKeys struct {
+	meta, messages, spill, spillLock, expiry string
+}
+
+// keysFor devuelve las claves de la sesión del usuario.
+func keysFor(phone string) sessionKeys {
+	meta := KeyPrefix + phone
+	return sessionKeys{
+		meta:      meta,
+		messages:  meta + messagesSuffix,
+		spill:     meta + spillSuffix,
+		spillLock: meta + spillSuffix + ":bloqueo",
+		expiry:    meta + expirySuffix,
+	}
+}
+
+// Get devuelve la sesión del usuario con los mensajes que aún están en Redis.
+func (s *RedisStore) Get(ctx context.Context, phone string) (*Session, error) {
+	session, err := s.getMeta(ctx, s.rdb, phone)
+	if isWrongType(err) {
+		if err := s.migrate(ctx, phone); err != nil {
+			return nil, err
+		}
+		session, err = s.getMeta(ctx, s.rdb, phone)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := keysFor(phone)
+	var spilled, recent *redis.StringSliceCmd
+	_, err = s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		spilled = pipe.LRange(ctx, keys.spill, 0, -1)
+		recent = pipe.LRange(ctx, keys.messages, 0, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fallo al leer los mensajes de la sesión de %s: %w", phone, err)
+	}
+	session.Messages = append(decodeMessages(spilled.Val()), decodeMessages(recent.Val())...)
+	return session, nil
+}
+
+// getMeta lee los datos de la sesión sin sus mensajes con el cliente indicado, que puede ser la
+// transacción en curso.
+func (s *RedisStore) getMeta(ctx context.Context, cmd redis.Cmdable, phone string) (*Session, error) {
+	fields, err := cmd.HGetAll(ctx, KeyPrefix+phone).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+	return fromHash(fields)
+}
+
+// Create guarda una sesión nueva si el usuario no tiene una.
+func (s *RedisStore) Create(ctx context.Context, session *Session) error {
+	phone := session.UserInfo.Phone
+	keys := keysFor(phone)
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, keys.meta).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrExists
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return s.write(ctx, pipe, keys, session, session.Messages, 0, nil)
+		})
+		return err
+	}, keys.meta)
+	if errors.Is(err, redis.TxFailedErr) {
+		return ErrExists
+	}
+	if err != nil && !errors.Is(err, ErrExists) {
+		return fmt.Errorf("fallo al crear la sesión de %s: %w", phone, err)
+	}
+	if err == nil && len(session.Messages) > s.cfg.HistoryLimit {
+		s.spill(ctx, session)
+	}
+	return err
+}
+
+// Update aplica fn a los datos de la sesión, agrega los mensajes nuevos y guarda todo solo si nadie
+// modificó la sesión desde que se leyó.
+func (s *RedisStore) Update(ctx context.Context, phone string, fn func(*Session) error) (*Session, error) {
+	keys := keysFor(phone)
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var updated *Session
+		spilled := false
+		err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+			session, err := s.getMeta(ctx, tx, phone)
+			if err != nil {
+				return err
+			}
+			length, err := tx.LLen(ctx, keys.messages).Result()
+			if err != nil {
+				return err
+			}
+
+			session.Messages = nil
+			if err := fn(session); err != nil {
+				return err
+			}
+
+			// Los mensajes que excedan el límite pasan al desborde en la misma transacción
+			var overflow []string
+			if excess := int(length) + len(session.Messages) - s.cfg.HistoryLimit; excess > 0 && length > 0 {
+				if int64(excess) > length {
+					excess = int(length)
+				}
+				if overflow, err = tx.LRange(ctx, keys.messages, 0, int64(excess)-1).Result(); err != nil {
+					return err
+				}
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				return s.write(ctx, pipe, keys, session, session.Messages, int64(len(overflow)), overflow)
+			})
+			if err != nil {
+				return err
+			}
+			updated, spilled = session, len(overflow) > 0 || len(session.Messages) > s.cfg.HistoryLimit
+			return nil
+		}, keys.meta, keys.messages)
+
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if isWrongType(err) {
+			if err := s.migrate(ctx, phone); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if spilled {
+			s.spill(ctx, updated)
+		}
+		return updated, nil
+	}
+	return nil, ErrConflict
+}
+
+// write agrega a la transacción la escritura de los datos de la sesión y de los mensajes nuevos. Los
+// primeros trimmed mensajes recientes, overflow, pasan al desborde, al igual que los mensajes nuevos
+// que por sí solos excedan el límite.
+func (s *RedisStore) write(ctx context.Context, pipe redis.Pipeliner, keys sessionKeys, session *Session, messages []Message, trimmed int64, overflow []string) error {
+	session.Version++
+	fields, err := toHash(session)
+	if err != nil {
+		return err
+	}
+	pipe.HSet(ctx, keys.meta, fields)
+
+	// Renovar el vencimiento; si ya pasó, la sesión queda en el índice para archivarla
+	expiresAt := s.cfg.Timeouts.ExpiresAt(session)
+	pipe.ZAdd(ctx, ActivityIndexKey, &redis.Z{Score: float64(expiresAt.UnixMilli()), Member: session.UserInfo.Phone})
+	if ttl := time.Until(expiresAt); ttl > 0 {
+		pipe.Set(ctx, keys.expiry, "", ttl)
+	} else {
+		pipe.Del(ctx, keys.expiry)
+	}
+
+	encoded, err := encodeMessages(messages)
+	if err != nil {
+		return err
+	}
+	if excess := len(encoded) - s.cfg.HistoryLimit; excess > 0 {
+		overflow = append(overflow, encoded[:excess]...)
+		encoded = encoded[excess:]
+	}
+	if len(overflow) > 0 {
+		pipe.RPush(ctx, keys.spill, toInterfaces(overflow)...)
+	}
+	if trimmed > 0 {
+		pipe.LTrim(ctx, keys.messages, trimmed, -1)
+	}
+	if len(encoded) > 0 {
+		pipe.RPush(ctx, keys.messages, toInterfaces(encoded)...)
+	}
+	return nil
+}
+
+// spill entrega el desborde de la sesión a Spill y lo elimina de Redis si se guardó. Una reserva
+// evita que dos instancias guarden los mismos mensajes; si otra lo está haciendo, no hace nada.
+func (s *RedisStore) spill(ctx context.Context, session *Session) {
+	if s.cfg.Spill == nil {
+		return
+	}
+	keys := keysFor(session.UserInfo.Phone)
+	token, err := s.lockSpill(ctx, keys)
+	if err != nil {
+		if !errors.Is(err, ErrSpillInProgress) {
+			logger.Log.Errorf("Error al reservar el historial antiguo de la sesión de %s: %v", session.UserInfo.Phone, err)
+		}
+		return
+	}
+	defer s.unlockSpill(ctx, keys, token)
+
+	payloads, err := s.rdb.LRange(ctx, keys.spill, 0, -1).Result()
+	if err != nil || len(payloads) == 0 {
+		return
+	}
+	// Si el recorte de un intento anterior falló, Spill recibe de nuevo mensajes que ya guardó y los omite
+	if err := s.cfg.Spill(ctx, session, decodeMessages(payloads)); err != nil {
+		logger.Log.Warnf("No se pudo guardar el historial antiguo de la sesión de %s, se reintentará: %v", session.UserInfo.Phone, err)
+		return
+	}
+	if err := s.rdb.LTrim(ctx, keys.spill, int64(len(payloads)), -1).Err(); err != nil {
+		logger.Log.Errorf("Error al quitar de Redis el historial antiguo ya guardado de %s: %v", session.UserInfo.Phone, err)
+		return
+	}
+	logger.Log.Infof("%d mensaje(s) antiguos de la sesión de %s guardados fuera de Redis", len(payloads), session.UserInfo.Phone)
+}
+
+// lockSpill reserva el desborde de la sesión durante spillLockTTL y devuelve el token de la reserva.
+// Devuelve ErrSpillInProgress si lo tiene otra escritura o un archivo de la sesión.
+func (s *RedisStore) lockSpill(ctx context.Context, keys sessionKeys) (string, error) {
+	token := newLockToken()
+	locked, err := s.rdb.SetNX(ctx, keys.spillLock, token, spillLockTTL).Result()
+	if err != nil {
+		return "", err
+	}
+	if !locked {
+		return "", ErrSpillInProgress
+	}
+	return token, nil
+}
+
+// unlockSpill libera la reserva del desborde si sigue siendo la del token.
+func (s *RedisStore) unlockSpill(ctx context.Context, keys sessionKeys, token string) {
+	if err := releaseSpillLockScript.Run(ctx, s.rdb, []string{keys.spillLock}, token).Err(); err != nil {
+		logger.Log.Errorf("Error al liberar la reserva del historial antiguo de %s: %v", keys.meta, err)
+	}
+}
+
+// WithSpillLock ejecuta fn con el desborde de la sesión reservado, de modo que ninguna escritura lo
+// guarda mientras tanto.
+func (s *RedisStore) WithSpillLock(ctx context.Context, phone string, fn func() error) error {
+	keys := keysFor(phone)
+	token, err := s.lockSpill(ctx, keys)
+	if err != nil {
+		return err
+	}
+	defer s.unlockSpill(ctx, keys, token)
+	return fn()
+}
+
+// newLockToken genera un token aleatorio para identificar una reserva.
+func newLockToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// migrate convierte una sesión guardada como un único JSON en el formato de hash y listas.
+func (s *RedisStore) migrate(ctx context.Context, phone string) error {
+	keys := keysFor(phone)
+	var migrated *Session
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, keys.meta).Bytes()
+		if err == redis.Nil || isWrongType(err) {
+			// Otra instancia ya la migró o la sesión se eliminó
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return fmt.Errorf("fallo al deserializar la sesión de %s: %w", phone, err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys.meta, keys.messages, keys.spill)
+			return s.write(ctx, pipe, keys, &session, session.Messages, 0, nil)
+		})
+		if err == nil {
+			migrated = &session
+		}
+		return err
+	}, keys.meta)
+	if err != nil && !errors.Is(err, redis.TxFailedErr) {
+		return fmt.Errorf("fallo al migrar la sesión de %s: %w", phone, err)
+	}
+	if migrated != nil {
+		logger.Log.Infof("Sesión de %s migrada al formato de historial por mensajes (%d mensajes)", phone, len(migrated.Messages))
+		if len(migrated.Messages) > s.cfg.HistoryLimit {
+			s.spill(ctx, migrated)
+		}
+	}
+	return nil
+}
+
+// Delete elimina la sesión del usuario con su historial.
+func (s *RedisStore) Delete(ctx context.Context, phone string) error {
+	keys := keysFor(phone)
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys.meta, keys.messages, keys.spill, keys.expiry)
+		pipe.ZRem(ctx, ActivityIndexKey, phone)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fallo al eliminar la sesión de %s: %w", phone, err)
+	}
+	return nil
+}
+
+// DeleteIfUnchanged elimina la sesión del usuario con su historial si su versión sigue siendo version.
+// Vigila los datos y el historial, de modo que una escritura concurrente también impide eliminarla.
+func (s *RedisStore) DeleteIfUnchanged(ctx context.Context, phone string, version int64) (bool, error) {
+	keys := keysFor(phone)
+	deleted := false
+	err := s.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.HGet(ctx, keys.meta, "version").Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil && current != version {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys.meta, keys.messages, keys.spill, keys.expiry)
+			pipe.ZRem(ctx, ActivityIndexKey, phone)
+			return nil
+		})
+		deleted = err == nil
+		return err
+	}, keys.meta, keys.messages)
+	if errors.Is(err, redis.TxFailedErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("fallo al eliminar la sesión de %s: %w", phone, err)
+	}
+	return deleted, nil
+}
+
+// Expired devuelve los teléfonos de las sesiones que vencieron antes de la hora indicada según el
+// índice de vencimientos, sin recorrer las claves.
+func (s *RedisStore) Expired(ctx context.Context, before time.Time) ([]string, error) {
+	phones, err := s.rdb.ZRangeByScore(ctx, ActivityIndexKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(before.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("fallo al obtener las sesiones vencidas: %w", err)
+	}
+	return phones, nil
+}
+
+// ExpiryNotifications devuelve los teléfonos de las sesiones a medida que expiran sus claves de
+// vencimiento, a partir de las notificaciones de Redis. Activa las notificaciones de claves
+// expiradas si no lo están; si Redis no lo permite hay que configurarlas en el servidor, y mientras
+// tanto las sesiones vencidas solo se encuentran con Expired. El canal se cierra al cancelar ctx.
+func (s *RedisStore) ExpiryNotifications(ctx context.Context) <-chan string {
+	if err := s.enableExpiryEvents(ctx); err != nil {
+		logger.Log.Warnf("No se pudieron activar las notificaciones de claves expiradas de Redis: %v", err)
+	}
+
+	channel := fmt.Sprintf("__keyevent@%d__:expired", s.rdb.Options().DB)
+	pubsub := s.rdb.Subscribe(ctx, channel)
+	phones := make(chan string)
+	go func() {
+		defer close(phones)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if !strings.HasPrefix(msg.Payload, KeyPrefix) || !strings.HasSuffix(msg.Payload, expirySuffix) {
+					continue
+				}
+				phone := strings.TrimSuffix(strings.TrimPrefix(msg.Payload, KeyPrefix), expirySuffix)
+				select {
+				case phones <- phone:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return phones
+}
+
+// enableExpiryEvents agrega a notify-keyspace-events las notificaciones de claves expiradas,
+// conservando las que ya estén configuradas.
+func (s *RedisStore) enableExpiryEvents(ctx context.Context) error {
+	current, err := s.rdb.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+	flags := ""
+	if len(current) == 2 {
+		flags, _ = current[1].(string)
+	}
+	updated := flags
+	if !strings.Contains(updated, "E") {
+		updated += "E"
+	}
+	if !strings.Contains(updated, "x") && !strings.Contains(updated, "A") {
+		updated += "x"
+	}
+	if updated == flags {
+		return nil
+	}
+	return s.rdb.ConfigSet(ctx, "notify-keyspace-events", updated).Err()
+}
+
+// Reindex agrega al índice de vencimientos las sesiones que no lo tienen, como las guardadas antes de
+// que existiera, y migra las guardadas como un único JSON. Recorre todas las claves, por lo que solo
+// se usa al iniciar.
+func (s *RedisStore) Reindex(ctx context.Context) error {
+	phones, err := s.Phones(ctx)
+	if err != nil {
+		return err
+	}
+	indexed := 0
+	for _, phone := range phones {
+		session, err := s.Get(ctx, phone)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.Log.Errorf("No se pudo indexar el vencimiento de la sesión de %s: %v", phone, err)
+			continue
+		}
+		expiresAt := s.cfg.Timeouts.ExpiresAt(session)
+		added, err := s.rdb.ZAddNX(ctx, ActivityIndexKey, &redis.Z{Score: float64(expiresAt.UnixMilli()), Member: phone}).Result()
+		if err != nil {
+			return fmt.Errorf("fallo al indexar el vencimiento de la sesión de %s: %w", phone, err)
+		}
+		if added == 0 {
+			continue
+		}
+		if ttl := time.Until(expiresAt); ttl > 0 {
+			s.rdb.SetNX(ctx, keysFor(phone).expiry, "", ttl)
+		}
+		indexed++
+	}
+	if indexed > 0 {
+		logger.Log.Infof("%d sesión(es) agregadas al índice de vencimientos", indexed)
+	}
+	return nil
+}
+
+// Phones devuelve los teléfonos de los usuarios con sesión. Recorre las claves con SCAN para no
+// bloquear Redis.
+func (s *RedisStore) Phones(ctx context.Context) ([]string, error) {
+	var phones []string
+	iter := s.rdb.Scan(ctx, 0, KeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		phone := iter.Val()[len(KeyPrefix):]
+		// Las claves del historial y del vencimiento comparten el prefijo
+		if strings.Contains(phone, ":") {
+			continue
+		}
+		phones = append(phones, phone)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("fallo al listar las sesiones: %w", err)
+	}
+	return phones, nil
+}
+
+// isWrongType indica si el error se debe a que la clave tiene otro tipo, como las sesiones guardadas
+// como un único JSON.
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// toHash convierte los datos de la sesión, sin sus mensajes, en los campos del hash.
+func toHash(session *Session) (map[string]interface{}, error) {
+	options, err := json.Marshal(session.PendingOptions)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(session.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := json.Marshal(session.RecordedMessageIDs)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"phone":                session.UserInfo.Phone,
+		"name":                 session.UserInfo.Name,
+		"thread":               session.Thread,
+		"thread_analizer":      session.ThreadAnalizer,
+		"state":                session.State,
+		"channel":              session.Channel,
+		"start_timestamp":      formatTime(session.StartTimestamp),
+		"last_activity":        formatTime(session.LastActivity),
+		"last_inbound":         formatTime(session.LastInbound),
+		"pending_question":     session.PendingQuestion,
+		"pending_options":      options,
+		"pending_format":       session.PendingFormat,
+		"metadata":             metadata,
+		"recorded_message_ids": recorded,
+		"version":              session.Version,
+	}, nil
+}
+
+// fromHash convierte los campos del hash en los datos de la sesión.
+func fromHash(fields map[string]string) (*Session, error) {
+	session := &Session{
+		UserInfo:        UserInfo{Phone: fields["phone"], Name: fields["name"]},
+		Thread:          fields["thread"],
+		ThreadAnalizer:  fields["thread_analizer"],
+		State:           fields["state"],
+		Channel:         fields["channel"],
+		StartTimestamp:  parseTime(fields["start_timestamp"]),
+		LastActivity:    parseTime(fields["last_activity"]),
+		LastInbound:     parseTime(fields["last_inbound"]),
+		PendingQuestion: fields["pending_question"],
+		PendingFormat:   fields["pending_format"],
+	}
+	if raw := fields["version"]; raw != "" {
+		version, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("versión inválida en la sesión de %s: %w", session.UserInfo.Phone, err)
+		}
+		session.Version = version
+	}
+	if raw := fields["pending_options"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &session.PendingOptions); err != nil {
+			return nil, fmt.Errorf("opciones pendientes inválidas en la sesión de %s: %w", session.UserInfo.Phone, err)
+		}
+	}
+	if raw := fields["metadata"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &session.Metadata); err != nil {
+			return nil, fmt.Errorf("metadatos inválidos en la sesión de %s: %w", session.UserInfo.Phone, err)
+		}
+	}
+	if raw := fields["recorded_message_ids"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &session.RecordedMessageIDs); err != nil {
+			return nil, fmt.Errorf("mensajes registrados inválidos en la sesión de %s: %w", session.UserInfo.Phone, err)
+		}
+	}
+	return session, nil
+}
+
+// formatTime guarda la hora en RFC 3339, o vacía si es la hora cero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime lee una hora guardada con formatTime.
+func parseTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+// encodeMessages serializa los mensajes para guardarlos en una lista.
+func encodeMessages(messages []Message) ([]string, error) {
+	encoded := make([]string, len(messages))
+	for i, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = string(data)
+	}
+	return encoded, nil
+}
+
+// decodeMessages deserializa los mensajes de una lista, descartando los inválidos.
+func decodeMessages(payloads []string) []Message {
+	messages := make([]Message, 0, len(payloads))
+	for _, payload := range payloads {
+		var message Message
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			logger.Log.Errorf("Mensaje inválido descartado del historial de la sesión: %v", err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// toInterfaces convierte los valores para pasarlos a RPUSH.
+func toInterfaces(values []string) []interface{} {
+	converted := make([]interface{}, len(values))
+	for i, value := range values {
+		converted[i] = value
+	}
+	return converted
+}
@@ -0,0 +1,358 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"chatbot/utils/redistest"
+)
+
+func TestRedisStoreUpdateSpillsOverflow(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    []string
+		added       []string
+		spillErr    error
+		wantSpilled []string
+		wantRecent  []string
+		wantAll     []string
+	}{
+		{
+			name:       "dentro del límite",
+			existing:   []string{"m1", "m2"},
+			added:      []string{"m3"},
+			wantRecent: []string{"m1", "m2", "m3"},
+			wantAll:    []string{"m1", "m2", "m3"},
+		},
+		{
+			name:        "desborda los más antiguos",
+			existing:    []string{"m1", "m2", "m3"},
+			added:       []string{"m4", "m5"},
+			wantSpilled: []string{"m1", "m2"},
+			wantRecent:  []string{"m3", "m4", "m5"},
+			wantAll:     []string{"m3", "m4", "m5"},
+		},
+		{
+			name:        "los mensajes nuevos solos exceden el límite",
+			existing:    []string{"m1"},
+			added:       []string{"m2", "m3", "m4", "m5"},
+			wantSpilled: []string{"m1", "m2"},
+			wantRecent:  []string{"m3", "m4", "m5"},
+			wantAll:     []string{"m3", "m4", "m5"},
+		},
+		{
+			name:       "si Spill falla se conserva el desborde",
+			existing:   []string{"m1", "m2", "m3"},
+			added:      []string{"m4"},
+			spillErr:   errors.New("postgres caído"),
+			wantRecent: []string{"m2", "m3", "m4"},
+			wantAll:    []string{"m1", "m2", "m3", "m4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rdb := redistest.New(t)
+			var spilled []string
+			spillErr := error(nil)
+			store := NewRedisStore(rdb, RedisConfig{HistoryLimit: 3, Spill: func(ctx context.Context, session *Session, messages []Message) error {
+				if spillErr != nil {
+					return spillErr
+				}
+				spilled = append(spilled, messageTexts(messages)...)
+				return nil
+			}})
+			phone := testPhone(t, store)
+
+			session := New(phone, "Ana", time.Now())
+			session.Messages = testMessages(tt.existing...)
+			if err := store.Create(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+			spillErr = tt.spillErr
+
+			if _, err := store.Update(ctx, phone, func(s *Session) error {
+				s.Messages = testMessages(tt.added...)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(spilled, tt.wantSpilled) {
+				t.Errorf("mensajes guardados fuera de Redis = %q, se esperaba %q", spilled, tt.wantSpilled)
+			}
+			recent, err := rdb.LRange(ctx, keysFor(phone).messages, 0, -1).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := messageTexts(decodeMessages(recent)); !reflect.DeepEqual(got, tt.wantRecent) {
+				t.Errorf("historial reciente = %q, se esperaba %q", got, tt.wantRecent)
+			}
+			stored, err := store.Get(ctx, phone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := messageTexts(stored.Messages); !reflect.DeepEqual(got, tt.wantAll) {
+				t.Errorf("mensajes de la sesión = %q, se esperaba %q", got, tt.wantAll)
+			}
+		})
+	}
+}
+
+func TestRedisStoreWithSpillLock(t *testing.T) {
+	ctx := context.Background()
+	rdb := redistest.New(t)
+	var spilled []string
+	store := NewRedisStore(rdb, RedisConfig{HistoryLimit: 2, Spill: func(ctx context.Context, session *Session, messages []Message) error {
+		spilled = append(spilled, messageTexts(messages)...)
+		return nil
+	}})
+	phone := testPhone(t, store)
+	keys := keysFor(phone)
+	t.Cleanup(func() { rdb.Del(context.Background(), keys.spillLock) })
+
+	session := New(phone, "Ana", time.Now())
+	session.Messages = testMessages("m1", "m2")
+	if err := store.Create(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mientras se archiva, el desborde queda en Redis y la sesión lo sigue incluyendo
+	err := store.WithSpillLock(ctx, phone, func() error {
+		if _, err := store.Update(ctx, phone, func(s *Session) error {
+			s.Messages = testMessages("m3")
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := store.WithSpillLock(ctx, phone, func() error { return nil }); !errors.Is(err, ErrSpillInProgress) {
+			t.Errorf("reserva anidada: error = %v, se esperaba ErrSpillInProgress", err)
+		}
+		stored, err := store.Get(ctx, phone)
+		if err != nil {
+			return err
+		}
+		if got := messageTexts(stored.Messages); !reflect.DeepEqual(got, []string{"m1", "m2", "m3"}) {
+			t.Errorf("mensajes de la sesión = %q durante la reserva", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spilled) != 0 {
+		t.Errorf("se guardó el desborde %q durante la reserva", spilled)
+	}
+
+	// La reserva vencida que tomó otra instancia no se libera al terminar
+	err = store.WithSpillLock(ctx, phone, func() error {
+		return rdb.Set(ctx, keys.spillLock, "otra-instancia", time.Minute).Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner, err := rdb.Get(ctx, keys.spillLock).Result(); err != nil || owner != "otra-instancia" {
+		t.Errorf("reserva = %q (%v), se esperaba la de la otra instancia", owner, err)
+	}
+	if _, err := store.Update(ctx, phone, func(s *Session) error {
+		s.Messages = testMessages("m4")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(spilled) != 0 {
+		t.Errorf("se guardó el desborde %q con la reserva de otra instancia", spilled)
+	}
+
+	// Sin reserva, la siguiente escritura guarda todo el desborde pendiente
+	rdb.Del(ctx, keys.spillLock)
+	if _, err := store.Update(ctx, phone, func(s *Session) error {
+		s.Messages = testMessages("m5")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"m1", "m2", "m3"}; !reflect.DeepEqual(spilled, want) {
+		t.Errorf("desborde guardado = %q, se esperaba %q", spilled, want)
+	}
+}
+
+func TestHashRoundTrip(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		name    string
+		session Session
+	}{
+		{name: "sesión vacía", session: Session{UserInfo: UserInfo{Phone: "5491100000000"}}},
+		{
+			name: "sesión completa",
+			session: Session{
+				UserInfo:        UserInfo{Phone: "5491100000000", Name: "Ana"},
+				Thread:          "hilo",
+				ThreadAnalizer:  "hilo_analizador",
+				State:           StateActive,
+				Channel:         ChannelWhatsApp,
+				StartTimestamp:  at,
+				LastActivity:    at.Add(time.Minute),
+				LastInbound:     at.Add(30 * time.Second),
+				PendingQuestion: "¿Algo más?",
+				PendingOptions:  []Option{{ID: "button_1", Title: "Sí"}},
+				PendingFormat:   OptionsFormatButtons,
+				Metadata:        map[string]string{"origen": "anuncio"},
+				Version:         7,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := toHash(&tt.session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Redis devuelve todos los campos como texto
+			stored := make(map[string]string, len(fields))
+			for key, value := range fields {
+				switch v := value.(type) {
+				case []byte:
+					stored[key] = string(v)
+				default:
+					stored[key] = fmt.Sprint(v)
+				}
+			}
+
+			got, err := fromHash(stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.session) {
+				t.Errorf("sesión leída = %+v, se esperaba %+v", *got, tt.session)
+			}
+		})
+	}
+}
+
+func TestRedisStoreExpiryIndex(t *testing.T) {
+	ctx := context.Background()
+	rdb := redistest.New(t)
+	timeouts := Timeouts{Default: time.Hour, PerChannel: map[string]time.Duration{"web": 3 * time.Hour}}
+	store := NewRedisStore(rdb, RedisConfig{HistoryLimit: 10, Timeouts: timeouts})
+	now := time.Now()
+
+	sessions := []struct {
+		phone        string
+		channel      string
+		lastActivity time.Time
+		wantExpired  bool
+	}{
+		{phone: "5491100000001", channel: ChannelWhatsApp, lastActivity: now.Add(-2 * time.Hour), wantExpired: true},
+		{phone: "5491100000002", channel: "web", lastActivity: now.Add(-2 * time.Hour)},
+		{phone: "5491100000003", channel: ChannelWhatsApp, lastActivity: now.Add(-10 * time.Minute)},
+	}
+	var wantExpired []string
+	for _, s := range sessions {
+		session := New(s.phone, "Ana", s.lastActivity)
+		session.Channel = s.channel
+		if err := store.Create(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		if s.wantExpired {
+			wantExpired = append(wantExpired, s.phone)
+		}
+
+		// Solo las sesiones vigentes tienen la clave que vence con la inactividad
+		ttl, err := rdb.TTL(ctx, keysFor(s.phone).expiry).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.wantExpired != (ttl < 0) {
+			t.Errorf("%s: la clave de vencimiento tiene TTL %v", s.phone, ttl)
+		}
+	}
+
+	expired, err := store.Expired(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expired, wantExpired) {
+		t.Errorf("sesiones vencidas = %v, se esperaban %v", expired, wantExpired)
+	}
+
+	// La actividad renueva el vencimiento de la sesión
+	if _, err := store.Update(ctx, "5491100000001", func(s *Session) error {
+		s.AddMessage("Ana", "sigo aquí", "text", time.Now())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if expired, err := store.Expired(ctx, time.Now()); err != nil || len(expired) != 0 {
+		t.Errorf("sesiones vencidas tras la actividad = %v (%v), no se esperaba ninguna", expired, err)
+	}
+	if ttl, err := rdb.TTL(ctx, keysFor("5491100000001").expiry).Result(); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("la clave de vencimiento renovada tiene TTL %v (%v), se esperaba hasta una hora", ttl, err)
+	}
+
+	// Al eliminar la sesión sale del índice
+	if err := store.Delete(ctx, "5491100000001"); err != nil {
+		t.Fatal(err)
+	}
+	if expired, err := store.Expired(ctx, time.Now().Add(4*time.Hour)); err != nil || len(expired) != 2 {
+		t.Errorf("sesiones en el índice tras eliminar una = %v (%v), se esperaban 2", expired, err)
+	}
+}
+
+func TestRedisStoreExpiryNotifications(t *testing.T) {
+	rdb := redistest.New(t)
+	store := NewRedisStore(rdb, RedisConfig{HistoryLimit: 10})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	phones := store.ExpiryNotifications(ctx)
+	channel := fmt.Sprintf("__keyevent@%d__:expired", rdb.Options().DB)
+
+	// Esperar a que la suscripción esté activa antes de publicar los eventos
+	deadline := time.Now().Add(time.Second)
+	for {
+		subscribers, err := rdb.Publish(context.Background(), channel, "otra:clave").Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subscribers > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tiempo agotado esperando la suscripción a las claves expiradas")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Solo la clave de vencimiento de una sesión se notifica, con el teléfono de la sesión
+	for _, key := range []string{KeyPrefix + "5491100000001", KeyPrefix + "5491100000001" + messagesSuffix, keysFor("5491100000002").expiry} {
+		if err := rdb.Publish(context.Background(), channel, key).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case phone := <-phones:
+		if phone != "5491100000002" {
+			t.Errorf("teléfono notificado = %q, se esperaba %q", phone, "5491100000002")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("tiempo agotado esperando la notificación de vencimiento")
+	}
+
+	cancel()
+	select {
+	case phone, ok := <-phones:
+		if ok {
+			t.Errorf("notificación inesperada de %q", phone)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("el canal no se cerró al cancelar el contexto")
+	}
+}
@@ -0,0 +1,203 @@
+// chatbot/utils/session/session.go
+
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// KeyPrefix es el prefijo de las claves de Redis con la sesión de cada usuario.
+const KeyPrefix = "usuario:"
+
+// Sufijos de las claves de Redis con el historial de la sesión
+const (
+	messagesSuffix = ":mensajes"
+	spillSuffix    = ":desborde"
+	expirySuffix   = ":expira"
+)
+
+// ActivityIndexKey es el sorted set con el vencimiento de cada sesión, por teléfono.
+const ActivityIndexKey = "sesiones:vencimiento"
+
+// Canales por los que llegan las conversaciones
+const (
+	ChannelWhatsApp = "whatsapp"
+)
+
+// Estados de la sesión
+const (
+	StateActive = "active"
+)
+
+// maxRecordedMessageIDs es el número de ids de mensajes registrados que recuerda cada sesión.
+const maxRecordedMessageIDs = 50
+
+// Tipos de mensaje que no provienen del usuario
+const (
+	MessageTypeOutgoing = "outgoing"
+)
+
+var (
+	// ErrNotFound indica que el usuario no tiene sesión.
+	ErrNotFound = errors.New("sesión no encontrada")
+	// ErrExists indica que el usuario ya tiene sesión al intentar crearla.
+	ErrExists = errors.New("la sesión ya existe")
+	// ErrConflict indica que la sesión cambió en cada intento de actualizarla.
+	ErrConflict = errors.New("la sesión se modificó durante la actualización")
+	// ErrSpillInProgress indica que otra instancia está guardando el historial antiguo de la sesión.
+	ErrSpillInProgress = errors.New("el historial antiguo de la sesión se está guardando")
+)
+
+// UserInfo son los datos del usuario de WhatsApp.
+type UserInfo struct {
+	Phone string `json:"phone"`
+	Name  string `json:"name"`
+}
+
+// Message es un mensaje de la conversación guardado en la sesión.
+type Message struct {
+	Message   string    `json:"message"`
+	Sender    string    `json:"sender"`
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"type"`
+}
+
+// Option es una opción enviada al usuario en un mensaje interactivo.
+type Option struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Formatos en que se presentan las opciones pendientes.
+const (
+	OptionsFormatButtons  = "buttons"
+	OptionsFormatList     = "list"
+	OptionsFormatNumbered = "numbered"
+)
+
+// Session es la conversación en curso de un usuario. Se guarda como JSON con los mismos campos que
+// las sesiones anteriores, de modo que ambas se leen igual.
+type Session struct {
+	UserInfo       UserInfo `json:"user_info"`
+	Thread         string   `json:"thread"`
+	ThreadAnalizer string   `json:"thread_analizer"`
+	State          string   `json:"state"`
+	// Channel es el canal de la conversación; las sesiones antiguas no lo tienen y son de WhatsApp.
+	Channel        string    `json:"channel,omitempty"`
+	Messages       []Message `json:"messages"`
+	StartTimestamp time.Time `json:"start_timestamp"`
+	LastActivity   time.Time `json:"last_activity"`
+	// LastInbound es la hora del último mensaje del usuario; las sesiones antiguas no la tienen.
+	LastInbound time.Time `json:"last_inbound"`
+
+	// PendingQuestion y PendingOptions son la última pregunta de seguimiento enviada y sus opciones.
+	// PendingFormat indica cómo se presentaron las opciones; las sesiones antiguas no lo tienen.
+	PendingQuestion string   `json:"pending_question,omitempty"`
+	PendingOptions  []Option `json:"pending_options,omitempty"`
+	PendingFormat   string   `json:"pending_format,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// RecordedMessageIDs son los ids de WhatsApp de los últimos mensajes del usuario registrados, para
+	// no registrar dos veces un mensaje que se vuelve a entregar.
+	RecordedMessageIDs []string `json:"recorded_message_ids,omitempty"`
+
+	// Version aumenta con cada escritura de la sesión en el almacén, para saber si cambió desde que se
+	// leyó.
+	Version int64 `json:"version,omitempty"`
+}
+
+// New crea una sesión activa para el usuario.
+func New(phone, name string, now time.Time) *Session {
+	return &Session{
+		UserInfo:       UserInfo{Phone: phone, Name: name},
+		State:          StateActive,
+		Channel:        ChannelWhatsApp,
+		Messages:       []Message{},
+		StartTimestamp: now,
+		LastActivity:   now,
+	}
+}
+
+// AddMessage agrega un mensaje y actualiza la última actividad y, si el mensaje es del usuario, el
+// último mensaje recibido.
+func (s *Session) AddMessage(sender, text, messageType string, at time.Time) {
+	s.Messages = append(s.Messages, Message{Message: text, Sender: sender, Timestamp: at, Type: messageType})
+	s.LastActivity = at
+	if messageType != MessageTypeOutgoing {
+		s.LastInbound = at
+	}
+}
+
+// HasRecorded indica si el mensaje con el id de WhatsApp indicado ya se registró en la sesión.
+func (s *Session) HasRecorded(messageID string) bool {
+	for _, id := range s.RecordedMessageIDs {
+		if id == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkRecorded recuerda que se registró el mensaje con el id de WhatsApp indicado. Solo se conservan
+// los últimos maxRecordedMessageIDs ids.
+func (s *Session) MarkRecorded(messageID string) {
+	if messageID == "" || s.HasRecorded(messageID) {
+		return
+	}
+	s.RecordedMessageIDs = append(s.RecordedMessageIDs, messageID)
+	if excess := len(s.RecordedMessageIDs) - maxRecordedMessageIDs; excess > 0 {
+		s.RecordedMessageIDs = append([]string(nil), s.RecordedMessageIDs[excess:]...)
+	}
+}
+
+// LastInboundAt devuelve la hora del último mensaje del usuario. En las sesiones que no la guardan se
+// usa el último mensaje que no sea una respuesta del bot.
+func (s *Session) LastInboundAt() time.Time {
+	if !s.LastInbound.IsZero() {
+		return s.LastInbound
+	}
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		if s.Messages[i].Type != MessageTypeOutgoing {
+			return s.Messages[i].Timestamp
+		}
+	}
+	return time.Time{}
+}
+
+// SpillFunc guarda fuera de Redis los mensajes más antiguos de una sesión cuando su historial supera
+// el límite. Si falla, los mensajes se conservan y se vuelve a intentar en la siguiente escritura. Si
+// falla al quitarlos de Redis tras guardarlos, se entregan de nuevo, por lo que debe omitir los que ya
+// guardó.
+type SpillFunc func(ctx context.Context, session *Session, messages []Message) error
+
+// SessionStore guarda las sesiones de los usuarios por teléfono.
+type SessionStore interface {
+	// Get devuelve la sesión del usuario o ErrNotFound. Messages tiene los mensajes que aún no se
+	// guardaron fuera del almacén.
+	Get(ctx context.Context, phone string) (*Session, error)
+	// Create guarda una sesión nueva. Devuelve ErrExists si el usuario ya tiene una.
+	Create(ctx context.Context, session *Session) error
+	// Update aplica fn a la sesión del usuario y la guarda de forma atómica. fn recibe la sesión sin
+	// su historial: los mensajes que agregue se añaden al final y no se reescriben los anteriores. Si
+	// otra escritura la modifica mientras tanto, vuelve a leerla y a aplicar fn. Devuelve ErrNotFound
+	// si no existe y el error de fn sin guardar nada si fn falla. La sesión devuelta solo tiene los
+	// mensajes agregados por fn.
+	Update(ctx context.Context, phone string, fn func(*Session) error) (*Session, error)
+	// Delete elimina la sesión del usuario. No es un error que no exista.
+	Delete(ctx context.Context, phone string) error
+	// DeleteIfUnchanged elimina la sesión del usuario solo si su versión sigue siendo version. Devuelve
+	// false sin eliminarla si se modificó desde entonces. No es un error que no exista.
+	DeleteIfUnchanged(ctx context.Context, phone string, version int64) (bool, error)
+	// Phones devuelve los teléfonos de los usuarios con sesión.
+	Phones(ctx context.Context) ([]string, error)
+	// Expired devuelve los teléfonos de las sesiones que vencieron antes de la hora indicada, según
+	// los tiempos de inactividad del almacén.
+	Expired(ctx context.Context, before time.Time) ([]string, error)
+	// WithSpillLock ejecuta fn sin que ninguna escritura guarde mientras tanto el historial antiguo de
+	// la sesión, para archivarla sin guardar dos veces los mismos mensajes. Devuelve ErrSpillInProgress
+	// sin ejecutar fn si se está guardando.
+	WithSpillLock(ctx context.Context, phone string, fn func() error) error
+}
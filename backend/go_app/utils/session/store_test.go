@@ -0,0 +1,172 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"chatbot/logger"
+	"chatbot/utils/redistest"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testPhone devuelve un teléfono propio de la prueba y elimina su sesión al terminar.
+func testPhone(t *testing.T, store SessionStore) string {
+	t.Helper()
+	phone := fmt.Sprintf("prueba-%d", time.Now().UnixNano())
+	t.Cleanup(func() { store.Delete(context.Background(), phone) })
+	return phone
+}
+
+// testMessages crea mensajes del usuario con los textos indicados.
+func testMessages(texts ...string) []Message {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	messages := make([]Message, len(texts))
+	for i, text := range texts {
+		messages[i] = Message{Message: text, Sender: "usuario", Timestamp: at.Add(time.Duration(i) * time.Second), Type: "text"}
+	}
+	return messages
+}
+
+// messageTexts devuelve los textos de los mensajes.
+func messageTexts(messages []Message) []string {
+	texts := make([]string, len(messages))
+	for i, message := range messages {
+		texts[i] = message.Message
+	}
+	return texts
+}
+
+// testStores devuelve los almacenes sobre los que se prueba el contrato de SessionStore.
+func testStores() map[string]func(t *testing.T) SessionStore {
+	return map[string]func(t *testing.T) SessionStore{
+		"memoria": func(t *testing.T) SessionStore { return NewMemoryStore(Timeouts{}) },
+		"redis": func(t *testing.T) SessionStore {
+			return NewRedisStore(redistest.New(t), RedisConfig{HistoryLimit: 10})
+		},
+	}
+}
+
+func TestSessionStoreUpdate(t *testing.T) {
+	failure := errors.New("fallo de fn")
+	tests := []struct {
+		name      string
+		create    bool
+		existing  []string
+		added     []string
+		fnErr     error
+		wantErr   error
+		wantAdded []string
+		wantAll   []string
+	}{
+		{name: "agrega al final del historial", create: true, existing: []string{"hola"}, added: []string{"uno", "dos"}, wantAdded: []string{"uno", "dos"}, wantAll: []string{"hola", "uno", "dos"}},
+		{name: "sin mensajes nuevos", create: true, existing: []string{"hola"}, wantAdded: []string{}, wantAll: []string{"hola"}},
+		{name: "el error de fn no guarda nada", create: true, existing: []string{"hola"}, added: []string{"uno"}, fnErr: failure, wantErr: failure, wantAll: []string{"hola"}},
+		{name: "sesión inexistente", wantErr: ErrNotFound},
+	}
+
+	for storeName, newStore := range testStores() {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				store := newStore(t)
+				phone := testPhone(t, store)
+				if tt.create {
+					session := New(phone, "Ana", time.Now())
+					session.Messages = testMessages(tt.existing...)
+					if err := store.Create(ctx, session); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				updated, err := store.Update(ctx, phone, func(s *Session) error {
+					if len(s.Messages) != 0 {
+						t.Errorf("fn recibió %d mensajes, se esperaba la sesión sin historial", len(s.Messages))
+					}
+					s.PendingQuestion = "¿Algo más?"
+					s.Messages = append(s.Messages, testMessages(tt.added...)...)
+					return tt.fnErr
+				})
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, se esperaba %v", err, tt.wantErr)
+				}
+				if tt.wantErr == nil {
+					if got := messageTexts(updated.Messages); !reflect.DeepEqual(got, tt.wantAdded) {
+						t.Errorf("mensajes devueltos = %q, se esperaba %q", got, tt.wantAdded)
+					}
+				}
+				if !tt.create {
+					return
+				}
+
+				stored, err := store.Get(ctx, phone)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := messageTexts(stored.Messages); !reflect.DeepEqual(got, tt.wantAll) {
+					t.Errorf("historial = %q, se esperaba %q", got, tt.wantAll)
+				}
+				if saved := stored.PendingQuestion != ""; saved != (tt.wantErr == nil) {
+					t.Errorf("pregunta pendiente guardada = %v con el error %v", saved, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestSessionStoreDeleteIfUnchanged(t *testing.T) {
+	tests := []struct {
+		name        string
+		staleBy     int
+		wantDeleted bool
+	}{
+		{name: "misma versión", wantDeleted: true},
+		{name: "modificada después de leerla", staleBy: 1},
+	}
+
+	for storeName, newStore := range testStores() {
+		for _, tt := range tests {
+			t.Run(storeName+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				store := newStore(t)
+				phone := testPhone(t, store)
+				if err := store.Create(ctx, New(phone, "Ana", time.Now())); err != nil {
+					t.Fatal(err)
+				}
+				read, err := store.Get(ctx, phone)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < tt.staleBy; i++ {
+					if _, err := store.Update(ctx, phone, func(s *Session) error { return nil }); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				deleted, err := store.DeleteIfUnchanged(ctx, phone, read.Version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if deleted != tt.wantDeleted {
+					t.Errorf("eliminada = %v, se esperaba %v", deleted, tt.wantDeleted)
+				}
+				_, err = store.Get(ctx, phone)
+				if exists := !errors.Is(err, ErrNotFound); exists == tt.wantDeleted {
+					t.Errorf("la sesión existe = %v después de DeleteIfUnchanged (%v)", exists, err)
+				}
+			})
+		}
+	}
+}
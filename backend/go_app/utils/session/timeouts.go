@@ -0,0 +1,35 @@
+// chatbot/utils/session/timeouts.go
+
+package session
+
+import "time"
+
+// DefaultTimeout es el tiempo de inactividad tras el que vence una sesión si no se configura otro.
+const DefaultTimeout = time.Hour
+
+// Timeouts son los tiempos de inactividad tras los que vencen las sesiones de cada canal.
+type Timeouts struct {
+	// Default se usa para los canales sin tiempo propio.
+	Default time.Duration
+	// PerChannel tiene el tiempo de inactividad de cada canal.
+	PerChannel map[string]time.Duration
+}
+
+// For devuelve el tiempo de inactividad del canal. Las sesiones sin canal son de WhatsApp.
+func (t Timeouts) For(channel string) time.Duration {
+	if channel == "" {
+		channel = ChannelWhatsApp
+	}
+	if timeout, ok := t.PerChannel[channel]; ok && timeout > 0 {
+		return timeout
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return DefaultTimeout
+}
+
+// ExpiresAt devuelve la hora en que vence la sesión si no hay más actividad.
+func (t Timeouts) ExpiresAt(s *Session) time.Time {
+	return s.LastActivity.Add(t.For(s.Channel))
+}
@@ -0,0 +1,87 @@
+// chatbot/utils/storage/blobStore.go
+
+package storage
+
+import (
+	"chatbot/logger"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore define el almacenamiento de archivos binarios (por ejemplo, multimedia recibida por WhatsApp).
+type BlobStore interface {
+	// Save guarda el contenido bajo la clave indicada y devuelve la ubicación donde quedó almacenado.
+	Save(ctx context.Context, key, contentType string, data io.Reader) (string, error)
+	// Open devuelve el contenido almacenado bajo la clave indicada.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// LocalBlobStore guarda los archivos en un directorio del sistema de archivos local.
+type LocalBlobStore struct {
+	Dir string
+}
+
+// NewLocalBlobStore crea un LocalBlobStore en el directorio indicado, creándolo si no existe.
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("fallo al crear el directorio de almacenamiento %s: %w", dir, err)
+	}
+	return &LocalBlobStore{Dir: dir}, nil
+}
+
+// NewBlobStoreFromEnv crea el almacenamiento configurado en MEDIA_STORAGE_DIR (por defecto "media").
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	dir := os.Getenv("MEDIA_STORAGE_DIR")
+	if dir == "" {
+		dir = "media"
+		logger.Log.Infof("MEDIA_STORAGE_DIR no configurado, usando valor por defecto: %s", dir)
+	}
+	return NewLocalBlobStore(dir)
+}
+
+// Save escribe el contenido en Dir/key.
+func (s *LocalBlobStore) Save(ctx context.Context, key, contentType string, data io.Reader) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", fmt.Errorf("fallo al crear el directorio para %s: %w", key, err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("fallo al crear el archivo %s: %w", path, err)
+	}
+	defer file.Close()
+
+	written, err := io.Copy(file, data)
+	if err != nil {
+		return "", fmt.Errorf("fallo al escribir el archivo %s: %w", path, err)
+	}
+
+	logger.Log.Infof("Archivo %s (%s, %d bytes) guardado en %s", key, contentType, written, path)
+	return path, nil
+}
+
+// Open abre el archivo Dir/key para lectura.
+func (s *LocalBlobStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// path resuelve la ruta de una clave evitando que salga del directorio base.
+func (s *LocalBlobStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if strings.Contains(clean, "..") {
+		return "", fmt.Errorf("clave de almacenamiento inválida: %s", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
@@ -0,0 +1,183 @@
+// chatbot/utils/whatsapp/client.go
+
+package whatsapp
+
+import (
+	"bytes"
+	"chatbot/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL es la URL base de la Graph API.
+const DefaultBaseURL = "https://graph.facebook.com"
+
+// Client envía mensajes y consulta multimedia a través de la Cloud API de WhatsApp.
+type Client struct {
+	// BaseURL es la URL base de la Graph API, sin la versión.
+	BaseURL string
+	// Version es la versión de la Graph API, por ejemplo "v19.0".
+	Version string
+	// PhoneNumberID es el id del número de teléfono del negocio que envía los mensajes.
+	PhoneNumberID string
+	// Token es el token de acceso de la aplicación.
+	Token string
+	// HTTPClient realiza las solicitudes. Debe tener un timeout configurado.
+	HTTPClient *http.Client
+}
+
+// NewClient crea un cliente con la URL base, la versión, el número y el token indicados.
+func NewClient(baseURL, version, phoneNumberID, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		Version:       version,
+		PhoneNumberID: phoneNumberID,
+		Token:         token,
+		HTTPClient:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// NewClientFromEnv crea un cliente con GRAPH_API_BASE_URL, VERSION, PHONE_NUMBER_ID y ACCESS_TOKEN.
+func NewClientFromEnv() *Client {
+	return NewClient(os.Getenv("GRAPH_API_BASE_URL"), os.Getenv("VERSION"), os.Getenv("PHONE_NUMBER_ID"), os.Getenv("ACCESS_TOKEN"))
+}
+
+// SendResponse es la respuesta de la Graph API al enviar un mensaje.
+type SendResponse struct {
+	MessagingProduct string `json:"messaging_product"`
+	Contacts         []struct {
+		Input string `json:"input"`
+		WaID  string `json:"wa_id"`
+	} `json:"contacts"`
+	Messages []struct {
+		ID            string `json:"id"`
+		MessageStatus string `json:"message_status,omitempty"`
+	} `json:"messages"`
+}
+
+// MessageID devuelve el id del mensaje enviado, o una cadena vacía si la respuesta no lo incluye.
+func (r *SendResponse) MessageID() string {
+	if len(r.Messages) == 0 {
+		return ""
+	}
+	return r.Messages[0].ID
+}
+
+// Send envía un mensaje y devuelve la respuesta de la Graph API.
+func (c *Client) Send(ctx context.Context, message *OutboundMessage) (*SendResponse, error) {
+	var response SendResponse
+	if err := c.post(ctx, c.messagesURL(), message, &response); err != nil {
+		return nil, fmt.Errorf("fallo al enviar mensaje de tipo %s a %s: %w", message.Type, message.To, err)
+	}
+	logger.Log.Infof("Mensaje de tipo %s enviado a %s con id %s", message.Type, message.To, response.MessageID())
+	return &response, nil
+}
+
+// MarkAsRead marca un mensaje recibido como leído y, si typing es true, muestra el indicador de escritura.
+func (c *Client) MarkAsRead(ctx context.Context, messageID string, typing bool) error {
+	receipt := readReceipt{MessagingProduct: messagingProduct, Status: "read", MessageID: messageID}
+	if typing {
+		receipt.TypingIndicator = &typingIndicator{Type: "text"}
+	}
+	if err := c.post(ctx, c.messagesURL(), receipt, nil); err != nil {
+		return fmt.Errorf("fallo al marcar como leído el mensaje %s: %w", messageID, err)
+	}
+	return nil
+}
+
+// GetMediaInfo consulta la URL temporal y el tipo de un archivo multimedia a partir de su id.
+func (c *Client) GetMediaInfo(ctx context.Context, mediaID string) (*MediaInfo, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.graphURL(mediaID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("fallo al consultar multimedia %s: %w", mediaID, err)
+	}
+	defer resp.Body.Close()
+
+	var info MediaInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("fallo al deserializar información de multimedia %s: %w", mediaID, err)
+	}
+	return &info, nil
+}
+
+// DownloadMedia descarga el contenido de un archivo multimedia. El llamador debe cerrar el io.ReadCloser devuelto.
+func (c *Client) DownloadMedia(ctx context.Context, info *MediaInfo) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, info.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fallo al descargar multimedia %s: %w", info.ID, err)
+	}
+	return resp.Body, nil
+}
+
+// messagesURL devuelve el endpoint de mensajes del número del negocio.
+func (c *Client) messagesURL() string {
+	return c.graphURL(c.PhoneNumberID + "/messages")
+}
+
+// graphURL construye la URL de un recurso de la Graph API.
+func (c *Client) graphURL(path string) string {
+	return fmt.Sprintf("%s/%s/%s", c.BaseURL, c.Version, path)
+}
+
+// post serializa payload, lo envía por POST y, si out no es nil, deserializa la respuesta en out. Si la
+// respuesta es 2xx la solicitud ya fue aceptada: un cuerpo que no se puede deserializar solo se
+// registra, para que el llamador no la reintente, y out puede quedar vacío.
+func (c *Client) post(ctx context.Context, url string, payload, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("fallo al serializar cuerpo de la solicitud: %w", err)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		logger.Log.Warnf("Respuesta %d de %s aceptada pero no se pudo deserializar: %v", resp.StatusCode, url, err)
+	}
+	return nil
+}
+
+// do ejecuta una solicitud autenticada. Si la respuesta no es 2xx la convierte en *APIError.
+// El llamador debe cerrar el cuerpo de la respuesta devuelta.
+func (c *Client) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("fallo al crear solicitud: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, decodeAPIError(resp.StatusCode, respBody)
+	}
+	return resp, nil
+}
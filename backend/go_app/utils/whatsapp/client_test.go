@@ -0,0 +1,161 @@
+package whatsapp
+
+import (
+	"chatbot/logger"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	logger.Log = logrus.New()
+	logger.Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testClient crea un cliente que envía las solicitudes a un servidor de prueba que responde con
+// status y body.
+func testClient(t *testing.T, status int, body string) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, "v19.0", "123", "token")
+}
+
+func TestSendUndecodableSuccess(t *testing.T) {
+	client := testClient(t, http.StatusOK, "<html>ok</html>")
+
+	response, err := client.Send(context.Background(), NewTextMessage("5491100000000", "hola"))
+	if err != nil {
+		t.Fatalf("Send devolvió %v tras una respuesta 2xx", err)
+	}
+	if id := response.MessageID(); id != "" {
+		t.Errorf("MessageID = %q, se esperaba vacío", id)
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "sin error", err: nil, want: false},
+		{name: "límite de la Cloud API", err: &APIError{StatusCode: http.StatusBadRequest, Code: ErrorCodeRateLimit}, want: true},
+		{name: "error 5xx", err: &APIError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "parámetro inválido", err: &APIError{StatusCode: http.StatusBadRequest, Code: ErrorCodeInvalidParameter}, want: false},
+		{name: "timeout", err: fmt.Errorf("envío: %w", context.DeadlineExceeded), want: true},
+		{name: "contexto cancelado", err: fmt.Errorf("envío: %w", context.Canceled), want: false},
+		{name: "error de otro tipo", err: errors.New("fallo al serializar cuerpo de la solicitud"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTemporary(tt.err); got != tt.want {
+				t.Errorf("IsTemporary(%v) = %v, se esperaba %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTemporaryNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	client := NewClient(server.URL, "v19.0", "123", "token")
+	server.Close()
+
+	_, err := client.Send(context.Background(), NewTextMessage("5491100000000", "hola"))
+	if err == nil {
+		t.Fatal("Send no falló con el servidor cerrado")
+	}
+	if !IsTemporary(err) {
+		t.Errorf("IsTemporary(%v) = false para un fallo de red", err)
+	}
+}
+
+func TestSendErrorMapping(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantCode      int
+		wantMessage   string
+		wantDetails   string
+		wantTemporary bool
+	}{
+		{
+			name:          "ventana de 24 horas cerrada",
+			status:        http.StatusBadRequest,
+			body:          `{"error":{"message":"Re-engagement message","type":"OAuthException","code":131047,"error_data":{"messaging_product":"whatsapp","details":"Message failed to send because more than 24 hours have passed"},"fbtrace_id":"A1"}}`,
+			wantCode:      ErrorCodeWindowClosed,
+			wantMessage:   "Re-engagement message",
+			wantDetails:   "Message failed to send because more than 24 hours have passed",
+			wantTemporary: false,
+		},
+		{
+			name:          "límite de envíos",
+			status:        http.StatusBadRequest,
+			body:          `{"error":{"message":"Rate limit hit","type":"OAuthException","code":130429}}`,
+			wantCode:      ErrorCodeRateLimit,
+			wantMessage:   "Rate limit hit",
+			wantTemporary: true,
+		},
+		{
+			name:          "límite de envíos por spam",
+			status:        http.StatusBadRequest,
+			body:          `{"error":{"message":"(#131056) (Business Account, Consumer Account) pair rate limit hit","type":"OAuthException","code":131056}}`,
+			wantCode:      ErrorCodeSpamRateLimit,
+			wantMessage:   "(#131056) (Business Account, Consumer Account) pair rate limit hit",
+			wantTemporary: true,
+		},
+		{
+			name:          "token inválido",
+			status:        http.StatusUnauthorized,
+			body:          `{"error":{"message":"Invalid OAuth access token","type":"OAuthException","code":190}}`,
+			wantCode:      ErrorCodeAccessTokenInvalid,
+			wantMessage:   "Invalid OAuth access token",
+			wantTemporary: false,
+		},
+		{
+			name:          "cuerpo sin el formato de la Graph API",
+			status:        http.StatusBadGateway,
+			body:          "<html>Bad Gateway</html>",
+			wantMessage:   "<html>Bad Gateway</html>",
+			wantTemporary: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testClient(t, tt.status, tt.body)
+
+			_, err := client.Send(context.Background(), NewTextMessage("5491100000000", "hola"))
+			apiErr, ok := AsAPIError(err)
+			if !ok {
+				t.Fatalf("Send devolvió %v, se esperaba un *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Code != tt.wantCode || apiErr.Message != tt.wantMessage {
+				t.Errorf("error = HTTP %d, código %d, mensaje %q; se esperaba HTTP %d, código %d, mensaje %q",
+					apiErr.StatusCode, apiErr.Code, apiErr.Message, tt.status, tt.wantCode, tt.wantMessage)
+			}
+			if tt.wantDetails != "" && (apiErr.ErrorData == nil || apiErr.ErrorData.Details != tt.wantDetails) {
+				t.Errorf("detalles = %+v, se esperaba %q", apiErr.ErrorData, tt.wantDetails)
+			}
+			if tt.wantCode != 0 && !IsErrorCode(err, tt.wantCode) {
+				t.Errorf("IsErrorCode(%v, %d) = false", err, tt.wantCode)
+			}
+			if got := IsTemporary(err); got != tt.wantTemporary {
+				t.Errorf("IsTemporary(%v) = %v, se esperaba %v", err, got, tt.wantTemporary)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// chatbot/utils/whatsapp/errors.go
+
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Códigos de error de la Graph API y de la Cloud API de WhatsApp.
+const (
+	ErrorCodeUnknown            = 1
+	ErrorCodeServiceUnavailable = 2
+	ErrorCodeAppRateLimit       = 4
+	ErrorCodeAccessTokenInvalid = 190
+	ErrorCodeAccountRateLimit   = 80007
+	ErrorCodeRateLimit          = 130429
+	ErrorCodeTemporary          = 131000
+	ErrorCodeSpamRateLimit      = 131056
+	ErrorCodeUndeliverable      = 131026
+	ErrorCodeWindowClosed       = 131047
+	ErrorCodeInvalidParameter   = 100
+	ErrorCodeTemplateNotFound   = 132001
+)
+
+// APIError es un error devuelto por la Graph API.
+type APIError struct {
+	// StatusCode es el código HTTP de la respuesta.
+	StatusCode   int        `json:"-"`
+	Message      string     `json:"message"`
+	Type         string     `json:"type"`
+	Code         int        `json:"code"`
+	ErrorSubcode int        `json:"error_subcode,omitempty"`
+	ErrorData    *ErrorData `json:"error_data,omitempty"`
+	FBTraceID    string     `json:"fbtrace_id,omitempty"`
+}
+
+// Error implementa la interfaz error.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("error de la Graph API (HTTP %d, código %d): %s", e.StatusCode, e.Code, e.Message)
+	if e.ErrorData != nil && e.ErrorData.Details != "" {
+		msg += ": " + e.ErrorData.Details
+	}
+	return msg
+}
+
+// Temporary indica si el error es transitorio y la solicitud puede reintentarse: errores 5xx,
+// limitación por 429 o códigos de límite de rendimiento de la Cloud API, incluido el límite de envíos
+// a un mismo usuario (131056).
+func (e *APIError) Temporary() bool {
+	if e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	switch e.Code {
+	case ErrorCodeUnknown, ErrorCodeServiceUnavailable, ErrorCodeAppRateLimit, ErrorCodeAccountRateLimit,
+		ErrorCodeRateLimit, ErrorCodeSpamRateLimit, ErrorCodeTemporary:
+		return true
+	}
+	return false
+}
+
+// IsTemporary indica si err puede reintentarse. Además de los errores transitorios de la Graph API,
+// solo se consideran transitorios los fallos de red y los timeouts; la cancelación del contexto y
+// cualquier otro error no lo son.
+func IsTemporary(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.Temporary()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// decodeAPIError convierte el cuerpo de una respuesta fallida en *APIError. Si el cuerpo no tiene el
+// formato de la Graph API se conserva como mensaje.
+func decodeAPIError(statusCode int, body []byte) error {
+	var envelope struct {
+		Error *APIError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error == nil {
+		return &APIError{StatusCode: statusCode, Message: string(body)}
+	}
+	envelope.Error.StatusCode = statusCode
+	return envelope.Error
+}
+
+// AsAPIError devuelve el *APIError contenido en err, si lo hay.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsErrorCode indica si err es un error de la Graph API con el código indicado.
+func IsErrorCode(err error, code int) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.Code == code
+}
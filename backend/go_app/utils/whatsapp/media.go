@@ -0,0 +1,29 @@
+// chatbot/utils/whatsapp/media.go
+
+package whatsapp
+
+// MediaInfo es la respuesta del endpoint de multimedia de la Graph API.
+type MediaInfo struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+	FileSize int64  `json:"file_size"`
+}
+
+// MediaOf devuelve el archivo multimedia de un mensaje según su tipo, o nil si no tiene.
+func (m *Message) MediaOf() *Media {
+	switch m.Type {
+	case MessageTypeImage:
+		return m.Image
+	case MessageTypeAudio:
+		return m.Audio
+	case MessageTypeVideo:
+		return m.Video
+	case MessageTypeDocument:
+		return m.Document
+	case MessageTypeSticker:
+		return m.Sticker
+	}
+	return nil
+}
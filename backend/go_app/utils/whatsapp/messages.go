@@ -0,0 +1,264 @@
+// chatbot/utils/whatsapp/messages.go
+
+package whatsapp
+
+const messagingProduct = "whatsapp"
+
+// Tipos de mensajes interactivos salientes.
+const (
+	InteractiveTypeButton = "button"
+	InteractiveTypeList   = "list"
+	InteractiveTypeCTAURL = "cta_url"
+)
+
+// Tipo de mensaje saliente de plantilla; los demás tipos coinciden con los MessageType de los entrantes.
+const MessageTypeTemplate = "template"
+
+// OutboundMessage es el cuerpo de una solicitud de envío de mensaje de la Cloud API.
+// Se construye con los New*Message de este paquete.
+type OutboundMessage struct {
+	MessagingProduct string               `json:"messaging_product"`
+	RecipientType    string               `json:"recipient_type"`
+	To               string               `json:"to"`
+	Type             string               `json:"type"`
+	Context          *ReplyTo             `json:"context,omitempty"`
+	Text             *OutboundText        `json:"text,omitempty"`
+	Interactive      *OutboundInteractive `json:"interactive,omitempty"`
+	Template         *Template            `json:"template,omitempty"`
+	Image            *OutboundMedia       `json:"image,omitempty"`
+	Audio            *OutboundMedia       `json:"audio,omitempty"`
+	Video            *OutboundMedia       `json:"video,omitempty"`
+	Document         *OutboundMedia       `json:"document,omitempty"`
+	Sticker          *OutboundMedia       `json:"sticker,omitempty"`
+	Location         *Location            `json:"location,omitempty"`
+	Reaction         *OutboundReaction    `json:"reaction,omitempty"`
+}
+
+// ReplyTo indica el mensaje al que responde un mensaje saliente.
+type ReplyTo struct {
+	MessageID string `json:"message_id"`
+}
+
+// OutboundText es el contenido de un mensaje de texto saliente.
+type OutboundText struct {
+	PreviewURL bool   `json:"preview_url"`
+	Body       string `json:"body"`
+}
+
+// OutboundInteractive es el contenido de un mensaje interactivo saliente.
+type OutboundInteractive struct {
+	Type   string             `json:"type"`
+	Header *InteractiveHeader `json:"header,omitempty"`
+	Body   *InteractiveText   `json:"body,omitempty"`
+	Footer *InteractiveText   `json:"footer,omitempty"`
+	Action InteractiveAction  `json:"action"`
+}
+
+// InteractiveHeader es el encabezado de texto de un mensaje interactivo.
+type InteractiveHeader struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// InteractiveText es un bloque de texto de un mensaje interactivo.
+type InteractiveText struct {
+	Text string `json:"text"`
+}
+
+// InteractiveAction contiene los botones, las secciones de la lista o el enlace de un mensaje interactivo.
+type InteractiveAction struct {
+	Buttons    []replyButton     `json:"buttons,omitempty"`
+	Button     string            `json:"button,omitempty"`
+	Sections   []ListSection     `json:"sections,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Parameters *CTAURLParameters `json:"parameters,omitempty"`
+}
+
+// ReplyButton es un botón de respuesta rápida.
+type ReplyButton struct {
+	ID    string
+	Title string
+}
+
+// replyButton es la representación de un ReplyButton en la Cloud API.
+type replyButton struct {
+	Type  string           `json:"type"`
+	Reply InteractiveReply `json:"reply"`
+}
+
+// ListSection es una sección de un mensaje de lista.
+type ListSection struct {
+	Title string    `json:"title,omitempty"`
+	Rows  []ListRow `json:"rows"`
+}
+
+// ListRow es una opción de un mensaje de lista.
+type ListRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// CTAURLParameters es el botón con enlace de un mensaje interactivo cta_url.
+type CTAURLParameters struct {
+	DisplayText string `json:"display_text"`
+	URL         string `json:"url"`
+}
+
+// Template es una plantilla aprobada con sus parámetros.
+type Template struct {
+	Name       string              `json:"name"`
+	Language   TemplateLanguage    `json:"language"`
+	Components []TemplateComponent `json:"components,omitempty"`
+}
+
+// TemplateLanguage es el idioma de una plantilla, por ejemplo "es" o "es_PE".
+type TemplateLanguage struct {
+	Code string `json:"code"`
+}
+
+// TemplateComponent son los parámetros de una parte de la plantilla (header, body o button).
+type TemplateComponent struct {
+	Type       string              `json:"type"`
+	SubType    string              `json:"sub_type,omitempty"`
+	Index      string              `json:"index,omitempty"`
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+}
+
+// TemplateParameter es un valor de una variable de la plantilla.
+type TemplateParameter struct {
+	Type    string         `json:"type"`
+	Text    string         `json:"text,omitempty"`
+	Payload string         `json:"payload,omitempty"`
+	Image   *OutboundMedia `json:"image,omitempty"`
+}
+
+// OutboundMedia es un archivo multimedia saliente, referenciado por id de multimedia subida o por enlace.
+type OutboundMedia struct {
+	ID       string `json:"id,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// OutboundReaction es una reacción saliente. A diferencia de Reaction, el emoji se envía aunque esté vacío.
+type OutboundReaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// readReceipt es el cuerpo de la solicitud que marca un mensaje como leído.
+type readReceipt struct {
+	MessagingProduct string           `json:"messaging_product"`
+	Status           string           `json:"status"`
+	MessageID        string           `json:"message_id"`
+	TypingIndicator  *typingIndicator `json:"typing_indicator,omitempty"`
+}
+
+// typingIndicator muestra al usuario que el negocio está escribiendo.
+type typingIndicator struct {
+	Type string `json:"type"`
+}
+
+// newMessage crea un mensaje individual del tipo indicado.
+func newMessage(to, messageType string) *OutboundMessage {
+	return &OutboundMessage{MessagingProduct: messagingProduct, RecipientType: "individual", To: to, Type: messageType}
+}
+
+// NewTextMessage crea un mensaje de texto sin vista previa de enlaces.
+func NewTextMessage(to, body string) *OutboundMessage {
+	message := newMessage(to, MessageTypeText)
+	message.Text = &OutboundText{Body: body}
+	return message
+}
+
+// NewButtonsMessage crea un mensaje interactivo con hasta tres botones de respuesta rápida.
+func NewButtonsMessage(to, body string, buttons []ReplyButton) *OutboundMessage {
+	action := InteractiveAction{Buttons: make([]replyButton, len(buttons))}
+	for i, button := range buttons {
+		action.Buttons[i] = replyButton{Type: "reply", Reply: InteractiveReply{ID: button.ID, Title: button.Title}}
+	}
+
+	message := newMessage(to, MessageTypeInteractive)
+	message.Interactive = &OutboundInteractive{Type: InteractiveTypeButton, Body: &InteractiveText{Text: body}, Action: action}
+	return message
+}
+
+// NewListMessage crea un mensaje de lista; buttonText es el texto del botón que despliega las opciones.
+func NewListMessage(to, body, buttonText string, sections []ListSection) *OutboundMessage {
+	message := newMessage(to, MessageTypeInteractive)
+	message.Interactive = &OutboundInteractive{
+		Type:   InteractiveTypeList,
+		Body:   &InteractiveText{Text: body},
+		Action: InteractiveAction{Button: buttonText, Sections: sections},
+	}
+	return message
+}
+
+// NewCTAURLMessage crea un mensaje interactivo con un botón que abre una URL.
+func NewCTAURLMessage(to, body, displayText, url string) *OutboundMessage {
+	message := newMessage(to, MessageTypeInteractive)
+	message.Interactive = &OutboundInteractive{
+		Type: InteractiveTypeCTAURL,
+		Body: &InteractiveText{Text: body},
+		Action: InteractiveAction{
+			Name:       InteractiveTypeCTAURL,
+			Parameters: &CTAURLParameters{DisplayText: displayText, URL: url},
+		},
+	}
+	return message
+}
+
+// NewTemplateMessage crea un mensaje de plantilla aprobada en el idioma indicado.
+func NewTemplateMessage(to, name, languageCode string, components ...TemplateComponent) *OutboundMessage {
+	message := newMessage(to, MessageTypeTemplate)
+	message.Template = &Template{Name: name, Language: TemplateLanguage{Code: languageCode}, Components: components}
+	return message
+}
+
+// NewMediaMessage crea un mensaje multimedia; mediaType es uno de image, audio, video, document o sticker.
+func NewMediaMessage(to, mediaType string, media OutboundMedia) *OutboundMessage {
+	message := newMessage(to, mediaType)
+	switch mediaType {
+	case MessageTypeImage:
+		message.Image = &media
+	case MessageTypeAudio:
+		message.Audio = &media
+	case MessageTypeVideo:
+		message.Video = &media
+	case MessageTypeDocument:
+		message.Document = &media
+	case MessageTypeSticker:
+		message.Sticker = &media
+	}
+	return message
+}
+
+// HasCaption indica si la Cloud API admite texto en los mensajes multimedia de tipo mediaType. Los
+// audios y stickers no lo admiten.
+func HasCaption(mediaType string) bool {
+	return mediaType == MessageTypeImage || mediaType == MessageTypeVideo || mediaType == MessageTypeDocument
+}
+
+// NewLocationMessage crea un mensaje con una ubicación.
+func NewLocationMessage(to string, location Location) *OutboundMessage {
+	message := newMessage(to, MessageTypeLocation)
+	message.Location = &location
+	return message
+}
+
+// NewReactionMessage crea una reacción a un mensaje. Un emoji vacío quita la reacción.
+func NewReactionMessage(to, messageID, emoji string) *OutboundMessage {
+	message := newMessage(to, MessageTypeReaction)
+	message.Reaction = &OutboundReaction{MessageID: messageID, Emoji: emoji}
+	return message
+}
+
+// NewBodyParameters crea el componente body de una plantilla con parámetros de texto.
+func NewBodyParameters(values ...string) TemplateComponent {
+	component := TemplateComponent{Type: "body", Parameters: make([]TemplateParameter, len(values))}
+	for i, value := range values {
+		component.Parameters[i] = TemplateParameter{Type: "text", Text: value}
+	}
+	return component
+}
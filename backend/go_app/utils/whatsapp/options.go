@@ -0,0 +1,112 @@
+// chatbot/utils/whatsapp/options.go
+
+package whatsapp
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Límites de la Cloud API para botones y listas.
+const (
+	MaxReplyButtons      = 3
+	MaxButtonTitleLength = 20
+	MaxListRows          = 10
+	MaxRowTitleLength    = 24
+	MaxRowDescriptionLen = 72
+)
+
+// Textos de los mensajes de lista y de la alternativa numerada.
+const (
+	listButtonText     = "Ver opciones"
+	listSectionTitle   = "Opciones"
+	numberedOptionHint = "Responde con el número de tu opción."
+)
+
+// Option es una opción que se ofrece al usuario para que elija.
+type Option struct {
+	ID          string
+	Title       string
+	Description string
+}
+
+// NewOptionsMessage elige el formato adecuado para ofrecer las opciones: botones de respuesta rápida
+// si son hasta tres con títulos cortos, un mensaje de lista si son hasta diez y un texto numerado si
+// son más; sin opciones envía solo el texto. En las listas los títulos largos se recortan y el texto
+// completo va en la descripción. El usuario responde con el id de la opción o, en el texto numerado, con su número.
+func NewOptionsMessage(to, body string, options []Option) *OutboundMessage {
+	switch {
+	case len(options) == 0:
+		return NewTextMessage(to, body)
+	case len(options) <= MaxReplyButtons && fitButtons(options):
+		buttons := make([]ReplyButton, len(options))
+		for i, option := range options {
+			buttons[i] = ReplyButton{ID: option.ID, Title: option.Title}
+		}
+		return NewButtonsMessage(to, body, buttons)
+	default:
+		return NewListOptionsMessage(to, body, options)
+	}
+}
+
+// NewListOptionsMessage ofrece las opciones en un mensaje de lista aunque quepan en botones, o en un
+// texto numerado si son más de las que admite una lista.
+func NewListOptionsMessage(to, body string, options []Option) *OutboundMessage {
+	if len(options) > MaxListRows {
+		return NewTextMessage(to, NumberedOptionsText(body, options))
+	}
+	rows := make([]ListRow, len(options))
+	for i, option := range options {
+		rows[i] = listRow(option)
+	}
+	return NewListMessage(to, body, listButtonText, []ListSection{{Title: listSectionTitle, Rows: rows}})
+}
+
+// NumberedOptionsText genera el texto de la alternativa numerada para ofrecer las opciones.
+func NumberedOptionsText(body string, options []Option) string {
+	var b strings.Builder
+	b.WriteString(body)
+	b.WriteString("\n")
+	for i, option := range options {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, option.Title)
+		if option.Description != "" {
+			b.WriteString(" - " + option.Description)
+		}
+	}
+	b.WriteString("\n\n" + numberedOptionHint)
+	return b.String()
+}
+
+// fitButtons indica si todos los títulos caben en un botón de respuesta rápida.
+func fitButtons(options []Option) bool {
+	for _, option := range options {
+		if option.Title == "" || utf8.RuneCountInString(option.Title) > MaxButtonTitleLength {
+			return false
+		}
+	}
+	return true
+}
+
+// listRow convierte una opción en una fila de lista, recortando el título y usando el título completo
+// como descripción si no tiene una.
+func listRow(option Option) ListRow {
+	row := ListRow{ID: option.ID, Title: option.Title, Description: option.Description}
+	if utf8.RuneCountInString(option.Title) > MaxRowTitleLength {
+		row.Title = Truncate(option.Title, MaxRowTitleLength)
+		if row.Description == "" {
+			row.Description = option.Title
+		}
+	}
+	row.Description = Truncate(row.Description, MaxRowDescriptionLen)
+	return row
+}
+
+// Truncate recorta s a max caracteres como máximo, terminando en "…" si se recortó.
+func Truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
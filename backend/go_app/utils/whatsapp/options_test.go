@@ -0,0 +1,127 @@
+package whatsapp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// testOptions crea n opciones con ids y títulos numerados.
+func testOptions(n int) []Option {
+	options := make([]Option, n)
+	for i := range options {
+		options[i] = Option{ID: fmt.Sprintf("button_%d", i+1), Title: fmt.Sprintf("Opción %d", i+1)}
+	}
+	return options
+}
+
+func TestNewOptionsMessage(t *testing.T) {
+	longTitle := strings.Repeat("a", MaxButtonTitleLength+1)
+	tests := []struct {
+		name     string
+		options  []Option
+		wantType string
+		wantRows int
+	}{
+		{name: "sin opciones", options: nil, wantType: MessageTypeText},
+		{name: "una opción", options: testOptions(1), wantType: InteractiveTypeButton},
+		{name: "máximo de botones", options: testOptions(MaxReplyButtons), wantType: InteractiveTypeButton},
+		{name: "título de botón al límite", options: []Option{{ID: "a", Title: strings.Repeat("á", MaxButtonTitleLength)}}, wantType: InteractiveTypeButton},
+		{name: "título demasiado largo para un botón", options: []Option{{ID: "a", Title: longTitle}}, wantType: InteractiveTypeList, wantRows: 1},
+		{name: "título vacío", options: []Option{{ID: "a"}}, wantType: InteractiveTypeList, wantRows: 1},
+		{name: "más opciones que botones", options: testOptions(MaxReplyButtons + 1), wantType: InteractiveTypeList, wantRows: MaxReplyButtons + 1},
+		{name: "máximo de filas", options: testOptions(MaxListRows), wantType: InteractiveTypeList, wantRows: MaxListRows},
+		{name: "más opciones que filas", options: testOptions(MaxListRows + 1), wantType: MessageTypeText},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := NewOptionsMessage("5491100000000", "¿Qué prefieres?", tt.options)
+
+			messageType := message.Type
+			if message.Interactive != nil {
+				messageType = message.Interactive.Type
+			}
+			if messageType != tt.wantType {
+				t.Fatalf("tipo = %q, se esperaba %q", messageType, tt.wantType)
+			}
+
+			switch tt.wantType {
+			case InteractiveTypeButton:
+				buttons := message.Interactive.Action.Buttons
+				if len(buttons) != len(tt.options) {
+					t.Fatalf("%d botones, se esperaban %d", len(buttons), len(tt.options))
+				}
+				for i, button := range buttons {
+					if button.Reply.ID != tt.options[i].ID || button.Reply.Title != tt.options[i].Title {
+						t.Errorf("botón %d = %+v, se esperaba %+v", i, button.Reply, tt.options[i])
+					}
+				}
+			case InteractiveTypeList:
+				sections := message.Interactive.Action.Sections
+				if len(sections) != 1 || len(sections[0].Rows) != tt.wantRows {
+					t.Fatalf("secciones = %+v, se esperaba una con %d filas", sections, tt.wantRows)
+				}
+				for _, row := range sections[0].Rows {
+					if utf8.RuneCountInString(row.Title) > MaxRowTitleLength || utf8.RuneCountInString(row.Description) > MaxRowDescriptionLen {
+						t.Errorf("fila que excede los límites: %+v", row)
+					}
+				}
+			case MessageTypeText:
+				if len(tt.options) > 0 && !strings.Contains(message.Text.Body, numberedOptionHint) {
+					t.Errorf("el texto no tiene la alternativa numerada: %q", message.Text.Body)
+				}
+				if len(tt.options) == 0 && message.Text.Body != "¿Qué prefieres?" {
+					t.Errorf("texto = %q, se esperaba solo el cuerpo", message.Text.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestListRow(t *testing.T) {
+	longTitle := strings.Repeat("b", MaxRowTitleLength+6)
+	tests := []struct {
+		name   string
+		option Option
+		want   ListRow
+	}{
+		{
+			name:   "título corto",
+			option: Option{ID: "1", Title: "Envíos", Description: "Plazos y costos"},
+			want:   ListRow{ID: "1", Title: "Envíos", Description: "Plazos y costos"},
+		},
+		{
+			name:   "título largo sin descripción",
+			option: Option{ID: "2", Title: longTitle},
+			want:   ListRow{ID: "2", Title: strings.Repeat("b", MaxRowTitleLength-1) + "…", Description: longTitle},
+		},
+		{
+			name:   "título largo con descripción",
+			option: Option{ID: "3", Title: longTitle, Description: "Detalle"},
+			want:   ListRow{ID: "3", Title: strings.Repeat("b", MaxRowTitleLength-1) + "…", Description: "Detalle"},
+		},
+		{
+			name:   "descripción larga",
+			option: Option{ID: "4", Title: "Pagos", Description: strings.Repeat("c", MaxRowDescriptionLen+1)},
+			want:   ListRow{ID: "4", Title: "Pagos", Description: strings.Repeat("c", MaxRowDescriptionLen-1) + "…"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listRow(tt.option); got != tt.want {
+				t.Errorf("listRow() = %+v, se esperaba %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberedOptionsText(t *testing.T) {
+	options := []Option{{Title: "Envíos"}, {Title: "Pagos", Description: "Tarjetas y transferencias"}}
+	want := "¿Qué prefieres?\n\n1. Envíos\n2. Pagos - Tarjetas y transferencias\n\n" + numberedOptionHint
+	if got := NumberedOptionsText("¿Qué prefieres?", options); got != want {
+		t.Errorf("NumberedOptionsText() = %q, se esperaba %q", got, want)
+	}
+}
@@ -0,0 +1,428 @@
+// chatbot/utils/whatsapp/webhook.go
+
+package whatsapp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ObjectWhatsAppBusinessAccount es el valor del campo "object" en los webhooks de la Cloud API.
+const ObjectWhatsAppBusinessAccount = "whatsapp_business_account"
+
+// Tipos de mensajes entrantes soportados por la Cloud API.
+const (
+	MessageTypeText        = "text"
+	MessageTypeImage       = "image"
+	MessageTypeAudio       = "audio"
+	MessageTypeVideo       = "video"
+	MessageTypeDocument    = "document"
+	MessageTypeSticker     = "sticker"
+	MessageTypeLocation    = "location"
+	MessageTypeContacts    = "contacts"
+	MessageTypeInteractive = "interactive"
+	MessageTypeButton      = "button"
+	MessageTypeReaction    = "reaction"
+	MessageTypeUnsupported = "unsupported"
+)
+
+// Errores devueltos por DecodeWebhook.
+var (
+	ErrEmptyBody      = errors.New("cuerpo del webhook vacío")
+	ErrInvalidJSON    = errors.New("JSON del webhook inválido")
+	ErrNotWhatsApp    = errors.New("el evento no pertenece a la API de WhatsApp")
+	ErrNoEntries      = errors.New("el webhook no contiene entradas")
+	ErrMissingSender  = errors.New("el mensaje no tiene remitente")
+	ErrMissingContent = errors.New("el mensaje no tiene contenido para su tipo")
+)
+
+// WebhookPayload representa el sobre completo de un webhook de la Cloud API de WhatsApp.
+type WebhookPayload struct {
+	Object string  `json:"object"`
+	Entry  []Entry `json:"entry"`
+}
+
+// Entry representa una cuenta de WhatsApp Business dentro del webhook.
+type Entry struct {
+	ID      string   `json:"id"`
+	Changes []Change `json:"changes"`
+}
+
+// Change representa un cambio notificado para un campo suscrito.
+type Change struct {
+	Field string `json:"field"`
+	Value Value  `json:"value"`
+}
+
+// Value contiene los mensajes, estados y errores de un cambio.
+type Value struct {
+	MessagingProduct string    `json:"messaging_product"`
+	Metadata         Metadata  `json:"metadata"`
+	Contacts         []Contact `json:"contacts,omitempty"`
+	Messages         []Message `json:"messages,omitempty"`
+	Statuses         []Status  `json:"statuses,omitempty"`
+	Errors           []Error   `json:"errors,omitempty"`
+}
+
+// Metadata identifica el número de negocio que recibió el evento.
+type Metadata struct {
+	DisplayPhoneNumber string `json:"display_phone_number"`
+	PhoneNumberID      string `json:"phone_number_id"`
+}
+
+// Contact representa el perfil del usuario que envía el mensaje.
+type Contact struct {
+	WaID    string  `json:"wa_id"`
+	Profile Profile `json:"profile"`
+}
+
+// Profile contiene el nombre público del usuario.
+type Profile struct {
+	Name string `json:"name"`
+}
+
+// Message representa un mensaje entrante de cualquier tipo.
+type Message struct {
+	From        string          `json:"from"`
+	ID          string          `json:"id"`
+	Timestamp   string          `json:"timestamp"`
+	Type        string          `json:"type"`
+	Context     *MessageContext `json:"context,omitempty"`
+	Text        *Text           `json:"text,omitempty"`
+	Image       *Media          `json:"image,omitempty"`
+	Audio       *Media          `json:"audio,omitempty"`
+	Video       *Media          `json:"video,omitempty"`
+	Document    *Media          `json:"document,omitempty"`
+	Sticker     *Media          `json:"sticker,omitempty"`
+	Location    *Location       `json:"location,omitempty"`
+	Contacts    []SharedContact `json:"contacts,omitempty"`
+	Interactive *Interactive    `json:"interactive,omitempty"`
+	Button      *Button         `json:"button,omitempty"`
+	Reaction    *Reaction       `json:"reaction,omitempty"`
+	Errors      []Error         `json:"errors,omitempty"`
+}
+
+// MessageContext indica el mensaje al que responde el usuario.
+type MessageContext struct {
+	From string `json:"from"`
+	ID   string `json:"id"`
+}
+
+// Text contiene el cuerpo de un mensaje de texto.
+type Text struct {
+	Body string `json:"body"`
+}
+
+// Media describe un archivo multimedia (imagen, audio, video, documento o sticker).
+type Media struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Voice    bool   `json:"voice,omitempty"`
+	Animated bool   `json:"animated,omitempty"`
+}
+
+// Location describe una ubicación compartida por el usuario.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	URL       string  `json:"url,omitempty"`
+}
+
+// SharedContact describe una tarjeta de contacto compartida por el usuario.
+type SharedContact struct {
+	Name   ContactName    `json:"name"`
+	Phones []ContactPhone `json:"phones,omitempty"`
+	Emails []ContactEmail `json:"emails,omitempty"`
+	Org    *ContactOrg    `json:"org,omitempty"`
+}
+
+// ContactName contiene el nombre de una tarjeta de contacto.
+type ContactName struct {
+	FormattedName string `json:"formatted_name"`
+	FirstName     string `json:"first_name,omitempty"`
+	LastName      string `json:"last_name,omitempty"`
+}
+
+// ContactPhone contiene un teléfono de una tarjeta de contacto.
+type ContactPhone struct {
+	Phone string `json:"phone"`
+	WaID  string `json:"wa_id,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// ContactEmail contiene un correo de una tarjeta de contacto.
+type ContactEmail struct {
+	Email string `json:"email"`
+	Type  string `json:"type,omitempty"`
+}
+
+// ContactOrg contiene la organización de una tarjeta de contacto.
+type ContactOrg struct {
+	Company    string `json:"company,omitempty"`
+	Department string `json:"department,omitempty"`
+	Title      string `json:"title,omitempty"`
+}
+
+// Interactive contiene la respuesta del usuario a un mensaje interactivo.
+type Interactive struct {
+	Type        string            `json:"type"`
+	ButtonReply *InteractiveReply `json:"button_reply,omitempty"`
+	ListReply   *InteractiveReply `json:"list_reply,omitempty"`
+}
+
+// InteractiveReply representa la opción elegida en un botón o lista.
+type InteractiveReply struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// Button representa la respuesta a un botón de una plantilla.
+type Button struct {
+	Payload string `json:"payload"`
+	Text    string `json:"text"`
+}
+
+// Reaction representa una reacción con emoji a un mensaje.
+type Reaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji,omitempty"`
+}
+
+// Status representa una actualización de estado de un mensaje saliente.
+type Status struct {
+	ID           string        `json:"id"`
+	Status       string        `json:"status"`
+	Timestamp    string        `json:"timestamp"`
+	RecipientID  string        `json:"recipient_id"`
+	Conversation *Conversation `json:"conversation,omitempty"`
+	Pricing      *Pricing      `json:"pricing,omitempty"`
+	Errors       []Error       `json:"errors,omitempty"`
+}
+
+// Conversation describe la conversación facturable asociada a un estado.
+type Conversation struct {
+	ID                  string             `json:"id"`
+	ExpirationTimestamp string             `json:"expiration_timestamp,omitempty"`
+	Origin              ConversationOrigin `json:"origin"`
+}
+
+// ConversationOrigin indica la categoría que abrió la conversación.
+type ConversationOrigin struct {
+	Type string `json:"type"`
+}
+
+// Pricing describe la tarifa aplicada a un mensaje.
+type Pricing struct {
+	Billable     bool   `json:"billable"`
+	PricingModel string `json:"pricing_model"`
+	Category     string `json:"category"`
+}
+
+// Error representa un error reportado por la Cloud API dentro del webhook.
+type Error struct {
+	Code      int        `json:"code"`
+	Title     string     `json:"title"`
+	Message   string     `json:"message,omitempty"`
+	ErrorData *ErrorData `json:"error_data,omitempty"`
+	Href      string     `json:"href,omitempty"`
+}
+
+// ErrorData contiene el detalle de un error de la Cloud API.
+type ErrorData struct {
+	Details string `json:"details"`
+}
+
+// DecodeWebhook deserializa y valida el cuerpo de un webhook de la Cloud API.
+func DecodeWebhook(body []byte) (*WebhookPayload, error) {
+	if len(body) == 0 {
+		return nil, ErrEmptyBody
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	if payload.Object != ObjectWhatsAppBusinessAccount {
+		return nil, fmt.Errorf("%w: object=%q", ErrNotWhatsApp, payload.Object)
+	}
+
+	if len(payload.Entry) == 0 {
+		return nil, ErrNoEntries
+	}
+
+	return &payload, nil
+}
+
+// HasMessages indica si algún cambio del webhook contiene mensajes entrantes.
+func (p *WebhookPayload) HasMessages() bool {
+	for _, entry := range p.Entry {
+		for _, change := range entry.Changes {
+			if len(change.Value.Messages) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasStatuses indica si algún cambio del webhook contiene actualizaciones de estado.
+func (p *WebhookPayload) HasStatuses() bool {
+	for _, entry := range p.Entry {
+		for _, change := range entry.Changes {
+			if len(change.Value.Statuses) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InboundMessage agrupa un mensaje entrante con el contexto del cambio que lo contenía.
+type InboundMessage struct {
+	EntryID  string
+	Metadata Metadata
+	Contact  *Contact
+	Message  Message
+}
+
+// Statuses recorre todas las entradas y cambios del webhook y devuelve cada actualización de estado
+// en el orden en que fue entregada.
+func (p *WebhookPayload) Statuses() []Status {
+	var statuses []Status
+	for _, entry := range p.Entry {
+		for _, change := range entry.Changes {
+			statuses = append(statuses, change.Value.Statuses...)
+		}
+	}
+	return statuses
+}
+
+// Time convierte la marca de tiempo Unix del estado. Devuelve la hora actual si no es válida.
+func (s *Status) Time() time.Time {
+	seconds, err := strconv.ParseInt(s.Timestamp, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(seconds, 0)
+}
+
+// Messages recorre todas las entradas y cambios del webhook y devuelve cada mensaje entrante
+// en el orden en que fue entregado.
+func (p *WebhookPayload) Messages() []InboundMessage {
+	var inbound []InboundMessage
+	for _, entry := range p.Entry {
+		for _, change := range entry.Changes {
+			value := change.Value
+			for _, message := range value.Messages {
+				inbound = append(inbound, InboundMessage{
+					EntryID:  entry.ID,
+					Metadata: value.Metadata,
+					Contact:  value.ContactFor(message.From),
+					Message:  message,
+				})
+			}
+		}
+	}
+	return inbound
+}
+
+// Phone devuelve el wa_id del remitente, priorizando el del contacto.
+func (m *InboundMessage) Phone() string {
+	if m.Contact != nil && m.Contact.WaID != "" {
+		return m.Contact.WaID
+	}
+	return m.Message.From
+}
+
+// Name devuelve el nombre de perfil del remitente, o su teléfono si no hay perfil.
+func (m *InboundMessage) Name() string {
+	if name := m.Contact.SenderName(); name != "" {
+		return name
+	}
+	return m.Phone()
+}
+
+// ContactFor busca el contacto correspondiente a un wa_id. Devuelve nil si no existe.
+func (v *Value) ContactFor(waID string) *Contact {
+	for i := range v.Contacts {
+		if v.Contacts[i].WaID == waID {
+			return &v.Contacts[i]
+		}
+	}
+	if len(v.Contacts) == 1 {
+		return &v.Contacts[0]
+	}
+	return nil
+}
+
+// TextBody devuelve el texto del mensaje, o una cadena vacía si no es de tipo texto.
+func (m *Message) TextBody() string {
+	if m.Type != MessageTypeText || m.Text == nil {
+		return ""
+	}
+	return m.Text.Body
+}
+
+// Validate comprueba que el mensaje tenga remitente y el contenido que exige su tipo.
+func (m *Message) Validate() error {
+	if m.From == "" {
+		return ErrMissingSender
+	}
+
+	var present bool
+	switch m.Type {
+	case MessageTypeText:
+		present = m.Text != nil
+	case MessageTypeImage:
+		present = m.Image != nil
+	case MessageTypeAudio:
+		present = m.Audio != nil
+	case MessageTypeVideo:
+		present = m.Video != nil
+	case MessageTypeDocument:
+		present = m.Document != nil
+	case MessageTypeSticker:
+		present = m.Sticker != nil
+	case MessageTypeLocation:
+		present = m.Location != nil
+	case MessageTypeContacts:
+		present = len(m.Contacts) > 0
+	case MessageTypeInteractive:
+		present = m.Interactive != nil
+	case MessageTypeButton:
+		present = m.Button != nil
+	case MessageTypeReaction:
+		present = m.Reaction != nil
+	default:
+		present = true
+	}
+
+	if !present {
+		return fmt.Errorf("%w: type=%q id=%s", ErrMissingContent, m.Type, m.ID)
+	}
+	return nil
+}
+
+// IsInvalidMessage indica si err proviene de Validate: el mensaje está mal formado y ningún reintento
+// puede corregirlo.
+func IsInvalidMessage(err error) bool {
+	return errors.Is(err, ErrMissingSender) || errors.Is(err, ErrMissingContent)
+}
+
+// SenderName devuelve el nombre del perfil del contacto, o una cadena vacía si no hay contacto.
+func (c *Contact) SenderName() string {
+	if c == nil {
+		return ""
+	}
+	return c.Profile.Name
+}
@@ -0,0 +1,200 @@
+package whatsapp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// multiEntryPayload es una entrega con dos entradas, varios cambios y varios mensajes, como las que Meta
+// agrupa en un solo POST.
+const multiEntryPayload = `{
+  "object": "whatsapp_business_account",
+  "entry": [
+    {
+      "id": "102290129340398",
+      "changes": [
+        {
+          "field": "messages",
+          "value": {
+            "messaging_product": "whatsapp",
+            "metadata": {"display_phone_number": "15550783881", "phone_number_id": "106540352242922"},
+            "contacts": [
+              {"profile": {"name": "Ana"}, "wa_id": "5491100000001"},
+              {"profile": {"name": "Luis"}, "wa_id": "5491100000002"}
+            ],
+            "messages": [
+              {"from": "5491100000001", "id": "wamid.A1", "timestamp": "1700000000", "type": "text", "text": {"body": "hola"}},
+              {"from": "5491100000002", "id": "wamid.B1", "timestamp": "1700000001", "type": "text", "text": {"body": "buenas"}}
+            ]
+          }
+        },
+        {
+          "field": "messages",
+          "value": {
+            "messaging_product": "whatsapp",
+            "metadata": {"display_phone_number": "15550783881", "phone_number_id": "106540352242922"},
+            "statuses": [{"id": "wamid.OUT1", "status": "delivered", "timestamp": "1700000002", "recipient_id": "5491100000001"}]
+          }
+        }
+      ]
+    },
+    {
+      "id": "102290129340399",
+      "changes": [
+        {
+          "field": "messages",
+          "value": {
+            "messaging_product": "whatsapp",
+            "metadata": {"display_phone_number": "15550783882", "phone_number_id": "106540352242923"},
+            "contacts": [{"profile": {"name": "Ana"}, "wa_id": "5491100000001"}],
+            "messages": [
+              {"from": "5491100000001", "id": "wamid.A2", "timestamp": "1700000003", "type": "text", "text": {"body": "¿precio?"}}
+            ]
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+func TestWebhookPayloadMessages(t *testing.T) {
+	payload, err := DecodeWebhook([]byte(multiEntryPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct{ EntryID, PhoneNumberID, Phone, Name, ID, Text string }
+	var got []summary
+	for _, inbound := range payload.Messages() {
+		got = append(got, summary{
+			EntryID:       inbound.EntryID,
+			PhoneNumberID: inbound.Metadata.PhoneNumberID,
+			Phone:         inbound.Phone(),
+			Name:          inbound.Name(),
+			ID:            inbound.Message.ID,
+			Text:          inbound.Message.TextBody(),
+		})
+	}
+	want := []summary{
+		{EntryID: "102290129340398", PhoneNumberID: "106540352242922", Phone: "5491100000001", Name: "Ana", ID: "wamid.A1", Text: "hola"},
+		{EntryID: "102290129340398", PhoneNumberID: "106540352242922", Phone: "5491100000002", Name: "Luis", ID: "wamid.B1", Text: "buenas"},
+		{EntryID: "102290129340399", PhoneNumberID: "106540352242923", Phone: "5491100000001", Name: "Ana", ID: "wamid.A2", Text: "¿precio?"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Messages() = %+v\nse esperaba %+v", got, want)
+	}
+
+	statuses := payload.Statuses()
+	if len(statuses) != 1 || statuses[0].ID != "wamid.OUT1" || statuses[0].Status != "delivered" {
+		t.Errorf("Statuses() = %+v", statuses)
+	}
+}
+
+func TestDecodeWebhook(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantErr      error
+		wantMessages int
+		wantStatuses int
+		wantType     string
+	}{
+		{
+			name: "mensaje de texto",
+			body: `{"object":"whatsapp_business_account","entry":[{"id":"102290129340398","changes":[{"field":"messages","value":{
+				"messaging_product":"whatsapp","metadata":{"display_phone_number":"15550783881","phone_number_id":"106540352242922"},
+				"contacts":[{"profile":{"name":"Ana"},"wa_id":"5491100000001"}],
+				"messages":[{"from":"5491100000001","id":"wamid.HBgLNTQ5MTEwMDAwMDAxFQIAEhgUM0E","timestamp":"1700000000","type":"text","text":{"body":"hola"}}]}}]}]}`,
+			wantMessages: 1,
+			wantType:     MessageTypeText,
+		},
+		{
+			name: "respuesta interactiva",
+			body: `{"object":"whatsapp_business_account","entry":[{"id":"102290129340398","changes":[{"field":"messages","value":{
+				"messaging_product":"whatsapp","metadata":{"display_phone_number":"15550783881","phone_number_id":"106540352242922"},
+				"contacts":[{"profile":{"name":"Ana"},"wa_id":"5491100000001"}],
+				"messages":[{"context":{"from":"15550783881","id":"wamid.OUT1"},"from":"5491100000001","id":"wamid.IN2","timestamp":"1700000001",
+				"type":"interactive","interactive":{"type":"button_reply","button_reply":{"id":"button_1","title":"Sí"}}}]}}]}]}`,
+			wantMessages: 1,
+			wantType:     MessageTypeInteractive,
+		},
+		{
+			name: "solo estados",
+			body: `{"object":"whatsapp_business_account","entry":[{"id":"102290129340398","changes":[{"field":"messages","value":{
+				"messaging_product":"whatsapp","metadata":{"display_phone_number":"15550783881","phone_number_id":"106540352242922"},
+				"statuses":[{"id":"wamid.OUT1","status":"sent","timestamp":"1700000002","recipient_id":"5491100000001",
+				"conversation":{"id":"c1","origin":{"type":"service"}},"pricing":{"billable":true,"pricing_model":"CBP","category":"service"}},
+				{"id":"wamid.OUT1","status":"delivered","timestamp":"1700000003","recipient_id":"5491100000001"}]}}]}]}`,
+			wantStatuses: 2,
+		},
+		{name: "varias entradas", body: multiEntryPayload, wantMessages: 3, wantStatuses: 1, wantType: MessageTypeText},
+		{name: "cuerpo vacío", body: ``, wantErr: ErrEmptyBody},
+		{name: "JSON mal formado", body: `{"object":"whatsapp_business_account","entry":[`, wantErr: ErrInvalidJSON},
+		{name: "tipos incorrectos", body: `{"object":"whatsapp_business_account","entry":{"id":1}}`, wantErr: ErrInvalidJSON},
+		{name: "otro objeto", body: `{"object":"instagram","entry":[{"id":"1"}]}`, wantErr: ErrNotWhatsApp},
+		{name: "sin entradas", body: `{"object":"whatsapp_business_account","entry":[]}`, wantErr: ErrNoEntries},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := DecodeWebhook([]byte(tt.body))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DecodeWebhook() error = %v, se esperaba %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeWebhook() error = %v", err)
+			}
+
+			messages := payload.Messages()
+			if len(messages) != tt.wantMessages || len(payload.Statuses()) != tt.wantStatuses {
+				t.Fatalf("mensajes = %d, estados = %d; se esperaban %d y %d", len(messages), len(payload.Statuses()), tt.wantMessages, tt.wantStatuses)
+			}
+			if payload.HasMessages() != (tt.wantMessages > 0) || payload.HasStatuses() != (tt.wantStatuses > 0) {
+				t.Errorf("HasMessages() = %v, HasStatuses() = %v", payload.HasMessages(), payload.HasStatuses())
+			}
+			for _, inbound := range messages {
+				if inbound.Message.Type != tt.wantType {
+					t.Errorf("tipo = %q, se esperaba %q", inbound.Message.Type, tt.wantType)
+				}
+				if err := inbound.Message.Validate(); err != nil {
+					t.Errorf("Validate() = %v para un mensaje válido", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		wantErr error
+	}{
+		{name: "texto", message: Message{From: "549", Type: MessageTypeText, Text: &Text{Body: "hola"}}},
+		{name: "imagen", message: Message{From: "549", Type: MessageTypeImage, Image: &Media{ID: "m1"}}},
+		{name: "ubicación", message: Message{From: "549", Type: MessageTypeLocation, Location: &Location{Latitude: -34.6, Longitude: -58.4}}},
+		{name: "contactos", message: Message{From: "549", Type: MessageTypeContacts, Contacts: []SharedContact{{Name: ContactName{FormattedName: "Ana"}}}}},
+		{name: "tipo no soportado", message: Message{From: "549", Type: MessageTypeUnsupported}},
+		{name: "sin remitente", message: Message{Type: MessageTypeText, Text: &Text{Body: "hola"}}, wantErr: ErrMissingSender},
+		{name: "texto sin cuerpo", message: Message{From: "549", Type: MessageTypeText}, wantErr: ErrMissingContent},
+		{name: "interactivo sin respuesta", message: Message{From: "549", Type: MessageTypeInteractive}, wantErr: ErrMissingContent},
+		{name: "contactos vacíos", message: Message{From: "549", Type: MessageTypeContacts}, wantErr: ErrMissingContent},
+		{name: "reacción sin datos", message: Message{From: "549", Type: MessageTypeReaction}, wantErr: ErrMissingContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.message.Validate()
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("Validate() = %v, se esperaba %v", err, tt.wantErr)
+			}
+			if IsInvalidMessage(err) != (tt.wantErr != nil) {
+				t.Errorf("IsInvalidMessage(%v) = %v", err, IsInvalidMessage(err))
+			}
+		})
+	}
+}
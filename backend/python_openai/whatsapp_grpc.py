@@ -30,6 +30,10 @@ class WhatsAppServiceBase(abc.ABC):
     async def GenerateResponseAnalizer(self, stream: 'grpclib.server.Stream[whatsapp_pb2.GenerateResponseAnalizerRequest, whatsapp_pb2.GenerateResponseAnalizerResponse]') -> None:
         pass
 
+    @abc.abstractmethod
+    async def GenerateResponseStream(self, stream: 'grpclib.server.Stream[whatsapp_pb2.GenerateResponseRequest, whatsapp_pb2.GenerateResponseChunk]') -> None:
+        pass
+
     def __mapping__(self) -> typing.Dict[str, grpclib.const.Handler]:
         return {
             '/whatsapp.WhatsAppService/CreateThread': grpclib.const.Handler(
@@ -56,6 +60,12 @@ class WhatsAppServiceBase(abc.ABC):
                 whatsapp_pb2.GenerateResponseAnalizerRequest,
                 whatsapp_pb2.GenerateResponseAnalizerResponse,
             ),
+            '/whatsapp.WhatsAppService/GenerateResponseStream': grpclib.const.Handler(
+                self.GenerateResponseStream,
+                grpclib.const.Cardinality.UNARY_STREAM,
+                whatsapp_pb2.GenerateResponseRequest,
+                whatsapp_pb2.GenerateResponseChunk,
+            ),
         }
 
 
@@ -86,3 +96,9 @@ class WhatsAppServiceStub:
             whatsapp_pb2.GenerateResponseAnalizerRequest,
             whatsapp_pb2.GenerateResponseAnalizerResponse,
         )
+        self.GenerateResponseStream = grpclib.client.UnaryStreamMethod(
+            channel,
+            '/whatsapp.WhatsAppService/GenerateResponseStream',
+            whatsapp_pb2.GenerateResponseRequest,
+            whatsapp_pb2.GenerateResponseChunk,
+        )
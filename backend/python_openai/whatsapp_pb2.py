@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x0ewhatsapp.proto\x12\x08whatsapp\"\x15\n\x13\x43reateThreadRequest\")\n\x14\x43reateThreadResponse\x12\x11\n\tthread_id\x18\x01 \x01(\t\"\x1d\n\x1b\x43reateThreadAnalizerRequest\":\n\x1c\x43reateThreadAnalizerResponse\x12\x1a\n\x12thread_id_analizer\x18\x01 \x01(\t\"Q\n\x17GenerateResponseRequest\x12\r\n\x05phone\x18\x01 \x01(\t\x12\x11\n\tthread_id\x18\x02 \x01(\t\x12\x14\n\x0cmessage_body\x18\x03 \x01(\t\",\n\x18GenerateResponseResponse\x12\x10\n\x08response\x18\x01 \x01(\t\"S\n\x1fGenerateResponseAnalizerRequest\x12\x1a\n\x12thread_id_analizer\x18\x01 \x01(\t\x12\x14\n\x0cmessage_body\x18\x02 \x01(\t\"4\n GenerateResponseAnalizerResponse\x12\x10\n\x08response\x18\x01 \x01(\t2\x95\x03\n\x0fWhatsAppService\x12M\n\x0c\x43reateThread\x12\x1d.whatsapp.CreateThreadRequest\x1a\x1e.whatsapp.CreateThreadResponse\x12\x65\n\x14\x43reateThreadAnalizer\x12%.whatsapp.CreateThreadAnalizerRequest\x1a&.whatsapp.CreateThreadAnalizerResponse\x12Y\n\x10GenerateResponse\x12!.whatsapp.GenerateResponseRequest\x1a\".whatsapp.GenerateResponseResponse\x12q\n\x18GenerateResponseAnalizer\x12).whatsapp.GenerateResponseAnalizerRequest\x1a*.whatsapp.GenerateResponseAnalizerResponseB\x15Z\x13\x63hatbot/utils/protob\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x0ewhatsapp.proto\x12\x08whatsapp\"\x15\n\x13\x43reateThreadRequest\")\n\x14\x43reateThreadResponse\x12\x11\n\tthread_id\x18\x01 \x01(\t\"\x1d\n\x1b\x43reateThreadAnalizerRequest\":\n\x1c\x43reateThreadAnalizerResponse\x12\x1a\n\x12thread_id_analizer\x18\x01 \x01(\t\"\x84\x01\n\x17GenerateResponseRequest\x12\r\n\x05phone\x18\x01 \x01(\t\x12\x11\n\tthread_id\x18\x02 \x01(\t\x12\x14\n\x0cmessage_body\x18\x03 \x01(\t\x12\x31\n\x0fselected_option\x18\x04 \x01(\x0b\x32\x18.whatsapp.SelectedOption\"=\n\x0eSelectedOption\x12\n\n\x02id\x18\x01 \x01(\t\x12\r\n\x05title\x18\x02 \x01(\t\x12\x10\n\x08question\x18\x03 \x01(\t\"=\n\x0bReplyOption\x12\n\n\x02id\x18\x01 \x01(\t\x12\r\n\x05title\x18\x02 \x01(\t\x12\x13\n\x0b\x64\x65scription\x18\x03 \x01(\t\"\xda\x01\n\tReplyPart\x12!\n\x04kind\x18\x01 \x01(\x0e\x32\x13.whatsapp.ReplyKind\x12\x0c\n\x04text\x18\x02 \x01(\t\x12&\n\x07options\x18\x03 \x03(\x0b\x32\x15.whatsapp.ReplyOption\x12\x11\n\tmedia_url\x18\x04 \x01(\t\x12\x12\n\nmedia_type\x18\x05 \x01(\t\x12\x15\n\rtemplate_name\x18\x06 \x01(\t\x12\x19\n\x11template_language\x18\x07 \x01(\t\x12\x1b\n\x13template_parameters\x18\x08 \x03(\t\"T\n\nTokenUsage\x12\x15\n\rprompt_tokens\x18\x01 \x01(\x05\x12\x19\n\x11\x63ompletion_tokens\x18\x02 \x01(\x05\x12\x14\n\x0ctotal_tokens\x18\x03 \x01(\x05\"\xf5\x01\n\x18GenerateResponseResponse\x12\x10\n\x08response\x18\x01 \x01(\t\x12\x18\n\x10\x63ontract_version\x18\x02 \x01(\x05\x12\"\n\x05parts\x18\x03 \x03(\x0b\x32\x13.whatsapp.ReplyPart\x12\x1a\n\x12\x66ollow_up_question\x18\x04 \x01(\t\x12&\n\x07options\x18\x05 \x03(\x0b\x32\x15.whatsapp.ReplyOption\x12\x0f\n\x07intents\x18\x06 \x03(\t\x12\x0f\n\x07handoff\x18\x07 \x01(\x08\x12#\n\x05usage\x18\x08 \x01(\x0b\x32\x14.whatsapp.TokenUsage\"S\n\x1fGenerateResponseAnalizerRequest\x12\x1a\n\x12thread_id_analizer\x18\x01 \x01(\t\x12\x14\n\x0cmessage_body\x18\x02 \x01(\t\"4\n GenerateResponseAnalizerResponse\x12\x10\n\x08response\x18\x01 \x01(\t\"Y\n\x15GenerateResponseChunk\x12\r\n\x05\x64\x65lta\x18\x01 \x01(\t\x12\x31\n\x05\x66inal\x18\x02 \x01(\x0b\x32\".whatsapp.GenerateResponseResponse*\x98\x01\n\tReplyKind\x12\x1a\n\x16REPLY_KIND_UNSPECIFIED\x10\x00\x12\x13\n\x0fREPLY_KIND_TEXT\x10\x01\x12\x16\n\x12REPLY_KIND_BUTTONS\x10\x02\x12\x13\n\x0fREPLY_KIND_LIST\x10\x03\x12\x14\n\x10REPLY_KIND_MEDIA\x10\x04\x12\x17\n\x13REPLY_KIND_TEMPLATE\x10\x05\x32\xf5\x03\n\x0fWhatsAppService\x12M\n\x0c\x43reateThread\x12\x1d.whatsapp.CreateThreadRequest\x1a\x1e.whatsapp.CreateThreadResponse\x12\x65\n\x14\x43reateThreadAnalizer\x12%.whatsapp.CreateThreadAnalizerRequest\x1a&.whatsapp.CreateThreadAnalizerResponse\x12Y\n\x10GenerateResponse\x12!.whatsapp.GenerateResponseRequest\x1a\".whatsapp.GenerateResponseResponse\x12q\n\x18GenerateResponseAnalizer\x12).whatsapp.GenerateResponseAnalizerRequest\x1a*.whatsapp.GenerateResponseAnalizerResponse\x12^\n\x16GenerateResponseStream\x12!.whatsapp.GenerateResponseRequest\x1a\x1f.whatsapp.GenerateResponseChunk0\x01\x42\x15Z\x13\x63hatbot/utils/protob\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -32,6 +32,8 @@ _builder.BuildTopDescriptorsAndMessages(DESCRIPTOR, 'whatsapp_pb2', _globals)
 if not _descriptor._USE_C_DESCRIPTORS:
   _globals['DESCRIPTOR']._loaded_options = None
   _globals['DESCRIPTOR']._serialized_options = b'Z\023chatbot/utils/proto'
+  _globals['_REPLYKIND']._serialized_start=1232
+  _globals['_REPLYKIND']._serialized_end=1384
   _globals['_CREATETHREADREQUEST']._serialized_start=28
   _globals['_CREATETHREADREQUEST']._serialized_end=49
   _globals['_CREATETHREADRESPONSE']._serialized_start=51
@@ -40,14 +42,24 @@ if not _descriptor._USE_C_DESCRIPTORS:
   _globals['_CREATETHREADANALIZERREQUEST']._serialized_end=123
   _globals['_CREATETHREADANALIZERRESPONSE']._serialized_start=125
   _globals['_CREATETHREADANALIZERRESPONSE']._serialized_end=183
-  _globals['_GENERATERESPONSEREQUEST']._serialized_start=185
-  _globals['_GENERATERESPONSEREQUEST']._serialized_end=266
-  _globals['_GENERATERESPONSERESPONSE']._serialized_start=268
-  _globals['_GENERATERESPONSERESPONSE']._serialized_end=312
-  _globals['_GENERATERESPONSEANALIZERREQUEST']._serialized_start=314
-  _globals['_GENERATERESPONSEANALIZERREQUEST']._serialized_end=397
-  _globals['_GENERATERESPONSEANALIZERRESPONSE']._serialized_start=399
-  _globals['_GENERATERESPONSEANALIZERRESPONSE']._serialized_end=451
-  _globals['_WHATSAPPSERVICE']._serialized_start=454
-  _globals['_WHATSAPPSERVICE']._serialized_end=859
+  _globals['_GENERATERESPONSEREQUEST']._serialized_start=186
+  _globals['_GENERATERESPONSEREQUEST']._serialized_end=318
+  _globals['_SELECTEDOPTION']._serialized_start=320
+  _globals['_SELECTEDOPTION']._serialized_end=381
+  _globals['_REPLYOPTION']._serialized_start=383
+  _globals['_REPLYOPTION']._serialized_end=444
+  _globals['_REPLYPART']._serialized_start=447
+  _globals['_REPLYPART']._serialized_end=665
+  _globals['_TOKENUSAGE']._serialized_start=667
+  _globals['_TOKENUSAGE']._serialized_end=751
+  _globals['_GENERATERESPONSERESPONSE']._serialized_start=754
+  _globals['_GENERATERESPONSERESPONSE']._serialized_end=999
+  _globals['_GENERATERESPONSEANALIZERREQUEST']._serialized_start=1001
+  _globals['_GENERATERESPONSEANALIZERREQUEST']._serialized_end=1084
+  _globals['_GENERATERESPONSEANALIZERRESPONSE']._serialized_start=1086
+  _globals['_GENERATERESPONSEANALIZERRESPONSE']._serialized_end=1138
+  _globals['_GENERATERESPONSECHUNK']._serialized_start=1140
+  _globals['_GENERATERESPONSECHUNK']._serialized_end=1229
+  _globals['_WHATSAPPSERVICE']._serialized_start=1387
+  _globals['_WHATSAPPSERVICE']._serialized_end=1888
 # @@protoc_insertion_point(module_scope)
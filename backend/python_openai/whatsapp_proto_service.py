@@ -3,6 +3,7 @@
 import sys
 import os
 import logging
+from grpclib import GRPCError, Status
 from grpclib.server import Stream
 from prometheus_client import Summary, Counter
 
@@ -28,13 +29,34 @@ from whatsapp_utils import (
     create_thread,
     create_thread_analyzer,
     generate_response,
-    generate_response_analyzer
+    generate_response_analyzer,
+    split_reply
 )
 
+# Versión del contrato de la respuesta estructurada, igual a la del servidor Go
+REPLY_CONTRACT_VERSION = 1
+
 # Métricas de Prometheus
 REQUEST_TIME = Summary('grpc_request_processing_seconds', 'Time spent processing gRPC request', ['method'])
 REQUEST_COUNT = Counter('grpc_request_count', 'Number of gRPC requests processed', ['method'])
 
+def build_reply(text):
+    # Convierte el texto del asistente en la respuesta estructurada, conservando el texto original en response
+    paragraphs, question, options = split_reply(text)
+    return whatsapp_pb2.GenerateResponseResponse(
+        response=text,
+        contract_version=REPLY_CONTRACT_VERSION,
+        parts=[whatsapp_pb2.ReplyPart(kind=whatsapp_pb2.REPLY_KIND_TEXT, text=p) for p in paragraphs],
+        follow_up_question=question,
+        options=[whatsapp_pb2.ReplyOption(id=f"button_{i + 1}", title=title) for i, title in enumerate(options)],
+    )
+
+async def generate_reply_text(request):
+    selected_option = request.selected_option if request.HasField('selected_option') else None
+    return await generate_response(
+        request.phone, request.thread_id, request.message_body, selected_option
+    )
+
 class WhatsAppServiceServicer(whatsapp_grpc.WhatsAppServiceBase):
     
     @REQUEST_COUNT.labels(method='CreateThread').count_exceptions()
@@ -71,16 +93,30 @@ class WhatsAppServiceServicer(whatsapp_grpc.WhatsAppServiceBase):
         request = await stream.recv_message()
         logger.info(f"Generando respuesta para el hilo {request.thread_id}...")
         try:
-            response_text = await generate_response(
-                request.phone, request.thread_id, request.message_body
-            )
-            response = whatsapp_pb2.GenerateResponseResponse(response=response_text)
+            response = build_reply(await generate_reply_text(request))
             logger.info(f"Respuesta generada para el hilo {request.thread_id}")
         except Exception as e:
             logger.error(f"Error al generar la respuesta: {str(e)}")
             response = whatsapp_pb2.GenerateResponseResponse(response="")
         await stream.send_message(response)
 
+    @REQUEST_COUNT.labels(method='GenerateResponseStream').count_exceptions()
+    @REQUEST_TIME.labels(method='GenerateResponseStream').time()
+    async def GenerateResponseStream(self, stream: Stream):
+        # El asistente no genera en streaming: se envía el texto completo en un fragmento y luego el final
+        request = await stream.recv_message()
+        logger.info(f"Generando respuesta en streaming para el hilo {request.thread_id}...")
+        try:
+            response = build_reply(await generate_reply_text(request))
+        except Exception as e:
+            logger.error(f"Error al generar la respuesta en streaming: {str(e)}")
+            raise GRPCError(Status.UNAVAILABLE, "no se pudo generar la respuesta")
+        delta = "\n\n".join(part.text for part in response.parts)
+        if delta:
+            await stream.send_message(whatsapp_pb2.GenerateResponseChunk(delta=delta))
+        await stream.send_message(whatsapp_pb2.GenerateResponseChunk(final=response))
+        logger.info(f"Respuesta en streaming generada para el hilo {request.thread_id}")
+
     @REQUEST_COUNT.labels(method='GenerateResponseAnalizer').count_exceptions()
     @REQUEST_TIME.labels(method='GenerateResponseAnalizer').time()
     async def GenerateResponseAnalizer(self, stream: Stream):
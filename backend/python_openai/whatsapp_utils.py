@@ -29,6 +29,10 @@ FUNCTION_COUNT = Counter('whatsapp_function_count', 'Number of WhatsApp function
 # Caché para asistentes
 assistant_cache = {}
 
+# Formato de texto del asistente: "respuesta|||pregunta|||opción1|opción2"
+REPLY_PART_SEPARATOR = "|||"
+REPLY_OPTION_SEPARATOR = "|"
+
 def async_timed_prometheus(func):
     @wraps(func)
     @FUNCTION_COUNT.labels(function=func.__name__).count_exceptions()
@@ -139,11 +143,33 @@ async def process_response(thread_id, role, content, api_key):
     await add_message_to_thread(thread_id, role, content)
     return await execute_assistant(thread_id, api_key)
 
+def user_content(message_body, selected_option=None):
+    # Si el usuario eligió una opción interactiva, el asistente recibe la opción y la pregunta a la que responde
+    if selected_option is None or not selected_option.title:
+        return message_body
+    content = f'Elegí la opción "{selected_option.title}"'
+    if selected_option.question:
+        content += f' a la pregunta "{selected_option.question}"'
+    if message_body and message_body != selected_option.title:
+        content += "\n" + message_body
+    return content
+
+def split_reply(text):
+    # Separa el texto del asistente en párrafos, pregunta de seguimiento y títulos de las opciones
+    sections = text.split(REPLY_PART_SEPARATOR)
+    paragraphs = [p.strip() for p in sections[0].split("\n\n") if p.strip()]
+    question = sections[1].strip() if len(sections) > 1 else ""
+    options = []
+    if len(sections) > 2:
+        options = [o.strip() for o in sections[2].split(REPLY_OPTION_SEPARATOR) if o.strip()]
+    return paragraphs, question, options
+
 @async_timed_prometheus
-async def generate_response(phone, thread_id, message_body):
+async def generate_response(phone, thread_id, message_body, selected_option=None):
     logger.info(f"Generando respuesta para {phone} con hilo {thread_id}. Mensaje: {message_body}")
     try:
-        return await process_response(thread_id, 'user', message_body, OPENAI_API_KEY_ASSISTANT)
+        content = user_content(message_body, selected_option)
+        return await process_response(thread_id, 'user', content, OPENAI_API_KEY_ASSISTANT)
     except Exception as e:
         logger.error(f"Error al generar respuesta para el hilo {thread_id}: {str(e)}")
         return "Lo siento, ocurrió un error al procesar tu solicitud."